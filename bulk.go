@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultBulkBatchSize is the default maximum number of elements that BulkAddElements
+// and BulkAddMapElements will add in a single transaction, and that will be combined
+// into a single "add element" command in a Transaction. (See WithBulkBatchSize.)
+const DefaultBulkBatchSize = 1000
+
+// bulkAddElements adds elements to nft's table, running a separate transaction for each
+// batch of up to batchSize elements, and checking for cancellation of ctx between
+// batches.
+func bulkAddElements(ctx context.Context, nft Interface, batchSize int, elements []*Element) error {
+	for start := 0; start < len(elements); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("cancelled after adding %d of %d elements: %w", start, len(elements), err)
+		}
+
+		end := start + batchSize
+		if end > len(elements) {
+			end = len(elements)
+		}
+		tx := nft.NewTransaction()
+		for _, element := range elements[start:end] {
+			tx.Add(element)
+		}
+		if err := nft.Run(ctx, tx); err != nil {
+			return fmt.Errorf("failed after adding %d of %d elements: %w", start, len(elements), err)
+		}
+	}
+	return nil
+}
+
+// replaceSetElements adds operations to tx to replace the contents of the set setName
+// with elements with the given keys, and returns it.
+func replaceSetElements(tx *Transaction, setName string, keys [][]string) *Transaction {
+	tx.Flush(&Set{Name: setName})
+	for _, element := range setElements(setName, keys) {
+		tx.Add(element)
+	}
+	return tx
+}
+
+// setElements returns the elements with the given keys in the set setName.
+func setElements(setName string, keys [][]string) []*Element {
+	elements := make([]*Element, 0, len(keys))
+	for _, key := range keys {
+		elements = append(elements, &Element{Set: setName, Key: key})
+	}
+	return elements
+}
+
+// mapElements returns the elements with the given keys and values in the map mapName.
+func mapElements(mapName string, entries []MapEntry) []*Element {
+	elements := make([]*Element, 0, len(entries))
+	for _, entry := range entries {
+		elements = append(elements, &Element{Map: mapName, Key: entry.Key, Value: entry.Value})
+	}
+	return elements
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBulkAddElements(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	WithBulkBatchSize(2)(nft.(*realNFTables))
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add element ip kube-proxy ips { 10.0.0.1, 10.0.0.2 }\n",
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add element ip kube-proxy ips { 10.0.0.3, 10.0.0.4 }\n",
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add element ip kube-proxy ips { 10.0.0.5 }\n",
+		},
+	)
+	keys := [][]string{{"10.0.0.1"}, {"10.0.0.2"}, {"10.0.0.3"}, {"10.0.0.4"}, {"10.0.0.5"}}
+	err := nft.BulkAddElements(context.Background(), "ips", keys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An error stops the process, and is returned with the original error wrapped.
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add element ip kube-proxy ips { 10.0.0.1, 10.0.0.2 }\n",
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add element ip kube-proxy ips { 10.0.0.3, 10.0.0.4 }\n",
+			err:   mkExecError("Error: No such file or directory\nadd element ip kube-proxy ips { 10.0.0.3, 10.0.0.4 }\n                          ^^^\n"),
+		},
+	)
+	err = nft.BulkAddElements(context.Background(), "ips", keys)
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	} else if !strings.Contains(err.Error(), "after adding 2 of 5 elements") {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+}
+
+func TestFakeBulkAddElements(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	if err := fake.AddSet(&Set{Name: "ips", Type: "ipv4_addr"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := make([][]string, 0, DefaultBulkBatchSize+1)
+	for i := 0; i <= DefaultBulkBatchSize; i++ {
+		keys = append(keys, []string{fmt.Sprintf("10.0.%d.%d", i/256, i%256)})
+	}
+	err := fake.BulkAddElements(context.Background(), "ips", keys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.Transactions) != 2 {
+		t.Errorf("expected 2 transactions, got %d", len(fake.Transactions))
+	}
+	if len(fake.Table.Sets["ips"].Elements) != len(keys) {
+		t.Errorf("expected %d elements, got %d", len(keys), len(fake.Table.Sets["ips"].Elements))
+	}
+
+	// Cancellation stops the process before the next batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake.Transactions = nil
+	err = fake.BulkAddElements(ctx, "ips", [][]string{{"192.168.0.1"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(fake.Transactions) != 0 {
+		t.Errorf("expected no transactions after cancellation, got %d", len(fake.Transactions))
+	}
+}
+
+func TestBulkAddMapElements(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	WithBulkBatchSize(2)(nft.(*realNFTables))
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add element ip kube-proxy services { 10.0.0.1 . tcp . 80 : goto svc1, 10.0.0.1 . tcp . 443 : goto svc2 }\n",
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add element ip kube-proxy services { 10.0.0.2 . udp . 53 : goto svc3 }\n",
+		},
+	)
+	entries := []MapEntry{
+		{Key: []string{"10.0.0.1", "tcp", "80"}, Value: []string{"goto svc1"}},
+		{Key: []string{"10.0.0.1", "tcp", "443"}, Value: []string{"goto svc2"}},
+		{Key: []string{"10.0.0.2", "udp", "53"}, Value: []string{"goto svc3"}},
+	}
+	err := nft.BulkAddMapElements(context.Background(), "services", entries)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Invalid entries are caught before running anything
+	err = nft.BulkAddMapElements(context.Background(), "services", []MapEntry{{Key: []string{"10.0.0.3"}}})
+	if err == nil || !strings.Contains(err.Error(), "no map value") {
+		t.Errorf("expected validation error, got %v", err)
+	}
+}
+
+func TestFakeBulkAddMapElements(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	if err := fake.AddMap(&Map{Name: "ports", Type: "inet_service : inet_service"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := fake.BulkAddMapElements(context.Background(), "ports", []MapEntry{
+		{Key: []string{"80"}, Value: []string{"8080"}},
+		{Key: []string{"443"}, Value: []string{"8443"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elem := fake.Table.Maps["ports"].FindElement("443"); elem == nil || elem.Value[0] != "8443" {
+		t.Errorf("expected element 443 : 8443, got %+v", elem)
+	}
+}
+
+func TestClearSet(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "flush set ip kube-proxy ips\n",
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "flush set ip kube-proxy nosuchset\n",
+			err:   mkExecError("Error: No such file or directory\nflush set ip kube-proxy nosuchset\n                        ^^^^^^^^^\n"),
+		},
+	)
+	err := nft.ClearSet(context.Background(), "ips")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = nft.ClearSet(context.Background(), "nosuchset")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+}
+
+func TestFakeClearSet(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	if err := fake.AddSet(&Set{Name: "ips", Type: "ipv4_addr"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.BulkAddElements(context.Background(), "ips", [][]string{{"10.0.0.1"}, {"10.0.0.2"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := fake.ClearSet(context.Background(), "ips")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.Table.Sets["ips"].Elements) != 0 {
+		t.Errorf("expected set to be empty, got %d elements", len(fake.Table.Sets["ips"].Elements))
+	}
+
+	err = fake.ClearSet(context.Background(), "nosuchset")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+}
+
+func TestReplaceSetElements(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	WithBulkBatchSize(2)(nft.(*realNFTables))
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args: []string{"/nft", "-f", "-"},
+			stdin: strings.Join([]string{
+				"flush set ip kube-proxy ips",
+				"add element ip kube-proxy ips { 10.0.0.1, 10.0.0.2 }",
+				"add element ip kube-proxy ips { 10.0.0.3, 10.0.0.4 }",
+				"add element ip kube-proxy ips { 10.0.0.5 }",
+				"",
+			}, "\n"),
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "flush set ip kube-proxy ips\n",
+		},
+	)
+	keys := [][]string{{"10.0.0.1"}, {"10.0.0.2"}, {"10.0.0.3"}, {"10.0.0.4"}, {"10.0.0.5"}}
+	err := nft.ReplaceSetElements(context.Background(), "ips", keys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Replacing with no elements just flushes the set
+	err = nft.ReplaceSetElements(context.Background(), "ips", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFakeReplaceSetElements(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	if err := fake.AddSet(&Set{Name: "ips", Type: "ipv4_addr"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.BulkAddElements(context.Background(), "ips", [][]string{{"10.0.0.1"}, {"10.0.0.2"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake.Transactions = nil
+	err := fake.ReplaceSetElements(context.Background(), "ips", [][]string{{"10.0.0.2"}, {"10.0.0.3"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.Transactions) != 1 {
+		t.Errorf("expected a single transaction, got %d", len(fake.Transactions))
+	}
+	set := fake.Table.Sets["ips"]
+	if len(set.Elements) != 2 || set.FindElement("10.0.0.2") == nil || set.FindElement("10.0.0.3") == nil {
+		t.Errorf("unexpected set contents after replace:\n%s", fake.Dump())
+	}
+
+	// A failure leaves the set unchanged
+	err = fake.ReplaceSetElements(context.Background(), "ips", [][]string{{"10.0.0.4"}, {}})
+	if err == nil {
+		t.Fatalf("expected error for invalid key")
+	}
+	if len(set.Elements) != 2 || set.FindElement("10.0.0.4") != nil {
+		t.Errorf("set was modified by failed replace:\n%s", fake.Dump())
+	}
+}
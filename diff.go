@@ -0,0 +1,272 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Diff compares the chains, sets, maps, and elements that would be created by desired
+// (which must contain only Add and Create operations) against the current contents of
+// nft's table, and returns a new Transaction containing only the operations needed to
+// bring the table into the desired state: adding missing chains, sets, maps, and
+// elements, and deleting existing ones that are not part of desired.
+//
+// Because ListRules cannot return the contents of rules, Diff cannot compare rules
+// directly; instead, any existing chain in desired whose rules might differ will be
+// flushed and have all of its rules re-added. Existing chains, sets, and maps are only
+// compared by name; if an existing object has different properties (type, hook,
+// flags, etc) than the desired one, Diff will not fix it. Operations on the table
+// itself and on other types of objects are passed through unchanged, as is desired's
+// description (see Transaction.SetDescription).
+func Diff(ctx context.Context, nft Interface, desired *Transaction) (*Transaction, error) {
+	if desired.err != nil {
+		return nil, desired.err
+	}
+
+	// Sort the desired operations by type, preserving order within each type.
+	var passthroughOps []operation
+	var chainOps, setOps, mapOps []operation
+	desiredChains := make(map[string]bool)
+	desiredSets := make(map[string]bool)
+	desiredMaps := make(map[string]bool)
+	var rulesChains []string
+	rules := make(map[string][]*Rule)
+	var elementsSets, elementsMaps []string
+	setElements := make(map[string][]*Element)
+	mapElements := make(map[string][]*Element)
+
+	for _, op := range desired.operations {
+		if op.verb == commentVerb {
+			continue
+		}
+		if op.verb != addVerb && op.verb != createVerb {
+			return nil, fmt.Errorf("cannot diff transaction containing %s operation", op.verb)
+		}
+		switch obj := op.obj.(type) {
+		case *Chain:
+			chainOps = append(chainOps, op)
+			desiredChains[obj.Name] = true
+		case *Rule:
+			if rules[obj.Chain] == nil {
+				rulesChains = append(rulesChains, obj.Chain)
+			}
+			rules[obj.Chain] = append(rules[obj.Chain], obj)
+		case *Set:
+			setOps = append(setOps, op)
+			desiredSets[obj.Name] = true
+		case *Map:
+			mapOps = append(mapOps, op)
+			desiredMaps[obj.Name] = true
+		case *Element:
+			if obj.Set != "" {
+				if setElements[obj.Set] == nil {
+					elementsSets = append(elementsSets, obj.Set)
+				}
+				setElements[obj.Set] = append(setElements[obj.Set], obj)
+			} else {
+				if mapElements[obj.Map] == nil {
+					elementsMaps = append(elementsMaps, obj.Map)
+				}
+				mapElements[obj.Map] = append(mapElements[obj.Map], obj)
+			}
+		default:
+			passthroughOps = append(passthroughOps, op)
+		}
+	}
+
+	// A NotFoundError from any of these means the table doesn't exist yet.
+	existingChains := make(map[string]bool)
+	chains, err := nft.ListChains(ctx)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	for _, chain := range chains {
+		existingChains[chain.Name] = true
+	}
+	existingSets := make(map[string]bool)
+	sets, err := nft.ListSets(ctx)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	for _, set := range sets {
+		existingSets[set.Name] = true
+	}
+	existingMaps := make(map[string]bool)
+	maps, err := nft.ListMaps(ctx)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	for _, mapObj := range maps {
+		existingMaps[mapObj.Name] = true
+	}
+
+	tx := nft.NewTransaction()
+	tx.description = desired.description
+
+	// Add the table and other objects first, then missing chains/sets/maps, so that
+	// later operations can refer to them.
+	for _, op := range passthroughOps {
+		tx.operation(op.verb, op.obj)
+	}
+	for _, op := range chainOps {
+		if !existingChains[op.obj.(*Chain).Name] {
+			tx.operation(op.verb, op.obj)
+		}
+	}
+	for _, op := range setOps {
+		if !existingSets[op.obj.(*Set).Name] {
+			tx.operation(op.verb, op.obj)
+		}
+	}
+	for _, op := range mapOps {
+		if !existingMaps[op.obj.(*Map).Name] {
+			tx.operation(op.verb, op.obj)
+		}
+	}
+
+	// Reconcile elements
+	for _, name := range elementsSets {
+		err := diffElements(ctx, nft, tx, "set", name, existingSets[name], setElements[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range elementsMaps {
+		err := diffElements(ctx, nft, tx, "map", name, existingMaps[name], mapElements[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Desired sets and maps with no desired elements must be emptied
+	for _, op := range setOps {
+		name := op.obj.(*Set).Name
+		if existingSets[name] && setElements[name] == nil {
+			if err := diffElements(ctx, nft, tx, "set", name, true, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, op := range mapOps {
+		name := op.obj.(*Map).Name
+		if existingMaps[name] && mapElements[name] == nil {
+			if err := diffElements(ctx, nft, tx, "map", name, true, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Reconcile rules. Existing chains with desired rules are always flushed and
+	// refilled. Existing desired chains without desired rules only need to be
+	// flushed if they currently have rules.
+	for _, op := range chainOps {
+		name := op.obj.(*Chain).Name
+		if existingChains[name] && rules[name] == nil {
+			existingRules, err := nft.ListRules(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			if len(existingRules) > 0 {
+				tx.Flush(&Chain{Name: name})
+			}
+		}
+	}
+	for _, name := range rulesChains {
+		if existingChains[name] {
+			tx.Flush(&Chain{Name: name})
+		}
+		for _, rule := range rules[name] {
+			tx.Add(rule)
+		}
+	}
+
+	// Delete chains, sets, and maps that are not desired. Chains are all flushed
+	// before any are deleted, since they may refer to each other.
+	for _, name := range sortKeys(existingChains) {
+		if !desiredChains[name] {
+			tx.Flush(&Chain{Name: name})
+		}
+	}
+	for _, name := range sortKeys(existingChains) {
+		if !desiredChains[name] {
+			tx.Delete(&Chain{Name: name})
+		}
+	}
+	for _, name := range sortKeys(existingSets) {
+		if !desiredSets[name] && setElements[name] == nil {
+			tx.Delete(&Set{Name: name})
+		}
+	}
+	for _, name := range sortKeys(existingMaps) {
+		if !desiredMaps[name] && mapElements[name] == nil {
+			tx.Delete(&Map{Name: name})
+		}
+	}
+
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	return tx, nil
+}
+
+// diffElements adds operations to tx to change the elements of the set or map (as
+// indicated by objectType) named name to desired.
+func diffElements(ctx context.Context, nft Interface, tx *Transaction, objectType, name string, exists bool, desired []*Element) error {
+	existing := make(map[string]*Element)
+	if exists {
+		elements, err := nft.ListElements(ctx, objectType, name)
+		if err != nil {
+			return err
+		}
+		for _, elem := range elements {
+			existing[strings.Join(elem.Key, " . ")] = elem
+		}
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	for _, elem := range desired {
+		key := strings.Join(elem.Key, " . ")
+		wanted[key] = true
+
+		old := existing[key]
+		if old != nil {
+			if strings.Join(old.Value, " . ") == strings.Join(elem.Value, " . ") {
+				continue
+			}
+			// nft won't change the value of an existing map element, so it
+			// must be deleted and re-added
+			tx.Delete(elementForDelete(objectType, name, old))
+		}
+		tx.Add(elem)
+	}
+
+	for _, key := range sortKeys(existing) {
+		if !wanted[key] {
+			tx.Delete(elementForDelete(objectType, name, existing[key]))
+		}
+	}
+	return nil
+}
+
+func elementForDelete(objectType, name string, elem *Element) *Element {
+	if objectType == "set" {
+		return &Element{Set: name, Key: elem.Key}
+	}
+	return &Element{Map: name, Key: elem.Key}
+}
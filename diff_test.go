@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/lithammer/dedent"
+)
+
+func TestDiff(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	// Diffing against a non-existent table returns the whole desired transaction
+	desired := fake.NewTransaction()
+	desired.Add(&Table{})
+	desired.Add(&Chain{
+		Name: "chain",
+	})
+	desired.Add(&Chain{
+		Name: "other",
+	})
+	desired.Add(&Set{
+		Name: "set",
+		Type: "ipv4_addr",
+	})
+	desired.Add(&Map{
+		Name: "map",
+		Type: "ipv4_addr : verdict",
+	})
+	desired.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip saddr @set drop",
+	})
+	desired.Add(&Element{
+		Set: "set",
+		Key: []string{"10.0.0.1"},
+	})
+	desired.Add(&Element{
+		Set: "set",
+		Key: []string{"10.0.0.2"},
+	})
+	desired.Add(&Element{
+		Map:   "map",
+		Key:   []string{"10.0.0.1"},
+		Value: []string{"goto other"},
+	})
+
+	tx, err := Diff(context.Background(), fake, desired)
+	if err != nil {
+		t.Fatalf("unexpected error from Diff: %v", err)
+	}
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add chain ip kube-proxy other
+		add set ip kube-proxy set { type ipv4_addr ; }
+		add map ip kube-proxy map { type ipv4_addr : verdict ; }
+		add element ip kube-proxy set { 10.0.0.1, 10.0.0.2 }
+		add element ip kube-proxy map { 10.0.0.1 : goto other }
+		add rule ip kube-proxy chain ip saddr @set drop
+		`), "\n")
+	diff := cmp.Diff(expected, tx.String())
+	if diff != "" {
+		t.Errorf("unexpected Diff result:\n%s", diff)
+	}
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	// Diffing against the same state only refreshes the rules
+	tx, err = Diff(context.Background(), fake, desired)
+	if err != nil {
+		t.Fatalf("unexpected error from Diff: %v", err)
+	}
+	expected = strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		flush chain ip kube-proxy chain
+		add rule ip kube-proxy chain ip saddr @set drop
+		`), "\n")
+	diff = cmp.Diff(expected, tx.String())
+	if diff != "" {
+		t.Errorf("unexpected Diff result:\n%s", diff)
+	}
+
+	// Add some stuff that isn't desired
+	tx = fake.NewTransaction()
+	tx.Add(&Chain{
+		Name: "extra",
+	})
+	tx.Add(&Rule{
+		Chain: "other",
+		Rule:  "jump extra",
+	})
+	tx.Add(&Set{
+		Name: "extraset",
+		Type: "ipv4_addr",
+	})
+	tx.Add(&Element{
+		Set: "set",
+		Key: []string{"10.0.0.3"},
+	})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	// Change the desired state
+	desired = fake.NewTransaction()
+	desired.Add(&Table{})
+	desired.Add(&Chain{
+		Name: "chain",
+	})
+	desired.Add(&Chain{
+		Name: "other",
+	})
+	desired.Add(&Chain{
+		Name: "new",
+	})
+	desired.Add(&Set{
+		Name: "set",
+		Type: "ipv4_addr",
+	})
+	desired.Add(&Map{
+		Name: "map",
+		Type: "ipv4_addr : verdict",
+	})
+	desired.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip saddr @set drop",
+	})
+	desired.Add(&Element{
+		Set: "set",
+		Key: []string{"10.0.0.1"},
+	})
+	desired.Add(&Element{
+		Map:   "map",
+		Key:   []string{"10.0.0.1"},
+		Value: []string{"goto new"},
+	})
+
+	tx, err = Diff(context.Background(), fake, desired)
+	if err != nil {
+		t.Fatalf("unexpected error from Diff: %v", err)
+	}
+	expected = strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy new
+		delete element ip kube-proxy set { 10.0.0.2 }
+		delete element ip kube-proxy set { 10.0.0.3 }
+		delete element ip kube-proxy map { 10.0.0.1 }
+		add element ip kube-proxy map { 10.0.0.1 : goto new }
+		flush chain ip kube-proxy other
+		flush chain ip kube-proxy chain
+		add rule ip kube-proxy chain ip saddr @set drop
+		flush chain ip kube-proxy extra
+		delete chain ip kube-proxy extra
+		delete set ip kube-proxy extraset
+		`), "\n")
+	diff = cmp.Diff(expected, tx.String())
+	if diff != "" {
+		t.Errorf("unexpected Diff result:\n%s", diff)
+	}
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	// The result should be the same as applying desired to an empty table
+	fresh := NewFake(IPv4Family, "kube-proxy")
+	err = fresh.Run(context.Background(), desired)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+	diff = cmp.Diff(fresh.Dump(), fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected final state:\n%s", diff)
+	}
+}
+
+func TestDiffInvalid(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	desired := fake.NewTransaction()
+	desired.Add(&Table{})
+	desired.Delete(&Chain{
+		Name: "chain",
+	})
+	_, err := Diff(context.Background(), fake, desired)
+	if err == nil || !strings.Contains(err.Error(), "cannot diff") {
+		t.Errorf("unexpected error from Diff: %v", err)
+	}
+}
@@ -19,6 +19,7 @@ package knftables
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os/exec"
 	"strings"
 	"syscall"
@@ -30,6 +31,18 @@ type nftablesError struct {
 	errno   syscall.Errno
 }
 
+// nftErrnos maps the strerror() text that nft outputs to the corresponding errno, for
+// the errnos we care about.
+var nftErrnos = []struct {
+	msg   string
+	errno syscall.Errno
+}{
+	{"No such file or directory", syscall.ENOENT},
+	{"File exists", syscall.EEXIST},
+	{"Resource temporarily unavailable", syscall.EAGAIN},
+	{"No buffer space available", syscall.ENOBUFS},
+}
+
 // wrapError wraps an error resulting from running nft
 func wrapError(err error) error {
 	nerr := &nftablesError{wrapped: err, msg: err.Error()}
@@ -40,30 +53,59 @@ func wrapError(err error) error {
 			eol := strings.Index(nerr.msg, "\n")
 			// The nft binary does not call setlocale() and so will return
 			// English error strings regardless of the locale.
-			enoent := strings.Index(nerr.msg, "No such file or directory")
-			eexist := strings.Index(nerr.msg, "File exists")
-			if enoent != -1 && (enoent < eol || eol == -1) {
-				nerr.errno = syscall.ENOENT
-			} else if eexist != -1 && (eexist < eol || eol == -1) {
-				nerr.errno = syscall.EEXIST
+			for _, e := range nftErrnos {
+				i := strings.Index(nerr.msg, e.msg)
+				if i != -1 && (i < eol || eol == -1) {
+					nerr.errno = e.errno
+					break
+				}
 			}
 		}
 	}
 	return nerr
 }
 
+// RunError is the error returned (possibly wrapped by another error, such as a
+// *NotFoundError) when an invocation of the nft binary fails. Its message is the same
+// as the message of the wrapped error, but it also provides the details of the failed
+// command, for logging or debugging.
+type RunError struct {
+	// Cmd is the command that failed, including the path to nft. (Note that for Run
+	// and Check, the transaction is passed on stdin and so does not appear here; use
+	// Transaction.String() to get it.)
+	Cmd []string
+
+	// Stderr is the complete stderr output of the failed command, if any.
+	Stderr string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (rerr *RunError) Error() string {
+	return rerr.Err.Error()
+}
+
+func (rerr *RunError) Unwrap() error {
+	return rerr.Err
+}
+
+// newRunError wraps err, the error from running cmd, in a *RunError.
+func newRunError(cmd []string, err error) error {
+	rerr := &RunError{Cmd: cmd, Err: err}
+	ee := &exec.ExitError{}
+	if errors.As(err, &ee) {
+		rerr.Stderr = string(ee.Stderr)
+	}
+	return rerr
+}
+
 // notFoundError returns an nftablesError with the given message for which IsNotFound will
 // return true.
 func notFoundError(format string, args ...interface{}) error {
 	return &nftablesError{msg: fmt.Sprintf(format, args...), errno: syscall.ENOENT}
 }
 
-// existsError returns an nftablesError with the given message for which IsAlreadyExists
-// will return true.
-func existsError(format string, args ...interface{}) error {
-	return &nftablesError{msg: fmt.Sprintf(format, args...), errno: syscall.EEXIST}
-}
-
 func (nerr *nftablesError) Error() string {
 	return nerr.msg
 }
@@ -72,10 +114,143 @@ func (nerr *nftablesError) Unwrap() error {
 	return nerr.wrapped
 }
 
+// Is allows errors.Is(err, fs.ErrNotExist) and errors.Is(err, fs.ErrExist) to be used as
+// equivalents of IsNotFound(err) and IsAlreadyExists(err).
+func (nerr *nftablesError) Is(target error) bool {
+	return nerr.errno != 0 && nerr.errno.Is(target)
+}
+
+// NotFoundError is the error returned by the List and Get methods of Interface when the
+// chain, set, or map being looked up does not exist. IsNotFound will return true for it,
+// but callers that need to know which object was missing can use errors.As to get the
+// details.
+type NotFoundError struct {
+	// ObjectType is the type of the missing object (eg "chain", "set", or "map").
+	ObjectType string
+
+	// ObjectName is the name of the missing object.
+	ObjectName string
+
+	wrapped error
+}
+
+func (nferr *NotFoundError) Error() string {
+	if nferr.wrapped != nil {
+		return fmt.Sprintf("no such %s %q: %v", nferr.ObjectType, nferr.ObjectName, nferr.wrapped)
+	}
+	return fmt.Sprintf("no such %s %q", nferr.ObjectType, nferr.ObjectName)
+}
+
+func (nferr *NotFoundError) Unwrap() error {
+	return nferr.wrapped
+}
+
+// Is allows errors.Is(err, fs.ErrNotExist) to be used as an equivalent of IsNotFound(err).
+func (nferr *NotFoundError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// AlreadyExistsError is the error returned by Run and Check (of both the real Interface
+// and the Fake) when a "create" operation fails because the object already exists, if
+// the object can be identified. IsAlreadyExists will return true for it (and for other
+// "already exists" errors), but callers that need to know which object already existed
+// can use errors.As to get the details.
+type AlreadyExistsError struct {
+	// ObjectType is the type of the existing object (eg "chain", "set", or
+	// "element").
+	ObjectType string
+
+	// ObjectName is the name of the existing object. (For an element, this is the
+	// element's key.)
+	ObjectName string
+
+	wrapped error
+}
+
+func (aeerr *AlreadyExistsError) Error() string {
+	if aeerr.wrapped != nil {
+		return fmt.Sprintf("%s %q already exists: %v", aeerr.ObjectType, aeerr.ObjectName, aeerr.wrapped)
+	}
+	return fmt.Sprintf("%s %q already exists", aeerr.ObjectType, aeerr.ObjectName)
+}
+
+func (aeerr *AlreadyExistsError) Unwrap() error {
+	return aeerr.wrapped
+}
+
+// Is allows errors.Is(err, fs.ErrExist) to be used as an equivalent of
+// IsAlreadyExists(err).
+func (aeerr *AlreadyExistsError) Is(target error) bool {
+	return target == fs.ErrExist
+}
+
+// checkAlreadyExists converts err, an error from running a transaction, into an
+// *AlreadyExistsError if it is an "already exists" error and the failing command can be
+// identified from nft's output. Otherwise it returns err unchanged.
+func checkAlreadyExists(err error) error {
+	var nerr *nftablesError
+	if !errors.As(err, &nerr) || nerr.errno != syscall.EEXIST {
+		return err
+	}
+
+	// nft's output will look like:
+	//
+	//   /dev/stdin:3:1-32: Error: Could not process rule: File exists
+	//   create chain ip kube-proxy chain
+	//   ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^
+	var command string
+	lines := strings.Split(nerr.msg, "\n")
+	for i := range lines[:len(lines)-1] {
+		if strings.Contains(lines[i], "File exists") {
+			command = lines[i+1]
+			break
+		}
+	}
+	fields := strings.Fields(command)
+	if len(fields) < 4 {
+		return err
+	}
+	objectType, fields := fields[1], fields[2:]
+	if objectType == "ct" {
+		objectType, fields = "ct "+fields[0], fields[1:]
+	}
+
+	// fields is now "family name" for a table, or "family table name ..." for
+	// anything else
+	var name string
+	switch {
+	case objectType == "table":
+		name = fields[1]
+	case objectType == "element":
+		start := strings.Index(command, "{")
+		end := strings.LastIndex(command, "}")
+		if start == -1 || end < start {
+			return err
+		}
+		name = command[start+1 : end]
+		// Strip off the value, timeout, and/or comment
+		for _, sep := range []string{" : ", " timeout ", " comment "} {
+			if i := strings.Index(name, sep); i != -1 {
+				name = name[:i]
+			}
+		}
+		name = strings.TrimSpace(name)
+	case len(fields) >= 3:
+		name = fields[2]
+	default:
+		return err
+	}
+	return &AlreadyExistsError{ObjectType: objectType, ObjectName: name, wrapped: err}
+}
+
 // IsNotFound tests if err corresponds to an nftables "not found" error of any sort.
 // (e.g., in response to a "delete rule" command, this might indicate that the rule
 // doesn't exist, or the chain doesn't exist, or the table doesn't exist.)
 func IsNotFound(err error) bool {
+	var nferr *NotFoundError
+	if errors.As(err, &nferr) {
+		return true
+	}
 	var nerr *nftablesError
 	if errors.As(err, &nerr) {
 		return nerr.errno == syscall.ENOENT
@@ -83,9 +258,23 @@ func IsNotFound(err error) bool {
 	return false
 }
 
+// isTransient tests if err corresponds to an nftables error that may succeed if
+// retried (e.g. because of a concurrent modification by another process).
+func isTransient(err error) bool {
+	var nerr *nftablesError
+	if errors.As(err, &nerr) {
+		return nerr.errno == syscall.EAGAIN || nerr.errno == syscall.ENOBUFS
+	}
+	return false
+}
+
 // IsAlreadyExists tests if err corresponds to an nftables "already exists" error (e.g.
 // when doing a "create" rather than an "add").
 func IsAlreadyExists(err error) bool {
+	var aeerr *AlreadyExistsError
+	if errors.As(err, &aeerr) {
+		return true
+	}
 	var nerr *nftablesError
 	if errors.As(err, &nerr) {
 		return nerr.errno == syscall.EEXIST
@@ -17,7 +17,9 @@ limitations under the License.
 package knftables
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os/exec"
 	"testing"
 )
@@ -28,10 +30,11 @@ func mkExecError(stderr string) error {
 
 func TestError(t *testing.T) {
 	for _, tc := range []struct {
-		name       string
-		err        error
-		isNotFound bool
-		isExists   bool
+		name        string
+		err         error
+		isNotFound  bool
+		isExists    bool
+		isTransient bool
 	}{
 		{
 			name:       "generic doesn't exist",
@@ -57,6 +60,16 @@ func TestError(t *testing.T) {
 			isNotFound: true,
 			isExists:   false,
 		},
+		{
+			name:        "transient error",
+			err:         mkExecError("Error: Could not process rule: Resource temporarily unavailable\nadd table ip foo\n^^^^^^^^^^^^^^^^\n"),
+			isTransient: true,
+		},
+		{
+			name:        "transient error (ENOBUFS)",
+			err:         mkExecError("netlink: Error: Could not process rule: No buffer space available\n"),
+			isTransient: true,
+		},
 		{
 			name:       "misc error",
 			err:        mkExecError("Error: syntax error, unexpected string, expecting '{' or '$'"),
@@ -82,8 +95,26 @@ func TestError(t *testing.T) {
 			isExists:   false,
 		},
 		{
-			name:       "fake exists",
-			err:        existsError("already exists"),
+			name:       "NotFoundError",
+			err:        &NotFoundError{ObjectType: "chain", ObjectName: "foo"},
+			isNotFound: true,
+			isExists:   false,
+		},
+		{
+			name:       "wrapped NotFoundError",
+			err:        fmt.Errorf("oh my! %w", &NotFoundError{ObjectType: "set", ObjectName: "foo", wrapped: mkExecError("Error: No such file or directory")}),
+			isNotFound: true,
+			isExists:   false,
+		},
+		{
+			name:       "AlreadyExistsError",
+			err:        &AlreadyExistsError{ObjectType: "chain", ObjectName: "foo"},
+			isNotFound: false,
+			isExists:   true,
+		},
+		{
+			name:       "wrapped AlreadyExistsError",
+			err:        fmt.Errorf("oh my! %w", checkAlreadyExists(mkExecError("Error: Could not process rule: File exists\ncreate table ip foo\n^^^^^^^^^^^^^^^^^^^\n"))),
 			isNotFound: false,
 			isExists:   true,
 		},
@@ -95,6 +126,86 @@ func TestError(t *testing.T) {
 			if IsAlreadyExists(tc.err) != tc.isExists {
 				t.Errorf("expected IsAlreadyExists %v, got %v", tc.isExists, IsAlreadyExists(tc.err))
 			}
+			if errors.Is(tc.err, fs.ErrNotExist) != tc.isNotFound {
+				t.Errorf("expected errors.Is(err, fs.ErrNotExist) %v", tc.isNotFound)
+			}
+			if errors.Is(tc.err, fs.ErrExist) != tc.isExists {
+				t.Errorf("expected errors.Is(err, fs.ErrExist) %v", tc.isExists)
+			}
+			if isTransient(tc.err) != tc.isTransient {
+				t.Errorf("expected isTransient %v, got %v", tc.isTransient, isTransient(tc.err))
+			}
+		})
+	}
+}
+
+func TestCheckAlreadyExists(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		err        error
+		objectType string
+		objectName string
+	}{
+		{
+			name:       "table",
+			err:        mkExecError("/dev/stdin:1:1-19: Error: Could not process rule: File exists\ncreate table ip foo\n^^^^^^^^^^^^^^^^^^^\n"),
+			objectType: "table",
+			objectName: "foo",
+		},
+		{
+			name:       "chain",
+			err:        mkExecError("/dev/stdin:2:1-32: Error: Could not process rule: File exists\ncreate chain ip kube-proxy chain\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"),
+			objectType: "chain",
+			objectName: "chain",
+		},
+		{
+			name:       "set",
+			err:        mkExecError("/dev/stdin:2:1-55: Error: Could not process rule: File exists\ncreate set ip kube-proxy ips { type ipv4_addr ; }\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"),
+			objectType: "set",
+			objectName: "ips",
+		},
+		{
+			name:       "ct helper",
+			err:        mkExecError("/dev/stdin:2:1-55: Error: Could not process rule: File exists\ncreate ct helper ip kube-proxy ftp { type \"ftp\" protocol tcp ; }\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"),
+			objectType: "ct helper",
+			objectName: "ftp",
+		},
+		{
+			name:       "element",
+			err:        mkExecError("/dev/stdin:2:1-55: Error: Could not process rule: File exists\ncreate element ip kube-proxy map { 10.0.0.1 . tcp comment \"foo\" : drop }\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"),
+			objectType: "element",
+			objectName: "10.0.0.1 . tcp",
+		},
+		{
+			name: "unparseable",
+			err:  mkExecError("Error: Could not process rule: File exists\n"),
+		},
+		{
+			name: "not an already-exists error",
+			err:  mkExecError("Error: No such file or directory\ncreate chain ip kube-proxy chain\n"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkAlreadyExists(tc.err)
+			var aeerr *AlreadyExistsError
+			if !errors.As(err, &aeerr) {
+				if tc.objectType != "" {
+					t.Fatalf("expected AlreadyExistsError, got %v", err)
+				}
+				if err != tc.err {
+					t.Errorf("expected error to be returned unchanged, got %v", err)
+				}
+				return
+			}
+			if tc.objectType == "" {
+				t.Fatalf("unexpected AlreadyExistsError %v", err)
+			}
+			if aeerr.ObjectType != tc.objectType || aeerr.ObjectName != tc.objectName {
+				t.Errorf("expected %s %q, got %s %q", tc.objectType, tc.objectName, aeerr.ObjectType, aeerr.ObjectName)
+			}
+			if !IsAlreadyExists(err) {
+				t.Errorf("expected IsAlreadyExists to be true")
+			}
 		})
 	}
 }
@@ -17,6 +17,9 @@ limitations under the License.
 package knftables
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"os/exec"
 )
 
@@ -28,6 +31,11 @@ type execer interface {
 	// Run runs cmd as with cmd.Output(). If an error occurs, and the process outputs
 	// stderr, then that output will be returned in the error.
 	Run(cmd *exec.Cmd) (string, error)
+
+	// Stream runs cmd, calling handleLine with each line of its output as it is
+	// output, and returns when cmd exits. If an error occurs, and the process outputs
+	// stderr, then that output will be returned in the error.
+	Stream(cmd *exec.Cmd, handleLine func(line string)) error
 }
 
 // realExec implements execer by actually using os/exec
@@ -46,3 +54,43 @@ func (realExec) Run(cmd *exec.Cmd) (string, error) {
 	}
 	return string(out), err
 }
+
+// maxStreamLine is the maximum length of a line of output that Stream will accept.
+const maxStreamLine = 16 * 1024 * 1024
+
+// Stream is part of execer
+func (realExec) Stream(cmd *exec.Cmd, handleLine func(line string)) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return wrapError(err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, maxStreamLine)
+	for scanner.Scan() {
+		handleLine(scanner.Text())
+	}
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		// Make sure the process doesn't block forever trying to write more output.
+		_ = cmd.Process.Kill()
+	}
+
+	err = cmd.Wait()
+	if scanErr != nil {
+		return scanErr
+	}
+	if err != nil {
+		ee := &exec.ExitError{}
+		if errors.As(err, &ee) {
+			ee.Stderr = stderr.Bytes()
+		}
+		return wrapError(err)
+	}
+	return nil
+}
@@ -20,10 +20,12 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // fakeExec is a mockable implementation of execer for unit tests
@@ -57,23 +59,67 @@ type expectedCmd struct {
 	stdin  string
 	stdout string
 	err    error
+
+	// If file is set, then the last argument of the command must be the path to a
+	// file with this content, and that argument is compared against args as "FILE".
+	file string
+	// fileDelay, if set, is how long to wait before reading file.
+	fileDelay time.Duration
 }
 
 func (fe *fakeExec) Run(cmd *exec.Cmd) (string, error) {
+	expected, err := fe.next(cmd)
+	if err != nil {
+		return "", err
+	}
+	return expected.stdout, expected.err
+}
+
+// Stream is part of execer. It passes each line of the expected stdout to handleLine
+// and then returns the expected error.
+func (fe *fakeExec) Stream(cmd *exec.Cmd, handleLine func(line string)) error {
+	expected, err := fe.next(cmd)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.SplitAfter(expected.stdout, "\n") {
+		if line != "" {
+			handleLine(strings.TrimSuffix(line, "\n"))
+		}
+	}
+	return expected.err
+}
+
+// next checks cmd against the next expected command and returns it.
+func (fe *fakeExec) next(cmd *exec.Cmd) (*expectedCmd, error) {
 	if fe.t.Failed() {
-		return "", fmt.Errorf("unit test failed")
+		return nil, fmt.Errorf("unit test failed")
 	}
 
 	if len(fe.expected) == fe.matched {
 		fe.t.Errorf("ran out of commands before executing %v", cmd.Args)
-		return "", fmt.Errorf("unit test failed")
+		return nil, fmt.Errorf("unit test failed")
 	}
 	expected := &fe.expected[fe.matched]
 	fe.matched++
 
-	if !reflect.DeepEqual(expected.args, cmd.Args) {
-		fe.t.Errorf("incorrect arguments: expected %v, got %v", expected.args, cmd.Args)
-		return "", fmt.Errorf("unit test failed")
+	args := cmd.Args
+	if expected.file != "" && len(args) > 0 {
+		time.Sleep(expected.fileDelay)
+		content, err := os.ReadFile(args[len(args)-1])
+		if err != nil {
+			fe.t.Errorf("could not read file argument: %v", err)
+			return nil, fmt.Errorf("unit test failed")
+		}
+		if expected.file != string(content) {
+			fe.t.Errorf("incorrect file content: expected %q, got %q", expected.file, string(content))
+			return nil, fmt.Errorf("unit test failed")
+		}
+		args = append(append([]string{}, args[:len(args)-1]...), "FILE")
+	}
+	if !reflect.DeepEqual(expected.args, args) {
+		fe.t.Errorf("incorrect arguments: expected %v, got %v", expected.args, args)
+		return nil, fmt.Errorf("unit test failed")
 	}
 
 	var stdin string
@@ -83,10 +129,10 @@ func (fe *fakeExec) Run(cmd *exec.Cmd) (string, error) {
 	}
 	if expected.stdin != stdin {
 		fe.t.Errorf("incorrect stdin: expected %q, got %q", expected.stdin, stdin)
-		return "", fmt.Errorf("unit test failed")
+		return nil, fmt.Errorf("unit test failed")
 	}
 
-	return expected.stdout, expected.err
+	return expected, nil
 }
 
 type execTestCase struct {
@@ -193,3 +239,24 @@ func TestFakeExec(t *testing.T) {
 		})
 	}
 }
+
+func TestRealExecStream(t *testing.T) {
+	execer := &realExec{}
+
+	var lines []string
+	cmd := exec.Command("printf", "one\ntwo\n\nthree")
+	err := execer.Stream(cmd, func(line string) { lines = append(lines, line) })
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := []string{"one", "two", "", "three"}
+	if !reflect.DeepEqual(expected, lines) {
+		t.Errorf("expected lines %q, got %q", expected, lines)
+	}
+
+	cmd = exec.Command("cat", ".")
+	err = execer.Stream(cmd, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "Is a directory") {
+		t.Errorf("expected error containing %q, got %v", "Is a directory", err)
+	}
+}
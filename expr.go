@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Expr is a single statement from a rule's JSON expression, as returned by
+// UnmarshalExprs. It will be an *ExprMatch, *ExprVerdict, *ExprCounter, or *ExprOther.
+type Expr interface {
+	// exprKind returns the name of the statement in nft's JSON syntax
+	exprKind() string
+}
+
+// ExprMatch is a "match" statement, which compares Left against Right using Op (e.g.
+// "==", "!=", "in"). Left and Right are expressions in nft's JSON syntax (see
+// libnftables-json(5)), decoded as by json.Unmarshal into an interface{}; for example,
+// `ip saddr 10.0.0.1` has Left `map[string]interface{}{"payload":
+// map[string]interface{}{"protocol": "ip", "field": "saddr"}}` and Right "10.0.0.1".
+type ExprMatch struct {
+	Op    string
+	Left  interface{}
+	Right interface{}
+}
+
+// ExprVerdict is a verdict statement. Type is "accept", "drop", "continue", "return",
+// "jump", or "goto", and Target is the name of the chain for "jump" and "goto".
+type ExprVerdict struct {
+	Type   string
+	Target string
+}
+
+// ExprCounter is a "counter" statement. For an anonymous counter, Packets and Bytes
+// are its current values. For a reference to a named counter, Name is the counter's
+// name, and Packets and Bytes are 0.
+type ExprCounter struct {
+	Name    string
+	Packets uint64
+	Bytes   uint64
+}
+
+// ExprOther is a statement of a kind that has no specific Expr type. Kind is the name
+// of the statement (e.g. "log", "masquerade") and Value is its raw JSON value.
+type ExprOther struct {
+	Kind  string
+	Value json.RawMessage
+}
+
+func (expr *ExprMatch) exprKind() string {
+	return "match"
+}
+
+func (expr *ExprVerdict) exprKind() string {
+	return expr.Type
+}
+
+func (expr *ExprCounter) exprKind() string {
+	return "counter"
+}
+
+func (expr *ExprOther) exprKind() string {
+	return expr.Kind
+}
+
+// UnmarshalExprs parses the JSON statements of a rule expression (as in Rule.Exprs)
+// into Exprs. Statements of kinds without a specific Expr type are returned as
+// *ExprOther; an error is only returned if a statement is not valid.
+func UnmarshalExprs(raw []json.RawMessage) ([]Expr, error) {
+	exprs := make([]Expr, 0, len(raw))
+	for _, stmt := range raw {
+		expr, err := unmarshalExpr(stmt)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+// unmarshalExpr parses a single JSON statement, which must be an object with a single
+// key (the statement's kind).
+func unmarshalExpr(raw json.RawMessage) (Expr, error) {
+	var stmt map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &stmt); err != nil {
+		return nil, fmt.Errorf("could not parse rule expression %q: %w", string(raw), err)
+	}
+	if len(stmt) != 1 {
+		return nil, fmt.Errorf("could not parse rule expression %q: expected a single statement", string(raw))
+	}
+
+	var kind string
+	var value json.RawMessage
+	for k, v := range stmt {
+		kind, value = k, v
+	}
+
+	var err error
+	switch kind {
+	case "match":
+		var match struct {
+			Op    string      `json:"op"`
+			Left  interface{} `json:"left"`
+			Right interface{} `json:"right"`
+		}
+		if err = json.Unmarshal(value, &match); err == nil {
+			return &ExprMatch{Op: match.Op, Left: match.Left, Right: match.Right}, nil
+		}
+
+	case "accept", "drop", "continue", "return":
+		return &ExprVerdict{Type: kind}, nil
+
+	case "jump", "goto":
+		var verdict struct {
+			Target string `json:"target"`
+		}
+		if err = json.Unmarshal(value, &verdict); err == nil {
+			return &ExprVerdict{Type: kind, Target: verdict.Target}, nil
+		}
+
+	case "counter":
+		var name string
+		if json.Unmarshal(value, &name) == nil {
+			return &ExprCounter{Name: name}, nil
+		}
+		var counter struct {
+			Packets uint64 `json:"packets"`
+			Bytes   uint64 `json:"bytes"`
+		}
+		if err = json.Unmarshal(value, &counter); err == nil {
+			return &ExprCounter{Packets: counter.Packets, Bytes: counter.Bytes}, nil
+		}
+
+	default:
+		return &ExprOther{Kind: kind, Value: value}, nil
+	}
+
+	return nil, fmt.Errorf("could not parse %q statement %q: %w", kind, string(value), err)
+}
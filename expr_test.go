@@ -0,0 +1,134 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnmarshalExprs(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		raw      []json.RawMessage
+		expected []Expr
+		err      string
+	}{
+		{
+			name:     "empty",
+			raw:      nil,
+			expected: []Expr{},
+		},
+		{
+			name: "match and verdict",
+			raw: rawExprs(
+				`{"match":{"left":{"payload":{"protocol":"ip","field":"saddr"}},"op":"==","right":"10.0.0.1"}}`,
+				`{"match":{"left":{"ct":{"key":"state"}},"op":"in","right":{"set":["established","related"]}}}`,
+				`{"accept":null}`,
+			),
+			expected: []Expr{
+				&ExprMatch{
+					Op:    "==",
+					Left:  map[string]interface{}{"payload": map[string]interface{}{"protocol": "ip", "field": "saddr"}},
+					Right: "10.0.0.1",
+				},
+				&ExprMatch{
+					Op:    "in",
+					Left:  map[string]interface{}{"ct": map[string]interface{}{"key": "state"}},
+					Right: map[string]interface{}{"set": []interface{}{"established", "related"}},
+				},
+				&ExprVerdict{Type: "accept"},
+			},
+		},
+		{
+			name: "verdicts",
+			raw: rawExprs(
+				`{"drop":null}`,
+				`{"return":null}`,
+				`{"jump":{"target":"services"}}`,
+				`{"goto":{"target":"svc-1"}}`,
+			),
+			expected: []Expr{
+				&ExprVerdict{Type: "drop"},
+				&ExprVerdict{Type: "return"},
+				&ExprVerdict{Type: "jump", Target: "services"},
+				&ExprVerdict{Type: "goto", Target: "svc-1"},
+			},
+		},
+		{
+			name: "counters",
+			raw: rawExprs(
+				`{"counter":{"packets":10,"bytes":1500}}`,
+				`{"counter":"packets"}`,
+			),
+			expected: []Expr{
+				&ExprCounter{Packets: 10, Bytes: 1500},
+				&ExprCounter{Name: "packets"},
+			},
+		},
+		{
+			name: "other",
+			raw: rawExprs(
+				`{"masquerade":null}`,
+				`{"log":{"prefix":"dropped: "}}`,
+			),
+			expected: []Expr{
+				&ExprOther{Kind: "masquerade", Value: json.RawMessage(`null`)},
+				&ExprOther{Kind: "log", Value: json.RawMessage(`{"prefix":"dropped: "}`)},
+			},
+		},
+		{
+			name: "not an object",
+			raw:  rawExprs(`"accept"`),
+			err:  "could not parse rule expression",
+		},
+		{
+			name: "multiple statements",
+			raw:  rawExprs(`{"accept":null,"drop":null}`),
+			err:  "expected a single statement",
+		},
+		{
+			name: "bad jump",
+			raw:  rawExprs(`{"jump":"services"}`),
+			err:  `could not parse "jump" statement`,
+		},
+		{
+			name: "bad counter",
+			raw:  rawExprs(`{"counter":{"packets":-1}}`),
+			err:  `could not parse "counter" statement`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exprs, err := UnmarshalExprs(tc.raw)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, exprs); diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
+			}
+		})
+	}
+}
@@ -22,17 +22,37 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Fake is a fake implementation of Interface
+// Fake is a fake implementation of Interface. As with the real implementation, its
+// methods are safe for concurrent use, but you must not access its exported fields while
+// another goroutine may be calling its methods.
 type Fake struct {
 	nftContext
 
+	// mutex protects all of the fields below it
+	mutex      sync.Mutex
 	nextHandle int
 
 	// Table contains the Interface's table. This will be `nil` until you `tx.Add()`
 	// the table.
 	Table *FakeTable
+
+	// Transactions contains the transactions that have been passed to Run,
+	// RunAndVerify, RunWithEcho, RunFromFile, or ImportRuleset, in order, whether or
+	// not they succeeded. (A call to RunAll records the single combined transaction
+	// that it runs. Transactions passed to Check are not recorded.) Each entry is a
+	// copy of the transaction as it was when it was run, so later changes to the
+	// original (eg, via Reset) do not affect it.
+	Transactions []*Transaction
+
+	// ListCalls contains a record of each call to the Interface's List*, Get*, and
+	// ExportRuleset methods, in order, as the method name followed by its string
+	// arguments (if any), separated by spaces; eg, "ListChains" or
+	// "ListElements map mymap".
+	ListCalls []string
 }
 
 // FakeTable wraps Table for the Fake implementation
@@ -47,6 +67,33 @@ type FakeTable struct {
 
 	// Maps contains the table's maps, keyed by name
 	Maps map[string]*FakeMap
+
+	// Flowtables contains the table's flowtables, keyed by name
+	Flowtables map[string]*Flowtable
+
+	// Counters contains the table's named counters, keyed by name. (Note that the
+	// fake does not actually count anything; the Packets and Bytes values will
+	// remain at whatever they were initialized to.)
+	Counters map[string]*Counter
+
+	// Quotas contains the table's named quotas, keyed by name. (As with Counters,
+	// the Used values will not be updated by the fake.)
+	Quotas map[string]*Quota
+
+	// Limits contains the table's named limits, keyed by name
+	Limits map[string]*Limit
+
+	// CTHelpers contains the table's ct helper objects, keyed by name
+	CTHelpers map[string]*CTHelper
+
+	// CTTimeouts contains the table's ct timeout objects, keyed by name
+	CTTimeouts map[string]*CTTimeout
+
+	// CTExpectations contains the table's ct expectation objects, keyed by name
+	CTExpectations map[string]*CTExpectation
+
+	// Secmarks contains the table's secmark objects, keyed by name
+	Secmarks map[string]*Secmark
 }
 
 // FakeChain wraps Chain for the Fake implementation
@@ -89,8 +136,12 @@ var _ Interface = &Fake{}
 
 // List is part of Interface.
 func (fake *Fake) List(_ context.Context, objectType string) ([]string, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("List", objectType)
+
 	if fake.Table == nil {
-		return nil, notFoundError("no such table %q", fake.table)
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
 	}
 
 	var result []string
@@ -108,6 +159,22 @@ func (fake *Fake) List(_ context.Context, objectType string) ([]string, error) {
 		for name := range fake.Table.Maps {
 			result = append(result, name)
 		}
+	case "flowtable", "flowtables":
+		for name := range fake.Table.Flowtables {
+			result = append(result, name)
+		}
+	case "counter", "counters":
+		for name := range fake.Table.Counters {
+			result = append(result, name)
+		}
+	case "quota", "quotas":
+		for name := range fake.Table.Quotas {
+			result = append(result, name)
+		}
+	case "limit", "limits":
+		for name := range fake.Table.Limits {
+			result = append(result, name)
+		}
 
 	default:
 		return nil, fmt.Errorf("unsupported object type %q", objectType)
@@ -116,22 +183,339 @@ func (fake *Fake) List(_ context.Context, objectType string) ([]string, error) {
 	return result, nil
 }
 
+// ListChains is part of Interface
+func (fake *Fake) ListChains(_ context.Context) ([]*Chain, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListChains")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	chains := make([]*Chain, 0, len(fake.Table.Chains))
+	for _, name := range sortKeys(fake.Table.Chains) {
+		chain := fake.Table.Chains[name].Chain
+		chains = append(chains, &chain)
+	}
+	return chains, nil
+}
+
+// GetChain is part of Interface
+func (fake *Fake) GetChain(_ context.Context, name string) (*Chain, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetChain", name)
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "chain", ObjectName: name}
+	}
+	ch := fake.Table.Chains[name]
+	if ch == nil {
+		return nil, &NotFoundError{ObjectType: "chain", ObjectName: name}
+	}
+	chain := ch.Chain
+	return &chain, nil
+}
+
+// ListSets is part of Interface
+func (fake *Fake) ListSets(_ context.Context) ([]*Set, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListSets")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	sets := make([]*Set, 0, len(fake.Table.Sets))
+	for _, name := range sortKeys(fake.Table.Sets) {
+		set := fake.Table.Sets[name].Set
+		sets = append(sets, &set)
+	}
+	return sets, nil
+}
+
+// GetSet is part of Interface
+func (fake *Fake) GetSet(_ context.Context, name string) (*Set, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetSet", name)
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "set", ObjectName: name}
+	}
+	s := fake.Table.Sets[name]
+	if s == nil {
+		return nil, &NotFoundError{ObjectType: "set", ObjectName: name}
+	}
+	set := s.Set
+	return &set, nil
+}
+
+// ListMaps is part of Interface
+func (fake *Fake) ListMaps(_ context.Context) ([]*Map, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListMaps")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	maps := make([]*Map, 0, len(fake.Table.Maps))
+	for _, name := range sortKeys(fake.Table.Maps) {
+		mapObj := fake.Table.Maps[name].Map
+		maps = append(maps, &mapObj)
+	}
+	return maps, nil
+}
+
+// GetMap is part of Interface
+func (fake *Fake) GetMap(_ context.Context, name string) (*Map, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetMap", name)
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "map", ObjectName: name}
+	}
+	m := fake.Table.Maps[name]
+	if m == nil {
+		return nil, &NotFoundError{ObjectType: "map", ObjectName: name}
+	}
+	mapObj := m.Map
+	return &mapObj, nil
+}
+
+// GetTable is part of Interface
+func (fake *Fake) GetTable(_ context.Context) (*Table, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetTable")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+	table := fake.Table.Table
+	return &table, nil
+}
+
+// GetTableHandle is part of Interface
+func (fake *Fake) GetTableHandle(_ context.Context) (int, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetTableHandle")
+
+	if fake.Table == nil {
+		return 0, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+	return *fake.Table.Handle, nil
+}
+
+// GetChainHandle is part of Interface
+func (fake *Fake) GetChainHandle(_ context.Context, name string) (int, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetChainHandle", name)
+
+	if fake.Table == nil || fake.Table.Chains[name] == nil {
+		return 0, &NotFoundError{ObjectType: "chain", ObjectName: name}
+	}
+	return *fake.Table.Chains[name].Handle, nil
+}
+
+// GetSetHandle is part of Interface
+func (fake *Fake) GetSetHandle(_ context.Context, name string) (int, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetSetHandle", name)
+
+	if fake.Table == nil || fake.Table.Sets[name] == nil {
+		return 0, &NotFoundError{ObjectType: "set", ObjectName: name}
+	}
+	return *fake.Table.Sets[name].Handle, nil
+}
+
+// GetMapHandle is part of Interface
+func (fake *Fake) GetMapHandle(_ context.Context, name string) (int, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetMapHandle", name)
+
+	if fake.Table == nil || fake.Table.Maps[name] == nil {
+		return 0, &NotFoundError{ObjectType: "map", ObjectName: name}
+	}
+	return *fake.Table.Maps[name].Handle, nil
+}
+
+// ListFlowtables is part of Interface
+func (fake *Fake) ListFlowtables(_ context.Context) ([]*Flowtable, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListFlowtables")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	flowtables := make([]*Flowtable, 0, len(fake.Table.Flowtables))
+	for _, name := range sortKeys(fake.Table.Flowtables) {
+		flowtable := *fake.Table.Flowtables[name]
+		flowtables = append(flowtables, &flowtable)
+	}
+	return flowtables, nil
+}
+
+// ListCounters is part of Interface
+func (fake *Fake) ListCounters(_ context.Context) ([]*Counter, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListCounters")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	counters := make([]*Counter, 0, len(fake.Table.Counters))
+	for _, name := range sortKeys(fake.Table.Counters) {
+		counter := *fake.Table.Counters[name]
+		counters = append(counters, &counter)
+	}
+	return counters, nil
+}
+
+// GetCounter is part of Interface
+func (fake *Fake) GetCounter(_ context.Context, name string) (*Counter, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("GetCounter", name)
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "counter", ObjectName: name}
+	}
+	c := fake.Table.Counters[name]
+	if c == nil {
+		return nil, &NotFoundError{ObjectType: "counter", ObjectName: name}
+	}
+	counter := *c
+	return &counter, nil
+}
+
+// ListQuotas is part of Interface
+func (fake *Fake) ListQuotas(_ context.Context) ([]*Quota, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListQuotas")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	quotas := make([]*Quota, 0, len(fake.Table.Quotas))
+	for _, name := range sortKeys(fake.Table.Quotas) {
+		quota := *fake.Table.Quotas[name]
+		quotas = append(quotas, &quota)
+	}
+	return quotas, nil
+}
+
+// ListLimits is part of Interface
+func (fake *Fake) ListLimits(_ context.Context) ([]*Limit, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListLimits")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	limits := make([]*Limit, 0, len(fake.Table.Limits))
+	for _, name := range sortKeys(fake.Table.Limits) {
+		limit := *fake.Table.Limits[name]
+		limits = append(limits, &limit)
+	}
+	return limits, nil
+}
+
+// ListCTTimeouts is part of Interface
+func (fake *Fake) ListCTTimeouts(_ context.Context) ([]*CTTimeout, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListCTTimeouts")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	timeouts := make([]*CTTimeout, 0, len(fake.Table.CTTimeouts))
+	for _, name := range sortKeys(fake.Table.CTTimeouts) {
+		timeout := *fake.Table.CTTimeouts[name]
+		timeouts = append(timeouts, &timeout)
+	}
+	return timeouts, nil
+}
+
+// ListCTExpectations is part of Interface
+func (fake *Fake) ListCTExpectations(_ context.Context) ([]*CTExpectation, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListCTExpectations")
+
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	expectations := make([]*CTExpectation, 0, len(fake.Table.CTExpectations))
+	for _, name := range sortKeys(fake.Table.CTExpectations) {
+		expect := *fake.Table.CTExpectations[name]
+		expectations = append(expectations, &expect)
+	}
+	return expectations, nil
+}
+
 // ListRules is part of Interface
 func (fake *Fake) ListRules(_ context.Context, chain string) ([]*Rule, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListRules", chain)
+
 	if fake.Table == nil {
-		return nil, notFoundError("no such chain %q", chain)
+		return nil, &NotFoundError{ObjectType: "chain", ObjectName: chain}
 	}
 	ch := fake.Table.Chains[chain]
 	if ch == nil {
-		return nil, notFoundError("no such chain %q", chain)
+		return nil, &NotFoundError{ObjectType: "chain", ObjectName: chain}
 	}
 	return ch.Rules, nil
 }
 
+// ListAllRules is part of Interface. Unlike with the real implementation, the returned
+// rules will have their Rule field filled in.
+func (fake *Fake) ListAllRules(_ context.Context) ([]*Rule, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListAllRules")
+
+	rs, err := fake.exportRuleset()
+	if err != nil {
+		return nil, err
+	}
+	rules := rs.Tables[0].Rules
+	if rules == nil {
+		rules = []*Rule{}
+	}
+	return rules, nil
+}
+
 // ListElements is part of Interface
 func (fake *Fake) ListElements(_ context.Context, objectType, name string) ([]*Element, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListElements", objectType, name)
+
 	if fake.Table == nil {
-		return nil, notFoundError("no such %s %q", objectType, name)
+		return nil, &NotFoundError{ObjectType: objectType, ObjectName: name}
 	}
 	if objectType == "set" {
 		s := fake.Table.Sets[name]
@@ -144,7 +528,148 @@ func (fake *Fake) ListElements(_ context.Context, objectType, name string) ([]*E
 			return m.Elements, nil
 		}
 	}
-	return nil, notFoundError("no such %s %q", objectType, name)
+	return nil, &NotFoundError{ObjectType: objectType, ObjectName: name}
+}
+
+// ListAllElements is part of Interface
+func (fake *Fake) ListAllElements(_ context.Context) ([]*Element, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListAllElements")
+
+	rs, err := fake.exportRuleset()
+	if err != nil {
+		return nil, err
+	}
+	elements := rs.Tables[0].Elements
+	if elements == nil {
+		elements = []*Element{}
+	}
+	return elements, nil
+}
+
+// ExportRuleset is part of Interface. Unlike with the real implementation, the returned
+// rules will have their Rule field filled in.
+func (fake *Fake) ExportRuleset(_ context.Context) (*Ruleset, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ExportRuleset")
+	return fake.exportRuleset()
+}
+
+func (fake *Fake) exportRuleset() (*Ruleset, error) {
+	if fake.Table == nil {
+		return nil, &NotFoundError{ObjectType: "table", ObjectName: fake.table}
+	}
+
+	table := &RulesetTable{
+		Family:         fake.family,
+		Name:           fake.table,
+		Table:          fake.Table.Table,
+		Flowtables:     sortedValues(fake.Table.Flowtables),
+		Counters:       sortedValues(fake.Table.Counters),
+		Quotas:         sortedValues(fake.Table.Quotas),
+		Limits:         sortedValues(fake.Table.Limits),
+		CTHelpers:      sortedValues(fake.Table.CTHelpers),
+		CTTimeouts:     sortedValues(fake.Table.CTTimeouts),
+		CTExpectations: sortedValues(fake.Table.CTExpectations),
+		Secmarks:       sortedValues(fake.Table.Secmarks),
+	}
+	for _, name := range sortKeys(fake.Table.Chains) {
+		ch := fake.Table.Chains[name]
+		chain := ch.Chain
+		table.Chains = append(table.Chains, &chain)
+		for _, rule := range ch.Rules {
+			rule := *rule
+			table.Rules = append(table.Rules, &rule)
+		}
+	}
+	for _, name := range sortKeys(fake.Table.Sets) {
+		s := fake.Table.Sets[name]
+		set := s.Set
+		table.Sets = append(table.Sets, &set)
+		table.Elements = append(table.Elements, s.Elements...)
+	}
+	for _, name := range sortKeys(fake.Table.Maps) {
+		m := fake.Table.Maps[name]
+		mapObj := m.Map
+		table.Maps = append(table.Maps, &mapObj)
+		table.Elements = append(table.Elements, m.Elements...)
+	}
+
+	return &Ruleset{Tables: []*RulesetTable{table}}, nil
+}
+
+// ListState is part of Interface. (Note that the fake does not update the values of
+// counters or quotas; see FakeTable.Counters.)
+func (fake *Fake) ListState(_ context.Context) (*Ruleset, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.recordListCall("ListState")
+
+	rs, err := fake.exportRuleset()
+	if err != nil {
+		return nil, err
+	}
+	return stateRuleset(rs), nil
+}
+
+// ImportRuleset is part of Interface
+func (fake *Fake) ImportRuleset(ctx context.Context, rs *Ruleset) error {
+	tx, err := rulesetTransaction(fake.NewTransaction(), rs)
+	if err != nil {
+		return err
+	}
+	return fake.Run(ctx, tx)
+}
+
+// AddChain adds chain to the fake's table (creating the table if it doesn't exist yet),
+// without recording a transaction. This can be used to pre-populate the fake's state
+// before running the code under test.
+func (fake *Fake) AddChain(chain *Chain) error {
+	return fake.preload(chain)
+}
+
+// AddSet adds set to the fake's table (creating the table if it doesn't exist yet),
+// without recording a transaction.
+func (fake *Fake) AddSet(set *Set) error {
+	return fake.preload(set)
+}
+
+// AddMap adds mapObj to the fake's table (creating the table if it doesn't exist yet),
+// without recording a transaction.
+func (fake *Fake) AddMap(mapObj *Map) error {
+	return fake.preload(mapObj)
+}
+
+// AddRule adds rule to its chain (which must already exist), without recording a
+// transaction.
+func (fake *Fake) AddRule(rule *Rule) error {
+	return fake.preload(rule)
+}
+
+// AddElement adds element to its set or map (which must already exist), without
+// recording a transaction.
+func (fake *Fake) AddElement(element *Element) error {
+	return fake.preload(element)
+}
+
+// preload adds obj to the fake's table, creating the table first if needed.
+func (fake *Fake) preload(obj Object) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	tx := fake.NewTransaction()
+	if fake.Table == nil {
+		tx.Add(&Table{})
+	}
+	tx.Add(obj)
+	updatedTable, _, err := fake.run(tx)
+	if err != nil {
+		return err
+	}
+	fake.Table = updatedTable
+	return nil
 }
 
 // NewTransaction is part of Interface
@@ -152,32 +677,261 @@ func (fake *Fake) NewTransaction() *Transaction {
 	return &Transaction{nftContext: &fake.nftContext}
 }
 
+// NewTransactionWithContext is part of Interface
+func (fake *Fake) NewTransactionWithContext(ctx context.Context) *Transaction {
+	return &Transaction{nftContext: &fake.nftContext, ctx: ctx}
+}
+
 // Run is part of Interface
 func (fake *Fake) Run(_ context.Context, tx *Transaction) error {
-	updatedTable, err := fake.run(tx)
-	if err == nil {
-		fake.Table = updatedTable
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	_, err := fake.runAndRecord(tx)
+	return err
+}
+
+// RunAll is part of Interface
+func (fake *Fake) RunAll(ctx context.Context, txs ...*Transaction) error {
+	tx, err := combineTransactions(fake.NewTransaction(), txs)
+	if err != nil {
+		return err
 	}
+	return fake.Run(ctx, tx)
+}
+
+// RunAndVerify is part of Interface
+func (fake *Fake) RunAndVerify(_ context.Context, tx *Transaction) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if _, err := fake.runAndRecord(tx); err != nil {
+		return err
+	}
+	rs, err := fake.exportRuleset()
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return verifyTransaction(tx, rs)
+}
+
+// RunWithEcho is part of Interface
+func (fake *Fake) RunWithEcho(_ context.Context, tx *Transaction) ([]Object, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return fake.runAndRecord(tx)
+}
+
+// RunFromFile is part of Interface. The fake runs tx as with Run, without writing it to
+// a file.
+func (fake *Fake) RunFromFile(_ context.Context, tx *Transaction, _ string) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	_, err := fake.runAndRecord(tx)
+	return err
+}
+
+// BulkAddElements is part of Interface. The fake uses DefaultBulkBatchSize, and records
+// each batch in Transactions.
+func (fake *Fake) BulkAddElements(ctx context.Context, setName string, keys [][]string) error {
+	return bulkAddElements(ctx, fake, fake.batchSize(), setElements(setName, keys))
+}
+
+// BulkAddMapElements is part of Interface. As with BulkAddElements, the fake uses
+// DefaultBulkBatchSize, and records each batch in Transactions.
+func (fake *Fake) BulkAddMapElements(ctx context.Context, mapName string, entries []MapEntry) error {
+	return bulkAddElements(ctx, fake, fake.batchSize(), mapElements(mapName, entries))
+}
+
+// ClearSet is part of Interface
+func (fake *Fake) ClearSet(ctx context.Context, setName string) error {
+	tx := fake.NewTransaction()
+	tx.Flush(&Set{Name: setName})
+	return fake.Run(ctx, tx)
+}
+
+// ReplaceSetElements is part of Interface
+func (fake *Fake) ReplaceSetElements(ctx context.Context, setName string, keys [][]string) error {
+	return fake.Run(ctx, replaceSetElements(fake.NewTransaction(), setName, keys))
+}
+
+// RenameChain is part of Interface. (Since this does not use a Transaction, it is not
+// recorded in Transactions.)
+func (fake *Fake) RenameChain(_ context.Context, oldName, newName string) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if oldName == "" || newName == "" {
+		return fmt.Errorf("chain name must not be empty")
+	}
+	if fake.Table == nil || fake.Table.Chains[oldName] == nil {
+		return &NotFoundError{ObjectType: "chain", ObjectName: oldName}
+	}
+	if fake.Table.Chains[newName] != nil {
+		return &AlreadyExistsError{ObjectType: "chain", ObjectName: newName}
+	}
+
+	// Copy the chain and its rules rather than modifying them in place, so as not
+	// to change objects that the caller may have gotten from fake.Table.
+	chain := *fake.Table.Chains[oldName]
+	chain.Name = newName
+	chain.Rules = append([]*Rule(nil), chain.Rules...)
+	delete(fake.Table.Chains, oldName)
+	fake.Table.Chains[newName] = &chain
+
+	for _, ch := range fake.Table.Chains {
+		for i, rule := range ch.Rules {
+			renamed, changed := renameJumps(rule.Rule, oldName, newName)
+			if !changed && rule.Chain != oldName {
+				continue
+			}
+			newRule := *rule
+			newRule.Chain = ch.Name
+			newRule.Rule = renamed
+			ch.Rules[i] = &newRule
+		}
+	}
+	for _, m := range fake.Table.Maps {
+		for i, elem := range m.Elements {
+			if len(elem.Value) != 1 {
+				continue
+			}
+			if renamed, changed := renameJumps(elem.Value[0], oldName, newName); changed {
+				newElem := *elem
+				newElem.Value = []string{renamed}
+				m.Elements[i] = &newElem
+			}
+		}
+	}
+	return nil
+}
+
+// CopyChain is part of Interface. The rules are copied with their Rule and Comment
+// fields, and the transaction is recorded in Transactions.
+func (fake *Fake) CopyChain(_ context.Context, srcChain, dstChain string) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if srcChain == dstChain {
+		return fmt.Errorf("cannot copy chain %q to itself", srcChain)
+	}
+	if fake.Table == nil || fake.Table.Chains[srcChain] == nil {
+		return &NotFoundError{ObjectType: "chain", ObjectName: srcChain}
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Chain{Name: dstChain})
+	for _, rule := range fake.Table.Chains[srcChain].Rules {
+		tx.Add(&Rule{Chain: dstChain, Rule: rule.Rule, Comment: rule.Comment})
+	}
+	_, err := fake.runAndRecord(tx)
 	return err
 }
 
+// renameJumps rewrites any "jump oldName" or "goto oldName" verdicts in rule to refer
+// to newName instead, and returns the new rule and whether it changed.
+func renameJumps(rule, oldName, newName string) (string, bool) {
+	words := strings.Split(rule, " ")
+	changed := false
+	for i := 0; i < len(words)-1; i++ {
+		if words[i] != "jump" && words[i] != "goto" {
+			continue
+		}
+		target := strings.TrimRight(words[i+1], ",;}")
+		if target == oldName {
+			words[i+1] = newName + words[i+1][len(target):]
+			changed = true
+		}
+	}
+	if !changed {
+		return rule, false
+	}
+	return strings.Join(words, " "), true
+}
+
+// WaitForChain is part of Interface
+func (fake *Fake) WaitForChain(ctx context.Context, chainName string, interval time.Duration) error {
+	return waitForChain(ctx, fake, chainName, interval)
+}
+
+// Monitor is part of Interface. The fake does not generate any events; it just waits
+// until ctx is cancelled.
+func (fake *Fake) Monitor(ctx context.Context, events chan<- MonitorEvent) error {
+	defer close(events)
+	<-ctx.Done()
+	return nil
+}
+
+// Version is part of Interface. The fake claims to be nft 1.0.9.
+func (fake *Fake) Version() NFTVersion {
+	return NFTVersion{Major: 1, Minor: 0, Patch: 9}
+}
+
+// SupportsFeature is part of Interface; the fake supports all known features.
+func (fake *Fake) SupportsFeature(feature Feature) bool {
+	return fake.supportsFeature(feature)
+}
+
 // Check is part of Interface
 func (fake *Fake) Check(_ context.Context, tx *Transaction) error {
-	_, err := fake.run(tx)
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	_, _, err := fake.run(tx)
 	return err
 }
 
-func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
+func (fake *Fake) recordListCall(method string, args ...string) {
+	fake.ListCalls = append(fake.ListCalls, strings.Join(append([]string{method}, args...), " "))
+}
+
+// runAndRecord records tx in fake.Transactions, runs it, and (if it succeeds) updates
+// fake.Table. fake.mutex must be held.
+func (fake *Fake) runAndRecord(tx *Transaction) ([]Object, error) {
+	// Record the transaction as it will be run (if fake.run doesn't reject it).
+	if bound, err := bindTransaction(&fake.nftContext, tx); err == nil {
+		tx = bound
+	}
+	fake.Transactions = append(fake.Transactions, tx.copy())
+	updatedTable, echo, err := fake.run(tx)
+	if err != nil {
+		return nil, err
+	}
+	fake.Table = updatedTable
+	return echo, nil
+}
+
+// run runs tx against a copy of fake.Table and returns the updated table, along with
+// copies of the objects that tx added, created, inserted, or replaced (as they would be
+// echoed back by "nft --echo").
+func (fake *Fake) run(tx *Transaction) (*FakeTable, []Object, error) {
 	if tx.err != nil {
-		return nil, tx.err
+		return nil, nil, tx.err
+	}
+	tx, err := bindTransaction(&fake.nftContext, tx)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	updatedTable := fake.Table.copy()
+	var echo []Object
+
+	// Sets and maps created by this transaction (whose elements can be modified even
+	// if they are constant).
+	newSets := make(map[string]bool)
+	newMaps := make(map[string]bool)
+
 	for _, op := range tx.operations {
+		if op.verb == commentVerb {
+			continue
+		}
+
 		// If the table hasn't been created, and this isn't a Table operation, then fail
 		if updatedTable == nil {
 			if _, ok := op.obj.(*Table); !ok {
-				return nil, notFoundError("no such table \"%s %s\"", fake.family, fake.table)
+				return nil, nil, notFoundError("no such table \"%s %s\"", fake.family, fake.table)
 			}
 		}
 
@@ -189,7 +943,7 @@ func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
 		case *Table:
 			err := checkExists(op.verb, "table", fake.table, updatedTable != nil)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			switch op.verb {
 			case flushVerb:
@@ -201,23 +955,32 @@ func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
 				}
 				table := *obj
 				table.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(table))
 				updatedTable = &FakeTable{
-					Table:  table,
-					Chains: make(map[string]*FakeChain),
-					Sets:   make(map[string]*FakeSet),
-					Maps:   make(map[string]*FakeMap),
+					Table:          table,
+					Chains:         make(map[string]*FakeChain),
+					Sets:           make(map[string]*FakeSet),
+					Maps:           make(map[string]*FakeMap),
+					Flowtables:     make(map[string]*Flowtable),
+					Counters:       make(map[string]*Counter),
+					Quotas:         make(map[string]*Quota),
+					Limits:         make(map[string]*Limit),
+					CTHelpers:      make(map[string]*CTHelper),
+					CTTimeouts:     make(map[string]*CTTimeout),
+					CTExpectations: make(map[string]*CTExpectation),
+					Secmarks:       make(map[string]*Secmark),
 				}
-			case deleteVerb:
+			case deleteVerb, destroyVerb:
 				updatedTable = nil
 			default:
-				return nil, fmt.Errorf("unhandled operation %q", op.verb)
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
 			}
 
 		case *Chain:
 			existingChain := updatedTable.Chains[obj.Name]
 			err := checkExists(op.verb, "chain", obj.Name, existingChain != nil)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			switch op.verb {
 			case addVerb, createVerb:
@@ -226,29 +989,31 @@ func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
 				}
 				chain := *obj
 				chain.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(chain))
 				updatedTable.Chains[obj.Name] = &FakeChain{
 					Chain: chain,
 				}
 			case flushVerb:
 				existingChain.Rules = nil
-			case deleteVerb:
+			case deleteVerb, destroyVerb:
 				// FIXME delete-by-handle
 				delete(updatedTable.Chains, obj.Name)
 			default:
-				return nil, fmt.Errorf("unhandled operation %q", op.verb)
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
 			}
 
 		case *Rule:
 			existingChain := updatedTable.Chains[obj.Chain]
 			if existingChain == nil {
-				return nil, notFoundError("no such chain %q", obj.Chain)
+				return nil, nil, notFoundError("no such chain %q", obj.Chain)
 			}
-			if op.verb == deleteVerb {
+			if op.verb == deleteVerb || op.verb == destroyVerb {
 				i := findRule(existingChain.Rules, *obj.Handle)
-				if i == -1 {
-					return nil, notFoundError("no rule with handle %d", *obj.Handle)
+				if i != -1 {
+					existingChain.Rules = append(existingChain.Rules[:i], existingChain.Rules[i+1:]...)
+				} else if op.verb == deleteVerb {
+					return nil, nil, notFoundError("no rule with handle %d", *obj.Handle)
 				}
-				existingChain.Rules = append(existingChain.Rules[:i], existingChain.Rules[i+1:]...)
 				continue
 			}
 
@@ -257,17 +1022,17 @@ func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
 			if rule.Handle != nil {
 				refRule = findRule(existingChain.Rules, *obj.Handle)
 				if refRule == -1 {
-					return nil, notFoundError("no rule with handle %d", *obj.Handle)
+					return nil, nil, notFoundError("no rule with handle %d", *obj.Handle)
 				}
 			} else if obj.Index != nil {
 				if *obj.Index >= len(existingChain.Rules) {
-					return nil, notFoundError("no rule with index %d", *obj.Index)
+					return nil, nil, notFoundError("no rule with index %d", *obj.Index)
 				}
 				refRule = *obj.Index
 			}
 
 			if err := checkRuleRefs(obj, updatedTable); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			switch op.verb {
@@ -278,6 +1043,7 @@ func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
 					existingChain.Rules = append(existingChain.Rules[:refRule+1], append([]*Rule{&rule}, existingChain.Rules[refRule+1:]...)...)
 				}
 				rule.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(rule))
 			case insertVerb:
 				if refRule == -1 {
 					existingChain.Rules = append([]*Rule{&rule}, existingChain.Rules...)
@@ -285,17 +1051,19 @@ func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
 					existingChain.Rules = append(existingChain.Rules[:refRule], append([]*Rule{&rule}, existingChain.Rules[refRule:]...)...)
 				}
 				rule.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(rule))
 			case replaceVerb:
 				existingChain.Rules[refRule] = &rule
+				echo = append(echo, PtrTo(rule))
 			default:
-				return nil, fmt.Errorf("unhandled operation %q", op.verb)
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
 			}
 
 		case *Set:
 			existingSet := updatedTable.Sets[obj.Name]
 			err := checkExists(op.verb, "set", obj.Name, existingSet != nil)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			switch op.verb {
 			case addVerb, createVerb:
@@ -304,114 +1072,328 @@ func (fake *Fake) run(tx *Transaction) (*FakeTable, error) {
 				}
 				set := *obj
 				set.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(set))
 				updatedTable.Sets[obj.Name] = &FakeSet{
 					Set: set,
 				}
+				newSets[obj.Name] = true
 			case flushVerb:
+				if hasSetFlag(existingSet.Flags, ConstantFlag) && !newSets[obj.Name] {
+					return nil, nil, fmt.Errorf("set %q is constant", obj.Name)
+				}
 				existingSet.Elements = nil
-			case deleteVerb:
+			case deleteVerb, destroyVerb:
 				// FIXME delete-by-handle
 				delete(updatedTable.Sets, obj.Name)
 			default:
-				return nil, fmt.Errorf("unhandled operation %q", op.verb)
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
 			}
 		case *Map:
 			existingMap := updatedTable.Maps[obj.Name]
 			err := checkExists(op.verb, "map", obj.Name, existingMap != nil)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			switch op.verb {
-			case addVerb:
+			case addVerb, createVerb:
 				if existingMap != nil {
 					continue
 				}
 				mapObj := *obj
 				mapObj.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(mapObj))
 				updatedTable.Maps[obj.Name] = &FakeMap{
 					Map: mapObj,
 				}
+				newMaps[obj.Name] = true
 			case flushVerb:
+				if hasSetFlag(existingMap.Flags, ConstantFlag) && !newMaps[obj.Name] {
+					return nil, nil, fmt.Errorf("map %q is constant", obj.Name)
+				}
 				existingMap.Elements = nil
-			case deleteVerb:
+			case deleteVerb, destroyVerb:
 				// FIXME delete-by-handle
 				delete(updatedTable.Maps, obj.Name)
 			default:
-				return nil, fmt.Errorf("unhandled operation %q", op.verb)
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *Flowtable:
+			existingFlowtable := updatedTable.Flowtables[obj.Name]
+			err := checkExists(op.verb, "flowtable", obj.Name, existingFlowtable != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingFlowtable != nil {
+					continue
+				}
+				flowtable := *obj
+				flowtable.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(flowtable))
+				updatedTable.Flowtables[obj.Name] = &flowtable
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.Flowtables, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *Counter:
+			existingCounter := updatedTable.Counters[obj.Name]
+			err := checkExists(op.verb, "counter", obj.Name, existingCounter != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingCounter != nil {
+					continue
+				}
+				counter := *obj
+				if counter.Packets == nil {
+					counter.Packets = PtrTo[uint64](0)
+					counter.Bytes = PtrTo[uint64](0)
+				}
+				counter.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(counter))
+				updatedTable.Counters[obj.Name] = &counter
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.Counters, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *Quota:
+			existingQuota := updatedTable.Quotas[obj.Name]
+			err := checkExists(op.verb, "quota", obj.Name, existingQuota != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingQuota != nil {
+					continue
+				}
+				quota := *obj
+				if quota.Used == nil {
+					quota.Used = PtrTo[uint64](0)
+				}
+				quota.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(quota))
+				updatedTable.Quotas[obj.Name] = &quota
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.Quotas, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *Limit:
+			existingLimit := updatedTable.Limits[obj.Name]
+			err := checkExists(op.verb, "limit", obj.Name, existingLimit != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingLimit != nil {
+					continue
+				}
+				limit := *obj
+				limit.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(limit))
+				updatedTable.Limits[obj.Name] = &limit
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.Limits, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *CTHelper:
+			existingHelper := updatedTable.CTHelpers[obj.Name]
+			err := checkExists(op.verb, "ct helper", obj.Name, existingHelper != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingHelper != nil {
+					continue
+				}
+				helper := *obj
+				helper.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(helper))
+				updatedTable.CTHelpers[obj.Name] = &helper
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.CTHelpers, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *CTTimeout:
+			existingTimeout := updatedTable.CTTimeouts[obj.Name]
+			err := checkExists(op.verb, "ct timeout", obj.Name, existingTimeout != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingTimeout != nil {
+					continue
+				}
+				timeout := *obj
+				timeout.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(timeout))
+				updatedTable.CTTimeouts[obj.Name] = &timeout
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.CTTimeouts, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *CTExpectation:
+			existingExpectation := updatedTable.CTExpectations[obj.Name]
+			err := checkExists(op.verb, "ct expectation", obj.Name, existingExpectation != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingExpectation != nil {
+					continue
+				}
+				expect := *obj
+				expect.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(expect))
+				updatedTable.CTExpectations[obj.Name] = &expect
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.CTExpectations, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
+			}
+		case *Secmark:
+			existingSecmark := updatedTable.Secmarks[obj.Name]
+			err := checkExists(op.verb, "secmark", obj.Name, existingSecmark != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch op.verb {
+			case addVerb, createVerb:
+				if existingSecmark != nil {
+					continue
+				}
+				secmark := *obj
+				secmark.Handle = PtrTo(fake.nextHandle)
+				echo = append(echo, PtrTo(secmark))
+				updatedTable.Secmarks[obj.Name] = &secmark
+			case deleteVerb, destroyVerb:
+				// FIXME delete-by-handle
+				delete(updatedTable.Secmarks, obj.Name)
+			default:
+				return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
 			}
 		case *Element:
-			if len(obj.Value) == 0 {
+			if obj.Set != "" {
 				existingSet := updatedTable.Sets[obj.Set]
 				if existingSet == nil {
-					return nil, notFoundError("no such set %q", obj.Set)
+					return nil, nil, notFoundError("no such set %q", obj.Set)
+				}
+				if hasSetFlag(existingSet.Flags, ConstantFlag) && !newSets[obj.Set] {
+					return nil, nil, fmt.Errorf("set %q is constant", obj.Set)
 				}
 				switch op.verb {
 				case addVerb, createVerb:
 					element := *obj
+					if element.Timeout != 0 {
+						element.ExpiresAt = time.Now().Add(element.Timeout)
+					}
+					echo = append(echo, PtrTo(element))
 					if i := findElement(existingSet.Elements, element.Key); i != -1 {
 						if op.verb == createVerb {
-							return nil, existsError("element %q already exists", strings.Join(element.Key, " . "))
+							return nil, nil, &AlreadyExistsError{ObjectType: "element", ObjectName: strings.Join(element.Key, " . ")}
 						}
 						existingSet.Elements[i] = &element
 					} else {
+						if existingSet.Size != nil && uint64(len(existingSet.Elements)) >= *existingSet.Size {
+							return nil, nil, fmt.Errorf("set %q is full", obj.Set)
+						}
 						existingSet.Elements = append(existingSet.Elements, &element)
 					}
-				case deleteVerb:
+				case deleteVerb, destroyVerb:
 					element := *obj
 					if i := findElement(existingSet.Elements, element.Key); i != -1 {
 						existingSet.Elements = append(existingSet.Elements[:i], existingSet.Elements[i+1:]...)
-					} else {
-						return nil, notFoundError("no such element %q", strings.Join(element.Key, " . "))
+					} else if op.verb == deleteVerb {
+						return nil, nil, notFoundError("no such element %q", strings.Join(element.Key, " . "))
 					}
 				default:
-					return nil, fmt.Errorf("unhandled operation %q", op.verb)
+					return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
 				}
 			} else {
 				existingMap := updatedTable.Maps[obj.Map]
 				if existingMap == nil {
-					return nil, notFoundError("no such map %q", obj.Map)
+					return nil, nil, notFoundError("no such map %q", obj.Map)
+				}
+				if hasSetFlag(existingMap.Flags, ConstantFlag) && !newMaps[obj.Map] {
+					return nil, nil, fmt.Errorf("map %q is constant", obj.Map)
 				}
 				if err := checkElementRefs(obj, updatedTable); err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 				switch op.verb {
 				case addVerb, createVerb:
 					element := *obj
+					if element.Timeout != 0 {
+						element.ExpiresAt = time.Now().Add(element.Timeout)
+					}
+					echo = append(echo, PtrTo(element))
 					if i := findElement(existingMap.Elements, element.Key); i != -1 {
 						if op.verb == createVerb {
-							return nil, existsError("element %q already exists", strings.Join(element.Key, ". "))
+							return nil, nil, &AlreadyExistsError{ObjectType: "element", ObjectName: strings.Join(element.Key, " . ")}
 						}
 						existingMap.Elements[i] = &element
 					} else {
+						if existingMap.Size != nil && uint64(len(existingMap.Elements)) >= *existingMap.Size {
+							return nil, nil, fmt.Errorf("map %q is full", obj.Map)
+						}
 						existingMap.Elements = append(existingMap.Elements, &element)
 					}
-				case deleteVerb:
+				case deleteVerb, destroyVerb:
 					element := *obj
 					if i := findElement(existingMap.Elements, element.Key); i != -1 {
 						existingMap.Elements = append(existingMap.Elements[:i], existingMap.Elements[i+1:]...)
-					} else {
-						return nil, notFoundError("no such element %q", strings.Join(element.Key, " . "))
+					} else if op.verb == deleteVerb {
+						return nil, nil, notFoundError("no such element %q", strings.Join(element.Key, " . "))
 					}
 				default:
-					return nil, fmt.Errorf("unhandled operation %q", op.verb)
+					return nil, nil, fmt.Errorf("unhandled operation %q", op.verb)
 				}
 			}
 		default:
-			return nil, fmt.Errorf("unhandled object type %T", op.obj)
+			return nil, nil, fmt.Errorf("unhandled object type %T", op.obj)
 		}
 	}
 
-	return updatedTable, nil
+	return updatedTable, echo, nil
+}
+
+func hasSetFlag(flags []SetFlag, flag SetFlag) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
 }
 
 func checkExists(verb verb, objectType, name string, exists bool) error {
 	switch verb {
-	case addVerb:
+	case addVerb, destroyVerb:
 		// It's fine if the object either exists or doesn't
 		return nil
 	case createVerb:
 		if exists {
-			return existsError("%s %q already exists", objectType, name)
+			return &AlreadyExistsError{ObjectType: objectType, ObjectName: name}
 		}
 	default:
 		if !exists {
@@ -427,7 +1409,11 @@ func checkRuleRefs(rule *Rule, table *FakeTable) error {
 	for i, word := range words {
 		if strings.HasPrefix(word, "@") {
 			name := word[1:]
-			if i > 0 && (words[i] == "map" || words[i] == "vmap") {
+			if i > 1 && words[i-2] == "flow" && (words[i-1] == "add" || words[i-1] == "offload") {
+				if table.Flowtables[name] == nil {
+					return notFoundError("no such flowtable %q", name)
+				}
+			} else if i > 0 && (words[i] == "map" || words[i] == "vmap") {
 				if table.Maps[name] == nil {
 					return notFoundError("no such map %q", name)
 				}
@@ -437,6 +1423,42 @@ func checkRuleRefs(rule *Rule, table *FakeTable) error {
 					return notFoundError("no such set %q", name)
 				}
 			}
+		} else if word == "name" && i > 0 && words[i-1] == "counter" && i < len(words)-1 {
+			name := strings.Trim(words[i+1], `"`)
+			if table.Counters[name] == nil {
+				return notFoundError("no such counter %q", name)
+			}
+		} else if word == "name" && i > 0 && words[i-1] == "quota" && i < len(words)-1 {
+			name := strings.Trim(words[i+1], `"`)
+			if table.Quotas[name] == nil {
+				return notFoundError("no such quota %q", name)
+			}
+		} else if word == "name" && i > 0 && words[i-1] == "limit" && i < len(words)-1 {
+			name := strings.Trim(words[i+1], `"`)
+			if table.Limits[name] == nil {
+				return notFoundError("no such limit %q", name)
+			}
+		} else if word == "set" && i > 1 && words[i-2] == "meta" && words[i-1] == "secmark" && i < len(words)-1 {
+			name := strings.Trim(words[i+1], `"`)
+			if table.Secmarks[name] == nil {
+				return notFoundError("no such secmark %q", name)
+			}
+		} else if word == "set" && i > 1 && words[i-2] == "ct" && i < len(words)-1 {
+			name := strings.Trim(words[i+1], `"`)
+			switch words[i-1] {
+			case "helper":
+				if table.CTHelpers[name] == nil {
+					return notFoundError("no such ct helper %q", name)
+				}
+			case "timeout":
+				if table.CTTimeouts[name] == nil {
+					return notFoundError("no such ct timeout %q", name)
+				}
+			case "expectation":
+				if table.CTExpectations[name] == nil {
+					return notFoundError("no such ct expectation %q", name)
+				}
+			}
 		} else if (word == "goto" || word == "jump") && i < len(words)-1 {
 			name := words[i+1]
 			if table.Chains[name] == nil {
@@ -464,6 +1486,9 @@ func checkElementRefs(element *Element, table *FakeTable) error {
 
 // Dump dumps the current contents of fake, in a way that looks like an nft transaction.
 func (fake *Fake) Dump() string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
 	if fake.Table == nil {
 		return ""
 	}
@@ -474,6 +1499,14 @@ func (fake *Fake) Dump() string {
 	chains := sortKeys(table.Chains)
 	sets := sortKeys(table.Sets)
 	maps := sortKeys(table.Maps)
+	flowtables := sortKeys(table.Flowtables)
+	counters := sortKeys(table.Counters)
+	quotas := sortKeys(table.Quotas)
+	limits := sortKeys(table.Limits)
+	ctHelpers := sortKeys(table.CTHelpers)
+	ctTimeouts := sortKeys(table.CTTimeouts)
+	ctExpectations := sortKeys(table.CTExpectations)
+	secmarks := sortKeys(table.Secmarks)
 
 	// Write out all of the object adds first.
 
@@ -490,6 +1523,38 @@ func (fake *Fake) Dump() string {
 		m := table.Maps[mname]
 		m.writeOperation(addVerb, &fake.nftContext, buf)
 	}
+	for _, ftname := range flowtables {
+		ft := table.Flowtables[ftname]
+		ft.writeOperation(addVerb, &fake.nftContext, buf)
+	}
+	for _, cname := range counters {
+		c := table.Counters[cname]
+		c.writeOperation(addVerb, &fake.nftContext, buf)
+	}
+	for _, qname := range quotas {
+		q := table.Quotas[qname]
+		q.writeOperation(addVerb, &fake.nftContext, buf)
+	}
+	for _, lname := range limits {
+		l := table.Limits[lname]
+		l.writeOperation(addVerb, &fake.nftContext, buf)
+	}
+	for _, hname := range ctHelpers {
+		h := table.CTHelpers[hname]
+		h.writeOperation(addVerb, &fake.nftContext, buf)
+	}
+	for _, tname := range ctTimeouts {
+		t := table.CTTimeouts[tname]
+		t.writeOperation(addVerb, &fake.nftContext, buf)
+	}
+	for _, ename := range ctExpectations {
+		e := table.CTExpectations[ename]
+		e.writeOperation(addVerb, &fake.nftContext, buf)
+	}
+	for _, sname := range secmarks {
+		s := table.Secmarks[sname]
+		s.writeOperation(addVerb, &fake.nftContext, buf)
+	}
 
 	// Now write their contents.
 
@@ -528,6 +1593,16 @@ func sortKeys[K ~string, V any](m map[K]V) []K {
 	return keys
 }
 
+// sortedValues returns copies of the values of m, sorted by key
+func sortedValues[T any](m map[string]*T) []*T {
+	var values []*T
+	for _, key := range sortKeys(m) {
+		val := *m[key]
+		values = append(values, &val)
+	}
+	return values
+}
+
 func findRule(rules []*Rule, handle int) int {
 	for i := range rules {
 		if rules[i].Handle != nil && *rules[i].Handle == handle {
@@ -554,10 +1629,18 @@ func (table *FakeTable) copy() *FakeTable {
 	}
 
 	tcopy := &FakeTable{
-		Table:  table.Table,
-		Chains: make(map[string]*FakeChain),
-		Sets:   make(map[string]*FakeSet),
-		Maps:   make(map[string]*FakeMap),
+		Table:          table.Table,
+		Chains:         make(map[string]*FakeChain),
+		Sets:           make(map[string]*FakeSet),
+		Maps:           make(map[string]*FakeMap),
+		Flowtables:     make(map[string]*Flowtable),
+		Counters:       make(map[string]*Counter),
+		Quotas:         make(map[string]*Quota),
+		Limits:         make(map[string]*Limit),
+		CTHelpers:      make(map[string]*CTHelper),
+		CTTimeouts:     make(map[string]*CTTimeout),
+		CTExpectations: make(map[string]*CTExpectation),
+		Secmarks:       make(map[string]*Secmark),
 	}
 	for name, chain := range table.Chains {
 		tcopy.Chains[name] = &FakeChain{
@@ -577,6 +1660,30 @@ func (table *FakeTable) copy() *FakeTable {
 			Elements: append([]*Element{}, mapObj.Elements...),
 		}
 	}
+	for name, flowtable := range table.Flowtables {
+		tcopy.Flowtables[name] = flowtable
+	}
+	for name, counter := range table.Counters {
+		tcopy.Counters[name] = counter
+	}
+	for name, quota := range table.Quotas {
+		tcopy.Quotas[name] = quota
+	}
+	for name, limit := range table.Limits {
+		tcopy.Limits[name] = limit
+	}
+	for name, helper := range table.CTHelpers {
+		tcopy.CTHelpers[name] = helper
+	}
+	for name, timeout := range table.CTTimeouts {
+		tcopy.CTTimeouts[name] = timeout
+	}
+	for name, expect := range table.CTExpectations {
+		tcopy.CTExpectations[name] = expect
+	}
+	for name, secmark := range table.Secmarks {
+		tcopy.Secmarks[name] = secmark
+	}
 
 	return tcopy
 }
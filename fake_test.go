@@ -22,9 +22,12 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/lithammer/dedent"
 )
 
@@ -99,8 +102,7 @@ func TestFakeRun(t *testing.T) {
 		add rule ip kube-proxy anotherchain ip saddr 1.2.3.4 drop comment "drop rule"
 		add rule ip kube-proxy anotherchain ip daddr 5.6.7.8 reject comment "reject rule"
 		add map ip kube-proxy map1 { type ipv4_addr . inet_proto . inet_service : verdict ; }
-		add element ip kube-proxy map1 { 192.168.0.1 . tcp . 80 : goto chain }
-		add element ip kube-proxy map1 { 192.168.0.2 . tcp . 443 comment "with a comment" : goto anotherchain }
+		add element ip kube-proxy map1 { 192.168.0.1 . tcp . 80 : goto chain, 192.168.0.2 . tcp . 443 comment "with a comment" : goto anotherchain }
 		add element ip kube-proxy map1 { 192.168.0.1 . tcp . 80 : drop }
 		`), "\n")
 	diff := cmp.Diff(expected, tx.String())
@@ -196,6 +198,49 @@ func TestFakeRun(t *testing.T) {
 		t.Errorf("unexpected result from List(chains): %v", chains)
 	}
 
+	chainObjs, err := fake.ListChains(context.Background())
+	if err != nil {
+		t.Errorf("unexpected error listing chains: %v", err)
+	}
+	if len(chainObjs) != 2 || chainObjs[0].Name != "anotherchain" || chainObjs[1].Name != "chain" {
+		t.Errorf("unexpected result from ListChains: %+v", chainObjs)
+	} else if chainObjs[1].Comment == nil || *chainObjs[1].Comment != "foo" || chainObjs[1].Handle == nil {
+		t.Errorf("unexpected chain from ListChains: %+v", chainObjs[1])
+	}
+
+	mapObjs, err := fake.ListMaps(context.Background())
+	if err != nil {
+		t.Errorf("unexpected error listing maps: %v", err)
+	}
+	if len(mapObjs) != 1 || mapObjs[0].Name != "map1" || mapObjs[0].Type != "ipv4_addr . inet_proto . inet_service : verdict" {
+		t.Errorf("unexpected result from ListMaps: %+v", mapObjs)
+	}
+
+	setObjs, err := fake.ListSets(context.Background())
+	if err != nil {
+		t.Errorf("unexpected error listing sets: %v", err)
+	}
+	if len(setObjs) != 0 {
+		t.Errorf("unexpected result from ListSets: %+v", setObjs)
+	}
+
+	chainObj, err := fake.GetChain(context.Background(), "chain")
+	if err != nil {
+		t.Errorf("unexpected error getting chain: %v", err)
+	} else if chainObj.Name != "chain" || chainObj.Comment == nil || *chainObj.Comment != "foo" {
+		t.Errorf("unexpected result from GetChain: %+v", chainObj)
+	}
+	mapObj, err := fake.GetMap(context.Background(), "map1")
+	if err != nil {
+		t.Errorf("unexpected error getting map: %v", err)
+	} else if mapObj.Name != "map1" {
+		t.Errorf("unexpected result from GetMap: %+v", mapObj)
+	}
+	_, err = fake.GetSet(context.Background(), "map1")
+	if err == nil || !IsNotFound(err) {
+		t.Errorf("expected not found error from GetSet but got: %v", err)
+	}
+
 	tx = fake.NewTransaction()
 	tx.Delete(ruleToDelete)
 	expected = fmt.Sprintf("delete rule ip kube-proxy chain handle %d\n", *ruleToDelete.Handle)
@@ -558,3 +603,1619 @@ func TestFakeAddInsertReplace(t *testing.T) {
 
 	assertRules(t, fake, "thirteenth", "sixth", "twelfth", "fifth", "seventh", "ninth", "eighth", "fourth", "third", "eleventh", "tenth")
 }
+
+func TestFakeFlush(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip daddr 10.0.0.0/8 drop",
+	})
+	tx.Add(&Set{
+		Name: "set1",
+		Type: "ipv4_addr",
+	})
+	tx.Add(&Element{
+		Set: "set1",
+		Key: []string{"192.168.0.1"},
+	})
+	tx.Add(&Map{
+		Name: "map1",
+		Type: "ipv4_addr : verdict",
+	})
+	tx.Add(&Element{
+		Map:   "map1",
+		Key:   []string{"192.168.0.1"},
+		Value: []string{"goto chain"},
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	// Flush everything and re-add one element, in a single transaction
+	tx = fake.NewTransaction()
+	tx.Flush(&Chain{
+		Name: "chain",
+	})
+	tx.Flush(&Set{
+		Name: "set1",
+	})
+	tx.Flush(&Map{
+		Name: "map1",
+	})
+	tx.Add(&Element{
+		Set: "set1",
+		Key: []string{"192.168.0.2"},
+	})
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		flush chain ip kube-proxy chain
+		flush set ip kube-proxy set1
+		flush map ip kube-proxy map1
+		add element ip kube-proxy set1 { 192.168.0.2 }
+		`), "\n")
+	diff := cmp.Diff(expected, tx.String())
+	if diff != "" {
+		t.Errorf("unexpected transaction content:\n%s", diff)
+	}
+
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected = strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add set ip kube-proxy set1 { type ipv4_addr ; }
+		add map ip kube-proxy map1 { type ipv4_addr : verdict ; }
+		add element ip kube-proxy set1 { 192.168.0.2 }
+		`), "\n")
+	diff = cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	// Flushing a non-existent set should fail
+	tx = fake.NewTransaction()
+	tx.Flush(&Set{
+		Name: "set2",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeFlowtables(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&Flowtable{
+		Name:     "ft",
+		Priority: PtrTo(FilterIngressPriority),
+		Devices:  []string{"eth0"},
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip protocol tcp flow add @ft",
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add flowtable ip kube-proxy ft { hook ingress priority 0 ; devices = { eth0 } ; }
+		add rule ip kube-proxy chain ip protocol tcp flow add @ft
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	flowtables, err := fake.ListFlowtables(context.Background())
+	if err != nil {
+		t.Errorf("unexpected error listing flowtables: %v", err)
+	}
+	if len(flowtables) != 1 || flowtables[0].Name != "ft" || flowtables[0].Handle == nil {
+		t.Errorf("unexpected result from ListFlowtables: %+v", flowtables)
+	}
+
+	// Can't refer to a non-existent flowtable
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip protocol udp flow add @missing",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	tx = fake.NewTransaction()
+	tx.Delete(&Flowtable{
+		Name: "ft",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+	if len(fake.Table.Flowtables) != 0 {
+		t.Errorf("flowtable was not deleted: %+v", fake.Table.Flowtables)
+	}
+}
+
+func TestFakeCounters(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&Counter{
+		Name:    "mycounter",
+		Comment: PtrTo("foo"),
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip daddr 10.0.0.0/8 counter name mycounter drop",
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add counter ip kube-proxy mycounter { packets 0 bytes 0 ; comment "foo" ; }
+		add rule ip kube-proxy chain ip daddr 10.0.0.0/8 counter name mycounter drop
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	counter, err := fake.GetCounter(context.Background(), "mycounter")
+	if err != nil {
+		t.Fatalf("unexpected error from GetCounter: %v", err)
+	}
+	if counter.Packets == nil || *counter.Packets != 0 || counter.Handle == nil {
+		t.Errorf("unexpected result from GetCounter: %+v", counter)
+	}
+
+	// Can't refer to a non-existent counter
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "counter name othercounter drop",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	tx = fake.NewTransaction()
+	tx.Flush(&Chain{
+		Name: "chain",
+	})
+	tx.Delete(&Counter{
+		Name: "mycounter",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+	counters, err := fake.ListCounters(context.Background())
+	if err != nil || len(counters) != 0 {
+		t.Errorf("unexpected result from ListCounters: %+v, %v", counters, err)
+	}
+}
+
+func TestFakeQuotas(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&Quota{
+		Name:  "myquota",
+		Bytes: 1000000,
+		Over:  true,
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "quota name myquota drop",
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add quota ip kube-proxy myquota { over 1000000 bytes used 0 bytes ; }
+		add rule ip kube-proxy chain quota name myquota drop
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	quotas, err := fake.ListQuotas(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error from ListQuotas: %v", err)
+	}
+	if len(quotas) != 1 || quotas[0].Name != "myquota" || quotas[0].Handle == nil {
+		t.Errorf("unexpected result from ListQuotas: %+v", quotas)
+	}
+
+	// Can't refer to a non-existent quota
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "quota name otherquota drop",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeLimits(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&Limit{
+		Name: "mylimit",
+		Rate: 10,
+		Per:  "second",
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "limit name mylimit accept",
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add limit ip kube-proxy mylimit { rate 10/second ; }
+		add rule ip kube-proxy chain limit name mylimit accept
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	limits, err := fake.ListLimits(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error from ListLimits: %v", err)
+	}
+	if len(limits) != 1 || limits[0].Name != "mylimit" || limits[0].Handle == nil {
+		t.Errorf("unexpected result from ListLimits: %+v", limits)
+	}
+
+	// Can't refer to a non-existent limit
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "limit name otherlimit accept",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeCTHelpers(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&CTHelper{
+		Name:     "ftp-standard",
+		Type:     "ftp",
+		Protocol: "tcp",
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `tcp dport 21 ct helper set "ftp-standard"`,
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add ct helper ip kube-proxy ftp-standard { type "ftp" protocol tcp ; }
+		add rule ip kube-proxy chain tcp dport 21 ct helper set "ftp-standard"
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	// Can't refer to a non-existent helper
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `udp dport 5060 ct helper set "sip-5060"`,
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeCTTimeouts(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&CTTimeout{
+		Name:     "tcp-long",
+		Protocol: "tcp",
+		Policy:   map[string]uint32{"established": 7200},
+	})
+	tx.Add(&CTTimeout{
+		Name:     "udp-short",
+		Protocol: "udp",
+		Policy:   map[string]uint32{"unreplied": 5, "replied": 10},
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `tcp dport 22 ct timeout set "tcp-long"`,
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add ct timeout ip kube-proxy tcp-long { protocol tcp ; policy = { established : 7200 } ; }
+		add ct timeout ip kube-proxy udp-short { protocol udp ; policy = { replied : 10, unreplied : 5 } ; }
+		add rule ip kube-proxy chain tcp dport 22 ct timeout set "tcp-long"
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	timeouts, err := fake.ListCTTimeouts(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error from ListCTTimeouts: %v", err)
+	}
+	if len(timeouts) != 2 || timeouts[0].Name != "tcp-long" || timeouts[1].Name != "udp-short" {
+		t.Errorf("unexpected ListCTTimeouts result: %+v", timeouts)
+	}
+
+	// Can't refer to a non-existent timeout
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `udp dport 53 ct timeout set "udp-long"`,
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeCTExpectations(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&CTExpectation{
+		Name:     "ftp-data",
+		Protocol: "tcp",
+		DPort:    20,
+		Timeout:  30 * time.Second,
+		Size:     8,
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `tcp dport 21 ct state new ct expectation set "ftp-data"`,
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add ct expectation ip kube-proxy ftp-data { protocol tcp ; dport 20 ; timeout 30000ms ; size 8 ; }
+		add rule ip kube-proxy chain tcp dport 21 ct state new ct expectation set "ftp-data"
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	expectations, err := fake.ListCTExpectations(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error from ListCTExpectations: %v", err)
+	}
+	if len(expectations) != 1 || expectations[0].Name != "ftp-data" {
+		t.Errorf("unexpected ListCTExpectations result: %+v", expectations)
+	}
+
+	// Can't refer to a non-existent expectation
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `udp dport 5060 ct expectation set "sip-rtp"`,
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeSecmarks(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&Secmark{
+		Name:    "sshtag",
+		Context: "system_u:object_r:ssh_server_packet_t:s0",
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `tcp dport 22 meta secmark set "sshtag"`,
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add secmark ip kube-proxy sshtag { "system_u:object_r:ssh_server_packet_t:s0" ; }
+		add rule ip kube-proxy chain tcp dport 22 meta secmark set "sshtag"
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	// Can't refer to a non-existent secmark
+	tx = fake.NewTransaction()
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  `tcp dport 80 meta secmark set "httptag"`,
+	})
+	err = fake.Run(context.Background(), tx)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeDestroy(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "drop",
+	})
+	tx.Add(&Set{
+		Name: "set",
+		Type: "ipv4_addr",
+	})
+	tx.Add(&Element{
+		Set: "set",
+		Key: []string{"10.0.0.1"},
+	})
+	tx.Add(&Counter{
+		Name: "counter",
+	})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+	rules, err := fake.ListRules(context.Background(), "chain")
+	if err != nil {
+		t.Fatalf("unexpected error from ListRules: %v", err)
+	}
+
+	// Destroying existing objects deletes them
+	tx = fake.NewTransaction()
+	tx.Destroy(&Rule{
+		Chain:  "chain",
+		Handle: rules[0].Handle,
+	})
+	tx.Destroy(&Element{
+		Set: "set",
+		Key: []string{"10.0.0.1"},
+	})
+	tx.Destroy(&Counter{
+		Name: "counter",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add set ip kube-proxy set { type ipv4_addr ; }
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	// Destroying non-existent objects is not an error
+	tx = fake.NewTransaction()
+	tx.Destroy(&Rule{
+		Chain:  "chain",
+		Handle: rules[0].Handle,
+	})
+	tx.Destroy(&Element{
+		Set: "set",
+		Key: []string{"10.0.0.1"},
+	})
+	tx.Destroy(&Counter{
+		Name: "counter",
+	})
+	tx.Destroy(&Map{
+		Name: "map",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+	diff = cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	// (But Delete still is.)
+	tx = fake.NewTransaction()
+	tx.Delete(&Counter{
+		Name: "counter",
+	})
+	err = fake.Run(context.Background(), tx)
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+
+	// Destroying the table removes everything
+	tx = fake.NewTransaction()
+	tx.Destroy(&Table{})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+	if fake.Table != nil {
+		t.Errorf("expected table to be destroyed")
+	}
+	tx = fake.NewTransaction()
+	tx.Destroy(&Table{})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestFakeForeignTransaction(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	other, err := NewTransactionFromScript("add table inet other\nadd chain inet other foo\n")
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %v", err)
+	}
+	if err := fake.Run(ctx, other); err == nil || !strings.Contains(err.Error(), "cannot be run against table ip kube-proxy") {
+		t.Errorf("expected error from Run, got %v", err)
+	}
+	if err := fake.Check(ctx, other); err == nil {
+		t.Errorf("expected error from Check")
+	}
+	if _, err := fake.RunWithEcho(ctx, other); err == nil {
+		t.Errorf("expected error from RunWithEcho")
+	}
+	if err := fake.RunAndVerify(ctx, other); err == nil {
+		t.Errorf("expected error from RunAndVerify")
+	}
+	if err := fake.RunFromFile(ctx, other, ""); err == nil {
+		t.Errorf("expected error from RunFromFile")
+	}
+	if fake.Table != nil {
+		t.Errorf("transaction for another table should not have been applied:\n%s", fake.Dump())
+	}
+
+	// A transaction for the same table is applied, and recorded as run by the Fake
+	tx, err := NewTransactionFromScript("add table ip kube-proxy\nadd chain ip kube-proxy foo\n")
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %v", err)
+	}
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.Table == nil || fake.Table.Chains["foo"] == nil {
+		t.Errorf("transaction was not applied:\n%s", fake.Dump())
+	}
+	recorded := fake.Transactions[len(fake.Transactions)-1]
+	if recorded.nftContext != &fake.nftContext {
+		t.Errorf("expected recorded transaction to use the Fake's context")
+	}
+}
+
+func TestFakeRunFromFile(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	if err := fake.RunFromFile(context.Background(), tx, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.Table == nil || fake.Table.Chains["chain"] == nil {
+		t.Errorf("transaction was not applied:\n%s", fake.Dump())
+	}
+	if len(fake.Transactions) != 1 || fake.Transactions[0].String() != tx.String() {
+		t.Errorf("transaction was not recorded")
+	}
+}
+
+func TestFakeRunAll(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx1 := fake.NewTransaction()
+	tx1.Add(&Table{})
+	tx1.Add(&Chain{
+		Name: "chain",
+	})
+	tx2 := fake.NewTransaction()
+	tx2.Add(&Rule{
+		Chain: "chain",
+		Rule:  "drop",
+	})
+	err := fake.RunAll(context.Background(), tx1, tx2)
+	if err != nil {
+		t.Fatalf("unexpected error from RunAll: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add rule ip kube-proxy chain drop
+		`), "\n")
+	diff := cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+
+	// If one transaction fails, none of them are applied
+	tx1 = fake.NewTransaction()
+	tx1.Add(&Chain{
+		Name: "chain2",
+	})
+	tx2 = fake.NewTransaction()
+	tx2.Add(&Rule{
+		Chain: "nosuchchain",
+		Rule:  "drop",
+	})
+	err = fake.RunAll(context.Background(), tx1, tx2)
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFound error from RunAll, got %v", err)
+	}
+	diff = cmp.Diff(expected, fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected Dump content:\n%s", diff)
+	}
+}
+
+func TestFakeExportRuleset(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	_, err := fake.ExportRuleset(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "b",
+	})
+	tx.Add(&Chain{
+		Name: "a",
+	})
+	tx.Add(&Rule{
+		Chain: "a",
+		Rule:  "jump b",
+	})
+	tx.Add(&Set{
+		Name: "ips",
+		Type: "ipv4_addr",
+	})
+	tx.Add(&Rule{
+		Chain: "b",
+		Rule:  "ip saddr @ips drop",
+	})
+	tx.Add(&Element{
+		Set: "ips",
+		Key: []string{"10.0.0.1"},
+	})
+	tx.Add(&Counter{
+		Name: "counter",
+	})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error from Run: %v", err)
+	}
+
+	rs, err := fake.ExportRuleset(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error from ExportRuleset: %v", err)
+	}
+	if len(rs.Tables) != 1 {
+		t.Fatalf("expected 1 table, got %d", len(rs.Tables))
+	}
+	table := rs.Tables[0]
+	if table.Family != IPv4Family || table.Name != "kube-proxy" {
+		t.Errorf("unexpected table %s %s", table.Family, table.Name)
+	}
+	var chainNames, rules []string
+	for _, chain := range table.Chains {
+		chainNames = append(chainNames, chain.Name)
+	}
+	for _, rule := range table.Rules {
+		rules = append(rules, rule.Chain+": "+rule.Rule)
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, chainNames); diff != "" {
+		t.Errorf("unexpected chains:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a: jump b", "b: ip saddr @ips drop"}, rules); diff != "" {
+		t.Errorf("unexpected rules:\n%s", diff)
+	}
+	if len(table.Sets) != 1 || len(table.Elements) != 1 || len(table.Counters) != 1 {
+		t.Errorf("unexpected sets/elements/counters: %v / %v / %v", table.Sets, table.Elements, table.Counters)
+	}
+}
+
+func TestFakeRunAndVerify(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Add(&Set{Name: "set", Type: "ipv4_addr"})
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.2"}})
+	tx.Add(&Counter{Name: "counter"})
+	tx.Add(&Chain{Name: "temp"})
+	tx.Delete(&Chain{Name: "temp"})
+	tx.Delete(&Element{Set: "set", Key: []string{"10.0.0.2"}})
+	err := fake.RunAndVerify(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Flushing a set means its earlier elements are not expected
+	tx = fake.NewTransaction()
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.3"}})
+	tx.Flush(&Set{Name: "set"})
+	err = fake.RunAndVerify(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Deleting the table means nothing is expected
+	tx = fake.NewTransaction()
+	tx.Add(&Chain{Name: "chain2"})
+	tx.Delete(&Table{})
+	err = fake.RunAndVerify(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Transaction errors are returned as with Run
+	tx = fake.NewTransaction()
+	tx.Add(&Chain{Name: "chain"})
+	err = fake.RunAndVerify(context.Background(), tx)
+	if !IsNotFound(err) {
+		t.Fatalf("expected NotFoundError, got %v", err)
+	}
+}
+
+func TestFakeRunWithEcho(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Add(&Set{Name: "set", Type: "ipv4_addr"})
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.1"}})
+	tx.Add(&Rule{Chain: "chain", Rule: "drop"})
+	objects, err := fake.RunWithEcho(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Object{
+		&Table{Handle: PtrTo(1)},
+		&Chain{Name: "chain", Handle: PtrTo(2)},
+		&Set{Name: "set", Type: "ipv4_addr", Handle: PtrTo(3)},
+		&Element{Set: "set", Key: []string{"10.0.0.1"}},
+		&Rule{Chain: "chain", Rule: "drop", Handle: PtrTo(5)},
+	}
+	if diff := cmp.Diff(expected, objects); diff != "" {
+		t.Errorf("unexpected objects:\n%s", diff)
+	}
+
+	// The returned handles can be used to refer to the objects later
+	tx = fake.NewTransaction()
+	tx.Replace(&Rule{Chain: "chain", Rule: "accept", Handle: objects[4].(*Rule).Handle})
+	objects, err = fake.RunWithEcho(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = []Object{
+		&Rule{Chain: "chain", Rule: "accept", Handle: PtrTo(5)},
+	}
+	if diff := cmp.Diff(expected, objects); diff != "" {
+		t.Errorf("unexpected objects:\n%s", diff)
+	}
+	if rules := fake.Table.Chains["chain"].Rules; len(rules) != 1 || rules[0].Rule != "accept" {
+		t.Errorf("unexpected rules after replace: %+v", rules)
+	}
+
+	// Errors are returned as with Run, and the table is not modified
+	tx = fake.NewTransaction()
+	tx.Add(&Chain{Name: "chain2"})
+	tx.Add(&Rule{Chain: "nonexistent", Rule: "drop"})
+	_, err = fake.RunWithEcho(context.Background(), tx)
+	if !IsNotFound(err) {
+		t.Fatalf("expected NotFoundError, got %v", err)
+	}
+	if fake.Table.Chains["chain2"] != nil {
+		t.Errorf("table was modified by failed transaction")
+	}
+}
+
+func TestFakeDeleteElements(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Add(&Set{Name: "ips", Type: "ipv4_addr"})
+	tx.Add(&Set{Name: "endpoints", Type: "ipv4_addr . inet_proto . inet_service"})
+	tx.Add(&Set{Name: "ranges", Type: "ipv4_addr", Flags: []SetFlag{IntervalFlag}})
+	tx.Add(&Map{Name: "services", Type: "ipv4_addr . inet_proto . inet_service : verdict"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.2"}})
+	tx.Add(&Element{Set: "endpoints", Key: []string{"10.0.0.1", "tcp", "80"}})
+	tx.Add(&Element{Set: "endpoints", Key: []string{"10.0.0.1", "udp", "53"}})
+	tx.Add(&Element{Set: "ranges", Key: []string{"10.0.0.0/8"}})
+	tx.Add(&Element{Set: "ranges", Key: []string{"192.168.0.1-192.168.0.9"}})
+	tx.Add(&Element{Map: "services", Key: []string{"10.0.0.1", "tcp", "80"}, Value: []string{"goto chain"}})
+	tx.Add(&Element{Map: "services", Key: []string{"10.0.0.1", "udp", "53"}, Value: []string{"goto chain"}})
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tx = fake.NewTransaction()
+	tx.Delete(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	tx.Delete(&Element{Set: "endpoints", Key: []string{"10.0.0.1", "tcp", "80"}})
+	tx.Delete(&Element{Set: "ranges", Key: []string{"192.168.0.1-192.168.0.9"}})
+	tx.Delete(&Element{Map: "services", Key: []string{"10.0.0.1", "udp", "53"}})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add set ip kube-proxy endpoints { type ipv4_addr . inet_proto . inet_service ; }
+		add set ip kube-proxy ips { type ipv4_addr ; }
+		add set ip kube-proxy ranges { type ipv4_addr ; flags interval ; }
+		add map ip kube-proxy services { type ipv4_addr . inet_proto . inet_service : verdict ; }
+		add element ip kube-proxy endpoints { 10.0.0.1 . udp . 53 }
+		add element ip kube-proxy ips { 10.0.0.2 }
+		add element ip kube-proxy ranges { 10.0.0.0/8 }
+		add element ip kube-proxy services { 10.0.0.1 . tcp . 80 : goto chain }
+		`), "\n")
+	if diff := cmp.Diff(expected, fake.Dump()); diff != "" {
+		t.Errorf("unexpected ruleset:\n%s", diff)
+	}
+
+	// Deleting an element that isn't present is an error (but destroying it isn't)
+	tx = fake.NewTransaction()
+	tx.Delete(&Element{Set: "endpoints", Key: []string{"10.0.0.1", "tcp", "80"}})
+	err = fake.Run(context.Background(), tx)
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+	tx = fake.NewTransaction()
+	tx.Destroy(&Element{Set: "endpoints", Key: []string{"10.0.0.1", "tcp", "80"}})
+	err = fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFakeListState(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	_, err := fake.ListState(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Add(&Counter{Name: "counter", Packets: PtrTo[uint64](1), Bytes: PtrTo[uint64](100)})
+	tx.Add(&Quota{Name: "quota", Bytes: 1000})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rs, err := fake.ListState(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &Ruleset{
+		Tables: []*RulesetTable{{
+			Family:   IPv4Family,
+			Name:     "kube-proxy",
+			Table:    Table{Handle: PtrTo(1)},
+			Counters: []*Counter{{Name: "counter", Packets: PtrTo[uint64](1), Bytes: PtrTo[uint64](100), Handle: PtrTo(3)}},
+			Quotas:   []*Quota{{Name: "quota", Bytes: 1000, Used: PtrTo[uint64](0), Handle: PtrTo(4)}},
+		}},
+	}
+	if diff := cmp.Diff(expected, rs); diff != "" {
+		t.Errorf("unexpected state:\n%s", diff)
+	}
+}
+
+func TestFakeGetTable(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	_, err := fake.GetTable(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError for missing table, got %v", err)
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{Comment: PtrTo("rules for kube-proxy")})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	table, err := fake.GetTable(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(&Table{Comment: PtrTo("rules for kube-proxy"), Handle: PtrTo(1)}, table); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestFakeGetHandles(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	_, err := fake.GetTableHandle(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError for missing table, got %v", err)
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Add(&Set{Name: "set", Type: "ipv4_addr"})
+	tx.Add(&Map{Name: "map", Type: "ipv4_addr : verdict"})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		get    func() (int, error)
+		handle int
+	}{
+		{func() (int, error) { return fake.GetTableHandle(context.Background()) }, 1},
+		{func() (int, error) { return fake.GetChainHandle(context.Background(), "chain") }, 2},
+		{func() (int, error) { return fake.GetSetHandle(context.Background(), "set") }, 3},
+		{func() (int, error) { return fake.GetMapHandle(context.Background(), "map") }, 4},
+	} {
+		handle, err := tc.get()
+		if err != nil || handle != tc.handle {
+			t.Errorf("expected handle %d, got %d, %v", tc.handle, handle, err)
+		}
+	}
+
+	_, err = fake.GetChainHandle(context.Background(), "set")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError for missing chain, got %v", err)
+	}
+
+	expectedCalls := []string{"GetTableHandle", "GetTableHandle", "GetChainHandle chain", "GetSetHandle set", "GetMapHandle map", "GetChainHandle set"}
+	if diff := cmp.Diff(expectedCalls, fake.ListCalls); diff != "" {
+		t.Errorf("unexpected ListCalls:\n%s", diff)
+	}
+}
+
+func TestFakeRenameChain(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	err := fake.RenameChain(context.Background(), "services", "services-v2")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError for missing table, got %v", err)
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "input"})
+	tx.Add(&Chain{Name: "services"})
+	tx.Add(&Chain{Name: "firewall"})
+	tx.Add(&Chain{Name: "services-extra"})
+	tx.Add(&Map{Name: "ports", Type: "inet_service : verdict"})
+	tx.Add(&Rule{Chain: "input", Rule: "ip daddr 10.0.0.1 jump services"})
+	tx.Add(&Rule{Chain: "input", Rule: "tcp dport vmap { 80 : goto services }"})
+	tx.Add(&Rule{Chain: "services", Rule: "counter", Comment: PtrTo("count")})
+	tx.Add(&Rule{Chain: "firewall", Rule: "jump services-extra", Comment: PtrTo("not a reference")})
+	tx.Add(&Element{Map: "ports", Key: []string{"22"}, Value: []string{"goto services"}})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	handle := *fake.Table.Chains["services"].Handle
+
+	err = fake.RenameChain(context.Background(), "services", "firewall")
+	if !IsAlreadyExists(err) {
+		t.Errorf("expected AlreadyExistsError, got %v", err)
+	}
+	err = fake.RenameChain(context.Background(), "missing", "other")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+
+	err = fake.RenameChain(context.Background(), "services", "services-v2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.Table.Chains["services"] != nil {
+		t.Errorf("old chain still exists")
+	}
+	chain := fake.Table.Chains["services-v2"]
+	if chain == nil {
+		t.Fatalf("new chain does not exist")
+	}
+	if chain.Name != "services-v2" || *chain.Handle != handle {
+		t.Errorf("unexpected chain name/handle: %q/%d", chain.Name, *chain.Handle)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy firewall
+		add chain ip kube-proxy input
+		add chain ip kube-proxy services-extra
+		add chain ip kube-proxy services-v2
+		add map ip kube-proxy ports { type inet_service : verdict ; }
+		add rule ip kube-proxy firewall jump services-extra comment "not a reference"
+		add rule ip kube-proxy input ip daddr 10.0.0.1 jump services-v2
+		add rule ip kube-proxy input tcp dport vmap { 80 : goto services-v2 }
+		add rule ip kube-proxy services-v2 counter comment "count"
+		add element ip kube-proxy ports { 22 : goto services-v2 }
+		`), "\n")
+	if diff := cmp.Diff(expected, fake.Dump()); diff != "" {
+		t.Errorf("unexpected Dump output:\n%s", diff)
+	}
+}
+
+func TestRenameJumps(t *testing.T) {
+	for _, tc := range []struct {
+		rule     string
+		expected string
+		changed  bool
+	}{
+		{"jump old", "jump new", true},
+		{"ip daddr 10.0.0.1 goto old", "ip daddr 10.0.0.1 goto new", true},
+		{"tcp dport vmap { 80 : jump old, 443 : goto old }", "tcp dport vmap { 80 : jump new, 443 : goto new }", true},
+		{"jump older", "jump older", false},
+		{"counter comment old", "counter comment old", false},
+	} {
+		result, changed := renameJumps(tc.rule, "old", "new")
+		if result != tc.expected || changed != tc.changed {
+			t.Errorf("renameJumps(%q): expected %q/%v, got %q/%v", tc.rule, tc.expected, tc.changed, result, changed)
+		}
+	}
+}
+
+func TestFakeCopyChain(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "services"})
+	tx.Add(&Chain{Name: "existing"})
+	tx.Add(&Rule{Chain: "services", Rule: "ip daddr 10.0.0.1 drop"})
+	tx.Add(&Rule{Chain: "services", Rule: "counter", Comment: PtrTo("count")})
+	tx.Add(&Rule{Chain: "existing", Rule: "accept"})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := fake.CopyChain(context.Background(), "services", "copy"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.CopyChain(context.Background(), "services", "existing"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := fake.CopyChain(context.Background(), "missing", "copy")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy copy
+		add chain ip kube-proxy existing
+		add chain ip kube-proxy services
+		add rule ip kube-proxy copy ip daddr 10.0.0.1 drop
+		add rule ip kube-proxy copy counter comment "count"
+		add rule ip kube-proxy existing accept
+		add rule ip kube-proxy existing ip daddr 10.0.0.1 drop
+		add rule ip kube-proxy existing counter comment "count"
+		add rule ip kube-proxy services ip daddr 10.0.0.1 drop
+		add rule ip kube-proxy services counter comment "count"
+		`), "\n")
+	if diff := cmp.Diff(expected, fake.Dump()); diff != "" {
+		t.Errorf("unexpected Dump output:\n%s", diff)
+	}
+	if len(fake.Transactions) != 3 {
+		t.Errorf("expected 3 transactions, got %d", len(fake.Transactions))
+	}
+	if *fake.Table.Chains["copy"].Rules[0].Handle == *fake.Table.Chains["services"].Rules[0].Handle {
+		t.Errorf("rule handle was copied")
+	}
+}
+
+func TestFakeListAllRules(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	_, err := fake.ListAllRules(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError for missing table, got %v", err)
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain2"})
+	tx.Add(&Chain{Name: "chain1"})
+	tx.Add(&Rule{Chain: "chain2", Rule: "jump chain1"})
+	tx.Add(&Rule{Chain: "chain1", Rule: "accept"})
+	tx.Add(&Rule{Chain: "chain1", Rule: "drop", Comment: PtrTo("second")})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rules, err := fake.ListAllRules(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*Rule{
+		{Chain: "chain1", Rule: "accept", Handle: PtrTo(5)},
+		{Chain: "chain1", Rule: "drop", Comment: PtrTo("second"), Handle: PtrTo(6)},
+		{Chain: "chain2", Rule: "jump chain1", Handle: PtrTo(4)},
+	}
+	if diff := cmp.Diff(expected, rules); diff != "" {
+		t.Errorf("unexpected rules:\n%s", diff)
+	}
+}
+
+func TestFakeListAllElements(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "web"})
+	tx.Add(&Set{Name: "ips", Type: "ipv4_addr"})
+	tx.Add(&Map{Name: "ports", Type: "inet_service : verdict"})
+	tx.Add(&Element{Map: "ports", Key: []string{"80"}, Value: []string{"goto web"}})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	elements, err := fake.ListAllElements(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*Element{
+		{Set: "ips", Key: []string{"10.0.0.1"}},
+		{Map: "ports", Key: []string{"80"}, Value: []string{"goto web"}},
+	}
+	if diff := cmp.Diff(expected, elements); diff != "" {
+		t.Errorf("unexpected elements:\n%s", diff)
+	}
+}
+
+func TestFakeRecording(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	_, _ = fake.ListChains(ctx)
+
+	tx1 := fake.NewTransaction()
+	tx1.Add(&Table{})
+	tx1.Add(&Set{Name: "set", Type: "ipv4_addr"})
+	if err := fake.Run(ctx, tx1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, _ = fake.ListElements(ctx, "set", "set")
+	_, _ = fake.GetChain(ctx, "chain")
+
+	tx2 := fake.NewTransaction()
+	tx2.Add(&Rule{Chain: "chain", Rule: "drop"})
+	if err := fake.Run(ctx, tx2); err == nil {
+		t.Fatalf("unexpected success adding rule to non-existent chain")
+	}
+
+	tx3 := fake.NewTransaction()
+	tx3.Add(&Chain{Name: "chain"})
+	if err := fake.Check(ctx, tx3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.RunAndVerify(ctx, tx3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedCalls := []string{
+		"ListChains",
+		"ListElements set set",
+		"GetChain chain",
+	}
+	if diff := cmp.Diff(expectedCalls, fake.ListCalls); diff != "" {
+		t.Errorf("unexpected ListCalls:\n%s", diff)
+	}
+
+	if len(fake.Transactions) != 3 || fake.Transactions[0].String() != tx1.String() ||
+		fake.Transactions[1].String() != tx2.String() || fake.Transactions[2].String() != tx3.String() {
+		t.Errorf("unexpected Transactions: %v", fake.Transactions)
+	}
+}
+
+func TestFakePreload(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	if err := fake.AddChain(&Chain{Name: "chain"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.AddRule(&Rule{Chain: "chain", Rule: "ip daddr @set drop"}); err == nil {
+		t.Errorf("unexpected success adding rule referencing non-existent set")
+	}
+	if err := fake.AddSet(&Set{Name: "set", Type: "ipv4_addr"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.AddMap(&Map{Name: "map", Type: "ipv4_addr : verdict"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.AddRule(&Rule{Chain: "chain", Rule: "ip daddr @set drop"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.AddElement(&Element{Set: "set", Key: []string{"10.0.0.1"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fake.AddElement(&Element{Map: "map", Key: []string{"10.0.0.1"}, Value: []string{"goto chain"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	chains, err := fake.ListChains(ctx)
+	if err != nil || len(chains) != 1 || chains[0].Name != "chain" {
+		t.Errorf("unexpected ListChains result: %v, %v", chains, err)
+	}
+	rules, err := fake.ListRules(ctx, "chain")
+	if err != nil || len(rules) != 1 {
+		t.Errorf("unexpected ListRules result: %v, %v", rules, err)
+	}
+	elements, err := fake.ListElements(ctx, "map", "map")
+	if err != nil || len(elements) != 1 {
+		t.Errorf("unexpected ListElements result: %v, %v", elements, err)
+	}
+
+	if len(fake.Transactions) != 0 {
+		t.Errorf("expected no recorded transactions, got %d", len(fake.Transactions))
+	}
+}
+
+func TestFakeSetSize(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Set{Name: "set", Type: "ipv4_addr", Size: PtrTo[uint64](2)})
+	tx.Add(&Map{Name: "map", Type: "ipv4_addr : verdict", Size: PtrTo[uint64](1)})
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.2"}})
+	tx.Add(&Element{Map: "map", Key: []string{"10.0.0.1"}, Value: []string{"drop"}})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Re-adding an existing element is fine
+	tx = fake.NewTransaction()
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.2"}})
+	tx.Add(&Element{Map: "map", Key: []string{"10.0.0.1"}, Value: []string{"accept"}})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tx = fake.NewTransaction()
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.3"}})
+	if err := fake.Run(ctx, tx); err == nil || !strings.Contains(err.Error(), "is full") {
+		t.Errorf("expected set full error, got %v", err)
+	}
+
+	tx = fake.NewTransaction()
+	tx.Add(&Element{Map: "map", Key: []string{"10.0.0.2"}, Value: []string{"drop"}})
+	if err := fake.Run(ctx, tx); err == nil || !strings.Contains(err.Error(), "is full") {
+		t.Errorf("expected map full error, got %v", err)
+	}
+
+	// Deleting an element makes room for another
+	tx = fake.NewTransaction()
+	tx.Delete(&Element{Set: "set", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.3"}})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFakeConstantSet(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Set{Name: "set", Type: "ipv4_addr", Flags: []SetFlag{ConstantFlag, IntervalFlag}})
+	tx.Add(&Map{Name: "map", Type: "ipv4_addr : verdict", Flags: []SetFlag{ConstantFlag}})
+	tx.Add(&Element{Set: "set", Key: []string{"10.0.0.0/8"}})
+	tx.Add(&Element{Map: "map", Key: []string{"10.0.0.1"}, Value: []string{"drop"}})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		op   func(tx *Transaction)
+	}{
+		{
+			name: "add set element",
+			op:   func(tx *Transaction) { tx.Add(&Element{Set: "set", Key: []string{"192.168.0.0/16"}}) },
+		},
+		{
+			name: "delete set element",
+			op:   func(tx *Transaction) { tx.Delete(&Element{Set: "set", Key: []string{"10.0.0.0/8"}}) },
+		},
+		{
+			name: "flush set",
+			op:   func(tx *Transaction) { tx.Flush(&Set{Name: "set"}) },
+		},
+		{
+			name: "add map element",
+			op: func(tx *Transaction) {
+				tx.Add(&Element{Map: "map", Key: []string{"10.0.0.2"}, Value: []string{"drop"}})
+			},
+		},
+		{
+			name: "flush map",
+			op:   func(tx *Transaction) { tx.Flush(&Map{Name: "map"}) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := fake.NewTransaction()
+			tc.op(tx)
+			if err := fake.Run(ctx, tx); err == nil || !strings.Contains(err.Error(), "is constant") {
+				t.Errorf("expected constant error, got %v", err)
+			}
+		})
+	}
+
+	// Deleting and recreating the set is allowed
+	tx = fake.NewTransaction()
+	tx.Delete(&Set{Name: "set"})
+	tx.Add(&Set{Name: "set", Type: "ipv4_addr", Flags: []SetFlag{ConstantFlag, IntervalFlag}})
+	tx.Add(&Element{Set: "set", Key: []string{"192.168.0.0/16"}})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFakeCreateMap(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Create(&Map{
+		Name:    "map",
+		Type:    "ipv4_addr . inet_service : verdict",
+		Flags:   []SetFlag{TimeoutFlag},
+		Size:    PtrTo[uint64](100),
+		Timeout: PtrTo(time.Minute),
+		Comment: PtrTo("a map"),
+	})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add map ip kube-proxy map { type ipv4_addr . inet_service : verdict ; flags timeout ; timeout 60s ; size 100 ; comment "a map" ; }
+		`), "\n")
+	if diff := cmp.Diff(expected, fake.Dump()); diff != "" {
+		t.Errorf("unexpected Dump:\n%s", diff)
+	}
+
+	tx = fake.NewTransaction()
+	tx.Create(&Map{Name: "map", Type: "ipv4_addr : verdict"})
+	if err := fake.Run(ctx, tx); !IsAlreadyExists(err) {
+		t.Errorf("expected AlreadyExists error, got %v", err)
+	}
+}
+
+func TestFakeTableComment(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{Comment: PtrTo("rules for kube-proxy")})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "add table ip kube-proxy { comment \"rules for kube-proxy\" ; }\n"
+	if diff := cmp.Diff(expected, fake.Dump()); diff != "" {
+		t.Errorf("unexpected Dump:\n%s", diff)
+	}
+
+	rs, err := fake.ExportRuleset(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	comment := rs.Tables[0].Table.Comment
+	if comment == nil || *comment != "rules for kube-proxy" {
+		t.Errorf("unexpected table comment %v", comment)
+	}
+}
+
+func TestFakeElementExpiresAt(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	if err := fake.AddSet(&Set{Name: "ips", Type: "ipv4_addr", Flags: []SetFlag{TimeoutFlag}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tx := fake.NewTransaction()
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.2"}, Timeout: 5 * time.Minute})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	elements, err := fake.ListElements(context.Background(), "set", "ips")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*Element{
+		{Set: "ips", Key: []string{"10.0.0.1"}},
+		{Set: "ips", Key: []string{"10.0.0.2"}, Timeout: 5 * time.Minute, ExpiresAt: time.Now().Add(5 * time.Minute)},
+	}
+	if diff := cmp.Diff(expected, elements, cmpopts.EquateApproxTime(time.Minute)); diff != "" {
+		t.Errorf("unexpected elements:\n%s", diff)
+	}
+}
+
+func TestFakeConcurrentAccess(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx := context.Background()
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Add(&Set{Name: "set", Type: "ipv4_addr"})
+	if err := fake.Run(ctx, tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// This is mostly useful when run with "go test -race"
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			tx := fake.NewTransaction()
+			tx.Add(&Rule{Chain: "chain", Rule: fmt.Sprintf("ip saddr 10.0.0.%d drop", i)})
+			tx.Add(&Element{Set: "set", Key: []string{fmt.Sprintf("10.0.0.%d", i)}})
+			if err := fake.Run(ctx, tx); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if _, err := fake.List(ctx, "chains"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if _, err := fake.ListRules(ctx, "chain"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if _, err := fake.ListElements(ctx, "set", "set"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			_ = fake.Dump()
+		}(i)
+	}
+	wg.Wait()
+
+	rules, err := fake.ListRules(ctx, "chain")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 10 {
+		t.Errorf("expected 10 rules, got %d", len(rules))
+	}
+	elements, err := fake.ListElements(ctx, "set", "set")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(elements) != 10 {
+		t.Errorf("expected 10 elements, got %d", len(elements))
+	}
+	if len(fake.ListCalls) != 32 {
+		t.Errorf("expected 32 list calls, got %d", len(fake.ListCalls))
+	}
+}
@@ -0,0 +1,59 @@
+//go:build go1.21
+
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"time"
+)
+
+// WithLogger returns an Option that causes a debug-level message to be logged to logger
+// after each invocation of nft, including the command's arguments, its exit code (or -1
+// if it could not be run), and how long it took. (This option is only available when
+// building with Go 1.21 or later.)
+func WithLogger(logger *slog.Logger) Option {
+	return func(nft *realNFTables) {
+		nft.logCommand = func(ctx context.Context, args []string, err error, duration time.Duration) {
+			attrs := []slog.Attr{
+				slog.Any("args", args),
+				slog.Int("exitCode", exitCode(err)),
+				slog.Duration("duration", duration),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			logger.LogAttrs(ctx, slog.LevelDebug, "ran nft", attrs...)
+		}
+	}
+}
+
+// exitCode returns the exit code of a command that returned err
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	ee := &exec.ExitError{}
+	if errors.As(err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,107 @@
+//go:build go1.21
+
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWithLogger(t *testing.T) {
+	fexec := newFakeExec(t)
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--version"},
+			stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check", "add", "table", "ip", "testing",
+				"{", "comment", `"test"`, "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			},
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add table ip testing\n",
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "delete chain ip testing chain\n",
+			err:   mkExecError("Error: No such file or directory\n"),
+		},
+	)
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	nft, err := newInternal(IPv4Family, "testing", fexec, WithLogger(logger))
+	if err != nil {
+		t.Fatalf("unexpected error creating Interface: %v", err)
+	}
+	buf.Reset()
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	_ = nft.Run(context.Background(), tx)
+	tx = nft.NewTransaction()
+	tx.Delete(&Chain{Name: "chain"})
+	_ = nft.Run(context.Background(), tx)
+
+	type logEntry struct {
+		Level    string
+		Msg      string
+		Args     []string `json:"args"`
+		ExitCode int      `json:"exitCode"`
+		Error    string   `json:"error"`
+	}
+	var entries []logEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry logEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("could not parse log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	expected := []logEntry{
+		{Level: "DEBUG", Msg: "ran nft", Args: []string{"/nft", "-f", "-"}, ExitCode: 0},
+		{Level: "DEBUG", Msg: "ran nft", Args: []string{"/nft", "-f", "-"}, ExitCode: -1, Error: "Error: No such file or directory\n"},
+	}
+	if diff := cmp.Diff(expected, entries); diff != "" {
+		t.Errorf("unexpected log entries:\n%s", diff)
+	}
+}
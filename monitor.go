@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MonitorEvent is a change to the table, as reported by Interface.Monitor.
+type MonitorEvent struct {
+	// Type is the type of change, as output by "nft monitor": "add" or "delete".
+	Type string
+
+	// Object is the object that was changed: a *Table, *Chain, *Rule, *Set, *Map,
+	// *Element, etc. As with ListRules, a *Rule will not have its Rule field filled
+	// in. (For "delete" events, nft may only fill in enough fields to identify the
+	// object.)
+	Object Object
+}
+
+// Monitor is part of Interface
+func (nft *realNFTables) Monitor(ctx context.Context, events chan<- MonitorEvent) error {
+	defer close(events)
+
+	// We cancel monitorCtx (killing nft) if we can't parse its output.
+	monitorCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Note that we don't use runCommand, since commandTimeout and retries don't make
+	// sense for a command that runs until it is killed.
+	args := append(append([]string{}, nft.extraArgs...), "--json", "monitor")
+	cmd := nft.command(monitorCtx, args...)
+
+	var parseErr error
+	start := time.Now()
+	err := nft.exec.Stream(cmd, func(line string) {
+		if parseErr != nil {
+			return
+		}
+		var monitorEvents []MonitorEvent
+		monitorEvents, parseErr = nft.parseMonitorEvent(line)
+		if parseErr != nil {
+			cancel()
+			return
+		}
+		for _, event := range monitorEvents {
+			select {
+			case events <- event:
+			case <-monitorCtx.Done():
+				return
+			}
+		}
+	})
+	if nft.logCommand != nil {
+		nft.logCommand(ctx, cmd.Args, err, time.Since(start))
+	}
+
+	if parseErr != nil {
+		return fmt.Errorf("unable to parse JSON output: %w", parseErr)
+	} else if ctx.Err() != nil {
+		return nil
+	} else if err != nil {
+		return newRunError(cmd.Args, err)
+	}
+	return nil
+}
+
+// parseMonitorEvent parses a line of output from "nft --json monitor", returning the
+// events that apply to nft's table. The line will look something like:
+//
+//	{"add": {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}}
+//
+// (using the same format as "nft --echo --json" uses for each command).
+func (nft *realNFTables) parseMonitorEvent(line string) ([]MonitorEvent, error) {
+	jsonEvent := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &jsonEvent); err != nil {
+		return nil, fmt.Errorf("could not parse nft output: %w", err)
+	}
+
+	var events []MonitorEvent
+	for eventType, cmd := range jsonEvent {
+		// Ignore anything that isn't an object change (eg, "metainfo").
+		objContainer, ok := cmd.(map[string]interface{})
+		if !ok || (eventType != "add" && eventType != "delete") {
+			continue
+		}
+		for objectType, jsonObj := range objContainer {
+			obj, ok := jsonObj.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("unexpected JSON output from nft (bad %q object: %q)", objectType, jsonObj)
+			}
+			family, _ := jsonVal[string](obj, "family")
+			table, _ := jsonVal[string](obj, "table")
+			if objectType == "table" {
+				table, _ = jsonVal[string](obj, "name")
+			}
+			if family != string(nft.family) || table != nft.table {
+				continue
+			}
+
+			objects, err := parseJSONEchoObject(objectType, obj)
+			if err != nil {
+				return nil, err
+			}
+			for _, obj := range objects {
+				events = append(events, MonitorEvent{Type: eventType, Object: obj})
+			}
+		}
+	}
+	return events, nil
+}
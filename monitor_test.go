@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/lithammer/dedent"
+)
+
+func TestMonitor(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args: []string{"/nft", "--json", "monitor"},
+			stdout: strings.TrimPrefix(dedent.Dedent(`
+				{"add": {"table": {"family": "ip", "name": "kube-proxy", "handle": 1}}}
+				{"add": {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}}
+				{"add": {"chain": {"family": "ip", "table": "other", "name": "services", "handle": 3}}}
+				{"add": {"chain": {"family": "ip6", "table": "kube-proxy", "name": "services", "handle": 4}}}
+				{"add": {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 5, "comment": "hello", "expr": [{"drop": null}]}}}
+				{"add": {"element": {"family": "ip", "table": "kube-proxy", "name": "ips", "elem": {"set": ["10.0.0.1", "10.0.0.2"]}}}}
+				{"delete": {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 5}}}
+				`), "\n"),
+			err: mkExecError("Error: nft exited unexpectedly\n"),
+		},
+	)
+
+	events := make(chan MonitorEvent, 10)
+	err := nft.Monitor(context.Background(), events)
+	if err == nil || !strings.Contains(err.Error(), "exited unexpectedly") {
+		t.Errorf("expected error from nft exiting, got %v", err)
+	}
+
+	var received []MonitorEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	expected := []MonitorEvent{
+		{Type: "add", Object: &Table{Handle: PtrTo(1)}},
+		{Type: "add", Object: &Chain{Name: "services", Handle: PtrTo(2)}},
+		{Type: "add", Object: &Rule{Chain: "services", Handle: PtrTo(5), Comment: PtrTo("hello"), Exprs: rawExprs(`{"drop":null}`)}},
+		{Type: "add", Object: &Element{Set: "ips", Key: []string{"10.0.0.1"}}},
+		{Type: "add", Object: &Element{Set: "ips", Key: []string{"10.0.0.2"}}},
+		{Type: "delete", Object: &Rule{Chain: "services", Handle: PtrTo(5)}},
+	}
+	if diff := cmp.Diff(expected, received); diff != "" {
+		t.Errorf("unexpected events:\n%s", diff)
+	}
+}
+
+func TestMonitorCancel(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "monitor"},
+			stdout: `{"add": {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}}` + "\n",
+		},
+	)
+
+	// Nothing is reading from events, so Monitor must notice that ctx was cancelled
+	// rather than blocking forever.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	events := make(chan MonitorEvent)
+	if err := nft.Monitor(ctx, events); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := <-events; ok {
+		t.Errorf("expected events to be closed")
+	}
+}
+
+func TestMonitorBadOutput(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "monitor"},
+			stdout: "{\"add\": {\"chain\": \"bad\"}}\n",
+		},
+	)
+
+	events := make(chan MonitorEvent, 10)
+	err := nft.Monitor(context.Background(), events)
+	if err == nil || !strings.Contains(err.Error(), "unable to parse JSON output") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestFakeMonitor(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan MonitorEvent)
+	done := make(chan error)
+	go func() {
+		done <- fake.Monitor(ctx, events)
+	}()
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := <-events; ok {
+		t.Errorf("expected events to be closed")
+	}
+}
@@ -17,44 +17,291 @@ limitations under the License.
 package knftables
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Interface is an interface for running nftables commands against a given family and table.
+//
+// Implementations of Interface are safe for concurrent use by multiple goroutines. (Note
+// that this only means that calls will not race with each other in-process; the kernel
+// is still free to interleave the effects of concurrent calls, so callers that need a
+// consistent view of the table across multiple calls must do their own locking.) A
+// Transaction, on the other hand, should only be built from a single goroutine.
 type Interface interface {
 	// NewTransaction returns a new (empty) Transaction
 	NewTransaction() *Transaction
 
+	// NewTransactionWithContext returns a new (empty) Transaction associated with
+	// ctx. If ctx is cancelled while the Transaction is being built, then further
+	// operations will not be added and the Transaction will fail with ctx's error
+	// when it is run. If ctx is cancelled while the Transaction is being run (by
+	// Run or a similar method), then the run will be aborted, just as if the
+	// context passed to Run had been cancelled.
+	NewTransactionWithContext(ctx context.Context) *Transaction
+
 	// Run runs a Transaction and returns the result. The IsNotFound and
-	// IsAlreadyExists methods can be used to test the result.
+	// IsAlreadyExists methods can be used to test the result. If tx was not created
+	// by this Interface (eg, it came from NewTransactionFromScript), it must be for
+	// the same family and table, and it is written out using this Interface's
+	// optional features. (The same applies to the other methods that take a
+	// Transaction.)
 	Run(ctx context.Context, tx *Transaction) error
 
+	// RunAll runs multiple Transactions (which must all be for this Interface's family
+	// and table) as a single atomic nftables transaction, and returns the result. If
+	// any of the Transactions has a pending error or is for a different table, or if
+	// any operation fails, then none of the Transactions will be applied.
+	RunAll(ctx context.Context, txs ...*Transaction) error
+
+	// RunAndVerify runs a Transaction, as with Run, and then lists the table to
+	// confirm that the objects added by the Transaction are present, returning an
+	// error describing any that are missing. (Objects that are added and then later
+	// deleted or flushed by the same Transaction are not expected to be present.)
+	// Rules are not verified, since their contents cannot be listed. Elements are only
+	// verified if their Key consists of IP addresses and integers (which can be
+	// normalized to match nft's output) and they are not in an interval set or map
+	// (whose elements nft may merge or split).
+	RunAndVerify(ctx context.Context, tx *Transaction) error
+
+	// RunWithEcho runs a Transaction, as with Run, and returns the objects that were
+	// added, created, inserted, or replaced by it, as reported back by nft (including
+	// their newly-assigned Handles). As with ListRules, the Rule field of returned
+	// rules will not be filled in.
+	RunWithEcho(ctx context.Context, tx *Transaction) ([]Object, error)
+
+	// RunFromFile runs a Transaction, as with Run, but writes it to a temporary file in
+	// the directory dir (or in the default directory for temporary files, if dir is
+	// "") and passes that to nft with "--file", rather than piping it to nft's stdin.
+	// This may be more efficient for very large transactions. The file is removed
+	// after nft exits, whether or not it succeeds.
+	RunFromFile(ctx context.Context, tx *Transaction, dir string) error
+
+	// BulkAddElements adds elements with the given keys to the set setName. Rather
+	// than adding all of the elements in a single transaction, it adds them in
+	// batches (of DefaultBulkBatchSize elements, unless overridden with
+	// WithBulkBatchSize), each in its own transaction, stopping if ctx is cancelled.
+	// As a result, if an error occurs, some of the elements may have been added and
+	// others not.
+	BulkAddElements(ctx context.Context, setName string, keys [][]string) error
+
+	// BulkAddMapElements adds entries to the map mapName, in batches, in the same way
+	// that BulkAddElements adds elements to a set.
+	BulkAddMapElements(ctx context.Context, mapName string, entries []MapEntry) error
+
+	// ClearSet removes all of the elements from the set setName (with "nft flush
+	// set"). This can be combined with BulkAddElements to replace a set's contents,
+	// though the set will be briefly empty in between. (Use ReplaceSetElements to
+	// avoid that.)
+	ClearSet(ctx context.Context, setName string) error
+
+	// ReplaceSetElements atomically replaces the contents of the set setName with
+	// elements with the given keys, by running a single transaction that flushes the
+	// set and then re-adds the elements (combined into "add element" commands of up to
+	// DefaultBulkBatchSize elements, unless overridden with WithBulkBatchSize). Unlike
+	// with ClearSet and BulkAddElements, there is no point at which the set is
+	// visibly empty.
+	ReplaceSetElements(ctx context.Context, setName string, keys [][]string) error
+
+	// RenameChain renames the chain oldName to newName (with "nft rename chain").
+	// This happens atomically, and preserves the chain's handle and rules; rules and
+	// verdict map elements that jump to or goto the chain will refer to it by its new
+	// name afterward. If oldName does not exist, this will return a *NotFoundError,
+	// and if newName already exists, it will return an *AlreadyExistsError.
+	RenameChain(ctx context.Context, oldName, newName string) error
+
+	// CopyChain adds copies of all of the rules in the chain srcChain to the end of
+	// the chain dstChain (creating dstChain as a regular chain if it does not already
+	// exist), in a single transaction. The rules are copied without their handles,
+	// and (since the rules are read with "nft --stateless") without the current
+	// values of any anonymous counters or quotas in them. If srcChain does not exist,
+	// this will return a *NotFoundError.
+	CopyChain(ctx context.Context, srcChain, dstChain string) error
+
+	// WaitForChain waits until the chain chainName exists (eg, because it is created
+	// by another process), checking with ListChains every interval. It returns nil
+	// once the chain exists, or an error if ctx is cancelled or expires first, or if
+	// ListChains fails for any reason other than the table not existing yet.
+	WaitForChain(ctx context.Context, chainName string, interval time.Duration) error
+
+	// Version returns the version of the nft binary.
+	Version() NFTVersion
+
+	// SupportsFeature returns true if the system supports feature (as determined when
+	// the Interface was created). Unknown features are reported as unsupported.
+	SupportsFeature(feature Feature) bool
+
 	// Check does a dry-run of a Transaction (as with `nft --check`) and returns the
-	// result. The IsNotFound and IsAlreadyExists methods can be used to test the
-	// result.
+	// result. This validates the transaction's syntax and semantics (e.g., that the
+	// chains its rules refer to exist) against the current state of the kernel,
+	// without modifying that state. The IsNotFound and IsAlreadyExists methods can be
+	// used to test the result.
 	Check(ctx context.Context, tx *Transaction) error
 
 	// List returns a list of the names of the objects of objectType ("chain", "set",
-	// or "map") in the table. If there are no such objects, this will return an empty
-	// list and no error.
+	// "map", "flowtable", "counter", "quota", or "limit") in the table. If there are
+	// no such objects, this will return an empty list and no error.
 	List(ctx context.Context, objectType string) ([]string, error)
 
+	// ListChains returns a list of the chains in the table, with their Type, Hook,
+	// Priority, Device, Comment, and Handle fields filled in (as appropriate). If
+	// there are no chains, this will return an empty list and no error.
+	ListChains(ctx context.Context) ([]*Chain, error)
+
+	// ListSets returns a list of the sets in the table (but not their elements), with
+	// all of the fields reported by nft filled in. Note that nft does not report
+	// TypeOf, so a set created with TypeOf will be returned with the equivalent Type
+	// instead. If there are no sets, this will return an empty list and no error.
+	ListSets(ctx context.Context) ([]*Set, error)
+
+	// ListMaps returns a list of the maps in the table (but not their elements), with
+	// all of the fields reported by nft filled in. As with ListSets, maps created
+	// with TypeOf will be returned with the equivalent Type instead. If there are no
+	// maps, this will return an empty list and no error.
+	ListMaps(ctx context.Context) ([]*Map, error)
+
+	// GetChain returns the chain with the given name, with the same fields filled in
+	// as with ListChains. If the chain does not exist, this will return a
+	// *NotFoundError.
+	GetChain(ctx context.Context, name string) (*Chain, error)
+
+	// GetSet returns the set with the given name (but not its elements), with the
+	// same fields filled in as with ListSets. If the set does not exist, this will
+	// return a *NotFoundError.
+	GetSet(ctx context.Context, name string) (*Set, error)
+
+	// GetMap returns the map with the given name (but not its elements), with the
+	// same fields filled in as with ListMaps. If the map does not exist, this will
+	// return a *NotFoundError.
+	GetMap(ctx context.Context, name string) (*Map, error)
+
+	// GetTable returns the table, with its Comment and Handle fields filled in. (As
+	// with ExportRuleset, the Comment field requires nft 1.0.8 or later.) If the table
+	// does not exist, this will return a *NotFoundError.
+	GetTable(ctx context.Context) (*Table, error)
+
+	// GetTableHandle returns the kernel-assigned handle of the table (eg, for use
+	// with a netlink-based library). If the table does not exist, this will return a
+	// *NotFoundError.
+	GetTableHandle(ctx context.Context) (int, error)
+
+	// GetChainHandle returns the handle of the chain with the given name. If the
+	// chain does not exist, this will return a *NotFoundError.
+	GetChainHandle(ctx context.Context, name string) (int, error)
+
+	// GetSetHandle returns the handle of the set with the given name. If the set
+	// does not exist, this will return a *NotFoundError.
+	GetSetHandle(ctx context.Context, name string) (int, error)
+
+	// GetMapHandle returns the handle of the map with the given name. If the map
+	// does not exist, this will return a *NotFoundError.
+	GetMapHandle(ctx context.Context, name string) (int, error)
+
+	// ListFlowtables returns a list of the flowtables in the table, with their
+	// Priority, Devices, and Handle fields filled in. If there are no flowtables,
+	// this will return an empty list and no error.
+	ListFlowtables(ctx context.Context) ([]*Flowtable, error)
+
+	// ListCounters returns a list of the named counters in the table, with their
+	// current Packets and Bytes values (and Comment and Handle) filled in. If there
+	// are no counters, this will return an empty list and no error.
+	ListCounters(ctx context.Context) ([]*Counter, error)
+
+	// GetCounter returns the named counter with the given name, with the same fields
+	// filled in as with ListCounters. If the counter does not exist, this will
+	// return a *NotFoundError.
+	GetCounter(ctx context.Context, name string) (*Counter, error)
+
+	// ListQuotas returns a list of the named quotas in the table, with their current
+	// Used values (and all other fields) filled in. If there are no quotas, this will
+	// return an empty list and no error.
+	ListQuotas(ctx context.Context) ([]*Quota, error)
+
+	// ListLimits returns a list of the named limits in the table. If there are no
+	// limits, this will return an empty list and no error.
+	ListLimits(ctx context.Context) ([]*Limit, error)
+
+	// ListCTTimeouts returns a list of the ct timeout objects in the table. If there
+	// are no ct timeouts, this will return an empty list and no error.
+	ListCTTimeouts(ctx context.Context) ([]*CTTimeout, error)
+
+	// ListCTExpectations returns a list of the ct expectation objects in the table.
+	// If there are no ct expectations, this will return an empty list and no error.
+	ListCTExpectations(ctx context.Context) ([]*CTExpectation, error)
+
 	// ListRules returns a list of the rules in a chain, in order. Note that at the
 	// present time, the Rule objects will have their `Comment` and `Handle` fields
 	// filled in, but *not* the actual `Rule` field. So this can only be used to find
 	// the handles of rules if they have unique comments to recognize them by, or if
 	// you know the order of the rules within the chain. If the chain exists but
-	// contains no rules, this will return an empty list and no error.
+	// contains no rules, this will return an empty list and no error. If the chain
+	// does not exist, this will return a *NotFoundError.
 	ListRules(ctx context.Context, chain string) ([]*Rule, error)
 
+	// ListAllRules returns a list of the rules in all of the chains of the table
+	// (grouped by chain), using a single nft command. As with ListRules, the Rule
+	// objects will have their Chain, Comment, and Handle fields filled in, but not
+	// their Rule field. If the table exists but contains no rules, this will return
+	// an empty list and no error. If the table does not exist, this will return a
+	// *NotFoundError.
+	ListAllRules(ctx context.Context) ([]*Rule, error)
+
 	// ListElements returns a list of the elements in a set or map. (objectType should
 	// be "set" or "map".) If the set/map exists but contains no elements, this will
-	// return an empty list and no error.
+	// return an empty list and no error. If the set/map does not exist, this will
+	// return a *NotFoundError. Elements of interval sets/maps are returned in CIDR
+	// notation ("10.0.0.0/8") or "start-end" notation ("10.0.0.1-10.0.0.99").
 	ListElements(ctx context.Context, objectType, name string) ([]*Element, error)
+
+	// ListAllElements returns a list of the elements of all of the sets and maps in
+	// the table (grouped by set or map), using a single nft command. Each element has
+	// either its Set or its Map field filled in to indicate where it came from. If
+	// the table exists but contains no elements, this will return an empty list and
+	// no error. If the table does not exist, this will return a *NotFoundError.
+	ListAllElements(ctx context.Context) ([]*Element, error)
+
+	// ExportRuleset returns a Ruleset containing a single RulesetTable with all of
+	// the objects in the table, as a consistent snapshot, which can later be restored
+	// with ImportRuleset. Unlike with ListRules, the Rule field of the returned rules
+	// is filled in; since this requires a second (text-format) listing of the table,
+	// the rule bodies may not be consistent with the rest of the snapshot if the
+	// table is modified concurrently. If the table does not exist, this will return
+	// a *NotFoundError.
+	ExportRuleset(ctx context.Context) (*Ruleset, error)
+
+	// ListState returns a Ruleset containing a single RulesetTable with just the
+	// runtime state of the table (the current values of its named counters and
+	// quotas), as a consistent snapshot, separately from its static configuration.
+	// If the table does not exist, this will return a *NotFoundError.
+	ListState(ctx context.Context) (*Ruleset, error)
+
+	// ImportRuleset adds all of the objects in rs to the table in a single
+	// transaction. rs must either contain a single RulesetTable (which will be
+	// imported into this Interface's table regardless of its Family and Name), or
+	// else contain a RulesetTable matching this Interface's family and table. Objects
+	// are added (as with Transaction.Add) in dependency order, ignoring their
+	// Handles; existing objects in the table that are not in rs are left alone.
+	// Rules must have their Rule field filled in (as ExportRuleset does, but
+	// ListRules and ListAllRules do not).
+	ImportRuleset(ctx context.Context, rs *Ruleset) error
+
+	// Monitor runs "nft monitor" and sends a MonitorEvent to events for each change
+	// to an object in the table, until ctx is cancelled or nft exits. It closes events
+	// before returning, so the caller can simply range over events until it is
+	// closed. (Monitor will not block sending to events after ctx is cancelled, even
+	// if nothing is reading from it.) Monitor returns nil if it exits because ctx
+	// was cancelled.
+	Monitor(ctx context.Context, events chan<- MonitorEvent) error
 }
 
 type nftContext struct {
@@ -62,21 +309,226 @@ type nftContext struct {
 	table  string
 
 	// noObjectComments is true if comments on Table/Chain/Set/Map are not supported.
-	// (Comments on Rule and Element are always supported.)
+	// (Comments on Rule are always supported.)
 	noObjectComments bool
+
+	// noSetComments is true if comments on Set/Map/Element are not supported. (This
+	// is always the case if noObjectComments is true.)
+	noSetComments bool
+
+	// noIntervalSets is true if sets/maps with the "interval" flag are not supported.
+	noIntervalSets bool
+
+	// bulkBatchSize is the maximum number of elements to add in a single command (or
+	// in a single transaction, for BulkAddElements). If 0, DefaultBulkBatchSize is
+	// used.
+	bulkBatchSize int
+}
+
+// batchSize returns ctx's bulkBatchSize, or DefaultBulkBatchSize if it is unset.
+func (ctx *nftContext) batchSize() int {
+	if ctx.bulkBatchSize <= 0 {
+		return DefaultBulkBatchSize
+	}
+	return ctx.bulkBatchSize
+}
+
+// supportsFeature returns whether feature is supported according to ctx's feature flags.
+func (ctx *nftContext) supportsFeature(feature Feature) bool {
+	switch feature {
+	case FeatureObjectComments:
+		return !ctx.noObjectComments
+	case FeatureSetComments:
+		return !ctx.noObjectComments && !ctx.noSetComments
+	case FeatureIntervalSets:
+		return !ctx.noIntervalSets
+	default:
+		return false
+	}
 }
 
-// realNFTables is an implementation of Interface
+// realNFTables is an implementation of Interface. Its fields are not modified after
+// newInternal returns, so it does not need any locking to be safe for concurrent use.
 type realNFTables struct {
 	nftContext
 
-	exec execer
-	path string
+	exec    execer
+	path    string
+	version NFTVersion
+
+	extraArgs []string
+	env       []string
+	metrics   MetricsRecorder
+
+	// netnsPath, if set, is the network namespace to run nft in (see
+	// NewForNamespace), and nsenterPath is the path to the nsenter binary. If
+	// netnsFile is set (see NewWithNetnsPath), it is passed to nsenter as fd 3, and
+	// netnsPath refers to that.
+	netnsPath   string
+	netnsFile   *os.File
+	nsenterPath string
+
+	// minJSONSchemaVersion and maxJSONSchemaVersion are the range of nft JSON schema
+	// versions that will be accepted
+	minJSONSchemaVersion int
+	maxJSONSchemaVersion int
+
+	// logCommand, if set, is called after each invocation of nft (see WithLogger)
+	logCommand func(ctx context.Context, args []string, err error, duration time.Duration)
+
+	commandTimeout time.Duration
+	retryAttempts  int
+	retryBackoff   time.Duration
+
+	// compressScripts, if set, causes RunFromFile to write gzip-compressed scripts
+	// (see WithScriptCompression)
+	compressScripts bool
+}
+
+// Option is an optional argument to New.
+type Option func(*realNFTables)
+
+// WithCommandTimeout returns an Option that limits each invocation of the nft binary to
+// timeout. (If the context passed to a method has an earlier deadline, that deadline
+// still applies.)
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(nft *realNFTables) {
+		nft.commandTimeout = timeout
+	}
+}
+
+// WithRetry returns an Option that causes nft invocations that fail with a transient
+// error (e.g. "Resource temporarily unavailable" because of a concurrent modification by
+// another process) to be retried, up to a total of attempts attempts. It waits backoff
+// before the first retry, doubling the wait before each subsequent retry, and stops
+// retrying if the context passed to the method is cancelled. Other errors are never
+// retried.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(nft *realNFTables) {
+		nft.retryAttempts = attempts
+		nft.retryBackoff = backoff
+	}
+}
+
+// WithBulkBatchSize returns an Option that sets the maximum number of elements that
+// BulkAddElements and BulkAddMapElements will add in a single transaction, and the
+// maximum number of consecutive element additions in a Transaction that will be combined
+// into a single "add element" command. The default is DefaultBulkBatchSize.
+func WithBulkBatchSize(size int) Option {
+	return func(nft *realNFTables) {
+		nft.bulkBatchSize = size
+	}
+}
+
+// WithNFTPath returns an Option that causes the given nft binary to be used, rather than
+// looking up "nft" in $PATH. (This can be used to run a particular nft binary in a
+// container or other non-standard environment, or to run a mock nft binary in
+// integration tests.)
+func WithNFTPath(path string) Option {
+	return func(nft *realNFTables) {
+		nft.path = path
+	}
+}
+
+// WithExtraArgs returns an Option that causes args to be passed to nft before the
+// arguments of every invocation (including the ones made by New itself to probe the
+// system), e.g. WithExtraArgs("--debug=netlink"). Calling it more than once appends to
+// the list of extra arguments.
+//
+// Note that knftables parses the output of nft, and so passing arguments that change the
+// output format (e.g. "--json", "--terse", "--numeric", or "--handle") may cause List
+// methods to fail or return incorrect results.
+func WithExtraArgs(args ...string) Option {
+	return func(nft *realNFTables) {
+		nft.extraArgs = append(nft.extraArgs, args...)
+	}
+}
+
+// WithEnvironment returns an Option that causes nft to be run with the environment env
+// (a list of "KEY=value" strings, as with os/exec.Cmd.Env) rather than inheriting the
+// current process's environment. For example, WithEnvironment([]string{"LANG=C"})
+// ensures that nft's error messages are not localized. (Passing an empty, non-nil slice
+// runs nft with an empty environment.)
+func WithEnvironment(env []string) Option {
+	return func(nft *realNFTables) {
+		nft.env = env
+	}
+}
+
+// WithScriptCompression returns an Option that, if enabled is true, causes RunFromFile
+// to write a gzip-compressed copy of the transaction to disk, and then pass it to nft via
+// a named pipe, decompressing it as nft reads it. This reduces the amount of disk space
+// and I/O used for very large transactions, at the cost of some CPU. Since nft cannot
+// re-read the script from the pipe, error messages for failed transactions may not
+// include the text of the failing command. Script compression is only supported on
+// platforms with named pipes; elsewhere, RunFromFile will return an error.
+func WithScriptCompression(enabled bool) Option {
+	return func(nft *realNFTables) {
+		nft.compressScripts = enabled
+	}
+}
+
+// WithMinJSONSchemaVersion returns an Option that sets the minimum "json_schema_version"
+// of nft's JSON output that will be accepted. The default is 1.
+func WithMinJSONSchemaVersion(version int) Option {
+	return func(nft *realNFTables) {
+		nft.minJSONSchemaVersion = version
+	}
+}
+
+// WithMaxJSONSchemaVersion returns an Option that sets the maximum "json_schema_version"
+// of nft's JSON output that will be accepted. The default is 1. This can be used to
+// allow a newer nft binary with a backward-compatible schema to be used without
+// updating knftables; however, if the schema has changed in incompatible ways, then
+// List methods may fail or return incorrect results.
+func WithMaxJSONSchemaVersion(version int) Option {
+	return func(nft *realNFTables) {
+		nft.maxJSONSchemaVersion = version
+	}
+}
+
+// MetricsRecorder is an interface for collecting metrics about nft invocations; see
+// WithMetrics. Its methods may be called from multiple goroutines at once.
+type MetricsRecorder interface {
+	// RecordRun is called each time nft is run to apply a transaction (by Run,
+	// RunAll, RunAndVerify, RunWithEcho, ImportRuleset, or one of the bulk element
+	// methods), with the resulting error (if any) and how long it took. (It is not
+	// called for Check.)
+	RecordRun(err error, duration time.Duration)
+
+	// RecordList is called each time nft is run to list objects (by one of the List*
+	// or Get* methods, or ExportRuleset), with the type of object listed (eg "chain",
+	// "rule", "element", or "table"), the number of objects returned (which will be 0
+	// if the call failed), and how long it took.
+	RecordList(objType string, count int, duration time.Duration)
+}
+
+// WithMetrics returns an Option that causes metrics about each invocation of nft to be
+// reported to recorder.
+func WithMetrics(recorder MetricsRecorder) Option {
+	return func(nft *realNFTables) {
+		nft.metrics = recorder
+	}
+}
+
+// recordRun reports a transaction that was started at start to nft.metrics, if set
+func (nft *realNFTables) recordRun(start time.Time, err error) {
+	if nft.metrics != nil {
+		nft.metrics.RecordRun(err, time.Since(start))
+	}
+}
+
+// recordList reports a list operation that was started at start to nft.metrics, if set.
+// (count is a function so that it can be used with defer.)
+func (nft *realNFTables) recordList(objType string, start time.Time, count func() int) {
+	if nft.metrics != nil {
+		nft.metrics.RecordList(objType, count(), time.Since(start))
+	}
 }
 
 // newInternal creates a new nftables.Interface for interacting with the given table; this
 // is split out from New() so it can be used from unit tests with a fakeExec.
-func newInternal(family Family, table string, execer execer) (Interface, error) {
+func newInternal(family Family, table string, execer execer, opts ...Option) (Interface, error) {
 	var err error
 
 	nft := &realNFTables{
@@ -86,37 +538,80 @@ func newInternal(family Family, table string, execer execer) (Interface, error)
 		},
 
 		exec: execer,
+
+		minJSONSchemaVersion: defaultJSONSchemaVersion,
+		maxJSONSchemaVersion: defaultJSONSchemaVersion,
+	}
+	for _, opt := range opts {
+		opt(nft)
+	}
+	if nft.minJSONSchemaVersion > nft.maxJSONSchemaVersion {
+		return nil, fmt.Errorf("minimum JSON schema version %d is greater than maximum JSON schema version %d", nft.minJSONSchemaVersion, nft.maxJSONSchemaVersion)
 	}
 
-	nft.path, err = nft.exec.LookPath("nft")
-	if err != nil {
-		return nil, fmt.Errorf("could not find nftables binary: %w", err)
+	if nft.path == "" {
+		nft.path, err = nft.exec.LookPath("nft")
+		if err != nil {
+			return nil, fmt.Errorf("could not find nftables binary: %w", err)
+		}
+	}
+	if nft.netnsPath != "" {
+		nft.nsenterPath, err = nft.exec.LookPath("nsenter")
+		if err != nil {
+			return nil, fmt.Errorf("could not find nsenter binary: %w", err)
+		}
 	}
 
-	cmd := exec.Command(nft.path, "--version")
-	out, err := nft.exec.Run(cmd)
+	out, err := nft.runCommand(context.Background(), nil, "--version")
 	if err != nil {
 		return nil, fmt.Errorf("could not run nftables command: %w", err)
 	}
-	if strings.HasPrefix(out, "nftables v0.") || strings.HasPrefix(out, "nftables v1.0.0 ") {
+	nft.version, err = parseNFTVersion(out)
+	if err != nil {
+		return nil, err
+	}
+	if !nft.version.AtLeast(1, 0, 1) {
 		return nil, fmt.Errorf("nft version must be v1.0.1 or later (got %s)", strings.TrimSpace(out))
 	}
 
 	// Check that (a) nft works, (b) we have permission, (c) the kernel is new enough
 	// to support object comments.
-	cmd = exec.Command(nft.path, "--check", "add", "table", string(nft.family), nft.table,
+	_, err = nft.runCommand(context.Background(), nil, "--check", "add", "table", string(nft.family), nft.table,
 		"{", "comment", `"test"`, "}",
 	)
-	_, err = nft.exec.Run(cmd)
 	if err != nil {
 		// Try again, checking just that (a) nft works, (b) we have permission.
-		cmd := exec.Command(nft.path, "--check", "add", "table", string(nft.family), nft.table)
-		_, err = nft.exec.Run(cmd)
+		_, err = nft.runCommand(context.Background(), nil, "--check", "add", "table", string(nft.family), nft.table)
 		if err != nil {
 			return nil, fmt.Errorf("could not run nftables command: %w", err)
 		}
 
+		// Set/Map/Element comments are never supported if other object comments
+		// aren't.
 		nft.noObjectComments = true
+		nft.noSetComments = true
+	} else {
+		// Check that the kernel also supports set comments.
+		_, err = nft.runCommand(context.Background(), nil, "--check",
+			"add", "table", string(nft.family), nft.table, ";",
+			"add", "set", string(nft.family), nft.table, "knftables-probe",
+			"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+		)
+		if err != nil {
+			nft.noSetComments = true
+		}
+	}
+
+	// Check that the kernel supports interval sets. (nft itself always does, but on
+	// older kernels the interval set backend is a separate module that may not be
+	// available, and "--check" passes the probe to the kernel.)
+	_, err = nft.runCommand(context.Background(), nil, "--check",
+		"add", "table", string(nft.family), nft.table, ";",
+		"add", "set", string(nft.family), nft.table, "knftables-probe",
+		"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+	)
+	if err != nil {
+		nft.noIntervalSets = true
 	}
 
 	return nft, nil
@@ -124,8 +619,194 @@ func newInternal(family Family, table string, execer execer) (Interface, error)
 
 // New creates a new nftables.Interface for interacting with the given table. If nftables
 // is not available/usable on the current host, it will return an error.
-func New(family Family, table string) (Interface, error) {
-	return newInternal(family, table, realExec{})
+func New(family Family, table string, opts ...Option) (Interface, error) {
+	return newInternal(family, table, realExec{}, opts...)
+}
+
+// netnsDir is the directory containing named network namespaces (as created by "ip
+// netns add").
+const netnsDir = "/var/run/netns"
+
+// NewForNamespace creates a new nftables.Interface for interacting with the given table
+// in a network namespace other than the caller's. netns is either the name of a named
+// network namespace (as created by "ip netns add"), or the path to a network
+// namespace file (such as "/proc/1234/ns/net" or a bind-mounted copy of one). Each
+// invocation of nft is run inside the namespace with "nsenter --net", so the nsenter
+// binary (from util-linux) must be available, and the caller needs CAP_SYS_ADMIN (to
+// enter the namespace) in addition to the usual CAP_NET_ADMIN. As with New, this will
+// return an error if nftables is not supported in the namespace. opts are handled as
+// with New.
+func NewForNamespace(family Family, table, netns string, opts ...Option) (Interface, error) {
+	if netns == "" {
+		return nil, fmt.Errorf("no network namespace specified")
+	}
+	return newInternal(family, table, realExec{}, append([]Option{withNetnsPath(netnsPath(netns))}, opts...)...)
+}
+
+// NewWithNetnsPath creates a new nftables.Interface for interacting with the given table
+// in the network namespace at path (eg, "/proc/1234/ns/net"). Unlike with
+// NewForNamespace, path is opened once, when the Interface is created, and every
+// invocation of nft is run (with "nsenter --net") in the namespace referred to by that
+// open file descriptor, rather than re-resolving path each time. This means that the
+// Interface will keep operating on the same namespace even if the process whose ns file
+// was specified exits and its PID is reused, or if a bind-mounted namespace file is
+// replaced, which would otherwise allow nft to be redirected into a different
+// namespace.
+//
+// The open file descriptor keeps the network namespace alive for as long as the
+// Interface exists. The returned Interface also implements io.Closer; calling its Close
+// method closes the file descriptor immediately (rather than waiting until the Interface
+// is garbage collected), after which the Interface must not be used. As with NewForNamespace, the
+// nsenter binary must be available, and the caller needs CAP_SYS_ADMIN (to enter the
+// namespace) in addition to CAP_NET_ADMIN; it also needs permission to open path
+// (which, for /proc/<pid>/ns/net, normally means having ptrace access to that process).
+// opts are handled as with New.
+func NewWithNetnsPath(family Family, table, path string, opts ...Option) (Interface, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open network namespace: %w", err)
+	}
+	nft, err := newInternal(family, table, realExec{}, append([]Option{withNetnsFile(file)}, opts...)...)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return nft, nil
+}
+
+// Close closes the network namespace file descriptor opened by NewWithNetnsPath, if
+// any. (This is not part of Interface; callers of NewWithNetnsPath can use it via an
+// io.Closer type assertion.)
+func (nft *realNFTables) Close() error {
+	if nft.netnsFile == nil {
+		return nil
+	}
+	return nft.netnsFile.Close()
+}
+
+// withNetnsFile returns an Option that causes nft to be run in the network namespace
+// referred to by file.
+func withNetnsFile(file *os.File) Option {
+	return func(nft *realNFTables) {
+		nft.netnsFile = file
+		// ExtraFiles[0] is always fd 3 in the child
+		nft.netnsPath = "/proc/self/fd/3"
+	}
+}
+
+// netnsPath returns the path to the network namespace netns, which is either a path or
+// the name of a namespace in netnsDir.
+func netnsPath(netns string) string {
+	if strings.Contains(netns, "/") {
+		return netns
+	}
+	return filepath.Join(netnsDir, netns)
+}
+
+// withNetnsPath returns an Option that causes nft to be run in the network namespace at
+// path.
+func withNetnsPath(path string) Option {
+	return func(nft *realNFTables) {
+		nft.netnsPath = path
+	}
+}
+
+// runCommand runs nft with the given arguments (and stdin, if non-nil), applying
+// nft.commandTimeout and retrying on transient errors if configured.
+func (nft *realNFTables) runCommand(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	if nft.retryAttempts <= 1 {
+		return nft.runCommandOnce(ctx, stdin, args...)
+	}
+
+	// We may need to pass stdin more than once
+	var stdinBytes []byte
+	if stdin != nil {
+		var err error
+		stdinBytes, err = io.ReadAll(stdin)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return nft.retry(ctx, func() (string, error) {
+		if stdinBytes != nil {
+			stdin = bytes.NewReader(stdinBytes)
+		}
+		return nft.runCommandOnce(ctx, stdin, args...)
+	})
+}
+
+// retry calls run until it succeeds, fails with a non-transient error, or has been
+// called nft.retryAttempts times, backing off exponentially between attempts.
+func (nft *realNFTables) retry(ctx context.Context, run func() (string, error)) (string, error) {
+	backoff := nft.retryBackoff
+	for attempt := 1; ; attempt++ {
+		out, err := run()
+		if err == nil || !isTransient(err) || attempt >= nft.retryAttempts {
+			return out, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return out, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// runCommandOnce runs nft with the given arguments (and stdin, if non-nil), applying
+// nft.commandTimeout if it is set.
+func (nft *realNFTables) runCommandOnce(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	if nft.commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nft.commandTimeout)
+		defer cancel()
+	}
+
+	if len(nft.extraArgs) > 0 {
+		args = append(append([]string{}, nft.extraArgs...), args...)
+	}
+	var endSpan func(error)
+	if tracer := tracerFromContext(ctx); tracer != nil {
+		ctx, endSpan = tracer.StartSpan(ctx, append([]string{nft.path}, args...))
+	}
+
+	cmd := nft.command(ctx, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	start := time.Now()
+	out, err := nft.exec.Run(cmd)
+	if nft.logCommand != nil {
+		nft.logCommand(ctx, cmd.Args, err, time.Since(start))
+	}
+	if err != nil {
+		err = newRunError(cmd.Args, err)
+	}
+	if endSpan != nil {
+		endSpan(err)
+	}
+	return out, err
+}
+
+// command returns an *exec.Cmd that will run nft with args (which should already include
+// nft.extraArgs) in nft's environment and network namespace.
+func (nft *realNFTables) command(ctx context.Context, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if nft.netnsPath != "" {
+		nsenterArgs := append([]string{"--net=" + nft.netnsPath, "--", nft.path}, args...)
+		cmd = exec.CommandContext(ctx, nft.nsenterPath, nsenterArgs...)
+		if nft.netnsFile != nil {
+			cmd.ExtraFiles = []*os.File{nft.netnsFile}
+		}
+	} else {
+		cmd = exec.CommandContext(ctx, nft.path, args...)
+	}
+	if nft.env != nil {
+		cmd.Env = nft.env
+	}
+	return cmd
 }
 
 // NewTransaction is part of Interface
@@ -133,214 +814,1485 @@ func (nft *realNFTables) NewTransaction() *Transaction {
 	return &Transaction{nftContext: &nft.nftContext}
 }
 
-// Run is part of Interface
-func (nft *realNFTables) Run(ctx context.Context, tx *Transaction) error {
-	if tx.err != nil {
-		return tx.err
+// NewTransactionWithContext is part of Interface
+func (nft *realNFTables) NewTransactionWithContext(ctx context.Context) *Transaction {
+	return &Transaction{nftContext: &nft.nftContext, ctx: ctx}
+}
+
+// Run is part of Interface
+func (nft *realNFTables) Run(ctx context.Context, tx *Transaction) error {
+	ctx, cancel := tx.runContext(ctx)
+	defer cancel()
+	if tx.err != nil {
+		return tx.err
+	}
+	tx, err := bindTransaction(&nft.nftContext, tx)
+	if err != nil {
+		return err
+	}
+
+	buf, err := tx.asCommandBuf()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	_, err = nft.runCommand(ctx, buf, "-f", "-")
+	err = checkAlreadyExists(err)
+	nft.recordRun(start, err)
+	return err
+}
+
+// RunAll is part of Interface
+func (nft *realNFTables) RunAll(ctx context.Context, txs ...*Transaction) error {
+	tx, err := combineTransactions(nft.NewTransaction(), txs)
+	if err != nil {
+		return err
+	}
+	return nft.Run(ctx, tx)
+}
+
+// RunAndVerify is part of Interface
+func (nft *realNFTables) RunAndVerify(ctx context.Context, tx *Transaction) error {
+	ctx, cancel := tx.runContext(ctx)
+	defer cancel()
+	if err := nft.Run(ctx, tx); err != nil {
+		return err
+	}
+	rs, err := nft.exportRuleset(ctx)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("could not verify transaction: %w", err)
+	}
+	return verifyTransaction(tx, rs)
+}
+
+// RunWithEcho is part of Interface
+func (nft *realNFTables) RunWithEcho(ctx context.Context, tx *Transaction) ([]Object, error) {
+	ctx, cancel := tx.runContext(ctx)
+	defer cancel()
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	tx, err := bindTransaction(&nft.nftContext, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := tx.asCommandBuf()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	out, err := nft.runCommand(ctx, buf, "--echo", "--json", "-f", "-")
+	err = checkAlreadyExists(err)
+	nft.recordRun(start, err)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := parseEchoOutput(out)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
+	}
+	return objects, nil
+}
+
+// RunFromFile is part of Interface
+func (nft *realNFTables) RunFromFile(ctx context.Context, tx *Transaction, dir string) error {
+	ctx, cancel := tx.runContext(ctx)
+	defer cancel()
+	if tx.err != nil {
+		return tx.err
+	}
+	tx, err := bindTransaction(&nft.nftContext, tx)
+	if err != nil {
+		return err
+	}
+
+	if nft.compressScripts {
+		return nft.runFromCompressedFile(ctx, tx, dir)
+	}
+
+	path, err := writeScriptFile(tx, dir, false)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	start := time.Now()
+	_, err = nft.runCommand(ctx, nil, "--file", path)
+	err = checkAlreadyExists(err)
+	nft.recordRun(start, err)
+	return err
+}
+
+// BulkAddElements is part of Interface
+func (nft *realNFTables) BulkAddElements(ctx context.Context, setName string, keys [][]string) error {
+	return bulkAddElements(ctx, nft, nft.batchSize(), setElements(setName, keys))
+}
+
+// BulkAddMapElements is part of Interface
+func (nft *realNFTables) BulkAddMapElements(ctx context.Context, mapName string, entries []MapEntry) error {
+	return bulkAddElements(ctx, nft, nft.batchSize(), mapElements(mapName, entries))
+}
+
+// ClearSet is part of Interface
+func (nft *realNFTables) ClearSet(ctx context.Context, setName string) error {
+	tx := nft.NewTransaction()
+	tx.Flush(&Set{Name: setName})
+	return nft.Run(ctx, tx)
+}
+
+// ReplaceSetElements is part of Interface
+func (nft *realNFTables) ReplaceSetElements(ctx context.Context, setName string, keys [][]string) error {
+	return nft.Run(ctx, replaceSetElements(nft.NewTransaction(), setName, keys))
+}
+
+// RenameChain is part of Interface
+func (nft *realNFTables) RenameChain(ctx context.Context, oldName, newName string) error {
+	if oldName == "" || newName == "" {
+		return fmt.Errorf("chain name must not be empty")
+	}
+
+	start := time.Now()
+	_, err := nft.runCommand(ctx, nil, "rename", "chain", string(nft.family), nft.table, oldName, newName)
+	if IsNotFound(err) {
+		err = &NotFoundError{ObjectType: "chain", ObjectName: oldName, wrapped: err}
+	} else if IsAlreadyExists(err) {
+		err = &AlreadyExistsError{ObjectType: "chain", ObjectName: newName, wrapped: err}
+	}
+	nft.recordRun(start, err)
+	return err
+}
+
+// WaitForChain is part of Interface
+func (nft *realNFTables) WaitForChain(ctx context.Context, chainName string, interval time.Duration) error {
+	return waitForChain(ctx, nft, chainName, interval)
+}
+
+// CopyChain is part of Interface
+func (nft *realNFTables) CopyChain(ctx context.Context, srcChain, dstChain string) error {
+	if srcChain == dstChain {
+		return fmt.Errorf("cannot copy chain %q to itself", srcChain)
+	}
+
+	// The JSON output does not give us the rules in nft syntax, so we need to parse
+	// the text output instead.
+	out, err := nft.runCommand(ctx, nil, "--stateless", "list", "chain", string(nft.family), nft.table, srcChain)
+	if err != nil {
+		return listError(err, "chain", srcChain)
+	}
+
+	tx := nft.NewTransaction()
+	tx.Add(&Chain{Name: dstChain})
+	for _, rule := range parseChainListing(out) {
+		tx.Add(&Rule{Chain: dstChain, Rule: rule})
+	}
+	return nft.Run(ctx, tx)
+}
+
+// chainPropertyRegexp matches the lines of a chain listing that describe the chain
+// itself rather than one of its rules.
+var chainPropertyRegexp = regexp.MustCompile(`^(?:type|policy|comment|devices)\s`)
+
+// parseChainListing parses the output of "nft list chain" (in text format) and returns
+// the chain's rules, in order. The listing will look something like:
+//
+//	table ip kube-proxy {
+//		chain services {
+//			type filter hook input priority filter; policy accept;
+//			comment "services"
+//			ip daddr 10.0.0.1 tcp dport 80 counter jump svc-1
+//			ip daddr {
+//				10.0.0.2,
+//				10.0.0.3,
+//			} drop
+//		}
+//	}
+//
+// (where anonymous sets are usually but not always listed on a single line).
+func parseChainListing(listing string) []string {
+	var rules []string
+	var pending string
+	depth := 0
+	for _, line := range strings.Split(listing, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if pending != "" {
+			pending += " " + line
+			if braceDepth(pending) == 0 {
+				rules = append(rules, strings.ReplaceAll(pending, ", }", " }"))
+				pending = ""
+			}
+			continue
+		}
+
+		switch {
+		case line == "}":
+			depth--
+		case depth < 2 && strings.HasSuffix(line, "{"):
+			// "table ... {" or "chain ... {"
+			depth++
+		case depth < 2 || chainPropertyRegexp.MatchString(line):
+			continue
+		case braceDepth(line) > 0:
+			pending = line
+		default:
+			rules = append(rules, line)
+		}
+	}
+	return rules
+}
+
+// braceDepth returns the number of unclosed "{"s in line, ignoring any in quoted
+// strings.
+func braceDepth(line string) int {
+	depth := 0
+	quoted := false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// Version is part of Interface
+func (nft *realNFTables) Version() NFTVersion {
+	return nft.version
+}
+
+// SupportsFeature is part of Interface
+func (nft *realNFTables) SupportsFeature(feature Feature) bool {
+	return nft.supportsFeature(feature)
+}
+
+// Check is part of Interface
+func (nft *realNFTables) Check(ctx context.Context, tx *Transaction) error {
+	ctx, cancel := tx.runContext(ctx)
+	defer cancel()
+	if tx.err != nil {
+		return tx.err
+	}
+	tx, err := bindTransaction(&nft.nftContext, tx)
+	if err != nil {
+		return err
+	}
+
+	buf, err := tx.asCommandBuf()
+	if err != nil {
+		return err
+	}
+
+	_, err = nft.runCommand(ctx, buf, "--check", "-f", "-")
+	return checkAlreadyExists(err)
+}
+
+// jsonVal looks up key in json; if it exists and is of type T, it returns (json[key], true).
+// Otherwise it returns (_, false).
+func jsonVal[T any](json map[string]interface{}, key string) (T, bool) {
+	if ifVal, exists := json[key]; exists {
+		tVal, ok := ifVal.(T)
+		return tVal, ok
+	}
+	var zero T
+	return zero, false
+}
+
+// listError converts an error from running "nft list" on an object into the error to
+// return to the caller, converting "not found" errors to a NotFoundError.
+func listError(err error, objectType, name string) error {
+	if IsNotFound(err) {
+		return &NotFoundError{ObjectType: objectType, ObjectName: name, wrapped: err}
+	}
+	return fmt.Errorf("failed to run nft: %w", err)
+}
+
+// getJSONObjects takes the output of "nft -j list", validates it, and returns an array
+// of just the objects of objectType.
+func (nft *realNFTables) getJSONObjects(listOutput, objectType string) ([]map[string]interface{}, error) {
+	// listOutput should contain JSON looking like:
+	//
+	// {
+	//   "nftables": [
+	//     {
+	//       "metainfo": {
+	//         "json_schema_version": 1,
+	//         ...
+	//       }
+	//     },
+	//     {
+	//       "chain": {
+	//         "family": "ip",
+	//         "table": "kube-proxy",
+	//         "name": "KUBE-SERVICES",
+	//         "handle": 3
+	//       }
+	//     },
+	//     {
+	//       "chain": {
+	//         "family": "ip",
+	//         "table": "kube-proxy",
+	//         "name": "KUBE-NODEPORTS",
+	//         "handle": 4
+	//       }
+	//     },
+	//     ...
+	//   ]
+	// }
+	//
+	// In this case, given objectType "chain", we would return
+	//
+	// [
+	//   {
+	//     "family": "ip",
+	//     "table": "kube-proxy",
+	//     "name": "KUBE-SERVICES",
+	//     "handle": 3
+	//   },
+	//   {
+	//     "family": "ip",
+	//     "table": "kube-proxy",
+	//     "name": "KUBE-NODEPORTS",
+	//     "handle": 4
+	//   },
+	//   ...
+	// ]
+
+	nftablesResult, err := parseJSONOutput(listOutput, nft.minJSONSchemaVersion, nft.maxJSONSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []map[string]interface{}
+	for _, objContainer := range nftablesResult {
+		obj := objContainer[objectType]
+		if obj != nil {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// defaultJSONSchemaVersion is the nft JSON schema version that knftables understands
+const defaultJSONSchemaVersion = 1
+
+// parseJSONOutput parses the output of "nft --json list ...", validates its metainfo
+// (including that its schema version is between minVersion and maxVersion), and returns
+// its list of (single-key) object containers.
+func parseJSONOutput(listOutput string, minVersion, maxVersion int) ([]map[string]map[string]interface{}, error) {
+	jsonResult := map[string][]map[string]map[string]interface{}{}
+	if err := json.Unmarshal([]byte(listOutput), &jsonResult); err != nil {
+		return nil, fmt.Errorf("could not parse nft output: %w", err)
+	}
+
+	nftablesResult := jsonResult["nftables"]
+	if len(nftablesResult) == 0 {
+		return nil, fmt.Errorf("could not find result in nft output %q", listOutput)
+	}
+	metainfo := nftablesResult[0]["metainfo"]
+	if metainfo == nil {
+		return nil, fmt.Errorf("could not find metadata in nft output %q", listOutput)
+	}
+	// json_schema_version is an integer but `json.Unmarshal()` will have parsed it as
+	// a float64 since we didn't tell it otherwise.
+	if version, ok := jsonVal[float64](metainfo, "json_schema_version"); !ok || version < float64(minVersion) || version > float64(maxVersion) {
+		return nil, fmt.Errorf("could not find supported json_schema_version in nft output %q", listOutput)
+	}
+
+	return nftablesResult, nil
+}
+
+// parseEchoOutput parses the output of "nft --echo --json -f -", which looks like:
+//
+//	{
+//	  "nftables": [
+//	    {
+//	      "add": {
+//	        "chain": {
+//	          "family": "ip",
+//	          "table": "kube-proxy",
+//	          "name": "KUBE-SERVICES",
+//	          "handle": 3
+//	        }
+//	      }
+//	    },
+//	    ...
+//	  ]
+//	}
+//
+// and returns the objects it contains. (Depending on the nft version, the output may or
+// may not start with a "metainfo" object.)
+func parseEchoOutput(echoOutput string) ([]Object, error) {
+	jsonResult := map[string][]map[string]interface{}{}
+	if err := json.Unmarshal([]byte(echoOutput), &jsonResult); err != nil {
+		return nil, fmt.Errorf("could not parse nft output: %w", err)
+	}
+
+	var objects []Object
+	for _, cmdContainer := range jsonResult["nftables"] {
+		for verb, cmd := range cmdContainer {
+			switch verb {
+			case "add", "create", "insert", "replace":
+			default:
+				continue
+			}
+			objContainer, ok := cmd.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("unexpected JSON output from nft (bad %q command: %q)", verb, cmd)
+			}
+			for objectType, jsonObj := range objContainer {
+				obj, ok := jsonObj.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("unexpected JSON output from nft (bad %q object: %q)", objectType, jsonObj)
+				}
+				parsed, err := parseJSONEchoObject(objectType, obj)
+				if err != nil {
+					return nil, err
+				}
+				objects = append(objects, parsed...)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// parseJSONEchoObject parses obj, a JSON object of type objectType from the output of
+// "nft --echo --json". Objects of unsupported types are ignored.
+func parseJSONEchoObject(objectType string, obj map[string]interface{}) ([]Object, error) {
+	switch objectType {
+	case "table":
+		return []Object{parseJSONTable(obj)}, nil
+	case "chain":
+		return []Object{parseJSONChain(obj)}, nil
+	case "rule":
+		return []Object{parseJSONRule(obj)}, nil
+	case "set":
+		set, err := parseJSONSet(obj)
+		if err != nil {
+			return nil, err
+		}
+		return []Object{set}, nil
+	case "map":
+		mapObj, err := parseJSONMap(obj)
+		if err != nil {
+			return nil, err
+		}
+		return []Object{mapObj}, nil
+	case "element":
+		// Unlike in "nft list" output, the echoed "elem" is a set expression:
+		//
+		//   "elem": { "set": [ ... ] }
+		//
+		// Also, it doesn't say whether it belongs to a set or a map, but map elements
+		// are [key, value] tuples.
+		if elemSet, ok := jsonVal[map[string]interface{}](obj, "elem"); ok {
+			obj["elem"] = elemSet["set"]
+		}
+		name, _ := jsonVal[string](obj, "name")
+		setOrMap := "set"
+		if jsonElements, _ := jsonVal[[]interface{}](obj, "elem"); len(jsonElements) > 0 {
+			if tuple, ok := jsonElements[0].([]interface{}); ok && len(tuple) == 2 {
+				setOrMap = "map"
+			}
+		}
+		elements, err := parseJSONElements(obj, setOrMap, name)
+		if err != nil {
+			return nil, err
+		}
+		objects := make([]Object, 0, len(elements))
+		for _, elem := range elements {
+			objects = append(objects, elem)
+		}
+		return objects, nil
+	case "flowtable":
+		flowtable, err := parseJSONFlowtable(obj)
+		if err != nil {
+			return nil, err
+		}
+		return []Object{flowtable}, nil
+	case "counter":
+		return []Object{parseJSONCounter(obj)}, nil
+	case "quota":
+		return []Object{parseJSONQuota(obj)}, nil
+	case "limit":
+		return []Object{parseJSONLimit(obj)}, nil
+	case "ct helper":
+		return []Object{parseJSONCTHelper(obj)}, nil
+	case "ct timeout":
+		return []Object{parseJSONCTTimeout(obj)}, nil
+	case "ct expectation":
+		return []Object{parseJSONCTExpectation(obj)}, nil
+	case "secmark":
+		return []Object{parseJSONSecmark(obj)}, nil
+	}
+	return nil, nil
+}
+
+// listObjects runs "nft list" on all of the objects of objectType ("chain", "set", etc)
+// in the family, and returns the JSON objects of that type that are in nft's table.
+func (nft *realNFTables) listObjects(ctx context.Context, objectType string) (objects []map[string]interface{}, err error) {
+	defer nft.recordList(objectType, time.Now(), func() int { return len(objects) })
+
+	out, err := nft.runCommand(ctx, nil, "--json", "list", objectType+"s", string(nft.family))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run nft: %w", err)
+	}
+
+	jsonObjects, err := nft.getJSONObjects(out, objectType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
+	}
+
+	objects = make([]map[string]interface{}, 0, len(jsonObjects))
+	for _, obj := range jsonObjects {
+		objTable, _ := jsonVal[string](obj, "table")
+		if objTable == nft.table {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// listCTObjects runs "nft list ct" on all of the ct objects of type ctType ("timeout",
+// etc) in nft's table, and returns their JSON objects.
+func (nft *realNFTables) listCTObjects(ctx context.Context, ctType string) (jsonObjects []map[string]interface{}, err error) {
+	defer nft.recordList("ct "+ctType, time.Now(), func() int { return len(jsonObjects) })
+
+	out, err := nft.runCommand(ctx, nil, "--json", "list", "ct", ctType, "table", string(nft.family), nft.table)
+	if err != nil {
+		return nil, listError(err, "table", nft.table)
+	}
+
+	jsonObjects, err = nft.getJSONObjects(out, "ct "+ctType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
+	}
+	return jsonObjects, nil
+}
+
+// getObject runs "nft list" on the object of objectType named name in nft's table, and
+// returns its JSON object. If the object doesn't exist, it returns a NotFoundError.
+func (nft *realNFTables) getObject(ctx context.Context, objectType, name string) (jsonObject map[string]interface{}, err error) {
+	defer nft.recordList(objectType, time.Now(), func() int {
+		if jsonObject == nil {
+			return 0
+		}
+		return 1
+	})
+
+	out, err := nft.runCommand(ctx, nil, "--json", "list", objectType, string(nft.family), nft.table, name)
+	if err != nil {
+		return nil, listError(err, objectType, name)
+	}
+
+	jsonObjects, err := nft.getJSONObjects(out, objectType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
+	}
+	if len(jsonObjects) != 1 {
+		return nil, fmt.Errorf("unexpected JSON output from nft (multiple results)")
+	}
+	return jsonObjects[0], nil
+}
+
+// List is part of Interface.
+func (nft *realNFTables) List(ctx context.Context, objectType string) (result []string, err error) {
+	// All currently-existing nftables object types have plural forms that are just
+	// the singular form plus 's'.
+	var typeSingular, typePlural string
+	if objectType[len(objectType)-1] == 's' {
+		typeSingular = objectType[:len(objectType)-1]
+		typePlural = objectType
+	} else {
+		typeSingular = objectType
+		typePlural = objectType + "s"
+	}
+	defer nft.recordList(typeSingular, time.Now(), func() int { return len(result) })
+
+	out, err := nft.runCommand(ctx, nil, "--json", "list", typePlural, string(nft.family))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run nft: %w", err)
+	}
+
+	objects, err := nft.getJSONObjects(out, typeSingular)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range objects {
+		objTable, _ := jsonVal[string](obj, "table")
+		if objTable != nft.table {
+			continue
+		}
+
+		if name, ok := jsonVal[string](obj, "name"); ok {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// ListChains is part of Interface
+func (nft *realNFTables) ListChains(ctx context.Context) ([]*Chain, error) {
+	jsonChains, err := nft.listObjects(ctx, "chain")
+	if err != nil {
+		return nil, err
+	}
+
+	chains := make([]*Chain, 0, len(jsonChains))
+	for _, jsonChain := range jsonChains {
+		chains = append(chains, parseJSONChain(jsonChain))
+	}
+	return chains, nil
+}
+
+// GetChain is part of Interface
+func (nft *realNFTables) GetChain(ctx context.Context, name string) (*Chain, error) {
+	jsonChain, err := nft.getObject(ctx, "chain", name)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONChain(jsonChain), nil
+}
+
+// parseJSONChain converts a "chain" object from nft's JSON output into a Chain
+func parseJSONChain(jsonChain map[string]interface{}) *Chain {
+	// jsonChain will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "table": "kube-proxy",
+	//     "name": "prerouting",
+	//     "handle": 1,
+	//     "type": "nat",
+	//     "hook": "prerouting",
+	//     "prio": -100,
+	//     "policy": "accept",
+	//     "comment": "this is a comment"
+	//   }
+	//
+	// where "type", "hook", "prio", and "policy" are only present for base chains,
+	// and "dev" is present for base chains on the ingress/egress hooks.
+
+	chain := &Chain{}
+	chain.Name, _ = jsonVal[string](jsonChain, "name")
+
+	if chainType, ok := jsonVal[string](jsonChain, "type"); ok {
+		chain.Type = PtrTo(BaseChainType(chainType))
+	}
+	if hook, ok := jsonVal[string](jsonChain, "hook"); ok {
+		chain.Hook = PtrTo(BaseChainHook(hook))
+	}
+	// As with handles, json.Unmarshal will have parsed the priority as a float64.
+	if prio, ok := jsonVal[float64](jsonChain, "prio"); ok {
+		chain.Priority = PtrTo(BaseChainPriority(strconv.Itoa(int(prio))))
+	}
+	if device, ok := jsonVal[string](jsonChain, "dev"); ok {
+		chain.Device = &device
+	}
+	if policy, ok := jsonVal[string](jsonChain, "policy"); ok {
+		chain.Policy = PtrTo(BaseChainPolicy(policy))
+	}
+	if comment, ok := jsonVal[string](jsonChain, "comment"); ok {
+		chain.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonChain, "handle"); ok {
+		chain.Handle = PtrTo(int(handle))
+	}
+
+	return chain
+}
+
+// ListSets is part of Interface
+func (nft *realNFTables) ListSets(ctx context.Context) ([]*Set, error) {
+	jsonSets, err := nft.listObjects(ctx, "set")
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([]*Set, 0, len(jsonSets))
+	for _, jsonSet := range jsonSets {
+		set, err := parseJSONSet(jsonSet)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// GetSet is part of Interface
+func (nft *realNFTables) GetSet(ctx context.Context, name string) (*Set, error) {
+	jsonSet, err := nft.getObject(ctx, "set", name)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONSet(jsonSet)
+}
+
+// parseJSONSet converts a "set" object from nft's JSON output into a Set
+func parseJSONSet(jsonSet map[string]interface{}) (*Set, error) {
+	// jsonSet will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "test",
+	//     "table": "kube-proxy",
+	//     "type": ["ipv4_addr", "inet_proto", "inet_service"],
+	//     "handle": 13,
+	//     "flags": ["timeout"],
+	//     "timeout": 3600,
+	//     "gc-interval": 60,
+	//     "size": 1000,
+	//     "comment": "this is a comment"
+	//   }
+	//
+	// where "type" is a string for non-concatenated types, and the timeouts are in
+	// seconds.
+
+	set := &Set{}
+	set.Name, _ = jsonVal[string](jsonSet, "name")
+
+	var err error
+	set.Type, err = parseJSONType(jsonSet["type"])
+	if err != nil {
+		return nil, err
+	}
+
+	if flags, ok := jsonVal[[]interface{}](jsonSet, "flags"); ok {
+		set.Flags, err = parseJSONSetFlags(flags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if timeout, ok := jsonVal[float64](jsonSet, "timeout"); ok {
+		set.Timeout = PtrTo(time.Duration(timeout) * time.Second)
+	}
+	if gcInterval, ok := jsonVal[float64](jsonSet, "gc-interval"); ok {
+		set.GCInterval = PtrTo(time.Duration(gcInterval) * time.Second)
+	}
+	if size, ok := jsonVal[float64](jsonSet, "size"); ok {
+		set.Size = PtrTo(uint64(size))
+	}
+	if policy, ok := jsonVal[string](jsonSet, "policy"); ok {
+		set.Policy = PtrTo(SetPolicy(policy))
+	}
+	if autoMerge, ok := jsonVal[bool](jsonSet, "auto-merge"); ok {
+		set.AutoMerge = &autoMerge
+	}
+	if comment, ok := jsonVal[string](jsonSet, "comment"); ok {
+		set.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonSet, "handle"); ok {
+		set.Handle = PtrTo(int(handle))
+	}
+
+	return set, nil
+}
+
+// ListMaps is part of Interface
+func (nft *realNFTables) ListMaps(ctx context.Context) ([]*Map, error) {
+	jsonMaps, err := nft.listObjects(ctx, "map")
+	if err != nil {
+		return nil, err
+	}
+
+	maps := make([]*Map, 0, len(jsonMaps))
+	for _, jsonMap := range jsonMaps {
+		mapObj, err := parseJSONMap(jsonMap)
+		if err != nil {
+			return nil, err
+		}
+		maps = append(maps, mapObj)
+	}
+	return maps, nil
+}
+
+// GetMap is part of Interface
+func (nft *realNFTables) GetMap(ctx context.Context, name string) (*Map, error) {
+	jsonMap, err := nft.getObject(ctx, "map", name)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONMap(jsonMap)
+}
+
+// getTableObject returns the JSON object for nft's table, or a NotFoundError if it
+// doesn't exist.
+func (nft *realNFTables) getTableObject(ctx context.Context) (jsonTable map[string]interface{}, err error) {
+	defer nft.recordList("table", time.Now(), func() int {
+		if jsonTable == nil {
+			return 0
+		}
+		return 1
+	})
+
+	// "nft list table" would output the entire contents of the table, so we list
+	// just the tables in the family instead.
+	out, err := nft.runCommand(ctx, nil, "--json", "list", "tables", string(nft.family))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run nft: %w", err)
+	}
+
+	jsonTables, err := nft.getJSONObjects(out, "table")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
+	}
+	for _, obj := range jsonTables {
+		if name, _ := jsonVal[string](obj, "name"); name == nft.table {
+			return obj, nil
+		}
+	}
+	return nil, &NotFoundError{ObjectType: "table", ObjectName: nft.table}
+}
+
+// GetTable is part of Interface
+func (nft *realNFTables) GetTable(ctx context.Context) (*Table, error) {
+	jsonTable, err := nft.getTableObject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONTable(jsonTable), nil
+}
+
+// parseJSONTable converts a "table" object from nft's JSON output into a Table
+func parseJSONTable(jsonTable map[string]interface{}) *Table {
+	// jsonTable will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "kube-proxy",
+	//     "handle": 1,
+	//     "comment": "rules for kube-proxy"
+	//   }
+	//
+	// (where "comment" is only output by nft 1.0.8 and later).
+	table := &Table{}
+	if comment, ok := jsonVal[string](jsonTable, "comment"); ok {
+		table.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonTable, "handle"); ok {
+		table.Handle = PtrTo(int(handle))
+	}
+	return table
+}
+
+// GetTableHandle is part of Interface
+func (nft *realNFTables) GetTableHandle(ctx context.Context) (int, error) {
+	jsonTable, err := nft.getTableObject(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return jsonHandle(jsonTable)
+}
+
+// GetChainHandle is part of Interface
+func (nft *realNFTables) GetChainHandle(ctx context.Context, name string) (int, error) {
+	jsonChain, err := nft.getObject(ctx, "chain", name)
+	if err != nil {
+		return 0, err
+	}
+	return jsonHandle(jsonChain)
+}
+
+// GetSetHandle is part of Interface
+func (nft *realNFTables) GetSetHandle(ctx context.Context, name string) (int, error) {
+	jsonSet, err := nft.getObject(ctx, "set", name)
+	if err != nil {
+		return 0, err
+	}
+	return jsonHandle(jsonSet)
+}
+
+// GetMapHandle is part of Interface
+func (nft *realNFTables) GetMapHandle(ctx context.Context, name string) (int, error) {
+	jsonMap, err := nft.getObject(ctx, "map", name)
+	if err != nil {
+		return 0, err
+	}
+	return jsonHandle(jsonMap)
+}
+
+// jsonHandle returns the "handle" field of a JSON object from nft's output.
+func jsonHandle(jsonObject map[string]interface{}) (int, error) {
+	handle, ok := jsonVal[float64](jsonObject, "handle")
+	if !ok {
+		return 0, fmt.Errorf("unexpected JSON output from nft (no handle)")
+	}
+	return int(handle), nil
+}
+
+// parseJSONMap converts a "map" object from nft's JSON output into a Map
+func parseJSONMap(jsonMap map[string]interface{}) (*Map, error) {
+	// jsonMap looks the same as a set (see parseJSONSet), except that it also has a
+	// "map" field containing the value type:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "test",
+	//     "table": "kube-proxy",
+	//     "type": ["ipv4_addr", "inet_proto"],
+	//     "map": "verdict",
+	//     "handle": 15
+	//   }
+
+	mapObj := &Map{}
+	mapObj.Name, _ = jsonVal[string](jsonMap, "name")
+
+	keyType, err := parseJSONType(jsonMap["type"])
+	if err != nil {
+		return nil, err
+	}
+	valueType, err := parseJSONType(jsonMap["map"])
+	if err != nil {
+		return nil, err
+	}
+	mapObj.Type = keyType + " : " + valueType
+
+	if flags, ok := jsonVal[[]interface{}](jsonMap, "flags"); ok {
+		mapObj.Flags, err = parseJSONSetFlags(flags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if timeout, ok := jsonVal[float64](jsonMap, "timeout"); ok {
+		mapObj.Timeout = PtrTo(time.Duration(timeout) * time.Second)
+	}
+	if gcInterval, ok := jsonVal[float64](jsonMap, "gc-interval"); ok {
+		mapObj.GCInterval = PtrTo(time.Duration(gcInterval) * time.Second)
+	}
+	if size, ok := jsonVal[float64](jsonMap, "size"); ok {
+		mapObj.Size = PtrTo(uint64(size))
+	}
+	if policy, ok := jsonVal[string](jsonMap, "policy"); ok {
+		mapObj.Policy = PtrTo(SetPolicy(policy))
+	}
+	if comment, ok := jsonVal[string](jsonMap, "comment"); ok {
+		mapObj.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonMap, "handle"); ok {
+		mapObj.Handle = PtrTo(int(handle))
+	}
+
+	return mapObj, nil
+}
+
+// ListFlowtables is part of Interface
+func (nft *realNFTables) ListFlowtables(ctx context.Context) ([]*Flowtable, error) {
+	jsonFlowtables, err := nft.listObjects(ctx, "flowtable")
+	if err != nil {
+		return nil, err
+	}
+
+	flowtables := make([]*Flowtable, 0, len(jsonFlowtables))
+	for _, jsonFlowtable := range jsonFlowtables {
+		flowtable, err := parseJSONFlowtable(jsonFlowtable)
+		if err != nil {
+			return nil, err
+		}
+		flowtables = append(flowtables, flowtable)
+	}
+	return flowtables, nil
+}
+
+// parseJSONFlowtable converts a "flowtable" object from nft's JSON output into a
+// Flowtable
+func parseJSONFlowtable(jsonFlowtable map[string]interface{}) (*Flowtable, error) {
+	// jsonFlowtable will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "myflowtable",
+	//     "table": "kube-proxy",
+	//     "handle": 5,
+	//     "hook": "ingress",
+	//     "prio": 0,
+	//     "dev": ["eth0", "eth1"]
+	//   }
+	//
+	// where "dev" will be a single string rather than an array if there is only one
+	// device.
+
+	flowtable := &Flowtable{}
+	flowtable.Name, _ = jsonVal[string](jsonFlowtable, "name")
+
+	if prio, ok := jsonVal[float64](jsonFlowtable, "prio"); ok {
+		flowtable.Priority = PtrTo(FlowtableIngressPriority(strconv.Itoa(int(prio))))
+	}
+	switch devices := jsonFlowtable["dev"].(type) {
+	case nil:
+	case string:
+		flowtable.Devices = []string{devices}
+	case []interface{}:
+		for _, dev := range devices {
+			devName, ok := dev.(string)
+			if !ok {
+				return nil, fmt.Errorf("could not parse flowtable device %q", dev)
+			}
+			flowtable.Devices = append(flowtable.Devices, devName)
+		}
+	default:
+		return nil, fmt.Errorf("could not parse flowtable devices %q", devices)
+	}
+	if handle, ok := jsonVal[float64](jsonFlowtable, "handle"); ok {
+		flowtable.Handle = PtrTo(int(handle))
+	}
+
+	return flowtable, nil
+}
+
+// ListCounters is part of Interface
+func (nft *realNFTables) ListCounters(ctx context.Context) ([]*Counter, error) {
+	jsonCounters, err := nft.listObjects(ctx, "counter")
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make([]*Counter, 0, len(jsonCounters))
+	for _, jsonCounter := range jsonCounters {
+		counters = append(counters, parseJSONCounter(jsonCounter))
+	}
+	return counters, nil
+}
+
+// GetCounter is part of Interface
+func (nft *realNFTables) GetCounter(ctx context.Context, name string) (*Counter, error) {
+	jsonCounter, err := nft.getObject(ctx, "counter", name)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONCounter(jsonCounter), nil
+}
+
+// parseJSONCounter converts a "counter" object from nft's JSON output into a Counter
+func parseJSONCounter(jsonCounter map[string]interface{}) *Counter {
+	// jsonCounter will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "mycounter",
+	//     "table": "kube-proxy",
+	//     "handle": 4,
+	//     "comment": "this is a comment",
+	//     "packets": 12,
+	//     "bytes": 1024
+	//   }
+
+	counter := &Counter{}
+	counter.Name, _ = jsonVal[string](jsonCounter, "name")
+
+	if packets, ok := jsonVal[float64](jsonCounter, "packets"); ok {
+		counter.Packets = PtrTo(uint64(packets))
+	}
+	if bytes, ok := jsonVal[float64](jsonCounter, "bytes"); ok {
+		counter.Bytes = PtrTo(uint64(bytes))
+	}
+	if comment, ok := jsonVal[string](jsonCounter, "comment"); ok {
+		counter.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonCounter, "handle"); ok {
+		counter.Handle = PtrTo(int(handle))
+	}
+
+	return counter
+}
+
+// ListQuotas is part of Interface
+func (nft *realNFTables) ListQuotas(ctx context.Context) ([]*Quota, error) {
+	jsonQuotas, err := nft.listObjects(ctx, "quota")
+	if err != nil {
+		return nil, err
+	}
+
+	quotas := make([]*Quota, 0, len(jsonQuotas))
+	for _, jsonQuota := range jsonQuotas {
+		quotas = append(quotas, parseJSONQuota(jsonQuota))
+	}
+	return quotas, nil
+}
+
+// parseJSONQuota converts a "quota" object from nft's JSON output into a Quota
+func parseJSONQuota(jsonQuota map[string]interface{}) *Quota {
+	// jsonQuota will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "myquota",
+	//     "table": "kube-proxy",
+	//     "handle": 4,
+	//     "bytes": 1048576,
+	//     "used": 1024,
+	//     "inv": true
+	//   }
+	//
+	// where "inv" indicates an "over" quota.
+
+	quota := &Quota{}
+	quota.Name, _ = jsonVal[string](jsonQuota, "name")
+
+	if bytes, ok := jsonVal[float64](jsonQuota, "bytes"); ok {
+		quota.Bytes = uint64(bytes)
+	}
+	if used, ok := jsonVal[float64](jsonQuota, "used"); ok {
+		quota.Used = PtrTo(uint64(used))
+	}
+	quota.Over, _ = jsonVal[bool](jsonQuota, "inv")
+	if comment, ok := jsonVal[string](jsonQuota, "comment"); ok {
+		quota.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonQuota, "handle"); ok {
+		quota.Handle = PtrTo(int(handle))
+	}
+
+	return quota
+}
+
+// ListLimits is part of Interface
+func (nft *realNFTables) ListLimits(ctx context.Context) ([]*Limit, error) {
+	jsonLimits, err := nft.listObjects(ctx, "limit")
+	if err != nil {
+		return nil, err
+	}
+
+	limits := make([]*Limit, 0, len(jsonLimits))
+	for _, jsonLimit := range jsonLimits {
+		limits = append(limits, parseJSONLimit(jsonLimit))
+	}
+	return limits, nil
+}
+
+// parseJSONLimit converts a "limit" object from nft's JSON output into a Limit
+func parseJSONLimit(jsonLimit map[string]interface{}) *Limit {
+	// jsonLimit will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "mylimit",
+	//     "table": "kube-proxy",
+	//     "handle": 4,
+	//     "rate": 10,
+	//     "per": "second",
+	//     "rate_unit": "mbytes",
+	//     "burst": 100,
+	//     "burst_unit": "kbytes",
+	//     "inv": true
+	//   }
+	//
+	// where "rate_unit" and "burst_unit" are only present for byte limits, and "burst"
+	// is only present if it is non-0.
+
+	limit := &Limit{}
+	limit.Name, _ = jsonVal[string](jsonLimit, "name")
+
+	if rate, ok := jsonVal[float64](jsonLimit, "rate"); ok {
+		limit.Rate = uint64(rate)
+	}
+	limit.RateUnit, _ = jsonVal[string](jsonLimit, "rate_unit")
+	limit.Per, _ = jsonVal[string](jsonLimit, "per")
+	if burst, ok := jsonVal[float64](jsonLimit, "burst"); ok && burst != 0 {
+		limit.Burst = PtrTo(uint64(burst))
+		limit.BurstUnit, _ = jsonVal[string](jsonLimit, "burst_unit")
+	}
+	limit.Inverse, _ = jsonVal[bool](jsonLimit, "inv")
+	if comment, ok := jsonVal[string](jsonLimit, "comment"); ok {
+		limit.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonLimit, "handle"); ok {
+		limit.Handle = PtrTo(int(handle))
 	}
 
-	buf, err := tx.asCommandBuf()
+	return limit
+}
+
+// ListCTTimeouts is part of Interface
+func (nft *realNFTables) ListCTTimeouts(ctx context.Context) ([]*CTTimeout, error) {
+	jsonTimeouts, err := nft.listCTObjects(ctx, "timeout")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	cmd := exec.CommandContext(ctx, nft.path, "-f", "-")
-	cmd.Stdin = buf
-	_, err = nft.exec.Run(cmd)
-	return err
+	timeouts := make([]*CTTimeout, 0, len(jsonTimeouts))
+	for _, jsonTimeout := range jsonTimeouts {
+		timeouts = append(timeouts, parseJSONCTTimeout(jsonTimeout))
+	}
+	return timeouts, nil
 }
 
-// Check is part of Interface
-func (nft *realNFTables) Check(ctx context.Context, tx *Transaction) error {
-	if tx.err != nil {
-		return tx.err
-	}
+// parseJSONCTTimeout converts a "ct timeout" object from nft's JSON output into a
+// CTTimeout
+func parseJSONCTTimeout(jsonTimeout map[string]interface{}) *CTTimeout {
+	// jsonTimeout will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "mytimeout",
+	//     "table": "kube-proxy",
+	//     "handle": 4,
+	//     "protocol": "tcp",
+	//     "l3proto": "ip",
+	//     "policy": {
+	//       "established": 120,
+	//       "close": 10
+	//     }
+	//   }
 
-	buf, err := tx.asCommandBuf()
-	if err != nil {
-		return err
+	timeout := &CTTimeout{}
+	timeout.Name, _ = jsonVal[string](jsonTimeout, "name")
+	timeout.Protocol, _ = jsonVal[string](jsonTimeout, "protocol")
+	if l3proto, ok := jsonVal[string](jsonTimeout, "l3proto"); ok {
+		timeout.L3Proto = PtrTo(Family(l3proto))
+	}
+	if policy, ok := jsonVal[map[string]interface{}](jsonTimeout, "policy"); ok {
+		timeout.Policy = make(map[string]uint32, len(policy))
+		for state, val := range policy {
+			if seconds, ok := val.(float64); ok {
+				timeout.Policy[state] = uint32(seconds)
+			}
+		}
+	}
+	if comment, ok := jsonVal[string](jsonTimeout, "comment"); ok {
+		timeout.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonTimeout, "handle"); ok {
+		timeout.Handle = PtrTo(int(handle))
 	}
 
-	cmd := exec.CommandContext(ctx, nft.path, "--check", "-f", "-")
-	cmd.Stdin = buf
-	_, err = nft.exec.Run(cmd)
-	return err
+	return timeout
 }
 
-// jsonVal looks up key in json; if it exists and is of type T, it returns (json[key], true).
-// Otherwise it returns (_, false).
-func jsonVal[T any](json map[string]interface{}, key string) (T, bool) {
-	if ifVal, exists := json[key]; exists {
-		tVal, ok := ifVal.(T)
-		return tVal, ok
+// ListCTExpectations is part of Interface
+func (nft *realNFTables) ListCTExpectations(ctx context.Context) ([]*CTExpectation, error) {
+	jsonExpectations, err := nft.listCTObjects(ctx, "expectation")
+	if err != nil {
+		return nil, err
 	}
-	var zero T
-	return zero, false
+
+	expectations := make([]*CTExpectation, 0, len(jsonExpectations))
+	for _, jsonExpectation := range jsonExpectations {
+		expectations = append(expectations, parseJSONCTExpectation(jsonExpectation))
+	}
+	return expectations, nil
 }
 
-// getJSONObjects takes the output of "nft -j list", validates it, and returns an array
-// of just the objects of objectType.
-func getJSONObjects(listOutput, objectType string) ([]map[string]interface{}, error) {
-	// listOutput should contain JSON looking like:
-	//
-	// {
-	//   "nftables": [
-	//     {
-	//       "metainfo": {
-	//         "json_schema_version": 1,
-	//         ...
-	//       }
-	//     },
-	//     {
-	//       "chain": {
-	//         "family": "ip",
-	//         "table": "kube-proxy",
-	//         "name": "KUBE-SERVICES",
-	//         "handle": 3
-	//       }
-	//     },
-	//     {
-	//       "chain": {
-	//         "family": "ip",
-	//         "table": "kube-proxy",
-	//         "name": "KUBE-NODEPORTS",
-	//         "handle": 4
-	//       }
-	//     },
-	//     ...
-	//   ]
-	// }
-	//
-	// In this case, given objectType "chain", we would return
+// parseJSONCTExpectation converts a "ct expectation" object from nft's JSON output
+// into a CTExpectation
+func parseJSONCTExpectation(jsonExpectation map[string]interface{}) *CTExpectation {
+	// jsonExpectation will look something like:
 	//
-	// [
 	//   {
 	//     "family": "ip",
+	//     "name": "myexpectation",
 	//     "table": "kube-proxy",
-	//     "name": "KUBE-SERVICES",
-	//     "handle": 3
-	//   },
+	//     "handle": 4,
+	//     "protocol": "tcp",
+	//     "dport": 21,
+	//     "timeout": 30000,
+	//     "size": 8,
+	//     "l3proto": "ip"
+	//   }
+	//
+	// where "timeout" is in milliseconds.
+
+	expect := &CTExpectation{}
+	expect.Name, _ = jsonVal[string](jsonExpectation, "name")
+	if l3proto, ok := jsonVal[string](jsonExpectation, "l3proto"); ok {
+		expect.L3Proto = PtrTo(Family(l3proto))
+	}
+	expect.Protocol, _ = jsonVal[string](jsonExpectation, "protocol")
+	if dport, ok := jsonVal[float64](jsonExpectation, "dport"); ok {
+		expect.DPort = uint16(dport)
+	}
+	if timeout, ok := jsonVal[float64](jsonExpectation, "timeout"); ok {
+		expect.Timeout = time.Duration(timeout) * time.Millisecond
+	}
+	if size, ok := jsonVal[float64](jsonExpectation, "size"); ok {
+		expect.Size = uint8(size)
+	}
+	if comment, ok := jsonVal[string](jsonExpectation, "comment"); ok {
+		expect.Comment = &comment
+	}
+	if handle, ok := jsonVal[float64](jsonExpectation, "handle"); ok {
+		expect.Handle = PtrTo(int(handle))
+	}
+
+	return expect
+}
+
+// parseJSONCTHelper converts a "ct helper" object from nft's JSON output into a
+// CTHelper
+func parseJSONCTHelper(jsonHelper map[string]interface{}) *CTHelper {
+	// jsonHelper will look something like:
+	//
 	//   {
 	//     "family": "ip",
+	//     "name": "myhelper",
 	//     "table": "kube-proxy",
-	//     "name": "KUBE-NODEPORTS",
-	//     "handle": 4
-	//   },
-	//   ...
-	// ]
-
-	jsonResult := map[string][]map[string]map[string]interface{}{}
-	if err := json.Unmarshal([]byte(listOutput), &jsonResult); err != nil {
-		return nil, fmt.Errorf("could not parse nft output: %w", err)
-	}
+	//     "handle": 4,
+	//     "type": "ftp",
+	//     "protocol": "tcp",
+	//     "l3proto": "ip"
+	//   }
 
-	nftablesResult := jsonResult["nftables"]
-	if len(nftablesResult) == 0 {
-		return nil, fmt.Errorf("could not find result in nft output %q", listOutput)
+	helper := &CTHelper{}
+	helper.Name, _ = jsonVal[string](jsonHelper, "name")
+	helper.Type, _ = jsonVal[string](jsonHelper, "type")
+	helper.Protocol, _ = jsonVal[string](jsonHelper, "protocol")
+	if l3proto, ok := jsonVal[string](jsonHelper, "l3proto"); ok {
+		helper.L3Proto = PtrTo(Family(l3proto))
 	}
-	metainfo := nftablesResult[0]["metainfo"]
-	if metainfo == nil {
-		return nil, fmt.Errorf("could not find metadata in nft output %q", listOutput)
+	if comment, ok := jsonVal[string](jsonHelper, "comment"); ok {
+		helper.Comment = &comment
 	}
-	// json_schema_version is an integer but `json.Unmarshal()` will have parsed it as
-	// a float64 since we didn't tell it otherwise.
-	if version, ok := jsonVal[float64](metainfo, "json_schema_version"); !ok || version != 1.0 {
-		return nil, fmt.Errorf("could not find supported json_schema_version in nft output %q", listOutput)
+	if handle, ok := jsonVal[float64](jsonHelper, "handle"); ok {
+		helper.Handle = PtrTo(int(handle))
 	}
 
-	var objects []map[string]interface{}
-	for _, objContainer := range nftablesResult {
-		obj := objContainer[objectType]
-		if obj != nil {
-			objects = append(objects, obj)
-		}
-	}
-	return objects, nil
+	return helper
 }
 
-// List is part of Interface.
-func (nft *realNFTables) List(ctx context.Context, objectType string) ([]string, error) {
-	// All currently-existing nftables object types have plural forms that are just
-	// the singular form plus 's'.
-	var typeSingular, typePlural string
-	if objectType[len(objectType)-1] == 's' {
-		typeSingular = objectType[:len(objectType)-1]
-		typePlural = objectType
-	} else {
-		typeSingular = objectType
-		typePlural = objectType + "s"
-	}
+// parseJSONSecmark converts a "secmark" object from nft's JSON output into a Secmark
+func parseJSONSecmark(jsonSecmark map[string]interface{}) *Secmark {
+	// jsonSecmark will look something like:
+	//
+	//   {
+	//     "family": "ip",
+	//     "name": "mysecmark",
+	//     "table": "kube-proxy",
+	//     "handle": 4,
+	//     "context": "system_u:object_r:ssh_server_packet_t:s0"
+	//   }
 
-	cmd := exec.CommandContext(ctx, nft.path, "--json", "list", typePlural, string(nft.family))
-	out, err := nft.exec.Run(cmd)
-	if err != nil {
-		return nil, fmt.Errorf("failed to run nft: %w", err)
+	secmark := &Secmark{}
+	secmark.Name, _ = jsonVal[string](jsonSecmark, "name")
+	secmark.Context, _ = jsonVal[string](jsonSecmark, "context")
+	if comment, ok := jsonVal[string](jsonSecmark, "comment"); ok {
+		secmark.Comment = &comment
 	}
-
-	objects, err := getJSONObjects(out, typeSingular)
-	if err != nil {
-		return nil, err
+	if handle, ok := jsonVal[float64](jsonSecmark, "handle"); ok {
+		secmark.Handle = PtrTo(int(handle))
 	}
 
-	var result []string
-	for _, obj := range objects {
-		objTable, _ := jsonVal[string](obj, "table")
-		if objTable != nft.table {
-			continue
+	return secmark
+}
+
+// parseJSONType parses the "type" (or "map") field of a set or map, converting
+// concatenated types to nft syntax.
+func parseJSONType(json interface{}) (string, error) {
+	switch val := json.(type) {
+	case string:
+		return val, nil
+	case []interface{}:
+		types := make([]string, len(val))
+		for i := range val {
+			str, ok := val[i].(string)
+			if !ok {
+				return "", fmt.Errorf("could not parse type %q", val)
+			}
+			types[i] = str
 		}
+		return strings.Join(types, " . "), nil
+	}
+	return "", fmt.Errorf("could not parse type %q", json)
+}
 
-		if name, ok := jsonVal[string](obj, "name"); ok {
-			result = append(result, name)
+// parseJSONSetFlags parses the "flags" field of a set or map
+func parseJSONSetFlags(json []interface{}) ([]SetFlag, error) {
+	flags := make([]SetFlag, len(json))
+	for i := range json {
+		str, ok := json[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("could not parse flag %q", json[i])
 		}
+		flags[i] = SetFlag(str)
 	}
-	return result, nil
+	return flags, nil
 }
 
 // ListRules is part of Interface
-func (nft *realNFTables) ListRules(ctx context.Context, chain string) ([]*Rule, error) {
-	cmd := exec.CommandContext(ctx, nft.path, "--json", "list", "chain", string(nft.family), nft.table, chain)
-	out, err := nft.exec.Run(cmd)
+func (nft *realNFTables) ListRules(ctx context.Context, chain string) (rules []*Rule, err error) {
+	defer nft.recordList("rule", time.Now(), func() int { return len(rules) })
+
+	out, err := nft.runCommand(ctx, nil, "--json", "list", "chain", string(nft.family), nft.table, chain)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run nft: %w", err)
+		return nil, listError(err, "chain", chain)
 	}
 
-	jsonRules, err := getJSONObjects(out, "rule")
+	jsonRules, err := nft.getJSONObjects(out, "rule")
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
 	}
 
-	rules := make([]*Rule, 0, len(jsonRules))
+	rules = make([]*Rule, 0, len(jsonRules))
 	for _, jsonRule := range jsonRules {
-		rule := &Rule{
-			Chain: chain,
-		}
+		rule := parseJSONRule(jsonRule)
+		rule.Chain = chain
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
 
-		// handle is written as an integer in nft's output, but json.Unmarshal
-		// will have parsed it as a float64. (Handles are uint64s, but they are
-		// assigned consecutively starting from 1, so as long as fewer than 2**53
-		// nftables objects have been created since boot time, we won't run into
-		// float64-vs-uint64 precision issues.)
-		if handle, ok := jsonVal[float64](jsonRule, "handle"); ok {
-			rule.Handle = PtrTo(int(handle))
-		}
-		if comment, ok := jsonVal[string](jsonRule, "comment"); ok {
-			rule.Comment = &comment
+// parseJSONRule converts a "rule" object from nft's JSON output into a Rule (without
+// its Rule field, since there's no easy way to convert the JSON rule expression back
+// into nft syntax; the expression is returned in Exprs instead).
+func parseJSONRule(jsonRule map[string]interface{}) *Rule {
+	rule := &Rule{}
+	rule.Chain, _ = jsonVal[string](jsonRule, "chain")
+
+	// handle is written as an integer in nft's output, but json.Unmarshal will have
+	// parsed it as a float64. (Handles are uint64s, but they are assigned
+	// consecutively starting from 1, so as long as fewer than 2**53 nftables objects
+	// have been created since boot time, we won't run into float64-vs-uint64
+	// precision issues.)
+	if handle, ok := jsonVal[float64](jsonRule, "handle"); ok {
+		rule.Handle = PtrTo(int(handle))
+	}
+	if comment, ok := jsonVal[string](jsonRule, "comment"); ok {
+		rule.Comment = &comment
+	}
+	if exprs, ok := jsonVal[[]interface{}](jsonRule, "expr"); ok {
+		rule.Exprs = make([]json.RawMessage, 0, len(exprs))
+		for _, expr := range exprs {
+			// expr came from json.Unmarshal, so it can be marshalled back.
+			raw, _ := json.Marshal(expr)
+			rule.Exprs = append(rule.Exprs, raw)
 		}
+	}
 
-		rules = append(rules, rule)
+	return rule
+}
+
+// ListAllRules is part of Interface
+func (nft *realNFTables) ListAllRules(ctx context.Context) ([]*Rule, error) {
+	rs, err := nft.exportRuleset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules := rs.Tables[0].Rules
+	if rules == nil {
+		rules = []*Rule{}
 	}
 	return rules, nil
 }
 
 // ListElements is part of Interface
-func (nft *realNFTables) ListElements(ctx context.Context, objectType, name string) ([]*Element, error) {
-	cmd := exec.CommandContext(ctx, nft.path, "--json", "list", objectType, string(nft.family), nft.table, name)
-	out, err := nft.exec.Run(cmd)
+func (nft *realNFTables) ListElements(ctx context.Context, objectType, name string) (elements []*Element, err error) {
+	defer nft.recordList("element", time.Now(), func() int { return len(elements) })
+
+	out, err := nft.runCommand(ctx, nil, "--json", "list", objectType, string(nft.family), nft.table, name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run nft: %w", err)
+		return nil, listError(err, objectType, name)
 	}
 
-	jsonSetsOrMaps, err := getJSONObjects(out, objectType)
+	jsonSetsOrMaps, err := nft.getJSONObjects(out, objectType)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
 	}
@@ -348,7 +2300,14 @@ func (nft *realNFTables) ListElements(ctx context.Context, objectType, name stri
 		return nil, fmt.Errorf("unexpected JSON output from nft (multiple results)")
 	}
 
-	jsonElements, _ := jsonVal[[]interface{}](jsonSetsOrMaps[0], "elem")
+	return parseJSONElements(jsonSetsOrMaps[0], objectType, name)
+}
+
+// parseJSONElements parses the "elem" field of a "set" or "map" object (as indicated by
+// objectType) from nft's JSON output into Elements.
+func parseJSONElements(jsonSetOrMap map[string]interface{}, objectType, name string) ([]*Element, error) {
+	var err error
+	jsonElements, _ := jsonVal[[]interface{}](jsonSetOrMap, "elem")
 	elements := make([]*Element, 0, len(jsonElements))
 	for _, jsonElement := range jsonElements {
 		var key, value interface{}
@@ -366,17 +2325,20 @@ func (nft *realNFTables) ListElements(ctx context.Context, objectType, name stri
 			key, value = tuple[0], tuple[1]
 		}
 
-		// If the element has a comment, then key will be a compound object like:
+		// If the element has a comment or timeout, then key will be a compound
+		// object like:
 		//
 		//   {
 		//     "elem": {
 		//       "val": "192.168.0.1",
-		//       "comment": "this is a comment"
+		//       "comment": "this is a comment",
+		//       "timeout": 300,
+		//       "expires": 287
 		//     }
 		//   }
 		//
 		// (Where "val" contains the value that key would have held if there was no
-		// comment.)
+		// comment or timeout, and "timeout" and "expires" are in seconds.)
 		if obj, ok := key.(map[string]interface{}); ok {
 			if compoundElem, ok := jsonVal[map[string]interface{}](obj, "elem"); ok {
 				if key, ok = jsonVal[interface{}](compoundElem, "val"); !ok {
@@ -385,6 +2347,12 @@ func (nft *realNFTables) ListElements(ctx context.Context, objectType, name stri
 				if comment, ok := jsonVal[string](compoundElem, "comment"); ok {
 					elem.Comment = &comment
 				}
+				if timeout, ok := jsonVal[float64](compoundElem, "timeout"); ok {
+					elem.Timeout = time.Duration(timeout * float64(time.Second))
+				}
+				if expires, ok := jsonVal[float64](compoundElem, "expires"); ok {
+					elem.ExpiresAt = time.Now().Add(time.Duration(expires * float64(time.Second)))
+				}
 			}
 		}
 
@@ -414,7 +2382,7 @@ func parseElementValue(json interface{}) ([]string, error) {
 	//   - a single number, e.g. 80
 	//
 	//   - a concatenation, expressed as an object containing an array of simple
-	//     values:
+	//     values (or, in an interval set, prefixes and ranges as described below):
 	//        {
 	//          "concat": [
 	//            "192.168.1.3",
@@ -423,6 +2391,23 @@ func parseElementValue(json interface{}) ([]string, error) {
 	//          ]
 	//        }
 	//
+	//   - a CIDR prefix or range (in an interval set), expressed as an object:
+	//        {
+	//          "prefix": {
+	//            "addr": "10.0.0.0",
+	//            "len": 8
+	//          }
+	//        }
+	//
+	//        {
+	//          "range": [
+	//            "10.0.0.0",
+	//            "10.255.255.255"
+	//          ]
+	//        }
+	//
+	//     which we return as "10.0.0.0/8" and "10.0.0.0-10.255.255.255".
+	//
 	//   - a verdict (for a vmap value), expressed as an object:
 	//        {
 	//          "drop": null
@@ -447,11 +2432,17 @@ func parseElementValue(json interface{}) ([]string, error) {
 					vals[i] = str
 				} else if num, ok := concat[i].(float64); ok {
 					vals[i] = fmt.Sprintf("%d", int(num))
+				} else if obj, ok := concat[i].(map[string]interface{}); ok {
+					if vals[i], ok = parseElementInterval(obj); !ok {
+						return nil, fmt.Errorf("could not parse element value %q", concat[i])
+					}
 				} else {
 					return nil, fmt.Errorf("could not parse element value %q", concat[i])
 				}
 			}
 			return vals, nil
+		} else if interval, ok := parseElementInterval(val); ok {
+			return []string{interval}, nil
 		} else if len(val) == 1 {
 			var verdict string
 			// We just checked that len(val) == 1, so this loop body will only
@@ -469,3 +2460,164 @@ func parseElementValue(json interface{}) ([]string, error) {
 
 	return nil, fmt.Errorf("could not parse element value %q", json)
 }
+
+// parseElementInterval parses a JSON "prefix" or "range" element value into a string
+// (see parseElementValue).
+func parseElementInterval(json map[string]interface{}) (string, bool) {
+	if prefix, ok := jsonVal[map[string]interface{}](json, "prefix"); ok {
+		addr, ok1 := jsonVal[string](prefix, "addr")
+		length, ok2 := jsonVal[float64](prefix, "len")
+		if !ok1 || !ok2 {
+			return "", false
+		}
+		return fmt.Sprintf("%s/%d", addr, int(length)), true
+	}
+	if rangeVal, ok := jsonVal[[]interface{}](json, "range"); ok && len(rangeVal) == 2 {
+		var bounds [2]string
+		for i := range rangeVal {
+			if str, ok := rangeVal[i].(string); ok {
+				bounds[i] = str
+			} else if num, ok := rangeVal[i].(float64); ok {
+				bounds[i] = fmt.Sprintf("%d", int(num))
+			} else {
+				return "", false
+			}
+		}
+		return bounds[0] + "-" + bounds[1], true
+	}
+	return "", false
+}
+
+// ListAllElements is part of Interface
+func (nft *realNFTables) ListAllElements(ctx context.Context) ([]*Element, error) {
+	rs, err := nft.exportRuleset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	elements := rs.Tables[0].Elements
+	if elements == nil {
+		elements = []*Element{}
+	}
+	return elements, nil
+}
+
+// ExportRuleset is part of Interface
+func (nft *realNFTables) ExportRuleset(ctx context.Context) (*Ruleset, error) {
+	rs, err := nft.exportRuleset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := nft.fillRuleText(ctx, rs.Tables[0]); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// exportRuleset implements ExportRuleset, without filling in the rules' Rule fields.
+func (nft *realNFTables) exportRuleset(ctx context.Context) (*Ruleset, error) {
+	var table *RulesetTable
+	defer nft.recordList("table", time.Now(), func() int {
+		if table == nil {
+			return 0
+		}
+		return 1
+	})
+
+	out, err := nft.runCommand(ctx, nil, "--json", "list", "table", string(nft.family), nft.table)
+	if err != nil {
+		return nil, listError(err, "table", nft.table)
+	}
+
+	rs, err := parseRuleset(out, nft.minJSONSchemaVersion, nft.maxJSONSchemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON output: %w", err)
+	}
+	table = rs.Table(nft.family, nft.table)
+	if table == nil {
+		return nil, fmt.Errorf("unexpected JSON output from nft (table not found)")
+	}
+	return &Ruleset{Tables: []*RulesetTable{table}}, nil
+}
+
+// fillRuleText fills in the Rule fields of table's rules, using a text-format listing of
+// the table, since there's no easy way to convert the JSON rule expression back into nft
+// syntax.
+func (nft *realNFTables) fillRuleText(ctx context.Context, table *RulesetTable) error {
+	if len(table.Rules) == 0 {
+		return nil
+	}
+
+	out, err := nft.runCommand(ctx, nil, "--stateless", "--handle", "list", "table", string(nft.family), nft.table)
+	if err != nil {
+		return listError(err, "table", nft.table)
+	}
+
+	ruleText := parseTableListing(out)
+	for _, rule := range table.Rules {
+		if rule.Handle == nil {
+			continue
+		}
+		text, ok := ruleText[*rule.Handle]
+		if !ok {
+			continue
+		}
+		if rule.Comment != nil {
+			text = strings.TrimSuffix(text, ` comment "`+*rule.Comment+`"`)
+		}
+		rule.Rule = text
+	}
+	return nil
+}
+
+// handleCommentRegexp matches a line of "nft --handle" output, which ends with the
+// object's handle.
+var handleCommentRegexp = regexp.MustCompile(`^(.*\S)\s+# handle (\d+)$`)
+
+// parseTableListing parses the output of "nft --stateless --handle list table" (in text
+// format) and returns the text of its rules (including their comments, if any), indexed
+// by handle.
+func parseTableListing(listing string) map[int]string {
+	// Remove the handles from the lines that start the table, chains, and other
+	// objects, so that parseChainListing will recognize them. The table's other
+	// objects are parsed as though they were chains, but since only rules have
+	// handles at the ends of their lines, they will be ignored below.
+	lines := strings.Split(listing, "\n")
+	for i, line := range lines {
+		match := handleCommentRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if match != nil && strings.HasSuffix(match[1], "{") {
+			lines[i] = match[1]
+		}
+	}
+
+	rules := make(map[int]string)
+	for _, rule := range parseChainListing(strings.Join(lines, "\n")) {
+		match := handleCommentRegexp.FindStringSubmatch(rule)
+		if match == nil {
+			continue
+		}
+		handle, err := strconv.Atoi(match[2])
+		if err == nil {
+			rules[handle] = match[1]
+		}
+	}
+	return rules
+}
+
+// ListState is part of Interface. (nft includes runtime state in its output unless it is
+// run with --stateless, so this is just a filtered ExportRuleset.)
+func (nft *realNFTables) ListState(ctx context.Context) (*Ruleset, error) {
+	rs, err := nft.exportRuleset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stateRuleset(rs), nil
+}
+
+// ImportRuleset is part of Interface
+func (nft *realNFTables) ImportRuleset(ctx context.Context, rs *Ruleset) error {
+	tx, err := rulesetTransaction(nft.NewTransaction(), rs)
+	if err != nil {
+		return err
+	}
+	return nft.Run(ctx, tx)
+}
@@ -18,36 +18,61 @@ package knftables
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/lithammer/dedent"
 )
 
-func newTestInterface(t *testing.T, family Family, tableName string) (Interface, *fakeExec, error) {
+func newTestInterface(t *testing.T, family Family, tableName string, opts ...Option) (Interface, *fakeExec, error) {
 	fexec := newFakeExec(t)
-	ip := "ip"
-	if family == IPv6Family {
-		ip = "ip6"
-	}
 	fexec.expected = append(fexec.expected,
 		expectedCmd{
 			args:   []string{"/nft", "--version"},
 			stdout: "nftables v1.0.7 (Old Doc Yak)\n",
 		},
 		expectedCmd{
-			args: []string{"/nft", "--check", "add", "table", ip, tableName,
+			args: []string{"/nft", "--check", "add", "table", string(family), tableName,
 				"{", "comment", `"test"`, "}",
 			},
 		},
+		expectedCmd{
+			args: []string{"/nft", "--check",
+				"add", "table", string(family), tableName, ";",
+				"add", "set", string(family), tableName, "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check",
+				"add", "table", string(family), tableName, ";",
+				"add", "set", string(family), tableName, "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			},
+		},
 	)
-	nft, err := newInternal(family, tableName, fexec)
+	nft, err := newInternal(family, tableName, fexec, opts...)
 	return nft, fexec, err
 }
 
+// rawExprs returns exprs as the Exprs field of a Rule
+func rawExprs(exprs ...string) []json.RawMessage {
+	raw := make([]json.RawMessage, 0, len(exprs))
+	for _, expr := range exprs {
+		raw = append(raw, json.RawMessage(expr))
+	}
+	return raw
+}
+
 func TestListBad(t *testing.T) {
 	for _, tc := range []struct {
 		name      string
@@ -128,6 +153,81 @@ func TestListBad(t *testing.T) {
 	}
 }
 
+func TestJSONSchemaVersion(t *testing.T) {
+	v1Output := `{"nftables":[{"metainfo":{"json_schema_version":1}},{"chain":{"family":"ip","table":"testing","name":"chain","handle":1}}]}`
+	v2Output := `{"nftables":[{"metainfo":{"json_schema_version":2}},{"chain":{"family":"ip","table":"testing","name":"chain","handle":1}}]}`
+
+	for _, tc := range []struct {
+		name     string
+		opts     []Option
+		output   string
+		expectOK bool
+	}{
+		{
+			name:     "default accepts v1",
+			output:   v1Output,
+			expectOK: true,
+		},
+		{
+			name:   "default rejects v2",
+			output: v2Output,
+		},
+		{
+			name:     "max 2 accepts v1",
+			opts:     []Option{WithMaxJSONSchemaVersion(2)},
+			output:   v1Output,
+			expectOK: true,
+		},
+		{
+			name:     "max 2 accepts v2",
+			opts:     []Option{WithMaxJSONSchemaVersion(2)},
+			output:   v2Output,
+			expectOK: true,
+		},
+		{
+			name:   "min 2 rejects v1",
+			opts:   []Option{WithMinJSONSchemaVersion(2), WithMaxJSONSchemaVersion(2)},
+			output: v1Output,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft, fexec, err := newTestInterface(t, IPv4Family, "testing", tc.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error creating Interface: %v", err)
+			}
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", "chains", "ip"},
+					stdout: tc.output,
+				},
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", "table", "ip", "testing"},
+					stdout: strings.Replace(tc.output, `{"chain"`, `{"table":{"family":"ip","name":"testing","handle":1}},{"chain"`, 1),
+				},
+			)
+
+			_, err = nft.ListChains(context.Background())
+			if tc.expectOK && err != nil {
+				t.Errorf("unexpected error from ListChains: %v", err)
+			} else if !tc.expectOK && (err == nil || !strings.Contains(err.Error(), "could not find supported json_schema_version")) {
+				t.Errorf("expected schema version error from ListChains, got %v", err)
+			}
+
+			_, err = nft.ExportRuleset(context.Background())
+			if tc.expectOK && err != nil {
+				t.Errorf("unexpected error from ExportRuleset: %v", err)
+			} else if !tc.expectOK && (err == nil || !strings.Contains(err.Error(), "could not find supported json_schema_version")) {
+				t.Errorf("expected schema version error from ExportRuleset, got %v", err)
+			}
+		})
+	}
+
+	_, err := newInternal(IPv4Family, "testing", newFakeExec(t), WithMinJSONSchemaVersion(3), WithMaxJSONSchemaVersion(2))
+	if err == nil {
+		t.Errorf("expected error with min version greater than max version")
+	}
+}
+
 func TestList(t *testing.T) {
 	for _, tc := range []struct {
 		name       string
@@ -174,71 +274,33 @@ func TestList(t *testing.T) {
 	}
 }
 
-func TestRun(t *testing.T) {
-	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
-
-	tx := nft.NewTransaction()
-
-	tx.Add(&Table{})
-	tx.Add(&Chain{
-		Name:    "chain",
-		Comment: PtrTo("foo"),
-	})
-	tx.Add(&Rule{
-		Chain: "chain",
-		Rule:  "ip daddr 10.0.0.0/8 drop",
-	})
-
-	expected := strings.TrimPrefix(dedent.Dedent(`
-		add table ip kube-proxy
-		add chain ip kube-proxy chain { comment "foo" ; }
-		add rule ip kube-proxy chain ip daddr 10.0.0.0/8 drop
-		`), "\n")
-	fexec.expected = append(fexec.expected,
-		expectedCmd{
-			args:  []string{"/nft", "-f", "-"},
-			stdin: expected,
-		},
-	)
-
-	err := nft.Run(context.Background(), tx)
-	if err != nil {
-		t.Errorf("unexpected error from Run: %v", err)
-	}
-}
-
-func TestListRules(t *testing.T) {
+func TestListChains(t *testing.T) {
 	for _, tc := range []struct {
 		name       string
 		nftOutput  string
-		nftError   string
-		listOutput []*Rule
+		listOutput []*Chain
 	}{
 		{
-			name:     "no such chain",
-			nftError: "Error: No such file or directory\nlist chain ip testing testchain\n                      ^^^^^^^^^\n",
-		},
-		{
-			name:       "no rules",
-			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "testchain", "handle": 21}}]}`,
-			listOutput: []*Rule{},
+			name:       "empty list",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}]}`,
+			listOutput: []*Chain{},
 		},
 		{
 			name:      "normal output",
-			nftOutput: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "testchain", "handle": 165}}, {"rule": {"family": "ip", "table": "testing", "chain": "testchain", "handle": 169, "expr": [{"match": {"op": "==", "left": {"ct": {"key": "state"}}, "right": {"set": ["established", "related"]}}}, {"accept": null}]}}, {"rule": {"family": "ip", "table": "testing", "chain": "testchain", "handle": 170, "comment": "This rule does something", "expr": [{"match": {"op": "in", "left": {"ct": {"key": "status"}}, "right": "dnat"}}, {"accept": null}]}}, {"rule": {"family": "ip", "table": "testing", "chain": "testchain", "handle": 171, "expr": [{"match": {"op": "==", "left": {"meta": {"key": "iifname"}}, "right": "lo"}}, {"accept": null}]}}]}`,
-			listOutput: []*Rule{
-				{
-					Chain:  "testchain",
-					Handle: PtrTo(169),
-				},
+			nftOutput: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "prerouting", "handle": 1, "type": "nat", "hook": "prerouting", "prio": -100, "policy": "accept"}}, {"chain": {"family": "ip", "table": "testing", "name": "KUBE-SERVICES", "handle": 11, "comment": "services chain"}}, {"chain": {"family": "ip", "table": "filter", "name": "INPUT", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "accept"}}]}`,
+			listOutput: []*Chain{
 				{
-					Chain:   "testchain",
-					Comment: PtrTo("This rule does something"),
-					Handle:  PtrTo(170),
+					Name:     "prerouting",
+					Type:     PtrTo(NATType),
+					Hook:     PtrTo(PreroutingHook),
+					Priority: PtrTo(BaseChainPriority("-100")),
+					Policy:   PtrTo(AcceptPolicy),
+					Handle:   PtrTo(1),
 				},
 				{
-					Chain:  "testchain",
-					Handle: PtrTo(171),
+					Name:    "KUBE-SERVICES",
+					Comment: PtrTo("services chain"),
+					Handle:  PtrTo(11),
 				},
 			},
 		},
@@ -246,29 +308,76 @@ func TestListRules(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
 
-			var err error
-			if tc.nftError != "" {
-				err = fmt.Errorf(tc.nftError)
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", "chains", "ip"},
+					stdout: tc.nftOutput,
+				},
+			)
+			result, err := nft.ListChains(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			diff := cmp.Diff(tc.listOutput, result)
+			if diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
 			}
+		})
+	}
+}
+
+func TestGetChain(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		nftOutput string
+		nftError  error
+		result    *Chain
+	}{
+		{
+			name:     "no such chain",
+			nftError: mkExecError("Error: No such file or directory\nlist chain ip testing testchain\n                      ^^^^^^^^^\n"),
+		},
+		{
+			name:      "base chain",
+			nftOutput: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "testchain", "handle": 21, "type": "filter", "hook": "input", "prio": 0, "policy": "drop", "comment": "hello"}}, {"rule": {"family": "ip", "table": "testing", "chain": "testchain", "handle": 169, "expr": [{"accept": null}]}}]}`,
+			result: &Chain{
+				Name:     "testchain",
+				Type:     PtrTo(FilterType),
+				Hook:     PtrTo(InputHook),
+				Priority: PtrTo(BaseChainPriority("0")),
+				Policy:   PtrTo(DropPolicy),
+				Comment:  PtrTo("hello"),
+				Handle:   PtrTo(21),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
 			fexec.expected = append(fexec.expected,
 				expectedCmd{
 					args:   []string{"/nft", "--json", "list", "chain", "ip", "testing", "testchain"},
-					stdout: strings.TrimSpace(dedent.Dedent(tc.nftOutput)),
-					err:    err,
+					stdout: tc.nftOutput,
+					err:    tc.nftError,
 				},
 			)
-			result, err := nft.ListRules(context.Background(), "testchain")
+			result, err := nft.GetChain(context.Background(), "testchain")
 			if err != nil {
-				if tc.nftError == "" {
+				var nferr *NotFoundError
+				if tc.nftError == nil {
 					t.Errorf("unexpected error: %v", err)
+				} else if !errors.As(err, &nferr) {
+					t.Errorf("expected NotFoundError, got %v", err)
+				} else if nferr.ObjectType != "chain" || nferr.ObjectName != "testchain" {
+					t.Errorf("unexpected NotFoundError contents: %#v", nferr)
 				}
 				return
-			} else if tc.nftError != "" {
+			} else if tc.nftError != nil {
 				t.Errorf("unexpected non-error")
 				return
 			}
 
-			diff := cmp.Diff(tc.listOutput, result)
+			diff := cmp.Diff(tc.result, result)
 			if diff != "" {
 				t.Errorf("unexpected result:\n%s", diff)
 			}
@@ -276,109 +385,37 @@ func TestListRules(t *testing.T) {
 	}
 }
 
-func TestListElements(t *testing.T) {
+func TestListSets(t *testing.T) {
 	for _, tc := range []struct {
 		name       string
-		objectType string
 		nftOutput  string
-		nftError   string
-		listOutput []*Element
+		listOutput []*Set
 	}{
 		{
-			name:       "no such set",
-			objectType: "set",
-			nftError:   "Error: No such file or directory\nlist set ip testing test\n                    ^^^^\n",
-		},
-		{
-			name:       "no elements",
-			objectType: "set",
-			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "inet_proto", "handle": 16}}]}`,
-			listOutput: []*Element{},
-		},
-		{
-			name:       "no elements",
-			objectType: "set",
-			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "inet_proto", "handle": 16, "elem": []}}]}`,
-			listOutput: []*Element{},
-		},
-		{
-			name:       "simple type",
-			objectType: "set",
-			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 12, "elem": ["192.168.1.1", "192.168.1.2", {"elem": {"val": "192.168.1.3", "comment": "with a comment"}}]}}]}`,
-			listOutput: []*Element{
-				{
-					Set: "test",
-					Key: []string{"192.168.1.1"},
-				},
-				{
-					Set: "test",
-					Key: []string{"192.168.1.2"},
-				},
-				{
-					Set:     "test",
-					Key:     []string{"192.168.1.3"},
-					Comment: PtrTo("with a comment"),
-				},
-			},
-		},
-		{
-			name:       "concatenated type",
-			objectType: "set",
-			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": ["ipv4_addr", "inet_proto", "inet_service"], "handle": 13, "elem": [{"concat": ["192.168.1.3", "tcp", 80]}, {"concat": ["192.168.1.4", "udp", 80]}, {"elem": {"val": {"concat": ["192.168.1.5", "tcp", 443]}, "comment": "foo"}}]}}]}`,
-			listOutput: []*Element{
-				{
-					Set: "test",
-					Key: []string{"192.168.1.3", "tcp", "80"},
-				},
-				{
-					Set: "test",
-					Key: []string{"192.168.1.4", "udp", "80"},
-				},
-				{
-					Set:     "test",
-					Key:     []string{"192.168.1.5", "tcp", "443"},
-					Comment: PtrTo("foo"),
-				},
-			},
-		},
-		{
-			name:       "simple map",
-			objectType: "map",
-			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"map": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 14, "map": "inet_service", "elem": [["10.0.0.1", 80], [{"elem": {"val": "10.0.0.2", "comment": "a comment"}}, 443]]}}]}`,
-			listOutput: []*Element{
-				{
-					Map:   "test",
-					Key:   []string{"10.0.0.1"},
-					Value: []string{"80"},
-				},
-				{
-					Map:     "test",
-					Key:     []string{"10.0.0.2"},
-					Value:   []string{"443"},
-					Comment: PtrTo("a comment"),
-				},
-			},
+			name:       "empty list",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}]}`,
+			listOutput: []*Set{},
 		},
 		{
-			name:       "verdict map, concatenated key",
-			objectType: "map",
-			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"map": {"family": "ip", "name": "test", "table": "testing", "type": ["ipv4_addr", "inet_proto"], "handle": 15, "map": "verdict", "elem": [[{"concat": ["192.168.1.1", "tcp"]}, {"drop": null}], [{"elem": {"val": {"concat": ["192.168.1.3", "tcp"]}, "comment": "foo"}}, {"return": null}], [{"concat": ["192.168.1.2", "udp"]}, {"goto": {"target": "test"}}]]}}]}`,
-			listOutput: []*Element{
-				{
-					Map:   "test",
-					Key:   []string{"192.168.1.1", "tcp"},
-					Value: []string{"drop"},
-				},
+			name:      "normal output",
+			nftOutput: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "simple", "table": "testing", "type": "ipv4_addr", "handle": 12, "comment": "a simple set"}}, {"set": {"family": "ip", "name": "concat", "table": "testing", "type": ["ipv4_addr", "inet_proto", "inet_service"], "handle": 13, "flags": ["interval", "timeout"], "timeout": 3600, "gc-interval": 60, "size": 1000, "policy": "memory", "auto-merge": true}}, {"set": {"family": "ip", "name": "other", "table": "filter", "type": "ipv4_addr", "handle": 3}}]}`,
+			listOutput: []*Set{
 				{
-					Map:     "test",
-					Key:     []string{"192.168.1.3", "tcp"},
-					Value:   []string{"return"},
-					Comment: PtrTo("foo"),
+					Name:    "simple",
+					Type:    "ipv4_addr",
+					Comment: PtrTo("a simple set"),
+					Handle:  PtrTo(12),
 				},
 				{
-					Map:   "test",
-					Key:   []string{"192.168.1.2", "udp"},
-					Value: []string{"goto test"},
+					Name:       "concat",
+					Type:       "ipv4_addr . inet_proto . inet_service",
+					Flags:      []SetFlag{IntervalFlag, TimeoutFlag},
+					Timeout:    PtrTo(time.Hour),
+					GCInterval: PtrTo(time.Minute),
+					Size:       PtrTo[uint64](1000),
+					Policy:     PtrTo(MemoryPolicy),
+					AutoMerge:  PtrTo(true),
+					Handle:     PtrTo(13),
 				},
 			},
 		},
@@ -386,29 +423,16 @@ func TestListElements(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
 
-			var err error
-			if tc.nftError != "" {
-				err = fmt.Errorf(tc.nftError)
-			}
 			fexec.expected = append(fexec.expected,
 				expectedCmd{
-					args:   []string{"/nft", "--json", "list", tc.objectType, "ip", "testing", "test"},
-					stdout: strings.TrimSpace(dedent.Dedent(tc.nftOutput)),
-					err:    err,
+					args:   []string{"/nft", "--json", "list", "sets", "ip"},
+					stdout: tc.nftOutput,
 				},
 			)
-
-			result, err := nft.ListElements(context.Background(), tc.objectType, "test")
+			result, err := nft.ListSets(context.Background())
 			if err != nil {
-				if tc.nftError == "" {
-					t.Errorf("unexpected error: %v", err)
-				}
-				return
-			} else if tc.nftError != "" {
-				t.Errorf("unexpected non-error")
-				return
+				t.Fatalf("unexpected error: %v", err)
 			}
-
 			diff := cmp.Diff(tc.listOutput, result)
 			if diff != "" {
 				t.Errorf("unexpected result:\n%s", diff)
@@ -417,96 +441,2408 @@ func TestListElements(t *testing.T) {
 	}
 }
 
-func TestFeatures(t *testing.T) {
+func TestListMaps(t *testing.T) {
 	for _, tc := range []struct {
-		name     string
-		commands []expectedCmd
-		result   *nftContext
+		name       string
+		nftOutput  string
+		listOutput []*Map
 	}{
 		{
-			name: "old nftables",
-			commands: []expectedCmd{
-				{
-					args: []string{
-						"/nft", "--version",
-					},
-					stdout: "nftables v0.9.3 (Topsy)\n",
-				},
-			},
-			result: nil,
+			name:       "empty list",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}]}`,
+			listOutput: []*Map{},
 		},
 		{
-			name: "all features",
-			commands: []expectedCmd{
+			name:      "normal output",
+			nftOutput: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"map": {"family": "ip", "name": "simple", "table": "testing", "type": "ipv4_addr", "handle": 14, "map": "inet_service", "comment": "a simple map"}}, {"map": {"family": "ip", "name": "vmap", "table": "testing", "type": ["ipv4_addr", "inet_proto"], "handle": 15, "map": "verdict", "flags": ["interval"], "size": 100}}, {"map": {"family": "ip", "name": "other", "table": "filter", "type": "ipv4_addr", "map": "verdict", "handle": 3}}]}`,
+			listOutput: []*Map{
 				{
-					args: []string{
-						"/nft", "--version",
-					},
-					stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+					Name:    "simple",
+					Type:    "ipv4_addr : inet_service",
+					Comment: PtrTo("a simple map"),
+					Handle:  PtrTo(14),
 				},
 				{
-					args: []string{
-						"/nft", "--check",
-						"add", "table", "ip", "testing",
-						"{", "comment", `"test"`, "}",
-					},
+					Name:   "vmap",
+					Type:   "ipv4_addr . inet_proto : verdict",
+					Flags:  []SetFlag{IntervalFlag},
+					Size:   PtrTo[uint64](100),
+					Handle: PtrTo(15),
 				},
 			},
-			result: &nftContext{
-				family: IPv4Family,
-				table:  "testing",
-			},
 		},
-		{
-			name: "noObjectComments",
-			commands: []expectedCmd{
-				{
-					args: []string{
-						"/nft", "--version",
-					},
-					stdout: "nftables v1.0.7 (Old Doc Yak)\n",
-				},
-				{
-					args: []string{
-						"/nft", "--check",
-						"add", "table", "ip", "testing",
-						"{", "comment", `"test"`, "}",
-					},
-					err: fmt.Errorf("Error: syntax error, unexpected comment"),
-				},
-				{
-					args: []string{
-						"/nft", "--check",
-						"add", "table", "ip", "testing",
-					},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", "maps", "ip"},
+					stdout: tc.nftOutput,
 				},
-			},
-			result: &nftContext{
-				family: IPv4Family,
-				table:  "testing",
+			)
+			result, err := nft.ListMaps(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			diff := cmp.Diff(tc.listOutput, result)
+			if diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
+			}
+		})
+	}
+}
 
-				noObjectComments: true,
+func TestGetSetAndMap(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		objectType string
+		nftOutput  string
+		nftError   error
+		result     interface{}
+	}{
+		{
+			name:       "no such set",
+			objectType: "set",
+			nftError:   mkExecError("Error: No such file or directory\nlist set ip testing test\n                    ^^^^\n"),
+		},
+		{
+			name:       "set",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 12, "flags": ["interval"], "elem": ["192.168.1.1", "192.168.1.2"]}}]}`,
+			result: &Set{
+				Name:   "test",
+				Type:   "ipv4_addr",
+				Flags:  []SetFlag{IntervalFlag},
+				Handle: PtrTo(12),
+			},
+		},
+		{
+			name:       "no such map",
+			objectType: "map",
+			nftError:   mkExecError("Error: No such file or directory\nlist map ip testing test\n                    ^^^^\n"),
+		},
+		{
+			name:       "map",
+			objectType: "map",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"map": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 14, "map": "inet_service", "comment": "a map", "elem": [["10.0.0.1", 80]]}}]}`,
+			result: &Map{
+				Name:    "test",
+				Type:    "ipv4_addr : inet_service",
+				Comment: PtrTo("a map"),
+				Handle:  PtrTo(14),
 			},
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			fexec := newFakeExec(t)
-			fexec.expected = tc.commands
-			nft, err := newInternal(IPv4Family, "testing", fexec)
-			if err != nil {
-				if tc.result != nil {
-					t.Fatalf("Unexpected error creating Interface: %v", err)
-				}
+			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", tc.objectType, "ip", "testing", "test"},
+					stdout: tc.nftOutput,
+					err:    tc.nftError,
+				},
+			)
+
+			var result interface{}
+			var err error
+			if tc.objectType == "set" {
+				result, err = nft.GetSet(context.Background(), "test")
 			} else {
-				result := nft.(*realNFTables).nftContext
-				if tc.result != nil {
-					if !reflect.DeepEqual(*tc.result, result) {
-						t.Errorf("Expected %#v, got %#v", *tc.result, result)
-					}
-				} else {
-					t.Fatalf("Expected failure, got %#v", result)
+				result, err = nft.GetMap(context.Background(), "test")
+			}
+			if err != nil {
+				if tc.nftError == nil {
+					t.Errorf("unexpected error: %v", err)
+				} else if !IsNotFound(err) {
+					t.Errorf("expected not-found error, got %v", err)
 				}
+				return
+			} else if tc.nftError != nil {
+				t.Errorf("unexpected non-error")
+				return
+			}
+
+			diff := cmp.Diff(tc.result, result)
+			if diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
 			}
 		})
 	}
 }
+
+func TestListFlowtables(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "flowtables", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"flowtable": {"family": "ip", "name": "one", "table": "testing", "handle": 5, "hook": "ingress", "prio": 0, "dev": "eth0"}}, {"flowtable": {"family": "ip", "name": "two", "table": "testing", "handle": 6, "hook": "ingress", "prio": 10, "dev": ["eth0", "eth1"]}}, {"flowtable": {"family": "ip", "name": "other", "table": "filter", "handle": 2, "hook": "ingress", "prio": 0, "dev": "eth0"}}]}`,
+		},
+	)
+	result, err := nft.ListFlowtables(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []*Flowtable{
+		{
+			Name:     "one",
+			Priority: PtrTo(FlowtableIngressPriority("0")),
+			Devices:  []string{"eth0"},
+			Handle:   PtrTo(5),
+		},
+		{
+			Name:     "two",
+			Priority: PtrTo(FlowtableIngressPriority("10")),
+			Devices:  []string{"eth0", "eth1"},
+			Handle:   PtrTo(6),
+		},
+	}
+	diff := cmp.Diff(expected, result)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestListAndGetCounters(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "counters", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"counter": {"family": "ip", "name": "one", "table": "testing", "handle": 4, "packets": 0, "bytes": 0}}, {"counter": {"family": "ip", "name": "two", "table": "testing", "handle": 5, "comment": "hello", "packets": 12, "bytes": 1024}}, {"counter": {"family": "ip", "name": "other", "table": "filter", "handle": 2, "packets": 0, "bytes": 0}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "counter", "ip", "testing", "two"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"counter": {"family": "ip", "name": "two", "table": "testing", "handle": 5, "comment": "hello", "packets": 15, "bytes": 2048}}]}`,
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "counter", "ip", "testing", "three"},
+			err:  mkExecError("Error: No such file or directory\nlist counter ip testing three\n                        ^^^^^\n"),
+		},
+	)
+
+	result, err := nft.ListCounters(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*Counter{
+		{
+			Name:    "one",
+			Packets: PtrTo[uint64](0),
+			Bytes:   PtrTo[uint64](0),
+			Handle:  PtrTo(4),
+		},
+		{
+			Name:    "two",
+			Packets: PtrTo[uint64](12),
+			Bytes:   PtrTo[uint64](1024),
+			Comment: PtrTo("hello"),
+			Handle:  PtrTo(5),
+		},
+	}
+	diff := cmp.Diff(expected, result)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	counter, err := nft.GetCounter(context.Background(), "two")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	diff = cmp.Diff(&Counter{
+		Name:    "two",
+		Packets: PtrTo[uint64](15),
+		Bytes:   PtrTo[uint64](2048),
+		Comment: PtrTo("hello"),
+		Handle:  PtrTo(5),
+	}, counter)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	_, err = nft.GetCounter(context.Background(), "three")
+	if !IsNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestListQuotas(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "quotas", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"quota": {"family": "ip", "name": "one", "table": "testing", "handle": 4, "bytes": 1048576, "used": 0, "inv": false}}, {"quota": {"family": "ip", "name": "two", "table": "testing", "handle": 5, "comment": "hello", "bytes": 2048, "used": 1024, "inv": true}}, {"quota": {"family": "ip", "name": "other", "table": "filter", "handle": 2, "bytes": 100, "used": 0, "inv": false}}]}`,
+		},
+	)
+
+	result, err := nft.ListQuotas(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*Quota{
+		{
+			Name:   "one",
+			Bytes:  1048576,
+			Used:   PtrTo[uint64](0),
+			Handle: PtrTo(4),
+		},
+		{
+			Name:    "two",
+			Bytes:   2048,
+			Used:    PtrTo[uint64](1024),
+			Over:    true,
+			Comment: PtrTo("hello"),
+			Handle:  PtrTo(5),
+		},
+	}
+	diff := cmp.Diff(expected, result)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestListLimits(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "limits", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"limit": {"family": "ip", "name": "packets", "table": "testing", "handle": 4, "rate": 400, "per": "minute", "burst": 5}}, {"limit": {"family": "ip", "name": "bytes", "table": "testing", "handle": 5, "comment": "hello", "rate": 10, "per": "second", "rate_unit": "mbytes", "burst": 100, "burst_unit": "kbytes", "inv": true}}, {"limit": {"family": "ip", "name": "other", "table": "filter", "handle": 2, "rate": 1, "per": "second"}}]}`,
+		},
+	)
+
+	result, err := nft.ListLimits(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*Limit{
+		{
+			Name:   "packets",
+			Rate:   400,
+			Per:    "minute",
+			Burst:  PtrTo[uint64](5),
+			Handle: PtrTo(4),
+		},
+		{
+			Name:      "bytes",
+			Rate:      10,
+			RateUnit:  "mbytes",
+			Per:       "second",
+			Burst:     PtrTo[uint64](100),
+			BurstUnit: "kbytes",
+			Inverse:   true,
+			Comment:   PtrTo("hello"),
+			Handle:    PtrTo(5),
+		},
+	}
+	diff := cmp.Diff(expected, result)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestListCTTimeouts(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, InetFamily, "testing")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "ct", "timeout", "table", "inet", "testing"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"ct timeout": {"family": "inet", "name": "tcp-long", "table": "testing", "handle": 4, "protocol": "tcp", "l3proto": "ip", "policy": {"established": 7200, "close": 10}}}, {"ct timeout": {"family": "inet", "name": "udp-short", "table": "testing", "handle": 5, "comment": "hello", "protocol": "udp", "l3proto": "ip6", "policy": {"unreplied": 5}}}]}`,
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "ct", "timeout", "table", "inet", "testing"},
+			err:  mkExecError("Error: No such file or directory\nlist ct timeout table inet testing\n                           ^^^^^^^\n"),
+		},
+	)
+
+	result, err := nft.ListCTTimeouts(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*CTTimeout{
+		{
+			Name:     "tcp-long",
+			Protocol: "tcp",
+			L3Proto:  PtrTo(IPv4Family),
+			Policy:   map[string]uint32{"established": 7200, "close": 10},
+			Handle:   PtrTo(4),
+		},
+		{
+			Name:     "udp-short",
+			Protocol: "udp",
+			L3Proto:  PtrTo(IPv6Family),
+			Policy:   map[string]uint32{"unreplied": 5},
+			Comment:  PtrTo("hello"),
+			Handle:   PtrTo(5),
+		},
+	}
+	diff := cmp.Diff(expected, result)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	_, err = nft.ListCTTimeouts(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+}
+
+func TestListCTExpectations(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "ct", "expectation", "table", "ip", "testing"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"ct expectation": {"family": "ip", "name": "ftp-data", "table": "testing", "handle": 4, "comment": "hello", "protocol": "tcp", "dport": 20, "timeout": 30000, "size": 8, "l3proto": "ip"}}]}`,
+		},
+	)
+
+	result, err := nft.ListCTExpectations(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*CTExpectation{
+		{
+			Name:     "ftp-data",
+			L3Proto:  PtrTo(IPv4Family),
+			Protocol: "tcp",
+			DPort:    20,
+			Timeout:  30 * time.Second,
+			Size:     8,
+			Comment:  PtrTo("hello"),
+			Handle:   PtrTo(4),
+		},
+	}
+	diff := cmp.Diff(expected, result)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestRun(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	tx := nft.NewTransaction()
+
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name:    "chain",
+		Comment: PtrTo("foo"),
+	})
+	tx.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip daddr 10.0.0.0/8 drop",
+	})
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain { comment "foo" ; }
+		add rule ip kube-proxy chain ip daddr 10.0.0.0/8 drop
+		`), "\n")
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: expected,
+		},
+	)
+
+	err := nft.Run(context.Background(), tx)
+	if err != nil {
+		t.Errorf("unexpected error from Run: %v", err)
+	}
+}
+
+func TestRunForeignTransaction(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	nft.(*realNFTables).noObjectComments = true
+
+	// A transaction not created by nft is written out using nft's features
+	tx, err := NewTransactionFromScript("add table ip kube-proxy { comment \"foo\" ; }\n")
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %v", err)
+	}
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add table ip kube-proxy\n",
+		},
+	)
+	if err := nft.Run(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error from Run: %v", err)
+	}
+
+	// A transaction for a different table is rejected without running nft
+	other, err := NewTransactionFromScript("add table inet other\nadd chain inet other foo\n")
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %v", err)
+	}
+	if err := nft.Run(context.Background(), other); err == nil || !strings.Contains(err.Error(), "cannot be run against table ip kube-proxy") {
+		t.Errorf("expected error from Run, got %v", err)
+	}
+	if err := nft.Check(context.Background(), other); err == nil {
+		t.Errorf("expected error from Check")
+	}
+	if _, err := nft.RunWithEcho(context.Background(), other); err == nil {
+		t.Errorf("expected error from RunWithEcho")
+	}
+	if err := nft.RunAndVerify(context.Background(), other); err == nil {
+		t.Errorf("expected error from RunAndVerify")
+	}
+	if err := nft.RunFromFile(context.Background(), other, t.TempDir()); err == nil {
+		t.Errorf("expected error from RunFromFile")
+	}
+	if fexec.matched != len(fexec.expected) {
+		t.Errorf("expected %d commands to be run, but %d were", len(fexec.expected), fexec.matched)
+	}
+}
+
+func TestRunFamilies(t *testing.T) {
+	for _, tc := range []struct {
+		family   Family
+		hook     BaseChainHook
+		device   string
+		priority string
+	}{
+		{family: IPv4Family, priority: "0"},
+		{family: IPv6Family, priority: "0"},
+		{family: InetFamily, priority: "0"},
+		{family: ARPFamily, priority: "0"},
+		{family: BridgeFamily, priority: "-200"},
+		{family: NetDevFamily, hook: IngressHook, device: "eth0", priority: "0"},
+	} {
+		family := tc.family
+		t.Run(string(family), func(t *testing.T) {
+			nft, fexec, err := newTestInterface(t, family, "kube-proxy")
+			if err != nil {
+				t.Fatalf("unexpected error creating Interface: %v", err)
+			}
+
+			chain := &Chain{
+				Name:     "chain",
+				Type:     PtrTo(FilterType),
+				Hook:     PtrTo(InputHook),
+				Priority: PtrTo(FilterPriority),
+			}
+			hookAndDevice := "input"
+			if tc.hook != "" {
+				chain.Hook = PtrTo(tc.hook)
+				chain.Device = PtrTo(tc.device)
+				hookAndDevice = fmt.Sprintf("%s device %q", tc.hook, tc.device)
+			}
+
+			tx := nft.NewTransaction()
+			tx.Add(&Table{})
+			tx.Add(chain)
+
+			expected := fmt.Sprintf(strings.TrimPrefix(dedent.Dedent(`
+				add table %[1]s kube-proxy
+				add chain %[1]s kube-proxy chain { type filter hook %[2]s priority %[3]s ; }
+				`), "\n"), family, hookAndDevice, tc.priority)
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:  []string{"/nft", "-f", "-"},
+					stdin: expected,
+				},
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", "chains", string(family)},
+					stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}]}`,
+				},
+			)
+
+			err = nft.Run(context.Background(), tx)
+			if err != nil {
+				t.Errorf("unexpected error from Run: %v", err)
+			}
+			_, err = nft.ListChains(context.Background())
+			if err != nil {
+				t.Errorf("unexpected error from ListChains: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	tx.Replace(&Rule{
+		Chain: "chain",
+		Rule:  "ip daddr 10.0.0.0/8 drop",
+	})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+
+	// Run should fail without invoking nft (so fexec has no expected commands)
+	err := nft.Run(context.Background(), tx)
+	if err == nil || !strings.Contains(err.Error(), "must specify Handle") {
+		t.Errorf("unexpected error from Run: %v", err)
+	}
+	if fexec.matched != len(fexec.expected) {
+		t.Errorf("unexpected commands run")
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	// Use a real execer running "sleep" in place of nft
+	nft := &realNFTables{
+		exec: realExec{},
+		path: "sleep",
+	}
+	WithCommandTimeout(50 * time.Millisecond)(nft)
+
+	start := time.Now()
+	_, err := nft.runCommand(context.Background(), nil, "5")
+	if err == nil {
+		t.Errorf("expected error from timed-out command")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command was not killed by timeout (took %v)", elapsed)
+	}
+
+	// The caller's deadline still applies if it is earlier
+	WithCommandTimeout(time.Hour)(nft)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = nft.runCommand(ctx, nil, "5")
+	if err == nil {
+		t.Errorf("expected error from timed-out command")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command was not killed by context deadline (took %v)", elapsed)
+	}
+
+	// Commands that finish in time succeed
+	_, err = nft.runCommand(context.Background(), nil, "0")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNFTPath(t *testing.T) {
+	fexec := newFakeExec(t)
+	fexec.missingBinaries["nft"] = true
+	_, err := newInternal(IPv4Family, "testing", fexec)
+	if err == nil || !strings.Contains(err.Error(), "could not find nftables binary") {
+		t.Errorf("expected lookup error, got %v", err)
+	}
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/opt/nft", "--version"},
+			stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+		},
+		expectedCmd{
+			args: []string{"/opt/nft", "--check", "add", "table", "ip", "testing",
+				"{", "comment", `"test"`, "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/opt/nft", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/opt/nft", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			},
+		},
+		expectedCmd{
+			args:  []string{"/opt/nft", "-f", "-"},
+			stdin: "add table ip testing\n",
+		},
+	)
+	nft, err := newInternal(IPv4Family, "testing", fexec, WithNFTPath("/opt/nft"))
+	if err != nil {
+		t.Fatalf("unexpected error creating Interface: %v", err)
+	}
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	if err := nft.Run(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNetworkNamespace(t *testing.T) {
+	fexec := newFakeExec(t)
+	fexec.missingBinaries["nsenter"] = true
+	_, err := newInternal(IPv4Family, "testing", fexec, withNetnsPath("/var/run/netns/pod1"))
+	if err == nil || !strings.Contains(err.Error(), "could not find nsenter binary") {
+		t.Errorf("expected lookup error, got %v", err)
+	}
+	delete(fexec.missingBinaries, "nsenter")
+
+	nsenter := []string{"/nsenter", "--net=/var/run/netns/pod1", "--", "/nft"}
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   append(nsenter, "--version"),
+			stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+		},
+		expectedCmd{
+			args: append(nsenter, "--check", "add", "table", "ip", "testing",
+				"{", "comment", `"test"`, "}",
+			),
+		},
+		expectedCmd{
+			args: append(nsenter, "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+			),
+		},
+		expectedCmd{
+			args: append(nsenter, "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			),
+		},
+		expectedCmd{
+			args:  append(nsenter, "-f", "-"),
+			stdin: "add table ip testing\n",
+		},
+	)
+	nft, err := newInternal(IPv4Family, "testing", fexec, withNetnsPath(netnsPath("pod1")))
+	if err != nil {
+		t.Fatalf("unexpected error creating Interface: %v", err)
+	}
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	if err := nft.Run(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for netns, expected := range map[string]string{
+		"pod1":              "/var/run/netns/pod1",
+		"/proc/1234/ns/net": "/proc/1234/ns/net",
+		"./netns":           "./netns",
+	} {
+		if path := netnsPath(netns); path != expected {
+			t.Errorf("expected netnsPath(%q) to be %q, got %q", netns, expected, path)
+		}
+	}
+
+	if _, err := NewForNamespace(IPv4Family, "testing", ""); err == nil {
+		t.Errorf("expected error for empty namespace")
+	}
+}
+
+func TestNetnsFile(t *testing.T) {
+	file, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("unexpected error opening file: %v", err)
+	}
+	defer file.Close()
+
+	fexec := newFakeExec(t)
+	nsenter := []string{"/nsenter", "--net=/proc/self/fd/3", "--", "/nft"}
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   append(nsenter, "--version"),
+			stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+		},
+		expectedCmd{
+			args: append(nsenter, "--check", "add", "table", "ip", "testing",
+				"{", "comment", `"test"`, "}",
+			),
+		},
+		expectedCmd{
+			args: append(nsenter, "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+			),
+		},
+		expectedCmd{
+			args: append(nsenter, "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			),
+		},
+	)
+	nft, err := newInternal(IPv4Family, "testing", fexec, withNetnsFile(file))
+	if err != nil {
+		t.Fatalf("unexpected error creating Interface: %v", err)
+	}
+
+	cmd := nft.(*realNFTables).command(context.Background(), "list", "ruleset")
+	if len(cmd.ExtraFiles) != 1 || cmd.ExtraFiles[0] != file {
+		t.Errorf("expected netns file to be passed as fd 3, got %v", cmd.ExtraFiles)
+	}
+
+	closer, ok := nft.(io.Closer)
+	if !ok {
+		t.Fatalf("expected Interface to implement io.Closer")
+	}
+	if err := closer.Close(); err != nil {
+		t.Errorf("unexpected error closing Interface: %v", err)
+	}
+	if err := file.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected netns file to have been closed, got %v", err)
+	}
+
+	_, err = NewWithNetnsPath(IPv4Family, "testing", "/does/not/exist")
+	if err == nil || !strings.Contains(err.Error(), "could not open network namespace") {
+		t.Errorf("expected open error, got %v", err)
+	}
+}
+
+func TestExtraArgs(t *testing.T) {
+	fexec := newFakeExec(t)
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--debug=netlink", "--stateless", "--version"},
+			stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+		},
+		expectedCmd{
+			args: []string{"/nft", "--debug=netlink", "--stateless", "--check", "add", "table", "ip", "testing",
+				"{", "comment", `"test"`, "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--debug=netlink", "--stateless", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--debug=netlink", "--stateless", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			},
+		},
+		expectedCmd{
+			args:  []string{"/nft", "--debug=netlink", "--stateless", "-f", "-"},
+			stdin: "add table ip testing\n",
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--debug=netlink", "--stateless", "--json", "list", "chains", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}]}`,
+		},
+	)
+	nft, err := newInternal(IPv4Family, "testing", fexec, WithExtraArgs("--debug=netlink"), WithExtraArgs("--stateless"))
+	if err != nil {
+		t.Fatalf("unexpected error creating Interface: %v", err)
+	}
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	if err := nft.Run(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := nft.List(context.Background(), "chains"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// fakeMetrics is a MetricsRecorder that records calls (without durations)
+type fakeMetrics struct {
+	calls []string
+}
+
+func (fm *fakeMetrics) RecordRun(err error, _ time.Duration) {
+	fm.calls = append(fm.calls, fmt.Sprintf("run err=%v", err))
+}
+
+func (fm *fakeMetrics) RecordList(objType string, count int, _ time.Duration) {
+	fm.calls = append(fm.calls, fmt.Sprintf("list %s count=%d", objType, count))
+}
+
+func TestMetrics(t *testing.T) {
+	fexec := newFakeExec(t)
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--version"},
+			stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check", "add", "table", "ip", "testing",
+				"{", "comment", `"test"`, "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			},
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add table ip testing\n",
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "delete chain ip testing chain\n",
+			err:   mkExecError("/dev/stdin:1:1-30: Error: No such file or directory\ndelete chain ip testing chain\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"),
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "chains", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "a", "handle": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "b", "handle": 2}}]}`,
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "set", "ip", "testing", "missing"},
+			err:  mkExecError("Error: No such file or directory\nlist set ip testing missing\n                   ^^^^^^^\n"),
+		},
+	)
+	metrics := &fakeMetrics{}
+	nft, err := newInternal(IPv4Family, "testing", fexec, WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("unexpected error creating Interface: %v", err)
+	}
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	_ = nft.Run(context.Background(), tx)
+	tx = nft.NewTransaction()
+	tx.Delete(&Chain{Name: "chain"})
+	runErr := nft.Run(context.Background(), tx)
+	_, _ = nft.ListChains(context.Background())
+	_, _ = nft.GetSet(context.Background(), "missing")
+
+	expected := []string{
+		"run err=<nil>",
+		fmt.Sprintf("run err=%v", runErr),
+		"list chain count=2",
+		"list set count=0",
+	}
+	if diff := cmp.Diff(expected, metrics.calls); diff != "" {
+		t.Errorf("unexpected metrics:\n%s", diff)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	// Use a real execer running "sh" in place of nft
+	nft := &realNFTables{
+		exec: realExec{},
+		path: "sh",
+	}
+	t.Setenv("KNFTABLES_TEST", "inherited")
+
+	out, err := nft.runCommand(context.Background(), nil, "-c", "echo $KNFTABLES_TEST")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "inherited\n" {
+		t.Errorf("expected inherited environment, got %q", out)
+	}
+
+	WithEnvironment([]string{"KNFTABLES_TEST=overridden"})(nft)
+	out, err = nft.runCommand(context.Background(), nil, "-c", "echo $KNFTABLES_TEST")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "overridden\n" {
+		t.Errorf("expected overridden environment, got %q", out)
+	}
+
+	WithEnvironment([]string{})(nft)
+	out, err = nft.runCommand(context.Background(), nil, "-c", "echo $KNFTABLES_TEST")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "\n" {
+		t.Errorf("expected empty environment, got %q", out)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transientErr := "Error: Could not process rule: Resource temporarily unavailable\nadd table ip kube-proxy\n^^^^^^^^^^^^^^^^^^^^^^^^\n"
+	otherErr := "Error: Could not process rule: Device or resource busy\ndelete chain ip kube-proxy chain\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"
+	stdin := "add table ip kube-proxy\n"
+	listOut := `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}]}`
+
+	for _, tc := range []struct {
+		name     string
+		list     bool
+		cancel   bool
+		results  []string
+		expected string
+	}{
+		{
+			name:    "no error",
+			results: []string{""},
+		},
+		{
+			name:    "transient errors then success",
+			results: []string{transientErr, transientErr, ""},
+		},
+		{
+			name:     "too many transient errors",
+			results:  []string{transientErr, transientErr, transientErr},
+			expected: "Resource temporarily unavailable",
+		},
+		{
+			name:     "non-transient error is not retried",
+			results:  []string{otherErr},
+			expected: "Device or resource busy",
+		},
+		{
+			name:     "not-found error is not retried",
+			list:     true,
+			results:  []string{"Error: No such file or directory\n"},
+			expected: "No such file or directory",
+		},
+		{
+			name:    "List is retried",
+			list:    true,
+			results: []string{transientErr, ""},
+		},
+		{
+			name:     "cancelled context is not retried",
+			cancel:   true,
+			results:  []string{transientErr},
+			expected: "Resource temporarily unavailable",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+			WithRetry(3, time.Millisecond)(nft.(*realNFTables))
+
+			for _, result := range tc.results {
+				cmd := expectedCmd{}
+				if tc.list {
+					cmd.args = []string{"/nft", "--json", "list", "chains", "ip"}
+					cmd.stdout = listOut
+				} else {
+					cmd.args = []string{"/nft", "-f", "-"}
+					cmd.stdin = stdin
+				}
+				if result != "" {
+					cmd.err = mkExecError(result)
+				}
+				fexec.expected = append(fexec.expected, cmd)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				cancel()
+			}
+
+			var err error
+			if tc.list {
+				_, err = nft.List(ctx, "chains")
+			} else {
+				tx := nft.NewTransaction()
+				tx.Add(&Table{})
+				err = nft.Run(ctx, tx)
+			}
+
+			if tc.expected == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, got %v", tc.expected, err)
+			}
+			if fexec.matched != len(fexec.expected) {
+				t.Errorf("expected %d commands to be run, but only %d were", len(fexec.expected), fexec.matched)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args: []string{"/nft", "--check", "-f", "-"},
+			stdin: strings.TrimPrefix(dedent.Dedent(`
+				add table ip kube-proxy
+				add chain ip kube-proxy chain
+				add rule ip kube-proxy chain jump other
+				`), "\n"),
+		},
+		expectedCmd{
+			args:  []string{"/nft", "--check", "-f", "-"},
+			stdin: "add rule ip kube-proxy chain jump other\n",
+			err:   mkExecError("/dev/stdin:1:35-39: Error: Could not process rule: No such file or directory\nadd rule ip kube-proxy chain jump other\n                                  ^^^^^\n"),
+		},
+	)
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Add(&Rule{Chain: "chain", Rule: "jump other"})
+	if err := nft.Check(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tx = nft.NewTransaction()
+	tx.Add(&Rule{Chain: "chain", Rule: "jump other"})
+	err := nft.Check(context.Background(), tx)
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+
+	// An invalid transaction fails without running nft at all
+	tx = nft.NewTransaction()
+	tx.Add(&Chain{})
+	if err := nft.Check(context.Background(), tx); err == nil {
+		t.Errorf("expected error from invalid transaction")
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	tx1 := nft.NewTransaction()
+	tx1.Add(&Table{})
+	tx1.Add(&Chain{
+		Name: "chain",
+	})
+
+	tx2 := nft.NewTransaction()
+	tx2.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip daddr 10.0.0.0/8 drop",
+	})
+
+	tx3 := nft.NewTransaction()
+	tx3.Add(&Rule{
+		Chain: "chain",
+		Rule:  "ip daddr 192.168.0.0/16 drop",
+	})
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		add rule ip kube-proxy chain ip daddr 10.0.0.0/8 drop
+		add rule ip kube-proxy chain ip daddr 192.168.0.0/16 drop
+		`), "\n")
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: expected,
+		},
+	)
+
+	err := nft.RunAll(context.Background(), tx1, tx2, tx3)
+	if err != nil {
+		t.Errorf("unexpected error from RunAll: %v", err)
+	}
+
+	// RunAll should fail without invoking nft if any transaction is invalid
+	tx2.Replace(&Rule{
+		Chain: "chain",
+		Rule:  "drop",
+	})
+	err = nft.RunAll(context.Background(), tx1, tx2, tx3)
+	if err == nil || !strings.Contains(err.Error(), "must specify Handle") {
+		t.Errorf("unexpected error from RunAll: %v", err)
+	}
+
+	// RunAll should fail without invoking nft if any transaction is for another table
+	other := NewFake(IPv4Family, "other").NewTransaction()
+	other.Add(&Chain{Name: "chain"})
+	err = nft.RunAll(context.Background(), tx1, other)
+	if err == nil || !strings.Contains(err.Error(), "transaction for table ip other cannot be run against table ip kube-proxy") {
+		t.Errorf("unexpected error from RunAll: %v", err)
+	}
+	if fexec.matched != len(fexec.expected) {
+		t.Errorf("unexpected commands run")
+	}
+}
+
+func TestListRules(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		nftOutput  string
+		nftError   string
+		listOutput []*Rule
+	}{
+		{
+			name:     "no such chain",
+			nftError: "Error: No such file or directory\nlist chain ip testing testchain\n                      ^^^^^^^^^\n",
+		},
+		{
+			name:       "no rules",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "testchain", "handle": 21}}]}`,
+			listOutput: []*Rule{},
+		},
+		{
+			name:      "normal output",
+			nftOutput: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "testchain", "handle": 165}}, {"rule": {"family": "ip", "table": "testing", "chain": "testchain", "handle": 169, "expr": [{"match": {"op": "==", "left": {"ct": {"key": "state"}}, "right": {"set": ["established", "related"]}}}, {"accept": null}]}}, {"rule": {"family": "ip", "table": "testing", "chain": "testchain", "handle": 170, "comment": "This rule does something", "expr": [{"match": {"op": "in", "left": {"ct": {"key": "status"}}, "right": "dnat"}}, {"accept": null}]}}, {"rule": {"family": "ip", "table": "testing", "chain": "testchain", "handle": 171, "expr": [{"match": {"op": "==", "left": {"meta": {"key": "iifname"}}, "right": "lo"}}, {"accept": null}]}}]}`,
+			listOutput: []*Rule{
+				{
+					Chain:  "testchain",
+					Handle: PtrTo(169),
+					Exprs:  rawExprs(`{"match":{"left":{"ct":{"key":"state"}},"op":"==","right":{"set":["established","related"]}}}`, `{"accept":null}`),
+				},
+				{
+					Chain:   "testchain",
+					Comment: PtrTo("This rule does something"),
+					Handle:  PtrTo(170),
+					Exprs:   rawExprs(`{"match":{"left":{"ct":{"key":"status"}},"op":"in","right":"dnat"}}`, `{"accept":null}`),
+				},
+				{
+					Chain:  "testchain",
+					Handle: PtrTo(171),
+					Exprs:  rawExprs(`{"match":{"left":{"meta":{"key":"iifname"}},"op":"==","right":"lo"}}`, `{"accept":null}`),
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+			var err error
+			if tc.nftError != "" {
+				err = fmt.Errorf(tc.nftError)
+			}
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", "chain", "ip", "testing", "testchain"},
+					stdout: strings.TrimSpace(dedent.Dedent(tc.nftOutput)),
+					err:    err,
+				},
+			)
+			result, err := nft.ListRules(context.Background(), "testchain")
+			if err != nil {
+				if tc.nftError == "" {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			} else if tc.nftError != "" {
+				t.Errorf("unexpected non-error")
+				return
+			}
+
+			diff := cmp.Diff(tc.listOutput, result)
+			if diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListAllRules(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		nftOutput  string
+		nftError   string
+		listOutput []*Rule
+	}{
+		{
+			name:     "no such table",
+			nftError: "Error: No such file or directory\nlist table ip testing\n                ^^^^^^^\n",
+		},
+		{
+			name:       "no rules",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "testing", "handle": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "testchain", "handle": 21}}]}`,
+			listOutput: []*Rule{},
+		},
+		{
+			name:      "normal output",
+			nftOutput: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "testing", "handle": 1}}, {"chain": {"family": "ip", "table": "testing", "name": "chain1", "handle": 2}}, {"chain": {"family": "ip", "table": "testing", "name": "chain2", "handle": 3}}, {"rule": {"family": "ip", "table": "testing", "chain": "chain1", "handle": 4, "expr": [{"accept": null}]}}, {"rule": {"family": "ip", "table": "testing", "chain": "chain1", "handle": 5, "comment": "second", "expr": [{"drop": null}]}}, {"rule": {"family": "ip", "table": "testing", "chain": "chain2", "handle": 6, "expr": [{"jump": {"target": "chain1"}}]}}]}`,
+			listOutput: []*Rule{
+				{
+					Chain:  "chain1",
+					Handle: PtrTo(4),
+					Exprs:  rawExprs(`{"accept":null}`),
+				},
+				{
+					Chain:   "chain1",
+					Comment: PtrTo("second"),
+					Handle:  PtrTo(5),
+					Exprs:   rawExprs(`{"drop":null}`),
+				},
+				{
+					Chain:  "chain2",
+					Handle: PtrTo(6),
+					Exprs:  rawExprs(`{"jump":{"target":"chain1"}}`),
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+			var err error
+			if tc.nftError != "" {
+				err = mkExecError(tc.nftError)
+			}
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", "table", "ip", "testing"},
+					stdout: tc.nftOutput,
+					err:    err,
+				},
+			)
+			result, err := nft.ListAllRules(context.Background())
+			if err != nil {
+				if tc.nftError == "" {
+					t.Errorf("unexpected error: %v", err)
+				} else if !IsNotFound(err) {
+					t.Errorf("expected NotFoundError, got %v", err)
+				}
+				return
+			} else if tc.nftError != "" {
+				t.Errorf("unexpected non-error")
+				return
+			}
+
+			diff := cmp.Diff(tc.listOutput, result)
+			if diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListElements(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		objectType string
+		nftOutput  string
+		nftError   string
+		listOutput []*Element
+	}{
+		{
+			name:       "no such set",
+			objectType: "set",
+			nftError:   "Error: No such file or directory\nlist set ip testing test\n                    ^^^^\n",
+		},
+		{
+			name:       "no elements",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "inet_proto", "handle": 16}}]}`,
+			listOutput: []*Element{},
+		},
+		{
+			name:       "no elements",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "inet_proto", "handle": 16, "elem": []}}]}`,
+			listOutput: []*Element{},
+		},
+		{
+			name:       "simple type",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 12, "elem": ["192.168.1.1", "192.168.1.2", {"elem": {"val": "192.168.1.3", "comment": "with a comment"}}]}}]}`,
+			listOutput: []*Element{
+				{
+					Set: "test",
+					Key: []string{"192.168.1.1"},
+				},
+				{
+					Set: "test",
+					Key: []string{"192.168.1.2"},
+				},
+				{
+					Set:     "test",
+					Key:     []string{"192.168.1.3"},
+					Comment: PtrTo("with a comment"),
+				},
+			},
+		},
+		{
+			name:       "concatenated type",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": ["ipv4_addr", "inet_proto", "inet_service"], "handle": 13, "elem": [{"concat": ["192.168.1.3", "tcp", 80]}, {"concat": ["192.168.1.4", "udp", 80]}, {"elem": {"val": {"concat": ["192.168.1.5", "tcp", 443]}, "comment": "foo"}}]}}]}`,
+			listOutput: []*Element{
+				{
+					Set: "test",
+					Key: []string{"192.168.1.3", "tcp", "80"},
+				},
+				{
+					Set: "test",
+					Key: []string{"192.168.1.4", "udp", "80"},
+				},
+				{
+					Set:     "test",
+					Key:     []string{"192.168.1.5", "tcp", "443"},
+					Comment: PtrTo("foo"),
+				},
+			},
+		},
+		{
+			name:       "simple map",
+			objectType: "map",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"map": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 14, "map": "inet_service", "elem": [["10.0.0.1", 80], [{"elem": {"val": "10.0.0.2", "comment": "a comment"}}, 443]]}}]}`,
+			listOutput: []*Element{
+				{
+					Map:   "test",
+					Key:   []string{"10.0.0.1"},
+					Value: []string{"80"},
+				},
+				{
+					Map:     "test",
+					Key:     []string{"10.0.0.2"},
+					Value:   []string{"443"},
+					Comment: PtrTo("a comment"),
+				},
+			},
+		},
+		{
+			name:       "verdict map, concatenated key",
+			objectType: "map",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"map": {"family": "ip", "name": "test", "table": "testing", "type": ["ipv4_addr", "inet_proto"], "handle": 15, "map": "verdict", "elem": [[{"concat": ["192.168.1.1", "tcp"]}, {"drop": null}], [{"elem": {"val": {"concat": ["192.168.1.3", "tcp"]}, "comment": "foo"}}, {"return": null}], [{"concat": ["192.168.1.2", "udp"]}, {"goto": {"target": "test"}}]]}}]}`,
+			listOutput: []*Element{
+				{
+					Map:   "test",
+					Key:   []string{"192.168.1.1", "tcp"},
+					Value: []string{"drop"},
+				},
+				{
+					Map:     "test",
+					Key:     []string{"192.168.1.3", "tcp"},
+					Value:   []string{"return"},
+					Comment: PtrTo("foo"),
+				},
+				{
+					Map:   "test",
+					Key:   []string{"192.168.1.2", "udp"},
+					Value: []string{"goto test"},
+				},
+			},
+		},
+		{
+			name:       "interval set",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 12, "flags": ["interval"], "elem": ["192.168.1.1", {"prefix": {"addr": "10.0.0.0", "len": 8}}, {"range": ["172.16.0.1", "172.16.0.99"]}, {"elem": {"val": {"prefix": {"addr": "192.168.0.0", "len": 16}}, "comment": "private"}}]}}]}`,
+			listOutput: []*Element{
+				{
+					Set: "test",
+					Key: []string{"192.168.1.1"},
+				},
+				{
+					Set: "test",
+					Key: []string{"10.0.0.0/8"},
+				},
+				{
+					Set: "test",
+					Key: []string{"172.16.0.1-172.16.0.99"},
+				},
+				{
+					Set:     "test",
+					Key:     []string{"192.168.0.0/16"},
+					Comment: PtrTo("private"),
+				},
+			},
+		},
+		{
+			name:       "interval map with port ranges",
+			objectType: "map",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"map": {"family": "ip", "name": "test", "table": "testing", "type": "inet_service", "handle": 14, "map": "verdict", "flags": ["interval"], "elem": [[{"range": [1000, 1999]}, {"drop": null}], [80, {"accept": null}]]}}]}`,
+			listOutput: []*Element{
+				{
+					Map:   "test",
+					Key:   []string{"1000-1999"},
+					Value: []string{"drop"},
+				},
+				{
+					Map:   "test",
+					Key:   []string{"80"},
+					Value: []string{"accept"},
+				},
+			},
+		},
+		{
+			name:       "interval set, concatenated type",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": ["ipv4_addr", "inet_proto", "inet_service"], "handle": 13, "flags": ["interval"], "elem": [{"concat": [{"prefix": {"addr": "10.0.0.0", "len": 8}}, "tcp", 80]}, {"concat": ["192.168.1.1", "udp", {"range": [1000, 1999]}]}, {"elem": {"val": {"concat": [{"range": ["172.16.0.1", "172.16.0.9"]}, "tcp", 443]}, "comment": "foo"}}]}}]}`,
+			listOutput: []*Element{
+				{
+					Set: "test",
+					Key: []string{"10.0.0.0/8", "tcp", "80"},
+				},
+				{
+					Set: "test",
+					Key: []string{"192.168.1.1", "udp", "1000-1999"},
+				},
+				{
+					Set:     "test",
+					Key:     []string{"172.16.0.1-172.16.0.9", "tcp", "443"},
+					Comment: PtrTo("foo"),
+				},
+			},
+		},
+		{
+			name:       "elements with timeouts",
+			objectType: "set",
+			nftOutput:  `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "test", "table": "testing", "type": "ipv4_addr", "handle": 12, "flags": ["timeout"], "elem": ["192.168.1.1", {"elem": {"val": "192.168.1.2", "timeout": 300, "expires": 287}}, {"elem": {"val": "192.168.1.3", "timeout": 60, "expires": 5, "comment": "expiring"}}]}}]}`,
+			listOutput: []*Element{
+				{
+					Set: "test",
+					Key: []string{"192.168.1.1"},
+				},
+				{
+					Set:       "test",
+					Key:       []string{"192.168.1.2"},
+					Timeout:   5 * time.Minute,
+					ExpiresAt: time.Now().Add(287 * time.Second),
+				},
+				{
+					Set:       "test",
+					Key:       []string{"192.168.1.3"},
+					Comment:   PtrTo("expiring"),
+					Timeout:   time.Minute,
+					ExpiresAt: time.Now().Add(5 * time.Second),
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+			var err error
+			if tc.nftError != "" {
+				err = fmt.Errorf(tc.nftError)
+			}
+			fexec.expected = append(fexec.expected,
+				expectedCmd{
+					args:   []string{"/nft", "--json", "list", tc.objectType, "ip", "testing", "test"},
+					stdout: strings.TrimSpace(dedent.Dedent(tc.nftOutput)),
+					err:    err,
+				},
+			)
+
+			result, err := nft.ListElements(context.Background(), tc.objectType, "test")
+			if err != nil {
+				if tc.nftError == "" {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			} else if tc.nftError != "" {
+				t.Errorf("unexpected non-error")
+				return
+			}
+
+			diff := cmp.Diff(tc.listOutput, result, cmpopts.EquateApproxTime(time.Minute))
+			if diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListAllElements(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "table", "ip", "testing"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "testing", "handle": 1}}, {"set": {"family": "ip", "name": "ips", "table": "testing", "type": "ipv4_addr", "handle": 2, "elem": ["10.0.0.1", "10.0.0.2"]}}, {"set": {"family": "ip", "name": "empty", "table": "testing", "type": "ipv4_addr", "handle": 3}}, {"map": {"family": "ip", "name": "ports", "table": "testing", "type": "inet_service", "handle": 4, "map": "verdict", "elem": [[80, {"goto": {"target": "web"}}]]}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "table", "ip", "testing"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "testing", "handle": 1}}]}`,
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "table", "ip", "testing"},
+			err:  mkExecError("Error: No such file or directory\nlist table ip testing\n              ^^^^^^^\n"),
+		},
+	)
+
+	elements, err := nft.ListAllElements(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*Element{
+		{Set: "ips", Key: []string{"10.0.0.1"}},
+		{Set: "ips", Key: []string{"10.0.0.2"}},
+		{Map: "ports", Key: []string{"80"}, Value: []string{"goto web"}},
+	}
+	if diff := cmp.Diff(expected, elements); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	elements, err = nft.ListAllElements(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elements == nil || len(elements) != 0 {
+		t.Errorf("expected empty list, got %#v", elements)
+	}
+
+	_, err = nft.ListAllElements(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		commands []expectedCmd
+		result   *nftContext
+	}{
+		{
+			name: "old nftables",
+			commands: []expectedCmd{
+				{
+					args: []string{
+						"/nft", "--version",
+					},
+					stdout: "nftables v0.9.3 (Topsy)\n",
+				},
+			},
+			result: nil,
+		},
+		{
+			name: "all features",
+			commands: []expectedCmd{
+				{
+					args: []string{
+						"/nft", "--version",
+					},
+					stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing",
+						"{", "comment", `"test"`, "}",
+					},
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing", ";",
+						"add", "set", "ip", "testing", "knftables-probe",
+						"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+					},
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing", ";",
+						"add", "set", "ip", "testing", "knftables-probe",
+						"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+					},
+				},
+			},
+			result: &nftContext{
+				family: IPv4Family,
+				table:  "testing",
+			},
+		},
+		{
+			name: "noSetComments",
+			commands: []expectedCmd{
+				{
+					args: []string{
+						"/nft", "--version",
+					},
+					stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing",
+						"{", "comment", `"test"`, "}",
+					},
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing", ";",
+						"add", "set", "ip", "testing", "knftables-probe",
+						"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+					},
+					err: fmt.Errorf("Error: Could not process rule: Operation not supported"),
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing", ";",
+						"add", "set", "ip", "testing", "knftables-probe",
+						"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+					},
+				},
+			},
+			result: &nftContext{
+				family: IPv4Family,
+				table:  "testing",
+
+				noSetComments: true,
+			},
+		},
+		{
+			name: "noIntervalSets",
+			commands: []expectedCmd{
+				{
+					args: []string{
+						"/nft", "--version",
+					},
+					stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing",
+						"{", "comment", `"test"`, "}",
+					},
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing", ";",
+						"add", "set", "ip", "testing", "knftables-probe",
+						"{", "type", "ipv4_addr", ";", "comment", `"test"`, ";", "}",
+					},
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing", ";",
+						"add", "set", "ip", "testing", "knftables-probe",
+						"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+					},
+					err: fmt.Errorf("Error: Could not process rule: Operation not supported"),
+				},
+			},
+			result: &nftContext{
+				family: IPv4Family,
+				table:  "testing",
+
+				noIntervalSets: true,
+			},
+		},
+		{
+			name: "noObjectComments",
+			commands: []expectedCmd{
+				{
+					args: []string{
+						"/nft", "--version",
+					},
+					stdout: "nftables v1.0.7 (Old Doc Yak)\n",
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing",
+						"{", "comment", `"test"`, "}",
+					},
+					err: fmt.Errorf("Error: syntax error, unexpected comment"),
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing",
+					},
+				},
+				{
+					args: []string{
+						"/nft", "--check",
+						"add", "table", "ip", "testing", ";",
+						"add", "set", "ip", "testing", "knftables-probe",
+						"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+					},
+				},
+			},
+			result: &nftContext{
+				family: IPv4Family,
+				table:  "testing",
+
+				noObjectComments: true,
+				noSetComments:    true,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fexec := newFakeExec(t)
+			fexec.expected = tc.commands
+			nft, err := newInternal(IPv4Family, "testing", fexec)
+			if err != nil {
+				if tc.result != nil {
+					t.Fatalf("Unexpected error creating Interface: %v", err)
+				}
+			} else {
+				result := nft.(*realNFTables).nftContext
+				if tc.result != nil {
+					if !reflect.DeepEqual(*tc.result, result) {
+						t.Errorf("Expected %#v, got %#v", *tc.result, result)
+					}
+					features := map[Feature]bool{
+						FeatureObjectComments: !tc.result.noObjectComments,
+						FeatureSetComments:    !tc.result.noObjectComments && !tc.result.noSetComments,
+						FeatureIntervalSets:   !tc.result.noIntervalSets,
+						Feature("bogus"):      false,
+					}
+					for feature, supported := range features {
+						if nft.SupportsFeature(feature) != supported {
+							t.Errorf("Expected SupportsFeature(%q) to be %v", feature, supported)
+						}
+					}
+					if version := nft.Version().String(); version != "1.0.7" {
+						t.Errorf("Expected version 1.0.7, got %s", version)
+					}
+				} else {
+					t.Fatalf("Expected failure, got %#v", result)
+				}
+			}
+		})
+	}
+}
+
+func TestExportRuleset(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "table", "ip", "kube-proxy"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "kube-proxy", "handle": 1}}, {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}, {"set": {"family": "ip", "name": "ips", "table": "kube-proxy", "type": "ipv4_addr", "handle": 3, "elem": ["10.0.0.1"]}}, {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 4, "comment": "block ips", "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "@ips"}}, {"counter": {"packets": 5, "bytes": 300}}, {"drop": null}]}}, {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 5, "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "saddr"}}, "right": {"set": ["10.0.0.2", "10.0.0.3"]}}}, {"accept": null}]}}]}`,
+		},
+		expectedCmd{
+			args: []string{"/nft", "--stateless", "--handle", "list", "table", "ip", "kube-proxy"},
+			stdout: dedent.Dedent(`
+				table ip kube-proxy { # handle 1
+					set ips { # handle 3
+						type ipv4_addr
+						elements = { 10.0.0.1 }
+					}
+
+					chain services { # handle 2
+						ip daddr @ips counter drop comment "block ips" # handle 4
+						ip saddr {
+							10.0.0.2,
+							10.0.0.3,
+						} accept # handle 5
+					}
+				}
+				`),
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "table", "ip", "kube-proxy"},
+			err:  mkExecError("Error: No such file or directory\nlist table ip kube-proxy\n              ^^^^^^^^^^\n"),
+		},
+	)
+
+	rs, err := nft.ExportRuleset(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &Ruleset{
+		Tables: []*RulesetTable{{
+			Family: IPv4Family,
+			Name:   "kube-proxy",
+			Table:  Table{Handle: PtrTo(1)},
+			Chains: []*Chain{{Name: "services", Handle: PtrTo(2)}},
+			Rules: []*Rule{
+				{
+					Chain:   "services",
+					Rule:    "ip daddr @ips counter drop",
+					Comment: PtrTo("block ips"),
+					Handle:  PtrTo(4),
+					Exprs:   rawExprs(`{"match":{"left":{"payload":{"field":"daddr","protocol":"ip"}},"op":"==","right":"@ips"}}`, `{"counter":{"bytes":300,"packets":5}}`, `{"drop":null}`),
+				},
+				{
+					Chain:  "services",
+					Rule:   "ip saddr { 10.0.0.2, 10.0.0.3 } accept",
+					Handle: PtrTo(5),
+					Exprs:  rawExprs(`{"match":{"left":{"payload":{"field":"saddr","protocol":"ip"}},"op":"==","right":{"set":["10.0.0.2","10.0.0.3"]}}}`, `{"accept":null}`),
+				},
+			},
+			Sets: []*Set{{Name: "ips", Type: "ipv4_addr", Handle: PtrTo(3)}},
+			Elements: []*Element{{
+				Set: "ips",
+				Key: []string{"10.0.0.1"},
+			}},
+		}},
+	}
+	diff := cmp.Diff(expected, rs)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	_, err = nft.ExportRuleset(context.Background())
+	var nferr *NotFoundError
+	if !errors.As(err, &nferr) || nferr.ObjectType != "table" {
+		t.Errorf("expected NotFoundError for table, got %v", err)
+	}
+
+	// The exported ruleset can be imported again
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args: []string{"/nft", "-f", "-"},
+			stdin: strings.TrimPrefix(dedent.Dedent(`
+				add table ip kube-proxy
+				add set ip kube-proxy ips { type ipv4_addr ; }
+				add chain ip kube-proxy services
+				add rule ip kube-proxy services ip daddr @ips counter drop comment "block ips"
+				add rule ip kube-proxy services ip saddr { 10.0.0.2, 10.0.0.3 } accept
+				add element ip kube-proxy ips { 10.0.0.1 }
+				`), "\n"),
+		},
+	)
+	if err := nft.ImportRuleset(context.Background(), rs); err != nil {
+		t.Errorf("unexpected error importing exported ruleset: %v", err)
+	}
+	if fexec.matched != len(fexec.expected) {
+		t.Errorf("expected %d commands to be run, but only %d were", len(fexec.expected), fexec.matched)
+	}
+}
+
+func TestParseTableListing(t *testing.T) {
+	listing := dedent.Dedent(`
+		table inet filter { # handle 7
+			counter dropped { # handle 9
+				packets 0 bytes 0
+			}
+
+			flowtable ft { # handle 10
+				hook ingress priority filter
+				devices = { eth0, eth1 }
+			}
+
+			chain input { # handle 1
+				type filter hook input priority filter; policy accept;
+				comment "input chain"
+				iifname "lo" accept # handle 3
+				tcp dport { 22, 80 } counter name "dropped" drop comment "has a # handle 12 in it" # handle 4
+			}
+
+			chain empty { # handle 2
+			}
+		}
+		`)
+	expected := map[int]string{
+		3: `iifname "lo" accept`,
+		4: `tcp dport { 22, 80 } counter name "dropped" drop comment "has a # handle 12 in it"`,
+	}
+	if diff := cmp.Diff(expected, parseTableListing(listing)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestListState(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "table", "ip", "kube-proxy"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "kube-proxy", "handle": 1}}, {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}, {"counter": {"family": "ip", "name": "dropped", "table": "kube-proxy", "handle": 3, "packets": 12, "bytes": 1024}}, {"quota": {"family": "ip", "name": "limit", "table": "kube-proxy", "handle": 4, "bytes": 1048576, "used": 2048, "inv": true}}, {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 5, "expr": [{"drop": null}]}}]}`,
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "table", "ip", "kube-proxy"},
+			err:  mkExecError("Error: No such file or directory\nlist table ip kube-proxy\n              ^^^^^^^^^^\n"),
+		},
+	)
+
+	rs, err := nft.ListState(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &Ruleset{
+		Tables: []*RulesetTable{{
+			Family: IPv4Family,
+			Name:   "kube-proxy",
+			Table:  Table{Handle: PtrTo(1)},
+			Counters: []*Counter{{
+				Name:    "dropped",
+				Packets: PtrTo[uint64](12),
+				Bytes:   PtrTo[uint64](1024),
+				Handle:  PtrTo(3),
+			}},
+			Quotas: []*Quota{{
+				Name:   "limit",
+				Bytes:  1048576,
+				Used:   PtrTo[uint64](2048),
+				Over:   true,
+				Handle: PtrTo(4),
+			}},
+		}},
+	}
+	if diff := cmp.Diff(expected, rs); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	_, err = nft.ListState(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+}
+
+func TestGetTable(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "tables", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.8", "release_name": "Old Doc Yak #2", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "filter", "handle": 3}}, {"table": {"family": "ip", "name": "kube-proxy", "handle": 7, "comment": "rules for kube-proxy"}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "tables", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "kube-proxy", "handle": 7}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "tables", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}]}`,
+		},
+	)
+
+	table, err := nft.GetTable(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(&Table{Comment: PtrTo("rules for kube-proxy"), Handle: PtrTo(7)}, table); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	// Older nft doesn't output the comment
+	table, err = nft.GetTable(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(&Table{Handle: PtrTo(7)}, table); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	_, err = nft.GetTable(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+}
+
+func TestGetHandles(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "tables", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "filter", "handle": 3}}, {"table": {"family": "ip", "name": "kube-proxy", "handle": 7}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "chain", "ip", "kube-proxy", "services"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 12}}, {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 13, "expr": [{"drop": null}]}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "set", "ip", "kube-proxy", "ips"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"set": {"family": "ip", "name": "ips", "table": "kube-proxy", "type": "ipv4_addr", "handle": 14, "elem": ["10.0.0.1"]}}]}`,
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "map", "ip", "kube-proxy", "ports"},
+			err:  mkExecError("Error: No such file or directory\nlist map ip kube-proxy ports\n                        ^^^^^\n"),
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "tables", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "filter", "handle": 3}}]}`,
+		},
+	)
+
+	handle, err := nft.GetTableHandle(context.Background())
+	if err != nil || handle != 7 {
+		t.Errorf("expected table handle 7, got %d, %v", handle, err)
+	}
+	handle, err = nft.GetChainHandle(context.Background(), "services")
+	if err != nil || handle != 12 {
+		t.Errorf("expected chain handle 12, got %d, %v", handle, err)
+	}
+	handle, err = nft.GetSetHandle(context.Background(), "ips")
+	if err != nil || handle != 14 {
+		t.Errorf("expected set handle 14, got %d, %v", handle, err)
+	}
+	_, err = nft.GetMapHandle(context.Background(), "ports")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError for map, got %v", err)
+	}
+	_, err = nft.GetTableHandle(context.Background())
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError for table, got %v", err)
+	}
+}
+
+func TestRenameChain(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args: []string{"/nft", "rename", "chain", "ip", "kube-proxy", "services", "services-v2"},
+		},
+		expectedCmd{
+			args: []string{"/nft", "rename", "chain", "ip", "kube-proxy", "missing", "other"},
+			err:  mkExecError("Error: No such file or directory\nrename chain ip kube-proxy missing other\n                          ^^^^^^^\n"),
+		},
+		expectedCmd{
+			args: []string{"/nft", "rename", "chain", "ip", "kube-proxy", "services-v2", "firewall"},
+			err:  mkExecError("Error: Could not process rule: File exists\nrename chain ip kube-proxy services-v2 firewall\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"),
+		},
+	)
+
+	err := nft.RenameChain(context.Background(), "services", "services-v2")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = nft.RenameChain(context.Background(), "missing", "other")
+	var nferr *NotFoundError
+	if !errors.As(err, &nferr) || nferr.ObjectType != "chain" || nferr.ObjectName != "missing" {
+		t.Errorf("expected NotFoundError for chain missing, got %v", err)
+	}
+
+	err = nft.RenameChain(context.Background(), "services-v2", "firewall")
+	var aeerr *AlreadyExistsError
+	if !errors.As(err, &aeerr) || aeerr.ObjectType != "chain" || aeerr.ObjectName != "firewall" {
+		t.Errorf("expected AlreadyExistsError for chain firewall, got %v", err)
+	}
+
+	err = nft.RenameChain(context.Background(), "firewall", "")
+	if err == nil {
+		t.Errorf("expected error for empty name")
+	}
+}
+
+func TestCopyChain(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args: []string{"/nft", "--stateless", "list", "chain", "ip", "kube-proxy", "services"},
+			stdout: dedent.Dedent(`
+				table ip kube-proxy {
+					chain services {
+						type filter hook input priority filter; policy accept;
+						comment "services chain"
+						ip daddr 10.0.0.1 tcp dport 80 counter jump svc-1
+						ip saddr { 192.168.0.1, 192.168.0.2 } drop comment "block {these}"
+						ip daddr {
+							10.0.0.2,
+							10.0.0.3,
+						} accept
+					}
+				}
+				`),
+		},
+		expectedCmd{
+			args: []string{"/nft", "-f", "-"},
+			stdin: strings.TrimPrefix(dedent.Dedent(`
+				add chain ip kube-proxy services-copy
+				add rule ip kube-proxy services-copy ip daddr 10.0.0.1 tcp dport 80 counter jump svc-1
+				add rule ip kube-proxy services-copy ip saddr { 192.168.0.1, 192.168.0.2 } drop comment "block {these}"
+				add rule ip kube-proxy services-copy ip daddr { 10.0.0.2, 10.0.0.3 } accept
+				`), "\n"),
+		},
+		expectedCmd{
+			args: []string{"/nft", "--stateless", "list", "chain", "ip", "kube-proxy", "missing"},
+			err:  mkExecError("Error: No such file or directory\nlist chain ip kube-proxy missing\n                         ^^^^^^^\n"),
+		},
+	)
+
+	err := nft.CopyChain(context.Background(), "services", "services-copy")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = nft.CopyChain(context.Background(), "missing", "services-copy")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+
+	err = nft.CopyChain(context.Background(), "services", "services")
+	if err == nil {
+		t.Errorf("expected error copying chain to itself")
+	}
+}
+
+func TestRunWithEchoDescription(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--echo", "--json", "-f", "-"},
+			stdin:  "# sync 1234\nadd table ip kube-proxy\n",
+			stdout: `{"nftables": [{"add": {"table": {"family": "ip", "name": "kube-proxy", "handle": 1}}}]}`,
+		},
+	)
+
+	tx := nft.NewTransaction()
+	tx.SetDescription("sync 1234")
+	tx.Add(&Table{})
+	objects, err := nft.RunWithEcho(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]Object{&Table{Handle: PtrTo(1)}}, objects); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestRunFromFile(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+	dir := t.TempDir()
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args: []string{"/nft", "--file", "FILE"},
+			file: "add table ip kube-proxy\nadd chain ip kube-proxy chain\n",
+		},
+		expectedCmd{
+			args: []string{"/nft", "--file", "FILE"},
+			file: "add rule ip kube-proxy missing drop\n",
+			err:  mkExecError("Error: No such file or directory\n"),
+		},
+	)
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	if err := nft.RunFromFile(context.Background(), tx, dir); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tx = nft.NewTransaction()
+	tx.Add(&Rule{Chain: "missing", Rule: "drop"})
+	if err := nft.RunFromFile(context.Background(), tx, dir); !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+
+	// The script files are removed whether or not nft succeeds
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected script files to be removed, found %v", entries)
+	}
+
+	err = nft.RunFromFile(context.Background(), tx, "/does/not/exist")
+	if err == nil || !strings.Contains(err.Error(), "could not create script file") {
+		t.Errorf("expected error creating file, got %v", err)
+	}
+}
+
+func TestRunAndVerify(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	listOutput := `{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"table": {"family": "ip", "name": "kube-proxy", "handle": 1}}, {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}, {"set": {"family": "ip", "name": "ips", "table": "kube-proxy", "type": "ipv4_addr", "handle": 3, "elem": ["10.0.0.1"]}}]}`
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add table ip kube-proxy\nadd chain ip kube-proxy services\nadd set ip kube-proxy ips { type ipv4_addr ; }\nadd element ip kube-proxy ips { 10.0.0.1 }\nadd rule ip kube-proxy services drop\n",
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "table", "ip", "kube-proxy"},
+			stdout: listOutput,
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add chain ip kube-proxy other\nadd element ip kube-proxy ips { 10.0.0.2 }\n",
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "table", "ip", "kube-proxy"},
+			stdout: listOutput,
+		},
+	)
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "services"})
+	tx.Add(&Set{Name: "ips", Type: "ipv4_addr"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	tx.Add(&Rule{Chain: "services", Rule: "drop"})
+	err := nft.RunAndVerify(context.Background(), tx)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tx = nft.NewTransaction()
+	tx.Add(&Chain{Name: "other"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.2"}})
+	err = nft.RunAndVerify(context.Background(), tx)
+	expectedErr := "objects missing after transaction: chain other, element set ips { 10.0.0.2 }"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("expected %q, got %v", expectedErr, err)
+	}
+}
+
+func TestRunAndVerifyNormalizedKeys(t *testing.T) {
+	fake := NewFake(IPv6Family, "kube-proxy")
+	tx := fake.NewTransaction()
+	tx.Add(&Set{Name: "ips", Type: "ipv6_addr"})
+	tx.Add(&Set{Name: "ports", Type: "inet_service"})
+	tx.Add(&Set{Name: "cidrs", Type: "ipv6_addr", Flags: []SetFlag{IntervalFlag}})
+	tx.Add(&Element{Set: "ips", Key: []string{"2001:DB8::0001"}})
+	tx.Add(&Element{Set: "ips", Key: []string{"2001:db8::2"}})
+	tx.Add(&Element{Set: "ports", Key: []string{"http"}})
+	tx.Add(&Element{Set: "ports", Key: []string{"0443"}})
+	tx.Add(&Element{Set: "cidrs", Key: []string{"2001:db8::/64"}})
+	tx.Add(&Element{Set: "cidrs", Key: []string{"2001:db8::1"}})
+
+	// nft outputs the IPv6 address in canonical form and the service name as a
+	// number, and merges the interval elements. The element "2001:db8::2" is
+	// missing.
+	rs, err := ParseRuleset(strings.NewReader(`{"nftables": [{"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}}, {"table": {"family": "ip6", "name": "kube-proxy", "handle": 1}}, {"set": {"family": "ip6", "name": "ips", "table": "kube-proxy", "type": "ipv6_addr", "handle": 2, "elem": ["2001:db8::1"]}}, {"set": {"family": "ip6", "name": "ports", "table": "kube-proxy", "type": "inet_service", "handle": 3, "elem": [80, 443]}}, {"set": {"family": "ip6", "name": "cidrs", "table": "kube-proxy", "type": "ipv6_addr", "handle": 4, "flags": ["interval"], "elem": [{"prefix": {"addr": "2001:db8::", "len": 64}}]}}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing ruleset: %v", err)
+	}
+	err = verifyTransaction(tx, rs)
+	expectedErr := "objects missing after transaction: element set ips { 2001:db8::2 }"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("expected %q, got %v", expectedErr, err)
+	}
+}
+
+func TestRunWithEcho(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "--echo", "--json", "-f", "-"},
+			stdin: "add table ip kube-proxy\nadd chain ip kube-proxy services\nadd set ip kube-proxy ips { type ipv4_addr ; }\nadd map ip kube-proxy ports { type inet_service : verdict ; }\nadd element ip kube-proxy ips { 10.0.0.1 }\nadd element ip kube-proxy ports { 80 : drop }\nadd rule ip kube-proxy services drop\n",
+			stdout: `{"nftables": [` +
+				`{"add": {"table": {"family": "ip", "name": "kube-proxy", "handle": 1}}}, ` +
+				`{"add": {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}}, ` +
+				`{"add": {"set": {"family": "ip", "name": "ips", "table": "kube-proxy", "type": "ipv4_addr", "handle": 3}}}, ` +
+				`{"add": {"map": {"family": "ip", "name": "ports", "table": "kube-proxy", "type": "inet_service", "handle": 4, "map": "verdict"}}}, ` +
+				`{"add": {"element": {"family": "ip", "table": "kube-proxy", "name": "ips", "elem": {"set": ["10.0.0.1"]}}}}, ` +
+				`{"add": {"element": {"family": "ip", "table": "kube-proxy", "name": "ports", "elem": {"set": [[80, {"drop": null}]]}}}}, ` +
+				`{"add": {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 5, "expr": [{"drop": null}]}}}` +
+				`]}`,
+		},
+	)
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "services"})
+	tx.Add(&Set{Name: "ips", Type: "ipv4_addr"})
+	tx.Add(&Map{Name: "ports", Type: "inet_service : verdict"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Map: "ports", Key: []string{"80"}, Value: []string{"drop"}})
+	tx.Add(&Rule{Chain: "services", Rule: "drop"})
+	objects, err := nft.RunWithEcho(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Object{
+		&Table{Handle: PtrTo(1)},
+		&Chain{Name: "services", Handle: PtrTo(2)},
+		&Set{Name: "ips", Type: "ipv4_addr", Handle: PtrTo(3)},
+		&Map{Name: "ports", Type: "inet_service : verdict", Handle: PtrTo(4)},
+		&Element{Set: "ips", Key: []string{"10.0.0.1"}},
+		&Element{Map: "ports", Key: []string{"80"}, Value: []string{"drop"}},
+		&Rule{Chain: "services", Handle: PtrTo(5), Exprs: rawExprs(`{"drop":null}`)},
+	}
+	diff := cmp.Diff(expected, objects)
+	if diff != "" {
+		t.Errorf("unexpected objects:\n%s", diff)
+	}
+}
+
+func TestRunNoObjectComments(t *testing.T) {
+	fexec := newFakeExec(t)
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--version"},
+			stdout: "nftables v1.0.1 (Fearless Fosdick #3)\n",
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check", "add", "table", "ip", "testing",
+				"{", "comment", `"test"`, "}",
+			},
+			err: fmt.Errorf("Error: syntax error, unexpected comment"),
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check", "add", "table", "ip", "testing"},
+		},
+		expectedCmd{
+			args: []string{"/nft", "--check",
+				"add", "table", "ip", "testing", ";",
+				"add", "set", "ip", "testing", "knftables-probe",
+				"{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}",
+			},
+		},
+		expectedCmd{
+			args: []string{"/nft", "-f", "-"},
+			stdin: strings.TrimPrefix(dedent.Dedent(`
+				add table ip testing
+				add chain ip testing chain
+				create chain ip testing base { type filter hook input priority 0 ; }
+				add rule ip testing chain drop comment "rule comments are always supported"
+				`), "\n"),
+		},
+	)
+	nft, err := newInternal(IPv4Family, "testing", fexec)
+	if err != nil {
+		t.Fatalf("unexpected error creating Interface: %v", err)
+	}
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{Comment: PtrTo("table comment")})
+	tx.Add(&Chain{Name: "chain", Comment: PtrTo("chain comment")})
+	tx.Create(&Chain{
+		Name:     "base",
+		Type:     PtrTo(FilterType),
+		Hook:     PtrTo(InputHook),
+		Priority: PtrTo(FilterPriority),
+		Comment:  PtrTo("base chain comment"),
+	})
+	tx.Add(&Rule{Chain: "chain", Rule: "drop", Comment: PtrTo("rule comments are always supported")})
+	if err := nft.Run(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunErrorDetails(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	runStderr := "/dev/stdin:1:1-30: Error: Could not process rule: Device or resource busy\ndelete chain ip kube-proxy chain\n^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"
+	listStderr := "Error: No such file or directory\nlist set ip kube-proxy ips\n                       ^^^\n"
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "delete chain ip kube-proxy chain\n",
+			err:   mkExecError(runStderr),
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "set", "ip", "kube-proxy", "ips"},
+			err:  mkExecError(listStderr),
+		},
+	)
+
+	tx := nft.NewTransaction()
+	tx.Delete(&Chain{Name: "chain"})
+	err := nft.Run(context.Background(), tx)
+	var rerr *RunError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected RunError, got %v", err)
+	}
+	if diff := cmp.Diff([]string{"/nft", "-f", "-"}, rerr.Cmd); diff != "" {
+		t.Errorf("unexpected Cmd:\n%s", diff)
+	}
+	if rerr.Stderr != runStderr {
+		t.Errorf("unexpected Stderr %q", rerr.Stderr)
+	}
+	if err.Error() != runStderr {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+
+	_, err = nft.ListElements(context.Background(), "set", "ips")
+	if !IsNotFound(err) {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected RunError, got %v", err)
+	}
+	if diff := cmp.Diff([]string{"/nft", "--json", "list", "set", "ip", "kube-proxy", "ips"}, rerr.Cmd); diff != "" {
+		t.Errorf("unexpected Cmd:\n%s", diff)
+	}
+	if rerr.Stderr != listStderr {
+		t.Errorf("unexpected Stderr %q", rerr.Stderr)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 )
 
 // Object implementation for Table
@@ -29,7 +30,7 @@ func (table *Table) validate(verb verb) error {
 		if table.Handle != nil {
 			return fmt.Errorf("cannot specify Handle in %s operation", verb)
 		}
-	case deleteVerb:
+	case deleteVerb, destroyVerb:
 		// Handle can be nil or non-nil
 	default:
 		return fmt.Errorf("%s is not implemented for tables", verb)
@@ -39,9 +40,9 @@ func (table *Table) validate(verb verb) error {
 }
 
 func (table *Table) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
-	// Special case for delete-by-handle
-	if verb == deleteVerb && table.Handle != nil {
-		fmt.Fprintf(writer, "delete table %s handle %d", ctx.family, *table.Handle)
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && table.Handle != nil {
+		fmt.Fprintf(writer, "%s table %s handle %d\n", verb, ctx.family, *table.Handle)
 		return
 	}
 
@@ -64,10 +65,32 @@ func (chain *Chain) validate(verb verb) error {
 		if chain.Device != nil {
 			return fmt.Errorf("regular chain %q must not specify Device", chain.Name)
 		}
+		if chain.Policy != nil {
+			return fmt.Errorf("regular chain %q must not specify Policy", chain.Name)
+		}
 	} else {
 		if chain.Type == nil || chain.Priority == nil {
 			return fmt.Errorf("base chain %q must specify Type and Priority", chain.Name)
 		}
+		isDeviceHook := *chain.Hook == IngressHook || *chain.Hook == EgressHook
+		if isDeviceHook && chain.Device == nil {
+			return fmt.Errorf("base chain %q on %s hook must specify Device", chain.Name, *chain.Hook)
+		} else if !isDeviceHook && chain.Device != nil {
+			return fmt.Errorf("base chain %q on %s hook must not specify Device", chain.Name, *chain.Hook)
+		}
+		switch *chain.Type {
+		case FilterType:
+		case NATType:
+			if *chain.Hook != PreroutingHook && *chain.Hook != InputHook && *chain.Hook != OutputHook && *chain.Hook != PostroutingHook {
+				return fmt.Errorf("base chain %q of type %s cannot use %s hook", chain.Name, *chain.Type, *chain.Hook)
+			}
+		case RouteType:
+			if *chain.Hook != OutputHook {
+				return fmt.Errorf("base chain %q of type %s cannot use %s hook", chain.Name, *chain.Type, *chain.Hook)
+			}
+		default:
+			return fmt.Errorf("base chain %q has unknown type %q", chain.Name, *chain.Type)
+		}
 	}
 
 	switch verb {
@@ -78,7 +101,7 @@ func (chain *Chain) validate(verb verb) error {
 		if chain.Handle != nil {
 			return fmt.Errorf("cannot specify Handle in %s operation", verb)
 		}
-	case deleteVerb:
+	case deleteVerb, destroyVerb:
 		if chain.Name == "" && chain.Handle == nil {
 			return fmt.Errorf("must specify either name or handle")
 		}
@@ -90,9 +113,9 @@ func (chain *Chain) validate(verb verb) error {
 }
 
 func (chain *Chain) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
-	// Special case for delete-by-handle
-	if verb == deleteVerb && chain.Handle != nil {
-		fmt.Fprintf(writer, "delete chain %s %s handle %d", ctx.family, ctx.table, *chain.Handle)
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && chain.Handle != nil {
+		fmt.Fprintf(writer, "%s chain %s %s handle %d\n", verb, ctx.family, ctx.table, *chain.Handle)
 		return
 	}
 
@@ -116,6 +139,9 @@ func (chain *Chain) writeOperation(verb verb, ctx *nftContext, writer io.Writer)
 				} else {
 					fmt.Fprintf(writer, " priority %s ;", *chain.Priority)
 				}
+				if chain.Policy != nil {
+					fmt.Fprintf(writer, " policy %s ;", *chain.Policy)
+				}
 			}
 			if chain.Comment != nil && !ctx.noObjectComments {
 				fmt.Fprintf(writer, " comment %q ;", *chain.Comment)
@@ -137,6 +163,9 @@ func (rule *Rule) validate(verb verb) error {
 	if rule.Index != nil && rule.Handle != nil {
 		return fmt.Errorf("cannot specify both Index and Handle")
 	}
+	if rule.Index != nil && *rule.Index < 0 {
+		return fmt.Errorf("rule index must not be negative")
+	}
 
 	switch verb {
 	case addVerb, insertVerb:
@@ -150,7 +179,7 @@ func (rule *Rule) validate(verb verb) error {
 		if rule.Handle == nil {
 			return fmt.Errorf("must specify Handle with %s", verb)
 		}
-	case deleteVerb:
+	case deleteVerb, destroyVerb:
 		if rule.Handle == nil {
 			return fmt.Errorf("must specify Handle with %s", verb)
 		}
@@ -191,12 +220,24 @@ func (set *Set) validate(verb verb) error {
 		if set.Handle != nil {
 			return fmt.Errorf("cannot specify Handle in %s operation", verb)
 		}
+		if set.Timeout != nil && *set.Timeout < time.Second {
+			return fmt.Errorf("set timeout must be at least 1 second")
+		}
+		if set.GCInterval != nil && *set.GCInterval < time.Second {
+			return fmt.Errorf("set gc-interval must be at least 1 second")
+		}
+		if err := validateSetPolicy(set.Policy); err != nil {
+			return err
+		}
+		if set.AutoMerge != nil && *set.AutoMerge && !hasSetFlag(set.Flags, IntervalFlag) {
+			return fmt.Errorf("set auto-merge requires the interval flag")
+		}
 		fallthrough
 	case flushVerb:
 		if set.Name == "" {
 			return fmt.Errorf("no name specified for set")
 		}
-	case deleteVerb:
+	case deleteVerb, destroyVerb:
 		if set.Name == "" && set.Handle == nil {
 			return fmt.Errorf("must specify either name or handle")
 		}
@@ -208,9 +249,9 @@ func (set *Set) validate(verb verb) error {
 }
 
 func (set *Set) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
-	// Special case for delete-by-handle
-	if verb == deleteVerb && set.Handle != nil {
-		fmt.Fprintf(writer, "delete set %s %s handle %d", ctx.family, ctx.table, *set.Handle)
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && set.Handle != nil {
+		fmt.Fprintf(writer, "%s set %s %s handle %d\n", verb, ctx.family, ctx.table, *set.Handle)
 		return
 	}
 
@@ -251,7 +292,7 @@ func (set *Set) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
 			fmt.Fprintf(writer, " auto-merge ;")
 		}
 
-		if set.Comment != nil && !ctx.noObjectComments {
+		if set.Comment != nil && !ctx.noObjectComments && !ctx.noSetComments {
 			fmt.Fprintf(writer, " comment %q ;", *set.Comment)
 		}
 
@@ -261,6 +302,19 @@ func (set *Set) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
 	fmt.Fprintf(writer, "\n")
 }
 
+// validateSetPolicy validates the Policy of a set or map
+func validateSetPolicy(policy *SetPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	switch *policy {
+	case PerformancePolicy, MemoryPolicy:
+		return nil
+	default:
+		return fmt.Errorf("unknown set policy %q", *policy)
+	}
+}
+
 // Object implementation for Map
 func (mapObj *Map) validate(verb verb) error {
 	switch verb {
@@ -271,12 +325,21 @@ func (mapObj *Map) validate(verb verb) error {
 		if mapObj.Handle != nil {
 			return fmt.Errorf("cannot specify Handle in %s operation", verb)
 		}
+		if mapObj.Timeout != nil && *mapObj.Timeout < time.Second {
+			return fmt.Errorf("map timeout must be at least 1 second")
+		}
+		if mapObj.GCInterval != nil && *mapObj.GCInterval < time.Second {
+			return fmt.Errorf("map gc-interval must be at least 1 second")
+		}
+		if err := validateSetPolicy(mapObj.Policy); err != nil {
+			return err
+		}
 		fallthrough
 	case flushVerb:
 		if mapObj.Name == "" {
 			return fmt.Errorf("no name specified for map")
 		}
-	case deleteVerb:
+	case deleteVerb, destroyVerb:
 		if mapObj.Name == "" && mapObj.Handle == nil {
 			return fmt.Errorf("must specify either name or handle")
 		}
@@ -288,9 +351,9 @@ func (mapObj *Map) validate(verb verb) error {
 }
 
 func (mapObj *Map) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
-	// Special case for delete-by-handle
-	if verb == deleteVerb && mapObj.Handle != nil {
-		fmt.Fprintf(writer, "delete map %s %s handle %d", ctx.family, ctx.table, *mapObj.Handle)
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && mapObj.Handle != nil {
+		fmt.Fprintf(writer, "%s map %s %s handle %d\n", verb, ctx.family, ctx.table, *mapObj.Handle)
 		return
 	}
 
@@ -328,7 +391,7 @@ func (mapObj *Map) writeOperation(verb verb, ctx *nftContext, writer io.Writer)
 			fmt.Fprintf(writer, " policy %s ;", *mapObj.Policy)
 		}
 
-		if mapObj.Comment != nil && !ctx.noObjectComments {
+		if mapObj.Comment != nil && !ctx.noObjectComments && !ctx.noSetComments {
 			fmt.Fprintf(writer, " comment %q ;", *mapObj.Comment)
 		}
 
@@ -358,7 +421,13 @@ func (element *Element) validate(verb verb) error {
 		if element.Map != "" && len(element.Value) == 0 {
 			return fmt.Errorf("no map value specified for map element")
 		}
-	case deleteVerb:
+		if len(element.Value) == 1 && (element.Value[0] == "goto" || element.Value[0] == "jump") {
+			return fmt.Errorf("no chain specified for %q verdict", element.Value[0])
+		}
+		if element.Timeout != 0 && element.Timeout < time.Second {
+			return fmt.Errorf("element timeout must be at least 1 second")
+		}
+	case deleteVerb, destroyVerb:
 	default:
 		return fmt.Errorf("%s is not implemented for elements", verb)
 	}
@@ -367,23 +436,468 @@ func (element *Element) validate(verb verb) error {
 }
 
 func (element *Element) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
-	name := element.Set
-	if name == "" {
-		name = element.Map
+	writeElements(verb, ctx, writer, []*Element{element})
+}
+
+// setOrMapName returns the name of element's set or map
+func (element *Element) setOrMapName() string {
+	if element.Set != "" {
+		return element.Set
 	}
+	return element.Map
+}
 
-	fmt.Fprintf(writer, "%s element %s %s %s { %s", verb, ctx.family, ctx.table, name,
-		strings.Join(element.Key, " . "))
+// writeElements writes out a single "nft" operation involving all of elements, which
+// must all be in the same set or map.
+func writeElements(verb verb, ctx *nftContext, writer io.Writer, elements []*Element) {
+	fmt.Fprintf(writer, "%s element %s %s %s {", verb, ctx.family, ctx.table, elements[0].setOrMapName())
 
-	if verb == addVerb || verb == createVerb {
-		if element.Comment != nil {
-			fmt.Fprintf(writer, " comment %q", *element.Comment)
+	for i, element := range elements {
+		if i > 0 {
+			fmt.Fprintf(writer, ",")
 		}
+		fmt.Fprintf(writer, " %s", strings.Join(element.Key, " . "))
+
+		if verb == addVerb || verb == createVerb {
+			if element.Timeout != 0 {
+				fmt.Fprintf(writer, " timeout %ds", int64(element.Timeout.Seconds()))
+			}
+			if element.Comment != nil && !ctx.noSetComments {
+				fmt.Fprintf(writer, " comment %q", *element.Comment)
+			}
 
-		if len(element.Value) != 0 {
-			fmt.Fprintf(writer, " : %s", strings.Join(element.Value, " . "))
+			if len(element.Value) != 0 {
+				fmt.Fprintf(writer, " : %s", strings.Join(element.Value, " . "))
+			}
 		}
 	}
 
 	fmt.Fprintf(writer, " }\n")
 }
+
+// Object implementation for Flowtable
+func (flowtable *Flowtable) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if flowtable.Name == "" {
+			return fmt.Errorf("no name specified for flowtable")
+		}
+		if flowtable.Priority == nil {
+			return fmt.Errorf("flowtable %q must specify Priority", flowtable.Name)
+		}
+		if flowtable.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+	case deleteVerb, destroyVerb:
+		if flowtable.Name == "" && flowtable.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for flowtables", verb)
+	}
+
+	return nil
+}
+
+func (flowtable *Flowtable) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && flowtable.Handle != nil {
+		fmt.Fprintf(writer, "%s flowtable %s %s handle %d\n", verb, ctx.family, ctx.table, *flowtable.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s flowtable %s %s %s", verb, ctx.family, ctx.table, flowtable.Name)
+	if verb == addVerb || verb == createVerb {
+		fmt.Fprintf(writer, " {")
+
+		// As with chains, parse the priority to a number if we can. (Flowtables use
+		// the same named priorities as the netdev family.)
+		if priority, err := ParsePriority(NetDevFamily, string(*flowtable.Priority)); err == nil {
+			fmt.Fprintf(writer, " hook ingress priority %d ;", priority)
+		} else {
+			fmt.Fprintf(writer, " hook ingress priority %s ;", *flowtable.Priority)
+		}
+
+		if len(flowtable.Devices) != 0 {
+			fmt.Fprintf(writer, " devices = { %s } ;", strings.Join(flowtable.Devices, ", "))
+		}
+
+		fmt.Fprintf(writer, " }")
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
+
+// Object implementation for Counter
+func (counter *Counter) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if counter.Name == "" {
+			return fmt.Errorf("no name specified for counter")
+		}
+		if counter.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+		if (counter.Packets == nil) != (counter.Bytes == nil) {
+			return fmt.Errorf("counter %q must specify both or neither of Packets and Bytes", counter.Name)
+		}
+	case deleteVerb, destroyVerb:
+		if counter.Name == "" && counter.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for counters", verb)
+	}
+
+	return nil
+}
+
+func (counter *Counter) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && counter.Handle != nil {
+		fmt.Fprintf(writer, "%s counter %s %s handle %d\n", verb, ctx.family, ctx.table, *counter.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s counter %s %s %s", verb, ctx.family, ctx.table, counter.Name)
+	if verb == addVerb || verb == createVerb {
+		if counter.Packets != nil || (counter.Comment != nil && !ctx.noObjectComments) {
+			fmt.Fprintf(writer, " {")
+
+			if counter.Packets != nil {
+				fmt.Fprintf(writer, " packets %d bytes %d ;", *counter.Packets, *counter.Bytes)
+			}
+			if counter.Comment != nil && !ctx.noObjectComments {
+				fmt.Fprintf(writer, " comment %q ;", *counter.Comment)
+			}
+
+			fmt.Fprintf(writer, " }")
+		}
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
+
+// Object implementation for Quota
+func (quota *Quota) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if quota.Name == "" {
+			return fmt.Errorf("no name specified for quota")
+		}
+		if quota.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+	case deleteVerb, destroyVerb:
+		if quota.Name == "" && quota.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for quotas", verb)
+	}
+
+	return nil
+}
+
+func (quota *Quota) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && quota.Handle != nil {
+		fmt.Fprintf(writer, "%s quota %s %s handle %d\n", verb, ctx.family, ctx.table, *quota.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s quota %s %s %s", verb, ctx.family, ctx.table, quota.Name)
+	if verb == addVerb || verb == createVerb {
+		fmt.Fprintf(writer, " {")
+
+		if quota.Over {
+			fmt.Fprintf(writer, " over")
+		}
+		fmt.Fprintf(writer, " %d bytes", quota.Bytes)
+		if quota.Used != nil {
+			fmt.Fprintf(writer, " used %d bytes", *quota.Used)
+		}
+		fmt.Fprintf(writer, " ;")
+
+		if quota.Comment != nil && !ctx.noObjectComments {
+			fmt.Fprintf(writer, " comment %q ;", *quota.Comment)
+		}
+
+		fmt.Fprintf(writer, " }")
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
+
+// Object implementation for Limit
+func (limit *Limit) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if limit.Name == "" {
+			return fmt.Errorf("no name specified for limit")
+		}
+		if limit.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+		switch limit.Per {
+		case "second", "minute", "hour", "day", "week":
+		default:
+			return fmt.Errorf("limit %q has invalid Per %q", limit.Name, limit.Per)
+		}
+		switch limit.RateUnit {
+		case "", "packets":
+			if limit.BurstUnit != "" && limit.BurstUnit != "packets" {
+				return fmt.Errorf("limit %q has invalid BurstUnit %q for packet limit", limit.Name, limit.BurstUnit)
+			}
+		case "bytes", "kbytes", "mbytes":
+			switch limit.BurstUnit {
+			case "", "bytes", "kbytes", "mbytes":
+			default:
+				return fmt.Errorf("limit %q has invalid BurstUnit %q for byte limit", limit.Name, limit.BurstUnit)
+			}
+		default:
+			return fmt.Errorf("limit %q has invalid RateUnit %q", limit.Name, limit.RateUnit)
+		}
+	case deleteVerb, destroyVerb:
+		if limit.Name == "" && limit.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for limits", verb)
+	}
+
+	return nil
+}
+
+func (limit *Limit) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && limit.Handle != nil {
+		fmt.Fprintf(writer, "%s limit %s %s handle %d\n", verb, ctx.family, ctx.table, *limit.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s limit %s %s %s", verb, ctx.family, ctx.table, limit.Name)
+	if verb == addVerb || verb == createVerb {
+		fmt.Fprintf(writer, " { rate")
+		if limit.Inverse {
+			fmt.Fprintf(writer, " over")
+		}
+
+		if limit.RateUnit == "" || limit.RateUnit == "packets" {
+			fmt.Fprintf(writer, " %d/%s", limit.Rate, limit.Per)
+			if limit.Burst != nil {
+				fmt.Fprintf(writer, " burst %d packets", *limit.Burst)
+			}
+		} else {
+			fmt.Fprintf(writer, " %d %s/%s", limit.Rate, limit.RateUnit, limit.Per)
+			if limit.Burst != nil {
+				burstUnit := limit.BurstUnit
+				if burstUnit == "" {
+					burstUnit = "bytes"
+				}
+				fmt.Fprintf(writer, " burst %d %s", *limit.Burst, burstUnit)
+			}
+		}
+		fmt.Fprintf(writer, " ;")
+
+		if limit.Comment != nil && !ctx.noObjectComments {
+			fmt.Fprintf(writer, " comment %q ;", *limit.Comment)
+		}
+
+		fmt.Fprintf(writer, " }")
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
+
+// Object implementation for CTHelper
+func (helper *CTHelper) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if helper.Name == "" {
+			return fmt.Errorf("no name specified for ct helper")
+		}
+		if helper.Type == "" || helper.Protocol == "" {
+			return fmt.Errorf("ct helper %q must specify Type and Protocol", helper.Name)
+		}
+		if helper.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+	case deleteVerb, destroyVerb:
+		if helper.Name == "" && helper.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for ct helpers", verb)
+	}
+
+	return nil
+}
+
+func (helper *CTHelper) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && helper.Handle != nil {
+		fmt.Fprintf(writer, "%s ct helper %s %s handle %d\n", verb, ctx.family, ctx.table, *helper.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s ct helper %s %s %s", verb, ctx.family, ctx.table, helper.Name)
+	if verb == addVerb || verb == createVerb {
+		fmt.Fprintf(writer, " { type %q protocol %s ;", helper.Type, helper.Protocol)
+		if helper.L3Proto != nil {
+			fmt.Fprintf(writer, " l3proto %s ;", *helper.L3Proto)
+		}
+		if helper.Comment != nil && !ctx.noObjectComments {
+			fmt.Fprintf(writer, " comment %q ;", *helper.Comment)
+		}
+		fmt.Fprintf(writer, " }")
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
+
+// Object implementation for CTTimeout
+func (timeout *CTTimeout) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if timeout.Name == "" {
+			return fmt.Errorf("no name specified for ct timeout")
+		}
+		if timeout.Protocol == "" {
+			return fmt.Errorf("ct timeout %q must specify Protocol", timeout.Name)
+		}
+		if timeout.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+	case deleteVerb, destroyVerb:
+		if timeout.Name == "" && timeout.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for ct timeouts", verb)
+	}
+
+	return nil
+}
+
+func (timeout *CTTimeout) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && timeout.Handle != nil {
+		fmt.Fprintf(writer, "%s ct timeout %s %s handle %d\n", verb, ctx.family, ctx.table, *timeout.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s ct timeout %s %s %s", verb, ctx.family, ctx.table, timeout.Name)
+	if verb == addVerb || verb == createVerb {
+		fmt.Fprintf(writer, " { protocol %s ;", timeout.Protocol)
+		if timeout.L3Proto != nil {
+			fmt.Fprintf(writer, " l3proto %s ;", *timeout.L3Proto)
+		}
+		if len(timeout.Policy) != 0 {
+			fmt.Fprintf(writer, " policy = {")
+			for i, state := range sortKeys(timeout.Policy) {
+				if i > 0 {
+					fmt.Fprintf(writer, ",")
+				}
+				fmt.Fprintf(writer, " %s : %d", state, timeout.Policy[state])
+			}
+			fmt.Fprintf(writer, " } ;")
+		}
+		if timeout.Comment != nil && !ctx.noObjectComments {
+			fmt.Fprintf(writer, " comment %q ;", *timeout.Comment)
+		}
+		fmt.Fprintf(writer, " }")
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
+
+// Object implementation for CTExpectation
+func (expect *CTExpectation) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if expect.Name == "" {
+			return fmt.Errorf("no name specified for ct expectation")
+		}
+		if expect.Protocol == "" || expect.DPort == 0 || expect.Timeout < time.Millisecond || expect.Size == 0 {
+			return fmt.Errorf("ct expectation %q must specify Protocol, DPort, Timeout, and Size", expect.Name)
+		}
+		if expect.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+	case deleteVerb, destroyVerb:
+		if expect.Name == "" && expect.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for ct expectations", verb)
+	}
+
+	return nil
+}
+
+func (expect *CTExpectation) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && expect.Handle != nil {
+		fmt.Fprintf(writer, "%s ct expectation %s %s handle %d\n", verb, ctx.family, ctx.table, *expect.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s ct expectation %s %s %s", verb, ctx.family, ctx.table, expect.Name)
+	if verb == addVerb || verb == createVerb {
+		fmt.Fprintf(writer, " { protocol %s ; dport %d ; timeout %dms ; size %d ;",
+			expect.Protocol, expect.DPort, expect.Timeout.Milliseconds(), expect.Size)
+		if expect.L3Proto != nil {
+			fmt.Fprintf(writer, " l3proto %s ;", *expect.L3Proto)
+		}
+		if expect.Comment != nil && !ctx.noObjectComments {
+			fmt.Fprintf(writer, " comment %q ;", *expect.Comment)
+		}
+		fmt.Fprintf(writer, " }")
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
+
+// Object implementation for Secmark
+func (secmark *Secmark) validate(verb verb) error {
+	switch verb {
+	case addVerb, createVerb:
+		if secmark.Name == "" {
+			return fmt.Errorf("no name specified for secmark")
+		}
+		if secmark.Context == "" {
+			return fmt.Errorf("secmark %q must specify Context", secmark.Name)
+		}
+		if secmark.Handle != nil {
+			return fmt.Errorf("cannot specify Handle in %s operation", verb)
+		}
+	case deleteVerb, destroyVerb:
+		if secmark.Name == "" && secmark.Handle == nil {
+			return fmt.Errorf("must specify either name or handle")
+		}
+	default:
+		return fmt.Errorf("%s is not implemented for secmarks", verb)
+	}
+
+	return nil
+}
+
+func (secmark *Secmark) writeOperation(verb verb, ctx *nftContext, writer io.Writer) {
+	// Special case for delete/destroy-by-handle
+	if (verb == deleteVerb || verb == destroyVerb) && secmark.Handle != nil {
+		fmt.Fprintf(writer, "%s secmark %s %s handle %d\n", verb, ctx.family, ctx.table, *secmark.Handle)
+		return
+	}
+
+	fmt.Fprintf(writer, "%s secmark %s %s %s", verb, ctx.family, ctx.table, secmark.Name)
+	if verb == addVerb || verb == createVerb {
+		fmt.Fprintf(writer, " { %q ;", secmark.Context)
+		if secmark.Comment != nil && !ctx.noObjectComments {
+			fmt.Fprintf(writer, " comment %q ;", *secmark.Comment)
+		}
+		fmt.Fprintf(writer, " }")
+	}
+
+	fmt.Fprintf(writer, "\n")
+}
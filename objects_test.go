@@ -70,12 +70,30 @@ func TestObjects(t *testing.T) {
 			object: &Table{},
 			out:    `delete table ip mytable`,
 		},
+		{
+			name:   "destroy table",
+			verb:   destroyVerb,
+			object: &Table{},
+			out:    `destroy table ip mytable`,
+		},
 		{
 			name:   "delete table by handle",
 			verb:   deleteVerb,
 			object: &Table{Handle: PtrTo(5)},
 			out:    `delete table ip handle 5`,
 		},
+		{
+			name:   "destroy table by handle",
+			verb:   destroyVerb,
+			object: &Table{Handle: PtrTo(5)},
+			out:    `destroy table ip handle 5`,
+		},
+		{
+			name:   "destroy table by handle",
+			verb:   destroyVerb,
+			object: &Table{Handle: PtrTo(5)},
+			out:    `destroy table ip handle 5`,
+		},
 		{
 			name:   "invalid insert table",
 			verb:   insertVerb,
@@ -120,6 +138,18 @@ func TestObjects(t *testing.T) {
 			object: &Chain{Name: "mychain", Type: PtrTo(NATType), Hook: PtrTo(PostroutingHook), Priority: PtrTo(SNATPriority + "+5")},
 			out:    `add chain ip mytable mychain { type nat hook postrouting priority 105 ; }`,
 		},
+		{
+			name:   "add base chain with named priority in another hook",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(NATType), Hook: PtrTo(OutputHook), Priority: PtrTo(DNATPriority)},
+			out:    `add chain ip mytable mychain { type nat hook output priority -100 ; }`,
+		},
+		{
+			name:   "add bridge-only priority in non-bridge family",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(FilterType), Hook: PtrTo(OutputHook), Priority: PtrTo(OutPriority)},
+			out:    `add chain ip mytable mychain { type filter hook output priority out ; }`,
+		},
 		{
 			name:   "add base chain with unrecognized priority",
 			verb:   addVerb,
@@ -135,8 +165,20 @@ func TestObjects(t *testing.T) {
 		{
 			name:   "add base chain with device",
 			verb:   addVerb,
-			object: &Chain{Name: "mychain", Type: PtrTo(NATType), Hook: PtrTo(IngressHook), Device: PtrTo("eth0"), Priority: PtrTo(SNATPriority)},
-			out:    `add chain ip mytable mychain { type nat hook ingress device "eth0" priority 100 ; }`,
+			object: &Chain{Name: "mychain", Type: PtrTo(FilterType), Hook: PtrTo(IngressHook), Device: PtrTo("eth0"), Priority: PtrTo(FilterPriority)},
+			out:    `add chain ip mytable mychain { type filter hook ingress device "eth0" priority 0 ; }`,
+		},
+		{
+			name:   "add base chain with policy",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(FilterType), Hook: PtrTo(InputHook), Priority: PtrTo(FilterPriority), Policy: PtrTo(DropPolicy), Comment: PtrTo("foo")},
+			out:    `add chain ip mytable mychain { type filter hook input priority 0 ; policy drop ; comment "foo" ; }`,
+		},
+		{
+			name:   "invalid add regular chain with policy",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Policy: PtrTo(AcceptPolicy)},
+			err:    "must not specify Policy",
 		},
 		{
 			name:   "create chain",
@@ -156,12 +198,30 @@ func TestObjects(t *testing.T) {
 			object: &Chain{Name: "mychain"},
 			out:    `delete chain ip mytable mychain`,
 		},
+		{
+			name:   "destroy chain",
+			verb:   destroyVerb,
+			object: &Chain{Name: "mychain"},
+			out:    `destroy chain ip mytable mychain`,
+		},
 		{
 			name:   "delete chain by handle",
 			verb:   deleteVerb,
 			object: &Chain{Name: "mychain", Handle: PtrTo(5)},
 			out:    `delete chain ip mytable handle 5`,
 		},
+		{
+			name:   "destroy chain by handle",
+			verb:   destroyVerb,
+			object: &Chain{Name: "mychain", Handle: PtrTo(5)},
+			out:    `destroy chain ip mytable handle 5`,
+		},
+		{
+			name:   "destroy chain by handle",
+			verb:   destroyVerb,
+			object: &Chain{Name: "mychain", Handle: PtrTo(5)},
+			out:    `destroy chain ip mytable handle 5`,
+		},
 		{
 			name:   "delete chain by handle (without name)",
 			verb:   deleteVerb,
@@ -228,6 +288,42 @@ func TestObjects(t *testing.T) {
 			object: &Chain{Name: "mychain", Priority: PtrTo(SNATPriority)},
 			err:    "must not specify Type or Priority",
 		},
+		{
+			name:   "invalid add ingress chain without device",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(FilterType), Hook: PtrTo(IngressHook), Priority: PtrTo(FilterPriority)},
+			err:    "must specify Device",
+		},
+		{
+			name:   "invalid add base chain with unknown type",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(BaseChainType("mangle")), Hook: PtrTo(InputHook), Priority: PtrTo(FilterPriority)},
+			err:    `unknown type "mangle"`,
+		},
+		{
+			name:   "invalid add nat chain on forward hook",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(NATType), Hook: PtrTo(ForwardHook), Priority: PtrTo(FilterPriority)},
+			err:    "of type nat cannot use forward hook",
+		},
+		{
+			name:   "invalid add route chain on input hook",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(RouteType), Hook: PtrTo(InputHook), Priority: PtrTo(ManglePriority)},
+			err:    "of type route cannot use input hook",
+		},
+		{
+			name:   "add route chain on output hook",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(RouteType), Hook: PtrTo(OutputHook), Priority: PtrTo(ManglePriority)},
+			out:    `add chain ip mytable mychain { type route hook output priority -150 ; }`,
+		},
+		{
+			name:   "invalid add input chain with device",
+			verb:   addVerb,
+			object: &Chain{Name: "mychain", Type: PtrTo(FilterType), Hook: PtrTo(InputHook), Device: PtrTo("eth0"), Priority: PtrTo(FilterPriority)},
+			err:    "must not specify Device",
+		},
 		{
 			name:   "invalid add non-base chain with device",
 			verb:   addVerb,
@@ -266,6 +362,12 @@ func TestObjects(t *testing.T) {
 			object: &Rule{Chain: "mychain", Rule: "drop"},
 			out:    `insert rule ip mytable mychain drop`,
 		},
+		{
+			name:   "insert rule relative to index",
+			verb:   insertVerb,
+			object: &Rule{Chain: "mychain", Rule: "drop", Index: PtrTo(0)},
+			out:    `insert rule ip mytable mychain index 0 drop`,
+		},
 		{
 			name:   "insert rule with comment relative to handle",
 			verb:   insertVerb,
@@ -284,12 +386,24 @@ func TestObjects(t *testing.T) {
 			object: &Rule{Chain: "mychain", Rule: "drop", Handle: PtrTo(2)},
 			out:    `delete rule ip mytable mychain handle 2`,
 		},
+		{
+			name:   "destroy rule",
+			verb:   destroyVerb,
+			object: &Rule{Chain: "mychain", Rule: "drop", Handle: PtrTo(2)},
+			out:    `destroy rule ip mytable mychain handle 2`,
+		},
 		{
 			name:   "delete rule without Rule",
 			verb:   deleteVerb,
 			object: &Rule{Chain: "mychain", Handle: PtrTo(2)},
 			out:    `delete rule ip mytable mychain handle 2`,
 		},
+		{
+			name:   "invalid destroy rule without Handle",
+			verb:   destroyVerb,
+			object: &Rule{Chain: "mychain", Rule: "drop"},
+			err:    "must specify Handle",
+		},
 		{
 			name:   "invalid create rule",
 			verb:   createVerb,
@@ -314,12 +428,30 @@ func TestObjects(t *testing.T) {
 			object: &Rule{Chain: "mychain"},
 			err:    "no rule",
 		},
+		{
+			name:   "invalid add rule with negative Index",
+			verb:   addVerb,
+			object: &Rule{Chain: "mychain", Rule: "drop", Index: PtrTo(-1)},
+			err:    "must not be negative",
+		},
 		{
 			name:   "invalid add rule with both Index and Handle",
 			verb:   addVerb,
 			object: &Rule{Chain: "mychain", Rule: "drop", Index: PtrTo(2), Handle: PtrTo(5)},
 			err:    "both Index and Handle",
 		},
+		{
+			name:   "invalid insert rule with both Index and Handle",
+			verb:   insertVerb,
+			object: &Rule{Chain: "mychain", Rule: "drop", Index: PtrTo(0), Handle: PtrTo(5)},
+			err:    "both Index and Handle",
+		},
+		{
+			name:   "invalid replace rule with both Index and Handle",
+			verb:   replaceVerb,
+			object: &Rule{Chain: "mychain", Rule: "drop", Index: PtrTo(0), Handle: PtrTo(5)},
+			err:    "both Index and Handle",
+		},
 		{
 			name:   "invalid replace rule with no Handle",
 			verb:   replaceVerb,
@@ -362,6 +494,60 @@ func TestObjects(t *testing.T) {
 			},
 			out: `add set ip mytable myset { type ipv4_addr ; flags dynamic,interval ; timeout 180s ; gc-interval 3600s ; size 1000 ; policy performance ; auto-merge ; comment "that's a lot of options" ; }`,
 		},
+		{
+			name:   "add set with timeout only",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", Timeout: PtrTo(5 * time.Minute)},
+			out:    `add set ip mytable myset { type ipv4_addr ; timeout 300s ; }`,
+		},
+		{
+			name:   "invalid add set with sub-second timeout",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", Timeout: PtrTo(500 * time.Millisecond)},
+			err:    "timeout must be at least 1 second",
+		},
+		{
+			name:   "invalid add set with sub-second gc-interval",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", Timeout: PtrTo(time.Minute), GCInterval: PtrTo(time.Duration(0))},
+			err:    "gc-interval must be at least 1 second",
+		},
+		{
+			name:   "add interval set with auto-merge",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", Flags: []SetFlag{IntervalFlag}, AutoMerge: PtrTo(true)},
+			out:    `add set ip mytable myset { type ipv4_addr ; flags interval ; auto-merge ; }`,
+		},
+		{
+			name:   "add set with AutoMerge false",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", AutoMerge: PtrTo(false)},
+			out:    `add set ip mytable myset { type ipv4_addr ; }`,
+		},
+		{
+			name:   "add set with memory policy",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", Policy: PtrTo(MemoryPolicy)},
+			out:    `add set ip mytable myset { type ipv4_addr ; policy memory ; }`,
+		},
+		{
+			name:   "invalid add set with unknown policy",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", Policy: PtrTo(SetPolicy("fast"))},
+			err:    `unknown set policy "fast"`,
+		},
+		{
+			name:   "invalid add map with unknown policy",
+			verb:   addVerb,
+			object: &Map{Name: "mymap", Type: "ipv4_addr : ipv4_addr", Policy: PtrTo(SetPolicy("fast"))},
+			err:    `unknown set policy "fast"`,
+		},
+		{
+			name:   "invalid add set with auto-merge but no interval flag",
+			verb:   addVerb,
+			object: &Set{Name: "myset", Type: "ipv4_addr", AutoMerge: PtrTo(true)},
+			err:    "auto-merge requires the interval flag",
+		},
 		{
 			name:   "create set",
 			verb:   createVerb,
@@ -386,12 +572,30 @@ func TestObjects(t *testing.T) {
 			object: &Set{Name: "myset"},
 			out:    `delete set ip mytable myset`,
 		},
+		{
+			name:   "destroy set",
+			verb:   destroyVerb,
+			object: &Set{Name: "myset"},
+			out:    `destroy set ip mytable myset`,
+		},
 		{
 			name:   "delete set by handle",
 			verb:   deleteVerb,
 			object: &Set{Name: "myset", Handle: PtrTo(5)},
 			out:    `delete set ip mytable handle 5`,
 		},
+		{
+			name:   "destroy set by handle",
+			verb:   destroyVerb,
+			object: &Set{Name: "myset", Handle: PtrTo(5)},
+			out:    `destroy set ip mytable handle 5`,
+		},
+		{
+			name:   "destroy set by handle",
+			verb:   destroyVerb,
+			object: &Set{Name: "myset", Handle: PtrTo(5)},
+			out:    `destroy set ip mytable handle 5`,
+		},
 		{
 			name:   "delete set by handle without Name",
 			verb:   deleteVerb,
@@ -463,6 +667,12 @@ func TestObjects(t *testing.T) {
 			},
 			out: `add map ip mytable mymap { type ipv4_addr : ipv4_addr ; flags dynamic,interval ; timeout 180s ; gc-interval 3600s ; size 1000 ; policy performance ; comment "that's a lot of options" ; }`,
 		},
+		{
+			name:   "invalid add map with sub-second timeout",
+			verb:   addVerb,
+			object: &Map{Name: "mymap", Type: "ipv4_addr : ipv4_addr", Timeout: PtrTo(time.Millisecond)},
+			err:    "timeout must be at least 1 second",
+		},
 		{
 			name:   "create map",
 			verb:   createVerb,
@@ -487,12 +697,24 @@ func TestObjects(t *testing.T) {
 			object: &Map{Name: "mymap"},
 			out:    `delete map ip mytable mymap`,
 		},
+		{
+			name:   "destroy map",
+			verb:   destroyVerb,
+			object: &Map{Name: "mymap"},
+			out:    `destroy map ip mytable mymap`,
+		},
 		{
 			name:   "delete map by Handle",
 			verb:   deleteVerb,
 			object: &Map{Name: "mymap", Handle: PtrTo(5)},
 			out:    `delete map ip mytable handle 5`,
 		},
+		{
+			name:   "destroy map by handle",
+			verb:   destroyVerb,
+			object: &Map{Name: "mymap", Handle: PtrTo(5)},
+			out:    `destroy map ip mytable handle 5`,
+		},
 		{
 			name:   "delete map by Handle without Name",
 			verb:   deleteVerb,
@@ -549,6 +771,42 @@ func TestObjects(t *testing.T) {
 			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"192.168.1.1"}},
 			out:    `add element ip mytable mymap { 10.0.0.1 : 192.168.1.1 }`,
 		},
+		{
+			name:   "add (map) element with goto verdict",
+			verb:   addVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1", "tcp", "80"}, Value: []string{"goto mychain"}},
+			out:    `add element ip mytable mymap { 10.0.0.1 . tcp . 80 : goto mychain }`,
+		},
+		{
+			name:   "add (map) element with jump verdict",
+			verb:   addVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"jump mychain"}},
+			out:    `add element ip mytable mymap { 10.0.0.1 : jump mychain }`,
+		},
+		{
+			name:   "add (map) element with simple verdicts",
+			verb:   addVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"return"}},
+			out:    `add element ip mytable mymap { 10.0.0.1 : return }`,
+		},
+		{
+			name:   "add (map) element with drop verdict and comment",
+			verb:   addVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"drop"}, Comment: PtrTo("blocked")},
+			out:    `add element ip mytable mymap { 10.0.0.1 comment "blocked" : drop }`,
+		},
+		{
+			name:   "invalid add (map) element with goto verdict but no chain",
+			verb:   addVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"goto"}},
+			err:    `no chain specified for "goto" verdict`,
+		},
+		{
+			name:   "invalid add (map) element with jump verdict but no chain",
+			verb:   addVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"jump"}},
+			err:    `no chain specified for "jump" verdict`,
+		},
 		{
 			name:   "create (set) element with comment",
 			verb:   createVerb,
@@ -561,6 +819,30 @@ func TestObjects(t *testing.T) {
 			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"192.168.1.1"}, Comment: PtrTo("comment")},
 			out:    `add element ip mytable mymap { 10.0.0.1 comment "comment" : 192.168.1.1 }`,
 		},
+		{
+			name:   "add (set) element with timeout",
+			verb:   addVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Timeout: 5 * time.Minute},
+			out:    `add element ip mytable myset { 10.0.0.1 timeout 300s }`,
+		},
+		{
+			name:   "add (map) element with timeout and comment",
+			verb:   addVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"192.168.1.1"}, Timeout: time.Hour, Comment: PtrTo("comment")},
+			out:    `add element ip mytable mymap { 10.0.0.1 timeout 3600s comment "comment" : 192.168.1.1 }`,
+		},
+		{
+			name:   "invalid add element with sub-second timeout",
+			verb:   addVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Timeout: time.Millisecond},
+			err:    "timeout must be at least 1 second",
+		},
+		{
+			name:   "delete element with timeout",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Timeout: 5 * time.Minute},
+			out:    `delete element ip mytable myset { 10.0.0.1 }`,
+		},
 		{
 			name:   "delete (set) element",
 			verb:   deleteVerb,
@@ -579,6 +861,66 @@ func TestObjects(t *testing.T) {
 			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}},
 			out:    `delete element ip mytable mymap { 10.0.0.1 }`,
 		},
+		{
+			name:   "destroy (set) element",
+			verb:   destroyVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}},
+			out:    `destroy element ip mytable myset { 10.0.0.1 }`,
+		},
+		{
+			name:   "delete (set) element with concatenated key",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1", "tcp", "80"}},
+			out:    `delete element ip mytable myset { 10.0.0.1 . tcp . 80 }`,
+		},
+		{
+			name:   "delete (set) element with prefix key",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.0/8"}},
+			out:    `delete element ip mytable myset { 10.0.0.0/8 }`,
+		},
+		{
+			name:   "delete (set) element with range key",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1-10.0.0.9"}},
+			out:    `delete element ip mytable myset { 10.0.0.1-10.0.0.9 }`,
+		},
+		{
+			name:   "delete (set) element with concatenated range key",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.0/8", "1000-2000"}},
+			out:    `delete element ip mytable myset { 10.0.0.0/8 . 1000-2000 }`,
+		},
+		{
+			name:   "delete (set) element with comment",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Comment: PtrTo("comment")},
+			out:    `delete element ip mytable myset { 10.0.0.1 }`,
+		},
+		{
+			name:   "delete (map) element with concatenated key",
+			verb:   deleteVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1", "tcp", "80"}, Value: []string{"goto mychain"}},
+			out:    `delete element ip mytable mymap { 10.0.0.1 . tcp . 80 }`,
+		},
+		{
+			name:   "destroy (map) element",
+			verb:   destroyVerb,
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}},
+			out:    `destroy element ip mytable mymap { 10.0.0.1 }`,
+		},
+		{
+			name:   "invalid delete element with no Key",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset"},
+			err:    "no key",
+		},
+		{
+			name:   "invalid delete (set) element with Value",
+			verb:   deleteVerb,
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Value: []string{"80"}},
+			err:    "map value specified for set element",
+		},
 		{
 			name:   "invalid add element with no Set",
 			verb:   addVerb,
@@ -627,95 +969,739 @@ func TestObjects(t *testing.T) {
 			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}},
 			err:    "not implemented",
 		},
-	} {
-		t.Run(tc.name, func(t *testing.T) {
-			err := tc.object.validate(tc.verb)
-			if err == nil {
-				if tc.err != "" {
-					t.Errorf("expected error with %q but got none", tc.err)
-				}
-			} else if tc.err == "" {
-				t.Errorf("expected no error but got %q", err)
-			} else if !strings.Contains(err.Error(), tc.err) {
-				t.Errorf("expected error with %q but got %q", tc.err, err)
-			}
-
-			objType := getObjType(tc.object)
-			if tested[objType] == nil {
-				tested[objType] = make(map[verb]struct{})
-			}
-			tested[objType][tc.verb] = struct{}{}
-
-			if err == nil && tc.err == "" {
-				b := &strings.Builder{}
-				ctx := &nftContext{family: IPv4Family, table: "mytable"}
-				tc.object.writeOperation(tc.verb, ctx, b)
-				out := strings.TrimSuffix(b.String(), "\n")
-				if out != tc.out {
-					t.Errorf("expected %q but got %q", tc.out, out)
-				}
-			}
-		})
-	}
-
-	// add, create, flush, insert, replace, delete
-	numVerbs := 6
-	for objType, verbs := range tested {
-		if len(verbs) != numVerbs {
-			t.Errorf("expected to test %d verbs for %s, got %d (%v)", numVerbs, objType, len(verbs), verbs)
-		}
-	}
-}
 
-func TestNoObjectComments(t *testing.T) {
-	for _, tc := range []struct {
-		name   string
-		object Object
-		out    string
-	}{
+		// Flowtables
 		{
-			name:   "add table with comment",
-			object: &Table{Comment: PtrTo("foo")},
-			out:    `add table ip mytable`,
+			name:   "add flowtable",
+			verb:   addVerb,
+			object: &Flowtable{Name: "myflowtable", Priority: PtrTo(FilterIngressPriority), Devices: []string{"eth0", "eth1"}},
+			out:    `add flowtable ip mytable myflowtable { hook ingress priority 0 ; devices = { eth0, eth1 } ; }`,
 		},
 		{
-			name:   "add chain with comment",
-			object: &Chain{Name: "mychain", Comment: PtrTo("foo")},
-			out:    `add chain ip mytable mychain`,
+			name:   "create flowtable with numeric priority",
+			verb:   createVerb,
+			object: &Flowtable{Name: "myflowtable", Priority: PtrTo(FlowtableIngressPriority("10"))},
+			out:    `create flowtable ip mytable myflowtable { hook ingress priority 10 ; }`,
 		},
 		{
-			name:   "add base chain with comment",
-			object: &Chain{Name: "mychain", Type: PtrTo(NATType), Hook: PtrTo(PostroutingHook), Priority: PtrTo(SNATPriority), Comment: PtrTo("foo")},
-			out:    `add chain ip mytable mychain { type nat hook postrouting priority 100 ; }`,
+			name:   "delete flowtable",
+			verb:   deleteVerb,
+			object: &Flowtable{Name: "myflowtable"},
+			out:    `delete flowtable ip mytable myflowtable`,
 		},
 		{
-			name:   "add rule with comment",
-			object: &Rule{Chain: "mychain", Rule: "drop", Comment: PtrTo("comment")},
-			out:    `add rule ip mytable mychain drop comment "comment"`,
+			name:   "destroy flowtable",
+			verb:   destroyVerb,
+			object: &Flowtable{Name: "myflowtable"},
+			out:    `destroy flowtable ip mytable myflowtable`,
 		},
 		{
-			name:   "add set with comment",
-			object: &Set{Name: "myset", Type: "ipv4_addr", Comment: PtrTo("comment")},
-			out:    `add set ip mytable myset { type ipv4_addr ; }`,
+			name:   "delete flowtable by handle",
+			verb:   deleteVerb,
+			object: &Flowtable{Name: "myflowtable", Handle: PtrTo(5)},
+			out:    `delete flowtable ip mytable handle 5`,
 		},
 		{
-			name:   "add map with comment",
-			object: &Map{Name: "mymap", Type: "ipv4_addr : ipv4_addr", Comment: PtrTo("comment")},
-			out:    `add map ip mytable mymap { type ipv4_addr : ipv4_addr ; }`,
+			name:   "destroy flowtable by handle",
+			verb:   destroyVerb,
+			object: &Flowtable{Name: "myflowtable", Handle: PtrTo(5)},
+			out:    `destroy flowtable ip mytable handle 5`,
 		},
 		{
-			name:   "add (set) element with comment",
-			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Comment: PtrTo("comment")},
-			out:    `add element ip mytable myset { 10.0.0.1 comment "comment" }`,
+			name:   "destroy flowtable by handle",
+			verb:   destroyVerb,
+			object: &Flowtable{Name: "myflowtable", Handle: PtrTo(5)},
+			out:    `destroy flowtable ip mytable handle 5`,
 		},
 		{
-			name:   "add (map) element with comment",
-			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"192.168.1.1"}, Comment: PtrTo("comment")},
-			out:    `add element ip mytable mymap { 10.0.0.1 comment "comment" : 192.168.1.1 }`,
+			name:   "invalid add flowtable with no Priority",
+			verb:   addVerb,
+			object: &Flowtable{Name: "myflowtable", Devices: []string{"eth0"}},
+			err:    "must specify Priority",
 		},
-	} {
-		t.Run(tc.name, func(t *testing.T) {
-			b := &strings.Builder{}
+		{
+			name:   "invalid add flowtable with Handle",
+			verb:   addVerb,
+			object: &Flowtable{Name: "myflowtable", Priority: PtrTo(FilterIngressPriority), Handle: PtrTo(5)},
+			err:    "cannot specify Handle",
+		},
+		{
+			name:   "invalid flush flowtable",
+			verb:   flushVerb,
+			object: &Flowtable{Name: "myflowtable"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert flowtable",
+			verb:   insertVerb,
+			object: &Flowtable{Name: "myflowtable"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace flowtable",
+			verb:   replaceVerb,
+			object: &Flowtable{Name: "myflowtable"},
+			err:    "not implemented",
+		},
+
+		// Counters
+		{
+			name:   "add counter",
+			verb:   addVerb,
+			object: &Counter{Name: "mycounter"},
+			out:    `add counter ip mytable mycounter`,
+		},
+		{
+			name:   "add counter with initial values and comment",
+			verb:   addVerb,
+			object: &Counter{Name: "mycounter", Packets: PtrTo[uint64](10), Bytes: PtrTo[uint64](1000), Comment: PtrTo("foo")},
+			out:    `add counter ip mytable mycounter { packets 10 bytes 1000 ; comment "foo" ; }`,
+		},
+		{
+			name:   "create counter",
+			verb:   createVerb,
+			object: &Counter{Name: "mycounter"},
+			out:    `create counter ip mytable mycounter`,
+		},
+		{
+			name:   "delete counter",
+			verb:   deleteVerb,
+			object: &Counter{Name: "mycounter"},
+			out:    `delete counter ip mytable mycounter`,
+		},
+		{
+			name:   "destroy counter",
+			verb:   destroyVerb,
+			object: &Counter{Name: "mycounter"},
+			out:    `destroy counter ip mytable mycounter`,
+		},
+		{
+			name:   "delete counter by handle",
+			verb:   deleteVerb,
+			object: &Counter{Handle: PtrTo(5)},
+			out:    `delete counter ip mytable handle 5`,
+		},
+		{
+			name:   "destroy counter by handle",
+			verb:   destroyVerb,
+			object: &Counter{Handle: PtrTo(5)},
+			out:    `destroy counter ip mytable handle 5`,
+		},
+		{
+			name:   "destroy counter by handle",
+			verb:   destroyVerb,
+			object: &Counter{Handle: PtrTo(5)},
+			out:    `destroy counter ip mytable handle 5`,
+		},
+		{
+			name:   "invalid add counter with only Packets",
+			verb:   addVerb,
+			object: &Counter{Name: "mycounter", Packets: PtrTo[uint64](10)},
+			err:    "both or neither",
+		},
+		{
+			name:   "invalid add counter with no name",
+			verb:   addVerb,
+			object: &Counter{},
+			err:    "no name",
+		},
+		{
+			name:   "invalid flush counter",
+			verb:   flushVerb,
+			object: &Counter{Name: "mycounter"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert counter",
+			verb:   insertVerb,
+			object: &Counter{Name: "mycounter"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace counter",
+			verb:   replaceVerb,
+			object: &Counter{Name: "mycounter"},
+			err:    "not implemented",
+		},
+
+		// Quotas
+		{
+			name:   "add quota",
+			verb:   addVerb,
+			object: &Quota{Name: "myquota", Bytes: 1000000},
+			out:    `add quota ip mytable myquota { 1000000 bytes ; }`,
+		},
+		{
+			name:   "add over quota with used and comment",
+			verb:   addVerb,
+			object: &Quota{Name: "myquota", Bytes: 1000000, Used: PtrTo[uint64](500), Over: true, Comment: PtrTo("foo")},
+			out:    `add quota ip mytable myquota { over 1000000 bytes used 500 bytes ; comment "foo" ; }`,
+		},
+		{
+			name:   "create quota",
+			verb:   createVerb,
+			object: &Quota{Name: "myquota", Bytes: 1000},
+			out:    `create quota ip mytable myquota { 1000 bytes ; }`,
+		},
+		{
+			name:   "delete quota",
+			verb:   deleteVerb,
+			object: &Quota{Name: "myquota"},
+			out:    `delete quota ip mytable myquota`,
+		},
+		{
+			name:   "destroy quota",
+			verb:   destroyVerb,
+			object: &Quota{Name: "myquota"},
+			out:    `destroy quota ip mytable myquota`,
+		},
+		{
+			name:   "delete quota by handle",
+			verb:   deleteVerb,
+			object: &Quota{Handle: PtrTo(5)},
+			out:    `delete quota ip mytable handle 5`,
+		},
+		{
+			name:   "destroy quota by handle",
+			verb:   destroyVerb,
+			object: &Quota{Handle: PtrTo(5)},
+			out:    `destroy quota ip mytable handle 5`,
+		},
+		{
+			name:   "destroy quota by handle",
+			verb:   destroyVerb,
+			object: &Quota{Handle: PtrTo(5)},
+			out:    `destroy quota ip mytable handle 5`,
+		},
+		{
+			name:   "invalid add quota with no name",
+			verb:   addVerb,
+			object: &Quota{Bytes: 1000},
+			err:    "no name",
+		},
+		{
+			name:   "invalid flush quota",
+			verb:   flushVerb,
+			object: &Quota{Name: "myquota"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert quota",
+			verb:   insertVerb,
+			object: &Quota{Name: "myquota"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace quota",
+			verb:   replaceVerb,
+			object: &Quota{Name: "myquota"},
+			err:    "not implemented",
+		},
+
+		// Limits
+		{
+			name:   "add packet limit",
+			verb:   addVerb,
+			object: &Limit{Name: "mylimit", Rate: 400, Per: "minute"},
+			out:    `add limit ip mytable mylimit { rate 400/minute ; }`,
+		},
+		{
+			name:   "add packet limit with burst and comment",
+			verb:   addVerb,
+			object: &Limit{Name: "mylimit", Rate: 400, RateUnit: "packets", Per: "minute", Burst: PtrTo[uint64](5), Comment: PtrTo("foo")},
+			out:    `add limit ip mytable mylimit { rate 400/minute burst 5 packets ; comment "foo" ; }`,
+		},
+		{
+			name:   "create inverse byte limit with burst",
+			verb:   createVerb,
+			object: &Limit{Name: "mylimit", Rate: 10, RateUnit: "mbytes", Per: "second", Burst: PtrTo[uint64](100), BurstUnit: "kbytes", Inverse: true},
+			out:    `create limit ip mytable mylimit { rate over 10 mbytes/second burst 100 kbytes ; }`,
+		},
+		{
+			name:   "delete limit",
+			verb:   deleteVerb,
+			object: &Limit{Name: "mylimit"},
+			out:    `delete limit ip mytable mylimit`,
+		},
+		{
+			name:   "destroy limit",
+			verb:   destroyVerb,
+			object: &Limit{Name: "mylimit"},
+			out:    `destroy limit ip mytable mylimit`,
+		},
+		{
+			name:   "delete limit by handle",
+			verb:   deleteVerb,
+			object: &Limit{Handle: PtrTo(5)},
+			out:    `delete limit ip mytable handle 5`,
+		},
+		{
+			name:   "destroy limit by handle",
+			verb:   destroyVerb,
+			object: &Limit{Handle: PtrTo(5)},
+			out:    `destroy limit ip mytable handle 5`,
+		},
+		{
+			name:   "destroy limit by handle",
+			verb:   destroyVerb,
+			object: &Limit{Handle: PtrTo(5)},
+			out:    `destroy limit ip mytable handle 5`,
+		},
+		{
+			name:   "invalid add limit with no Per",
+			verb:   addVerb,
+			object: &Limit{Name: "mylimit", Rate: 400},
+			err:    "invalid Per",
+		},
+		{
+			name:   "invalid add limit with bad RateUnit",
+			verb:   addVerb,
+			object: &Limit{Name: "mylimit", Rate: 400, RateUnit: "gbytes", Per: "second"},
+			err:    "invalid RateUnit",
+		},
+		{
+			name:   "invalid add packet limit with byte BurstUnit",
+			verb:   addVerb,
+			object: &Limit{Name: "mylimit", Rate: 400, Per: "second", Burst: PtrTo[uint64](5), BurstUnit: "bytes"},
+			err:    "invalid BurstUnit",
+		},
+		{
+			name:   "invalid flush limit",
+			verb:   flushVerb,
+			object: &Limit{Name: "mylimit"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert limit",
+			verb:   insertVerb,
+			object: &Limit{Name: "mylimit"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace limit",
+			verb:   replaceVerb,
+			object: &Limit{Name: "mylimit"},
+			err:    "not implemented",
+		},
+
+		// CT helpers
+		{
+			name:   "add ct helper",
+			verb:   addVerb,
+			object: &CTHelper{Name: "ftp-standard", Type: "ftp", Protocol: "tcp"},
+			out:    `add ct helper ip mytable ftp-standard { type "ftp" protocol tcp ; }`,
+		},
+		{
+			name:   "add ct helper with l3proto and comment",
+			verb:   addVerb,
+			object: &CTHelper{Name: "ftp-standard", Type: "ftp", Protocol: "tcp", L3Proto: PtrTo(InetFamily), Comment: PtrTo("foo")},
+			out:    `add ct helper ip mytable ftp-standard { type "ftp" protocol tcp ; l3proto inet ; comment "foo" ; }`,
+		},
+		{
+			name:   "create ct helper",
+			verb:   createVerb,
+			object: &CTHelper{Name: "sip-5060", Type: "sip", Protocol: "udp"},
+			out:    `create ct helper ip mytable sip-5060 { type "sip" protocol udp ; }`,
+		},
+		{
+			name:   "delete ct helper",
+			verb:   deleteVerb,
+			object: &CTHelper{Name: "ftp-standard"},
+			out:    `delete ct helper ip mytable ftp-standard`,
+		},
+		{
+			name:   "destroy ct helper",
+			verb:   destroyVerb,
+			object: &CTHelper{Name: "ftp-standard"},
+			out:    `destroy ct helper ip mytable ftp-standard`,
+		},
+		{
+			name:   "delete ct helper by handle",
+			verb:   deleteVerb,
+			object: &CTHelper{Handle: PtrTo(5)},
+			out:    `delete ct helper ip mytable handle 5`,
+		},
+		{
+			name:   "destroy ct helper by handle",
+			verb:   destroyVerb,
+			object: &CTHelper{Handle: PtrTo(5)},
+			out:    `destroy ct helper ip mytable handle 5`,
+		},
+		{
+			name:   "destroy ct helper by handle",
+			verb:   destroyVerb,
+			object: &CTHelper{Handle: PtrTo(5)},
+			out:    `destroy ct helper ip mytable handle 5`,
+		},
+		{
+			name:   "invalid add ct helper with no Protocol",
+			verb:   addVerb,
+			object: &CTHelper{Name: "ftp-standard", Type: "ftp"},
+			err:    "must specify Type and Protocol",
+		},
+		{
+			name:   "invalid flush ct helper",
+			verb:   flushVerb,
+			object: &CTHelper{Name: "ftp-standard"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert ct helper",
+			verb:   insertVerb,
+			object: &CTHelper{Name: "ftp-standard"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace ct helper",
+			verb:   replaceVerb,
+			object: &CTHelper{Name: "ftp-standard"},
+			err:    "not implemented",
+		},
+
+		// CT timeouts
+		{
+			name:   "add ct timeout",
+			verb:   addVerb,
+			object: &CTTimeout{Name: "tcp-long", Protocol: "tcp"},
+			out:    `add ct timeout ip mytable tcp-long { protocol tcp ; }`,
+		},
+		{
+			name: "add ct timeout with policy",
+			verb: addVerb,
+			object: &CTTimeout{
+				Name:     "tcp-long",
+				Protocol: "tcp",
+				L3Proto:  PtrTo(IPv4Family),
+				Policy:   map[string]uint32{"established": 7200, "close": 10},
+				Comment:  PtrTo("foo"),
+			},
+			out: `add ct timeout ip mytable tcp-long { protocol tcp ; l3proto ip ; policy = { close : 10, established : 7200 } ; comment "foo" ; }`,
+		},
+		{
+			name:   "create ct timeout",
+			verb:   createVerb,
+			object: &CTTimeout{Name: "udp-short", Protocol: "udp", Policy: map[string]uint32{"unreplied": 5}},
+			out:    `create ct timeout ip mytable udp-short { protocol udp ; policy = { unreplied : 5 } ; }`,
+		},
+		{
+			name:   "delete ct timeout",
+			verb:   deleteVerb,
+			object: &CTTimeout{Name: "tcp-long"},
+			out:    `delete ct timeout ip mytable tcp-long`,
+		},
+		{
+			name:   "destroy ct timeout",
+			verb:   destroyVerb,
+			object: &CTTimeout{Name: "tcp-long"},
+			out:    `destroy ct timeout ip mytable tcp-long`,
+		},
+		{
+			name:   "delete ct timeout by handle",
+			verb:   deleteVerb,
+			object: &CTTimeout{Handle: PtrTo(5)},
+			out:    `delete ct timeout ip mytable handle 5`,
+		},
+		{
+			name:   "destroy ct timeout by handle",
+			verb:   destroyVerb,
+			object: &CTTimeout{Handle: PtrTo(5)},
+			out:    `destroy ct timeout ip mytable handle 5`,
+		},
+		{
+			name:   "destroy ct timeout by handle",
+			verb:   destroyVerb,
+			object: &CTTimeout{Handle: PtrTo(5)},
+			out:    `destroy ct timeout ip mytable handle 5`,
+		},
+		{
+			name:   "invalid add ct timeout with no Protocol",
+			verb:   addVerb,
+			object: &CTTimeout{Name: "tcp-long"},
+			err:    "must specify Protocol",
+		},
+		{
+			name:   "invalid flush ct timeout",
+			verb:   flushVerb,
+			object: &CTTimeout{Name: "tcp-long"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert ct timeout",
+			verb:   insertVerb,
+			object: &CTTimeout{Name: "tcp-long"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace ct timeout",
+			verb:   replaceVerb,
+			object: &CTTimeout{Name: "tcp-long"},
+			err:    "not implemented",
+		},
+
+		// CT expectations
+		{
+			name:   "add ct expectation",
+			verb:   addVerb,
+			object: &CTExpectation{Name: "ftp-data", Protocol: "tcp", DPort: 20, Timeout: 30 * time.Second, Size: 8},
+			out:    `add ct expectation ip mytable ftp-data { protocol tcp ; dport 20 ; timeout 30000ms ; size 8 ; }`,
+		},
+		{
+			name:   "add ct expectation with l3proto and comment",
+			verb:   addVerb,
+			object: &CTExpectation{Name: "ftp-data", L3Proto: PtrTo(IPv6Family), Protocol: "tcp", DPort: 20, Timeout: 1500 * time.Millisecond, Size: 1, Comment: PtrTo("foo")},
+			out:    `add ct expectation ip mytable ftp-data { protocol tcp ; dport 20 ; timeout 1500ms ; size 1 ; l3proto ip6 ; comment "foo" ; }`,
+		},
+		{
+			name:   "create ct expectation",
+			verb:   createVerb,
+			object: &CTExpectation{Name: "sip-rtp", Protocol: "udp", DPort: 5062, Timeout: time.Minute, Size: 4},
+			out:    `create ct expectation ip mytable sip-rtp { protocol udp ; dport 5062 ; timeout 60000ms ; size 4 ; }`,
+		},
+		{
+			name:   "delete ct expectation",
+			verb:   deleteVerb,
+			object: &CTExpectation{Name: "ftp-data"},
+			out:    `delete ct expectation ip mytable ftp-data`,
+		},
+		{
+			name:   "destroy ct expectation",
+			verb:   destroyVerb,
+			object: &CTExpectation{Name: "ftp-data"},
+			out:    `destroy ct expectation ip mytable ftp-data`,
+		},
+		{
+			name:   "delete ct expectation by handle",
+			verb:   deleteVerb,
+			object: &CTExpectation{Handle: PtrTo(5)},
+			out:    `delete ct expectation ip mytable handle 5`,
+		},
+		{
+			name:   "destroy ct expectation by handle",
+			verb:   destroyVerb,
+			object: &CTExpectation{Handle: PtrTo(5)},
+			out:    `destroy ct expectation ip mytable handle 5`,
+		},
+		{
+			name:   "destroy ct expectation by handle",
+			verb:   destroyVerb,
+			object: &CTExpectation{Handle: PtrTo(5)},
+			out:    `destroy ct expectation ip mytable handle 5`,
+		},
+		{
+			name:   "invalid add ct expectation with no Timeout",
+			verb:   addVerb,
+			object: &CTExpectation{Name: "ftp-data", Protocol: "tcp", DPort: 20, Size: 8},
+			err:    "must specify Protocol, DPort, Timeout, and Size",
+		},
+		{
+			name:   "invalid flush ct expectation",
+			verb:   flushVerb,
+			object: &CTExpectation{Name: "ftp-data"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert ct expectation",
+			verb:   insertVerb,
+			object: &CTExpectation{Name: "ftp-data"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace ct expectation",
+			verb:   replaceVerb,
+			object: &CTExpectation{Name: "ftp-data"},
+			err:    "not implemented",
+		},
+
+		// Secmarks
+		{
+			name:   "add secmark",
+			verb:   addVerb,
+			object: &Secmark{Name: "sshtag", Context: "system_u:object_r:ssh_server_packet_t:s0"},
+			out:    `add secmark ip mytable sshtag { "system_u:object_r:ssh_server_packet_t:s0" ; }`,
+		},
+		{
+			name:   "add secmark with comment",
+			verb:   addVerb,
+			object: &Secmark{Name: "sshtag", Context: "system_u:object_r:ssh_server_packet_t:s0", Comment: PtrTo("foo")},
+			out:    `add secmark ip mytable sshtag { "system_u:object_r:ssh_server_packet_t:s0" ; comment "foo" ; }`,
+		},
+		{
+			name:   "create secmark",
+			verb:   createVerb,
+			object: &Secmark{Name: "httptag", Context: "system_u:object_r:http_server_packet_t:s0"},
+			out:    `create secmark ip mytable httptag { "system_u:object_r:http_server_packet_t:s0" ; }`,
+		},
+		{
+			name:   "delete secmark",
+			verb:   deleteVerb,
+			object: &Secmark{Name: "sshtag"},
+			out:    `delete secmark ip mytable sshtag`,
+		},
+		{
+			name:   "destroy secmark",
+			verb:   destroyVerb,
+			object: &Secmark{Name: "sshtag"},
+			out:    `destroy secmark ip mytable sshtag`,
+		},
+		{
+			name:   "delete secmark by handle",
+			verb:   deleteVerb,
+			object: &Secmark{Handle: PtrTo(5)},
+			out:    `delete secmark ip mytable handle 5`,
+		},
+		{
+			name:   "destroy secmark by handle",
+			verb:   destroyVerb,
+			object: &Secmark{Handle: PtrTo(5)},
+			out:    `destroy secmark ip mytable handle 5`,
+		},
+		{
+			name:   "destroy secmark by handle",
+			verb:   destroyVerb,
+			object: &Secmark{Handle: PtrTo(5)},
+			out:    `destroy secmark ip mytable handle 5`,
+		},
+		{
+			name:   "invalid add secmark with no Context",
+			verb:   addVerb,
+			object: &Secmark{Name: "sshtag"},
+			err:    "must specify Context",
+		},
+		{
+			name:   "invalid flush secmark",
+			verb:   flushVerb,
+			object: &Secmark{Name: "sshtag"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid insert secmark",
+			verb:   insertVerb,
+			object: &Secmark{Name: "sshtag"},
+			err:    "not implemented",
+		},
+		{
+			name:   "invalid replace secmark",
+			verb:   replaceVerb,
+			object: &Secmark{Name: "sshtag"},
+			err:    "not implemented",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.object.validate(tc.verb)
+			if err == nil {
+				if tc.err != "" {
+					t.Errorf("expected error with %q but got none", tc.err)
+				}
+			} else if tc.err == "" {
+				t.Errorf("expected no error but got %q", err)
+			} else if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error with %q but got %q", tc.err, err)
+			}
+
+			objType := getObjType(tc.object)
+			if tested[objType] == nil {
+				tested[objType] = make(map[verb]struct{})
+			}
+			tested[objType][tc.verb] = struct{}{}
+
+			if err == nil && tc.err == "" {
+				b := &strings.Builder{}
+				ctx := &nftContext{family: IPv4Family, table: "mytable"}
+				tc.object.writeOperation(tc.verb, ctx, b)
+				if !strings.HasSuffix(b.String(), "\n") {
+					t.Errorf("expected output to end with a newline but got %q", b.String())
+				}
+				out := strings.TrimSuffix(b.String(), "\n")
+				if out != tc.out {
+					t.Errorf("expected %q but got %q", tc.out, out)
+				}
+			}
+		})
+	}
+
+	// add, create, flush, insert, replace, delete, destroy
+	numVerbs := 7
+	for objType, verbs := range tested {
+		if len(verbs) != numVerbs {
+			t.Errorf("expected to test %d verbs for %s, got %d (%v)", numVerbs, objType, len(verbs), verbs)
+		}
+	}
+}
+
+func TestDeleteByHandle(t *testing.T) {
+	fake := NewFake(IPv4Family, "mytable")
+	tx := fake.NewTransaction()
+	tx.Delete(&Chain{Handle: PtrTo(5)})
+	tx.Delete(&Set{Handle: PtrTo(6)})
+	tx.Delete(&Map{Handle: PtrTo(7)})
+	tx.Add(&Chain{Name: "mychain"})
+
+	expected := strings.Join([]string{
+		"delete chain ip mytable handle 5",
+		"delete set ip mytable handle 6",
+		"delete map ip mytable handle 7",
+		"add chain ip mytable mychain",
+		"",
+	}, "\n")
+	if out := tx.String(); out != expected {
+		t.Errorf("expected %q but got %q", expected, out)
+	}
+}
+
+func TestNoObjectComments(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		object Object
+		out    string
+	}{
+		{
+			name:   "add table with comment",
+			object: &Table{Comment: PtrTo("foo")},
+			out:    `add table ip mytable`,
+		},
+		{
+			name:   "add chain with comment",
+			object: &Chain{Name: "mychain", Comment: PtrTo("foo")},
+			out:    `add chain ip mytable mychain`,
+		},
+		{
+			name:   "add base chain with comment",
+			object: &Chain{Name: "mychain", Type: PtrTo(NATType), Hook: PtrTo(PostroutingHook), Priority: PtrTo(SNATPriority), Comment: PtrTo("foo")},
+			out:    `add chain ip mytable mychain { type nat hook postrouting priority 100 ; }`,
+		},
+		{
+			name:   "add rule with comment",
+			object: &Rule{Chain: "mychain", Rule: "drop", Comment: PtrTo("comment")},
+			out:    `add rule ip mytable mychain drop comment "comment"`,
+		},
+		{
+			name:   "add set with comment",
+			object: &Set{Name: "myset", Type: "ipv4_addr", Comment: PtrTo("comment")},
+			out:    `add set ip mytable myset { type ipv4_addr ; }`,
+		},
+		{
+			name:   "add counter with comment",
+			object: &Counter{Name: "mycounter", Comment: PtrTo("comment")},
+			out:    `add counter ip mytable mycounter`,
+		},
+		{
+			name:   "add map with comment",
+			object: &Map{Name: "mymap", Type: "ipv4_addr : ipv4_addr", Comment: PtrTo("comment")},
+			out:    `add map ip mytable mymap { type ipv4_addr : ipv4_addr ; }`,
+		},
+		{
+			name:   "add (set) element with comment",
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Comment: PtrTo("comment")},
+			out:    `add element ip mytable myset { 10.0.0.1 comment "comment" }`,
+		},
+		{
+			name:   "add (map) element with comment",
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"192.168.1.1"}, Comment: PtrTo("comment")},
+			out:    `add element ip mytable mymap { 10.0.0.1 comment "comment" : 192.168.1.1 }`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &strings.Builder{}
 			ctx := &nftContext{family: IPv4Family, table: "mytable", noObjectComments: true}
 			tc.object.writeOperation(addVerb, ctx, b)
 			out := strings.TrimSuffix(b.String(), "\n")
@@ -726,6 +1712,55 @@ func TestNoObjectComments(t *testing.T) {
 	}
 }
 
+func TestNoSetComments(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		object Object
+		out    string
+	}{
+		{
+			name:   "add table with comment",
+			object: &Table{Comment: PtrTo("foo")},
+			out:    `add table ip mytable { comment "foo" ; }`,
+		},
+		{
+			name:   "add chain with comment",
+			object: &Chain{Name: "mychain", Comment: PtrTo("foo")},
+			out:    `add chain ip mytable mychain { comment "foo" ; }`,
+		},
+		{
+			name:   "add set with comment",
+			object: &Set{Name: "myset", Type: "ipv4_addr", Comment: PtrTo("comment")},
+			out:    `add set ip mytable myset { type ipv4_addr ; }`,
+		},
+		{
+			name:   "add map with comment",
+			object: &Map{Name: "mymap", Type: "ipv4_addr : ipv4_addr", Comment: PtrTo("comment")},
+			out:    `add map ip mytable mymap { type ipv4_addr : ipv4_addr ; }`,
+		},
+		{
+			name:   "add (set) element with comment",
+			object: &Element{Set: "myset", Key: []string{"10.0.0.1"}, Comment: PtrTo("comment")},
+			out:    `add element ip mytable myset { 10.0.0.1 }`,
+		},
+		{
+			name:   "add (map) element with comment",
+			object: &Element{Map: "mymap", Key: []string{"10.0.0.1"}, Value: []string{"192.168.1.1"}, Comment: PtrTo("comment")},
+			out:    `add element ip mytable mymap { 10.0.0.1 : 192.168.1.1 }`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			ctx := &nftContext{family: IPv4Family, table: "mytable", noSetComments: true}
+			tc.object.writeOperation(addVerb, ctx, b)
+			out := strings.TrimSuffix(b.String(), "\n")
+			if out != tc.out {
+				t.Errorf("expected %q but got %q", tc.out, out)
+			}
+		})
+	}
+}
+
 func TestParsePriority(t *testing.T) {
 	for _, tc := range []struct {
 		name     string
@@ -746,6 +1781,36 @@ func TestParsePriority(t *testing.T) {
 			priority: "dstnat",
 			out:      -300,
 		},
+		{
+			name:     "bridge-only priority",
+			family:   BridgeFamily,
+			priority: string(OutPriority),
+			out:      100,
+		},
+		{
+			name:     "bridge-only priority in other family",
+			family:   IPv4Family,
+			priority: string(OutPriority),
+			err:      true,
+		},
+		{
+			name:     "non-bridge priority in bridge family",
+			family:   BridgeFamily,
+			priority: string(RawPriority),
+			err:      true,
+		},
+		{
+			name:     "bridge family with math",
+			family:   BridgeFamily,
+			priority: string(FilterPriority) + "+10",
+			out:      -190,
+		},
+		{
+			name:     "inet family",
+			family:   InetFamily,
+			priority: string(SecurityPriority),
+			out:      50,
+		},
 		{
 			name:     "numeric",
 			family:   IPv4Family,
@@ -0,0 +1,476 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ParseRuleset parses the JSON output of "nft --json list ruleset" (or "nft --json list
+// table ...") read from r, without running nft. Objects of types that knftables does
+// not support are ignored. As with Interface.ListRules, the Rule field of the returned
+// rules will not be filled in.
+func ParseRuleset(r io.Reader) (*Ruleset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseRuleset(string(data), defaultJSONSchemaVersion, defaultJSONSchemaVersion)
+}
+
+// parseRuleset implements ParseRuleset, accepting JSON schema versions between minVersion
+// and maxVersion.
+func parseRuleset(data string, minVersion, maxVersion int) (*Ruleset, error) {
+	nftablesResult, err := parseJSONOutput(data, minVersion, maxVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &Ruleset{}
+	for _, objContainer := range nftablesResult {
+		for objectType, obj := range objContainer {
+			if objectType == "metainfo" {
+				continue
+			}
+
+			family, _ := jsonVal[string](obj, "family")
+			var tableName string
+			if objectType == "table" {
+				tableName, _ = jsonVal[string](obj, "name")
+			} else {
+				tableName, _ = jsonVal[string](obj, "table")
+			}
+			table := rs.Table(Family(family), tableName)
+			if table == nil {
+				table = &RulesetTable{Family: Family(family), Name: tableName}
+				rs.Tables = append(rs.Tables, table)
+			}
+
+			if err := table.addJSONObject(objectType, obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rs, nil
+}
+
+// Table returns the table in rs with the given family and name, or nil if there is no
+// such table.
+func (rs *Ruleset) Table(family Family, name string) *RulesetTable {
+	for _, table := range rs.Tables {
+		if table.Family == family && table.Name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// addJSONObject parses obj, a JSON object of type objectType from nft's output, and adds
+// it to table.
+func (table *RulesetTable) addJSONObject(objectType string, obj map[string]interface{}) error {
+	switch objectType {
+	case "table":
+		table.Table = *parseJSONTable(obj)
+	case "chain":
+		table.Chains = append(table.Chains, parseJSONChain(obj))
+	case "rule":
+		table.Rules = append(table.Rules, parseJSONRule(obj))
+	case "set":
+		set, err := parseJSONSet(obj)
+		if err != nil {
+			return err
+		}
+		table.Sets = append(table.Sets, set)
+		elements, err := parseJSONElements(obj, "set", set.Name)
+		if err != nil {
+			return err
+		}
+		table.Elements = append(table.Elements, elements...)
+	case "map":
+		mapObj, err := parseJSONMap(obj)
+		if err != nil {
+			return err
+		}
+		table.Maps = append(table.Maps, mapObj)
+		elements, err := parseJSONElements(obj, "map", mapObj.Name)
+		if err != nil {
+			return err
+		}
+		table.Elements = append(table.Elements, elements...)
+	case "flowtable":
+		flowtable, err := parseJSONFlowtable(obj)
+		if err != nil {
+			return err
+		}
+		table.Flowtables = append(table.Flowtables, flowtable)
+	case "counter":
+		table.Counters = append(table.Counters, parseJSONCounter(obj))
+	case "quota":
+		table.Quotas = append(table.Quotas, parseJSONQuota(obj))
+	case "limit":
+		table.Limits = append(table.Limits, parseJSONLimit(obj))
+	case "ct helper":
+		table.CTHelpers = append(table.CTHelpers, parseJSONCTHelper(obj))
+	case "ct timeout":
+		table.CTTimeouts = append(table.CTTimeouts, parseJSONCTTimeout(obj))
+	case "ct expectation":
+		table.CTExpectations = append(table.CTExpectations, parseJSONCTExpectation(obj))
+	case "secmark":
+		table.Secmarks = append(table.Secmarks, parseJSONSecmark(obj))
+	}
+	return nil
+}
+
+// stateRuleset returns a copy of rs containing only the objects that have runtime state
+// (named counters and quotas).
+func stateRuleset(rs *Ruleset) *Ruleset {
+	state := &Ruleset{}
+	for _, table := range rs.Tables {
+		state.Tables = append(state.Tables, &RulesetTable{
+			Family:   table.Family,
+			Name:     table.Name,
+			Table:    table.Table,
+			Counters: table.Counters,
+			Quotas:   table.Quotas,
+		})
+	}
+	return state
+}
+
+// rulesetTransaction adds operations to tx to add all of the objects in the appropriate
+// table of rs (see Interface.ImportRuleset), and returns it.
+func rulesetTransaction(tx *Transaction, rs *Ruleset) (*Transaction, error) {
+	var table *RulesetTable
+	if len(rs.Tables) == 1 {
+		table = rs.Tables[0]
+	} else {
+		table = rs.Table(tx.family, tx.table)
+		if table == nil {
+			return nil, fmt.Errorf("ruleset does not contain table %s %s", tx.family, tx.table)
+		}
+	}
+
+	// Objects can only refer to objects that were added before them, so we add the
+	// table, then sets, maps, and stateful objects, then chains, then rules, and
+	// finally elements (which may refer to chains, in verdict maps).
+	tableObj := table.Table
+	tableObj.Handle = nil
+	tx.Add(&tableObj)
+
+	for _, obj := range table.Sets {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Maps {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Flowtables {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Counters {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Quotas {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Limits {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.CTHelpers {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.CTTimeouts {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.CTExpectations {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Secmarks {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Chains {
+		obj := *obj
+		obj.Handle = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Rules {
+		obj := *obj
+		obj.Handle = nil
+		obj.Index = nil
+		tx.Add(&obj)
+	}
+	for _, obj := range table.Elements {
+		tx.Add(obj)
+	}
+
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	return tx, nil
+}
+
+// verifyTransaction checks that the objects that tx should have added to its table are
+// present in rs (which should be the result of calling ExportRuleset after running tx).
+// Rules are not checked: rules have no name to find them by, and nft prints their text
+// in its own normalized form, which need not match the text that tx wrote. (This also
+// means RunAndVerify only needs the JSON listing, without ExportRuleset's text listing.)
+// Elements are only checked if they are not in interval sets or maps (since nft may
+// merge or split interval elements) and if their keys can be normalized to match nft's
+// output (see verifyKey).
+func verifyTransaction(tx *Transaction, rs *Ruleset) error {
+	expected := make(map[string]bool)
+	var order []string
+	tableExpected := false
+
+	var table *RulesetTable
+	if rs != nil {
+		table = rs.Table(tx.family, tx.table)
+	}
+	intervals := intervalSets(tx, table)
+
+	for _, op := range tx.operations {
+		key := verifyKey(op.obj)
+		if elem, ok := op.obj.(*Element); ok && intervals[elementParent(elem)] {
+			key = ""
+		}
+		switch op.verb {
+		case addVerb, createVerb:
+			if _, ok := op.obj.(*Table); ok {
+				tableExpected = true
+			}
+			if key != "" {
+				if !expected[key] {
+					order = append(order, key)
+				}
+				expected[key] = true
+			}
+		case deleteVerb, destroyVerb:
+			if _, ok := op.obj.(*Table); ok {
+				tableExpected = false
+				expected = make(map[string]bool)
+			}
+			if key != "" {
+				delete(expected, key)
+			}
+			// Deleting a set or map also deletes its elements
+			switch obj := op.obj.(type) {
+			case *Set:
+				deleteElementKeys(expected, "set", obj.Name)
+			case *Map:
+				deleteElementKeys(expected, "map", obj.Name)
+			}
+		case flushVerb:
+			switch obj := op.obj.(type) {
+			case *Table:
+				deleteElementKeys(expected, "", "")
+			case *Set:
+				deleteElementKeys(expected, "set", obj.Name)
+			case *Map:
+				deleteElementKeys(expected, "map", obj.Name)
+			}
+		}
+	}
+
+	if table == nil {
+		if tableExpected || len(expected) > 0 {
+			return fmt.Errorf("table %s %s is missing after transaction", tx.family, tx.table)
+		}
+		return nil
+	}
+
+	present := make(map[string]bool)
+	for _, obj := range table.Chains {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Sets {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Maps {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Elements {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Flowtables {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Counters {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Quotas {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Limits {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.CTHelpers {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.CTTimeouts {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.CTExpectations {
+		present[verifyKey(obj)] = true
+	}
+	for _, obj := range table.Secmarks {
+		present[verifyKey(obj)] = true
+	}
+
+	var missing []string
+	for _, key := range order {
+		if expected[key] && !present[key] {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("objects missing after transaction: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// verifyKey returns a string identifying obj for verifyTransaction, or "" if obj is not
+// an object that verifyTransaction checks.
+func verifyKey(obj Object) string {
+	switch obj := obj.(type) {
+	case *Chain:
+		return "chain " + obj.Name
+	case *Set:
+		return "set " + obj.Name
+	case *Map:
+		return "map " + obj.Name
+	case *Element:
+		key := make([]string, 0, len(obj.Key))
+		for _, val := range obj.Key {
+			normalized, ok := normalizeKeyValue(val)
+			if !ok {
+				return ""
+			}
+			key = append(key, normalized)
+		}
+		return "element " + elementParent(obj) + " { " + strings.Join(key, " . ") + " }"
+	case *Flowtable:
+		return "flowtable " + obj.Name
+	case *Counter:
+		return "counter " + obj.Name
+	case *Quota:
+		return "quota " + obj.Name
+	case *Limit:
+		return "limit " + obj.Name
+	case *CTHelper:
+		return "ct helper " + obj.Name
+	case *CTTimeout:
+		return "ct timeout " + obj.Name
+	case *CTExpectation:
+		return "ct expectation " + obj.Name
+	case *Secmark:
+		return "secmark " + obj.Name
+	}
+	return ""
+}
+
+// normalizeKeyValue returns val (one component of an element key) in the form that nft
+// outputs it, if it is an IP address or an integer. Otherwise it returns false, since
+// other values (eg, service names like "http") may be output differently than they were
+// written.
+func normalizeKeyValue(val string) (string, bool) {
+	if addr, err := netip.ParseAddr(val); err == nil {
+		return addr.String(), true
+	}
+	if num, err := strconv.ParseUint(val, 10, 64); err == nil {
+		return strconv.FormatUint(num, 10), true
+	}
+	return "", false
+}
+
+// elementParent returns "set NAME" or "map NAME" for the set or map containing elem.
+func elementParent(elem *Element) string {
+	if elem.Set != "" {
+		return "set " + elem.Set
+	}
+	return "map " + elem.Map
+}
+
+// intervalSets returns the sets and maps (as "set NAME" or "map NAME") that are added by
+// tx or are present in table with the interval flag.
+func intervalSets(tx *Transaction, table *RulesetTable) map[string]bool {
+	intervals := make(map[string]bool)
+	addSet := func(set *Set) {
+		if hasSetFlag(set.Flags, IntervalFlag) {
+			intervals["set "+set.Name] = true
+		}
+	}
+	addMap := func(mapObj *Map) {
+		if hasSetFlag(mapObj.Flags, IntervalFlag) {
+			intervals["map "+mapObj.Name] = true
+		}
+	}
+	for _, op := range tx.operations {
+		switch obj := op.obj.(type) {
+		case *Set:
+			addSet(obj)
+		case *Map:
+			addMap(obj)
+		}
+	}
+	if table != nil {
+		for _, set := range table.Sets {
+			addSet(set)
+		}
+		for _, mapObj := range table.Maps {
+			addMap(mapObj)
+		}
+	}
+	return intervals
+}
+
+// deleteElementKeys deletes the keys of elements of the set or map (as indicated by
+// objectType) named name from keys. If objectType is "", it deletes the keys of all
+// elements.
+func deleteElementKeys(keys map[string]bool, objectType, name string) {
+	prefix := "element "
+	if objectType != "" {
+		prefix += objectType + " " + name + " { "
+	}
+	for key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			delete(keys, key)
+		}
+	}
+}
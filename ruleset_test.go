@@ -0,0 +1,306 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/lithammer/dedent"
+)
+
+func TestParseRuleset(t *testing.T) {
+	input := `{"nftables": [
+	  {"metainfo": {"version": "1.0.7", "release_name": "Old Doc Yak", "json_schema_version": 1}},
+	  {"table": {"family": "ip", "name": "kube-proxy", "handle": 1, "comment": "rules for kube-proxy"}},
+	  {"chain": {"family": "ip", "table": "kube-proxy", "name": "filter-input", "handle": 2, "type": "filter", "hook": "input", "prio": 0, "policy": "accept"}},
+	  {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 3}},
+	  {"set": {"family": "ip", "name": "ips", "table": "kube-proxy", "type": "ipv4_addr", "handle": 4, "elem": ["10.0.0.1", {"elem": {"val": "10.0.0.2", "comment": "two"}}]}},
+	  {"map": {"family": "ip", "name": "vmap", "table": "kube-proxy", "type": "ipv4_addr", "handle": 5, "map": "verdict", "elem": [["10.0.0.1", {"goto": {"target": "services"}}]]}},
+	  {"counter": {"family": "ip", "name": "packets", "table": "kube-proxy", "handle": 6, "packets": 10, "bytes": 1000}},
+	  {"synproxy": {"family": "ip", "name": "unsupported", "table": "kube-proxy", "handle": 7, "mss": 1460, "wscale": 7}},
+	  {"rule": {"family": "ip", "table": "kube-proxy", "chain": "filter-input", "handle": 8, "expr": [{"jump": {"target": "services"}}]}},
+	  {"rule": {"family": "ip", "table": "kube-proxy", "chain": "services", "handle": 9, "comment": "drop", "expr": [{"drop": null}]}},
+	  {"table": {"family": "ip6", "name": "filter", "handle": 2}},
+	  {"chain": {"family": "ip6", "table": "filter", "name": "INPUT", "handle": 1}}
+	]}`
+
+	rs, err := ParseRuleset(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &Ruleset{
+		Tables: []*RulesetTable{
+			{
+				Family: IPv4Family,
+				Name:   "kube-proxy",
+				Table: Table{
+					Comment: PtrTo("rules for kube-proxy"),
+					Handle:  PtrTo(1),
+				},
+				Chains: []*Chain{
+					{
+						Name:     "filter-input",
+						Type:     PtrTo(FilterType),
+						Hook:     PtrTo(InputHook),
+						Priority: PtrTo(BaseChainPriority("0")),
+						Policy:   PtrTo(AcceptPolicy),
+						Handle:   PtrTo(2),
+					},
+					{
+						Name:   "services",
+						Handle: PtrTo(3),
+					},
+				},
+				Rules: []*Rule{
+					{
+						Chain:  "filter-input",
+						Handle: PtrTo(8),
+						Exprs:  rawExprs(`{"jump":{"target":"services"}}`),
+					},
+					{
+						Chain:   "services",
+						Comment: PtrTo("drop"),
+						Handle:  PtrTo(9),
+						Exprs:   rawExprs(`{"drop":null}`),
+					},
+				},
+				Sets: []*Set{
+					{
+						Name:   "ips",
+						Type:   "ipv4_addr",
+						Handle: PtrTo(4),
+					},
+				},
+				Maps: []*Map{
+					{
+						Name:   "vmap",
+						Type:   "ipv4_addr : verdict",
+						Handle: PtrTo(5),
+					},
+				},
+				Elements: []*Element{
+					{
+						Set: "ips",
+						Key: []string{"10.0.0.1"},
+					},
+					{
+						Set:     "ips",
+						Key:     []string{"10.0.0.2"},
+						Comment: PtrTo("two"),
+					},
+					{
+						Map:   "vmap",
+						Key:   []string{"10.0.0.1"},
+						Value: []string{"goto services"},
+					},
+				},
+				Counters: []*Counter{
+					{
+						Name:    "packets",
+						Packets: PtrTo[uint64](10),
+						Bytes:   PtrTo[uint64](1000),
+						Handle:  PtrTo(6),
+					},
+				},
+			},
+			{
+				Family: IPv6Family,
+				Name:   "filter",
+				Table: Table{
+					Handle: PtrTo(2),
+				},
+				Chains: []*Chain{
+					{
+						Name:   "INPUT",
+						Handle: PtrTo(1),
+					},
+				},
+			},
+		},
+	}
+	diff := cmp.Diff(expected, rs)
+	if diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	if rs.Table(IPv6Family, "filter") != rs.Tables[1] {
+		t.Errorf("Table() did not find ip6 filter table")
+	}
+	if rs.Table(IPv4Family, "filter") != nil {
+		t.Errorf("Table() unexpectedly found ip filter table")
+	}
+}
+
+func TestParseRulesetBad(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name:  "not JSON",
+			input: `table ip foo { }`,
+			err:   "could not parse nft output",
+		},
+		{
+			name:  "no metadata",
+			input: `{"nftables": [{"table": {"family": "ip", "name": "foo", "handle": 1}}]}`,
+			err:   "could not find metadata",
+		},
+		{
+			name:  "bad set type",
+			input: `{"nftables": [{"metainfo": {"json_schema_version": 1}}, {"set": {"family": "ip", "name": "s", "table": "foo", "type": 5, "handle": 1}}]}`,
+			err:   "could not parse",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRuleset(strings.NewReader(tc.input))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestImportRuleset(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	rs := &Ruleset{
+		Tables: []*RulesetTable{{
+			Family: IPv4Family,
+			Name:   "other",
+			Table:  Table{Comment: PtrTo("restored"), Handle: PtrTo(1)},
+			Chains: []*Chain{
+				{Name: "a", Handle: PtrTo(2)},
+				{Name: "b", Handle: PtrTo(3)},
+			},
+			Rules: []*Rule{
+				{Chain: "a", Rule: "ip daddr @ips jump b", Handle: PtrTo(10)},
+				{Chain: "b", Rule: "counter name packets drop", Handle: PtrTo(11)},
+			},
+			Sets:     []*Set{{Name: "ips", Type: "ipv4_addr", Handle: PtrTo(4)}},
+			Maps:     []*Map{{Name: "vmap", Type: "ipv4_addr : verdict", Handle: PtrTo(5)}},
+			Counters: []*Counter{{Name: "packets", Handle: PtrTo(6)}},
+			Elements: []*Element{
+				{Set: "ips", Key: []string{"10.0.0.1"}},
+				{Map: "vmap", Key: []string{"10.0.0.1"}, Value: []string{"goto b"}},
+			},
+		}},
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy { comment "restored" ; }
+		add set ip kube-proxy ips { type ipv4_addr ; }
+		add map ip kube-proxy vmap { type ipv4_addr : verdict ; }
+		add counter ip kube-proxy packets
+		add chain ip kube-proxy a
+		add chain ip kube-proxy b
+		add rule ip kube-proxy a ip daddr @ips jump b
+		add rule ip kube-proxy b counter name packets drop
+		add element ip kube-proxy ips { 10.0.0.1 }
+		add element ip kube-proxy vmap { 10.0.0.1 : goto b }
+		`), "\n")
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: expected,
+		},
+	)
+
+	err := nft.ImportRuleset(context.Background(), rs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The Ruleset should not have been modified
+	if rs.Tables[0].Chains[0].Handle == nil || *rs.Tables[0].Rules[0].Handle != 10 {
+		t.Errorf("ImportRuleset modified its argument")
+	}
+
+	// The same ruleset can be imported into a fake, and exported back out again
+	fake := NewFake(IPv4Family, "kube-proxy")
+	err = fake.ImportRuleset(context.Background(), rs)
+	if err != nil {
+		t.Fatalf("unexpected error from fake: %v", err)
+	}
+	direct := NewFake(IPv4Family, "kube-proxy")
+	tx := direct.NewTransaction()
+	tx.Add(&Table{Comment: PtrTo("restored")})
+	tx.Add(&Set{Name: "ips", Type: "ipv4_addr"})
+	tx.Add(&Map{Name: "vmap", Type: "ipv4_addr : verdict"})
+	tx.Add(&Counter{Name: "packets"})
+	tx.Add(&Chain{Name: "a"})
+	tx.Add(&Chain{Name: "b"})
+	tx.Add(&Rule{Chain: "a", Rule: "ip daddr @ips jump b"})
+	tx.Add(&Rule{Chain: "b", Rule: "counter name packets drop"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Map: "vmap", Key: []string{"10.0.0.1"}, Value: []string{"goto b"}})
+	if err := direct.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error from fake: %v", err)
+	}
+	diff := cmp.Diff(direct.Dump(), fake.Dump())
+	if diff != "" {
+		t.Errorf("unexpected fake contents:\n%s", diff)
+	}
+	exported, err := fake.ExportRuleset(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error from ExportRuleset: %v", err)
+	}
+	fake2 := NewFake(IPv4Family, "kube-proxy")
+	err = fake2.ImportRuleset(context.Background(), exported)
+	if err != nil {
+		t.Fatalf("unexpected error from fake: %v", err)
+	}
+	diff = cmp.Diff(fake.Dump(), fake2.Dump())
+	if diff != "" {
+		t.Errorf("unexpected result from re-import:\n%s", diff)
+	}
+}
+
+func TestImportRulesetBad(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	// Rules without rule bodies (as returned from real ListAllRules) can't be
+	// imported.
+	rs := &Ruleset{
+		Tables: []*RulesetTable{{
+			Family: IPv4Family,
+			Name:   "kube-proxy",
+			Chains: []*Chain{{Name: "a"}},
+			Rules:  []*Rule{{Chain: "a", Handle: PtrTo(5)}},
+		}},
+	}
+	err := fake.ImportRuleset(context.Background(), rs)
+	if err == nil || !strings.Contains(err.Error(), "no rule specified") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// If there are multiple tables, one must match
+	rs = &Ruleset{
+		Tables: []*RulesetTable{
+			{Family: IPv4Family, Name: "filter"},
+			{Family: IPv6Family, Name: "kube-proxy"},
+		},
+	}
+	err = fake.ImportRuleset(context.Background(), rs)
+	if err == nil || !strings.Contains(err.Error(), "does not contain table ip kube-proxy") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
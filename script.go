@@ -0,0 +1,866 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewTransactionFromScript parses script (a series of nft commands, one per line) into a
+// new Transaction. Only the subset of nft syntax that knftables itself generates is
+// supported, so this can be used to round-trip a transaction through tx.String(), or to
+// import scripts written in the same style. All of the commands in script must operate on
+// the same family and table, which the returned Transaction will use; it can only be run
+// by an Interface for that family and table, which will write it out using its own
+// optional features (see Interface.SupportsFeature).
+//
+// Since "element" commands do not indicate whether they refer to a set or a map, an
+// element is assumed to belong to a map if it has a value or if a map of that name was
+// added earlier in the script, and to a set otherwise.
+func NewTransactionFromScript(script string) (*Transaction, error) {
+	p := &scriptParser{
+		tx:   &Transaction{nftContext: &nftContext{}},
+		maps: make(map[string]bool),
+	}
+	for i, line := range strings.Split(script, "\n") {
+		if err := p.parseLine(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return p.tx, nil
+}
+
+// scriptParser holds the state of NewTransactionFromScript
+type scriptParser struct {
+	tx *Transaction
+
+	// maps contains the names of maps added by the script
+	maps map[string]bool
+}
+
+// scriptToken is a single whitespace-separated word (or quoted string) from a line of an
+// nft script.
+type scriptToken struct {
+	// text is the token, with quotes removed if it was quoted
+	text string
+	// raw is the token exactly as it appeared in the line
+	raw string
+	// quoted is true if the token was a quoted string
+	quoted bool
+
+	// start and end are the offsets of the token in the line
+	start, end int
+}
+
+// tokenizeScriptLine splits line into scriptTokens
+func tokenizeScriptLine(line string) ([]scriptToken, error) {
+	var tokens []scriptToken
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		if line[i] == '"' {
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			i++
+			text, err := strconv.Unquote(line[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("bad quoted string %s: %w", line[start:i], err)
+			}
+			tokens = append(tokens, scriptToken{text: text, raw: line[start:i], quoted: true, start: start, end: i})
+			continue
+		}
+
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' && line[i] != '"' {
+			i++
+		}
+		tokens = append(tokens, scriptToken{text: line[start:i], raw: line[start:i], start: start, end: i})
+	}
+	return tokens, nil
+}
+
+// joinScriptTokens returns the raw text of tokens, separated by spaces
+func joinScriptTokens(tokens []scriptToken) string {
+	words := make([]string, len(tokens))
+	for i := range tokens {
+		words[i] = tokens[i].raw
+	}
+	return strings.Join(words, " ")
+}
+
+// parseScriptBody parses the "{ ... }" part of a command into a list of
+// semicolon-separated statements. If tokens is empty, it returns nil.
+func parseScriptBody(tokens []scriptToken) ([][]scriptToken, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	if len(tokens) < 2 || tokens[0].raw != "{" || tokens[len(tokens)-1].raw != "}" {
+		return nil, fmt.Errorf("unexpected %q", joinScriptTokens(tokens))
+	}
+
+	var stmts [][]scriptToken
+	var stmt []scriptToken
+	for _, token := range tokens[1 : len(tokens)-1] {
+		if token.raw == ";" {
+			if len(stmt) > 0 {
+				stmts = append(stmts, stmt)
+			}
+			stmt = nil
+		} else {
+			stmt = append(stmt, token)
+		}
+	}
+	if len(stmt) > 0 {
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// forEachScriptAttribute calls fn for each "key value" pair in stmts
+func forEachScriptAttribute(stmts [][]scriptToken, fn func(key string, value scriptToken) error) error {
+	for _, stmt := range stmts {
+		for i := 0; i < len(stmt); i += 2 {
+			if i+1 == len(stmt) {
+				return fmt.Errorf("missing value for %q", stmt[i].text)
+			}
+			if err := fn(stmt[i].text, stmt[i+1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseScriptBraceList parses a "= { a, b, ... }" list (as in a flowtable's devices),
+// returning the raw values.
+func parseScriptBraceList(tokens []scriptToken) ([]string, error) {
+	if len(tokens) < 3 || tokens[0].raw != "=" || tokens[1].raw != "{" || tokens[len(tokens)-1].raw != "}" {
+		return nil, fmt.Errorf("unexpected %q", joinScriptTokens(tokens))
+	}
+	var values []string
+	for _, token := range tokens[2 : len(tokens)-1] {
+		for _, value := range strings.Split(token.raw, ",") {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values, nil
+}
+
+func parseScriptInt(token scriptToken) (int, error) {
+	val, err := strconv.Atoi(token.text)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", token.text)
+	}
+	return val, nil
+}
+
+func parseScriptUint(token scriptToken, bitSize int) (uint64, error) {
+	val, err := strconv.ParseUint(token.text, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", token.text)
+	}
+	return val, nil
+}
+
+func parseScriptDuration(token scriptToken) (time.Duration, error) {
+	val, err := time.ParseDuration(token.text)
+	if err != nil {
+		return 0, fmt.Errorf("bad duration %q", token.text)
+	}
+	return val, nil
+}
+
+// setTable sets the family and table of p.tx, or returns an error if they were already set
+// to something else.
+func (p *scriptParser) setTable(family Family, table string) error {
+	if p.tx.family == "" {
+		p.tx.family = family
+	} else if p.tx.family != family {
+		return fmt.Errorf("script refers to multiple families (%s and %s)", p.tx.family, family)
+	}
+	if table == "" {
+		return nil
+	}
+	if p.tx.table == "" {
+		p.tx.table = table
+	} else if p.tx.table != table {
+		return fmt.Errorf("script refers to multiple tables (%s and %s)", p.tx.table, table)
+	}
+	return nil
+}
+
+// parseLine parses a single line of the script and adds it to p.tx
+func (p *scriptParser) parseLine(line string) error {
+	trimmed := strings.TrimLeft(line, " \t")
+	if strings.HasPrefix(trimmed, "#") {
+		p.tx.Comment(strings.TrimPrefix(strings.TrimPrefix(trimmed, "#"), " "))
+		return p.tx.err
+	}
+
+	tokens, err := tokenizeScriptLine(line)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	if len(tokens) < 3 {
+		return fmt.Errorf("incomplete command %q", line)
+	}
+
+	verb := verb(tokens[0].text)
+	switch verb {
+	case addVerb, createVerb, insertVerb, replaceVerb, deleteVerb, destroyVerb, flushVerb:
+	default:
+		return fmt.Errorf("unknown verb %q", verb)
+	}
+
+	objType := tokens[1].text
+	rest := tokens[2:]
+	if objType == "ct" {
+		objType = "ct " + rest[0].text
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("incomplete command %q", line)
+	}
+	family := Family(rest[0].text)
+	rest = rest[1:]
+
+	// Tables are special because they are named by the family+table rather than by
+	// their own name.
+	if objType == "table" {
+		table := &Table{}
+		if len(rest) == 2 && rest[0].text == "handle" {
+			handle, err := parseScriptInt(rest[1])
+			if err != nil {
+				return err
+			}
+			table.Handle = &handle
+			if err := p.setTable(family, ""); err != nil {
+				return err
+			}
+		} else {
+			if len(rest) == 0 {
+				return fmt.Errorf("incomplete command %q", line)
+			}
+			if err := p.setTable(family, rest[0].text); err != nil {
+				return err
+			}
+			stmts, err := parseScriptBody(rest[1:])
+			if err != nil {
+				return err
+			}
+			err = forEachScriptAttribute(stmts, func(key string, value scriptToken) error {
+				if key != "comment" {
+					return fmt.Errorf("unknown table attribute %q", key)
+				}
+				table.Comment = &value.text
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		p.tx.operation(verb, table)
+		return p.tx.err
+	}
+
+	if len(rest) < 2 {
+		return fmt.Errorf("incomplete command %q", line)
+	}
+	if err := p.setTable(family, rest[0].text); err != nil {
+		return err
+	}
+	rest = rest[1:]
+
+	switch objType {
+	case "rule":
+		return p.parseRule(verb, line, rest)
+	case "element":
+		return p.parseElements(verb, rest)
+	}
+
+	var name string
+	var handle *int
+	var stmts [][]scriptToken
+	if len(rest) == 2 && rest[0].text == "handle" && (verb == deleteVerb || verb == destroyVerb) {
+		val, err := parseScriptInt(rest[1])
+		if err != nil {
+			return err
+		}
+		handle = &val
+	} else {
+		name = rest[0].text
+		stmts, err = parseScriptBody(rest[1:])
+		if err != nil {
+			return err
+		}
+	}
+
+	var obj Object
+	switch objType {
+	case "chain":
+		obj, err = parseScriptChain(name, handle, stmts)
+	case "set":
+		obj, err = parseScriptSet(name, handle, stmts)
+	case "map":
+		obj, err = parseScriptMap(name, handle, stmts)
+		if err == nil && (verb == addVerb || verb == createVerb) {
+			p.maps[name] = true
+		}
+	case "flowtable":
+		obj, err = parseScriptFlowtable(name, handle, stmts)
+	case "counter":
+		obj, err = parseScriptCounter(name, handle, stmts)
+	case "quota":
+		obj, err = parseScriptQuota(name, handle, stmts)
+	case "limit":
+		obj, err = parseScriptLimit(name, handle, stmts)
+	case "ct helper":
+		obj, err = parseScriptCTHelper(name, handle, stmts)
+	case "ct timeout":
+		obj, err = parseScriptCTTimeout(name, handle, stmts)
+	case "ct expectation":
+		obj, err = parseScriptCTExpectation(name, handle, stmts)
+	case "secmark":
+		obj, err = parseScriptSecmark(name, handle, stmts)
+	default:
+		return fmt.Errorf("unknown object type %q", objType)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.tx.operation(verb, obj)
+	return p.tx.err
+}
+
+// parseRule parses the part of a "rule" command after the table name. Since the rule
+// text can contain arbitrary nft syntax, it is taken directly from line.
+func (p *scriptParser) parseRule(verb verb, line string, tokens []scriptToken) error {
+	rule := &Rule{Chain: tokens[0].text}
+	tokens = tokens[1:]
+
+	if len(tokens) >= 2 && (tokens[0].text == "index" || tokens[0].text == "handle") {
+		val, err := parseScriptInt(tokens[1])
+		if err != nil {
+			return err
+		}
+		if tokens[0].text == "index" {
+			rule.Index = &val
+		} else {
+			rule.Handle = &val
+		}
+		tokens = tokens[2:]
+	}
+
+	if verb == deleteVerb || verb == destroyVerb {
+		if len(tokens) != 0 {
+			return fmt.Errorf("unexpected %q", joinScriptTokens(tokens))
+		}
+	} else if len(tokens) > 0 {
+		if n := len(tokens); n >= 3 && tokens[n-1].quoted && tokens[n-2].raw == "comment" {
+			rule.Comment = &tokens[n-1].text
+			tokens = tokens[:n-2]
+		}
+		rule.Rule = line[tokens[0].start:tokens[len(tokens)-1].end]
+	}
+
+	p.tx.operation(verb, rule)
+	return p.tx.err
+}
+
+// parseElements parses the part of an "element" command after the table name, adding
+// an operation for each element.
+func (p *scriptParser) parseElements(verb verb, tokens []scriptToken) error {
+	name := tokens[0].text
+	tokens = tokens[1:]
+	if len(tokens) < 2 || tokens[0].raw != "{" || tokens[len(tokens)-1].raw != "}" {
+		return fmt.Errorf("unexpected %q", joinScriptTokens(tokens))
+	}
+
+	// Split the elements at commas
+	var elements [][]scriptToken
+	var cur []scriptToken
+	for _, token := range tokens[1 : len(tokens)-1] {
+		if !token.quoted && strings.HasSuffix(token.raw, ",") {
+			if token.raw != "," {
+				token.raw = strings.TrimSuffix(token.raw, ",")
+				token.text = token.raw
+				cur = append(cur, token)
+			}
+			elements = append(elements, cur)
+			cur = nil
+		} else {
+			cur = append(cur, token)
+		}
+	}
+	elements = append(elements, cur)
+
+	for _, elemTokens := range elements {
+		element, err := parseScriptElement(elemTokens)
+		if err != nil {
+			return err
+		}
+		if len(element.Value) != 0 || p.maps[name] {
+			element.Map = name
+		} else {
+			element.Set = name
+		}
+		p.tx.operation(verb, element)
+		if p.tx.err != nil {
+			return p.tx.err
+		}
+	}
+	return nil
+}
+
+// parseScriptElement parses a single element from an "element" command
+func parseScriptElement(tokens []scriptToken) (*Element, error) {
+	element := &Element{}
+
+	i := 0
+	for ; i < len(tokens); i++ {
+		if raw := tokens[i].raw; raw == "timeout" || raw == "comment" || raw == ":" {
+			break
+		}
+	}
+	if i == 0 {
+		return nil, fmt.Errorf("missing element key")
+	}
+	element.Key = strings.Split(joinScriptTokens(tokens[:i]), " . ")
+
+	for i < len(tokens) {
+		switch tokens[i].raw {
+		case "timeout":
+			if i+1 == len(tokens) {
+				return nil, fmt.Errorf("missing value for \"timeout\"")
+			}
+			timeout, err := parseScriptDuration(tokens[i+1])
+			if err != nil {
+				return nil, err
+			}
+			element.Timeout = timeout
+			i += 2
+		case "comment":
+			if i+1 == len(tokens) || !tokens[i+1].quoted {
+				return nil, fmt.Errorf("missing value for \"comment\"")
+			}
+			element.Comment = &tokens[i+1].text
+			i += 2
+		case ":":
+			if i+1 == len(tokens) {
+				return nil, fmt.Errorf("missing element value")
+			}
+			element.Value = strings.Split(joinScriptTokens(tokens[i+1:]), " . ")
+			i = len(tokens)
+		default:
+			return nil, fmt.Errorf("unexpected %q in element", tokens[i].raw)
+		}
+	}
+	return element, nil
+}
+
+func parseScriptChain(name string, handle *int, stmts [][]scriptToken) (*Chain, error) {
+	chain := &Chain{Name: name, Handle: handle}
+	err := forEachScriptAttribute(stmts, func(key string, value scriptToken) error {
+		switch key {
+		case "type":
+			chain.Type = PtrTo(BaseChainType(value.text))
+		case "hook":
+			chain.Hook = PtrTo(BaseChainHook(value.text))
+		case "device":
+			chain.Device = &value.text
+		case "priority":
+			chain.Priority = PtrTo(BaseChainPriority(value.text))
+		case "policy":
+			chain.Policy = PtrTo(BaseChainPolicy(value.text))
+		case "comment":
+			chain.Comment = &value.text
+		default:
+			return fmt.Errorf("unknown chain attribute %q", key)
+		}
+		return nil
+	})
+	return chain, err
+}
+
+func parseScriptSet(name string, handle *int, stmts [][]scriptToken) (*Set, error) {
+	set := &Set{Name: name, Handle: handle}
+	for _, stmt := range stmts {
+		key, args := stmt[0].text, stmt[1:]
+		if key == "auto-merge" {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("unexpected %q", joinScriptTokens(args))
+			}
+			set.AutoMerge = PtrTo(true)
+			continue
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("missing value for %q", key)
+		}
+
+		switch key {
+		case "type":
+			set.Type = joinScriptTokens(args)
+		case "typeof":
+			set.TypeOf = joinScriptTokens(args)
+		case "flags":
+			for _, flag := range strings.Split(joinScriptTokens(args), ",") {
+				if flag = strings.TrimSpace(flag); flag != "" {
+					set.Flags = append(set.Flags, SetFlag(flag))
+				}
+			}
+		case "timeout", "gc-interval":
+			val, err := parseScriptDuration(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if key == "timeout" {
+				set.Timeout = &val
+			} else {
+				set.GCInterval = &val
+			}
+		case "size":
+			val, err := parseScriptUint(args[0], 64)
+			if err != nil {
+				return nil, err
+			}
+			set.Size = &val
+		case "policy":
+			set.Policy = PtrTo(SetPolicy(args[0].text))
+		case "comment":
+			set.Comment = &args[0].text
+		default:
+			return nil, fmt.Errorf("unknown set attribute %q", key)
+		}
+	}
+	return set, nil
+}
+
+func parseScriptMap(name string, handle *int, stmts [][]scriptToken) (*Map, error) {
+	// Maps have the same attributes as sets, except auto-merge
+	set, err := parseScriptSet(name, handle, stmts)
+	if err != nil {
+		return nil, err
+	}
+	if set.AutoMerge != nil {
+		return nil, fmt.Errorf("unknown map attribute \"auto-merge\"")
+	}
+	return &Map{
+		Name:       set.Name,
+		Type:       set.Type,
+		TypeOf:     set.TypeOf,
+		Flags:      set.Flags,
+		Timeout:    set.Timeout,
+		GCInterval: set.GCInterval,
+		Size:       set.Size,
+		Policy:     set.Policy,
+		Comment:    set.Comment,
+		Handle:     set.Handle,
+	}, nil
+}
+
+func parseScriptFlowtable(name string, handle *int, stmts [][]scriptToken) (*Flowtable, error) {
+	flowtable := &Flowtable{Name: name, Handle: handle}
+	for _, stmt := range stmts {
+		if stmt[0].text == "devices" {
+			devices, err := parseScriptBraceList(stmt[1:])
+			if err != nil {
+				return nil, err
+			}
+			flowtable.Devices = devices
+			continue
+		}
+
+		err := forEachScriptAttribute([][]scriptToken{stmt}, func(key string, value scriptToken) error {
+			switch key {
+			case "hook":
+				if value.text != "ingress" {
+					return fmt.Errorf("unsupported flowtable hook %q", value.text)
+				}
+			case "priority":
+				flowtable.Priority = PtrTo(FlowtableIngressPriority(value.text))
+			default:
+				return fmt.Errorf("unknown flowtable attribute %q", key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return flowtable, nil
+}
+
+func parseScriptCounter(name string, handle *int, stmts [][]scriptToken) (*Counter, error) {
+	counter := &Counter{Name: name, Handle: handle}
+	err := forEachScriptAttribute(stmts, func(key string, value scriptToken) error {
+		switch key {
+		case "packets", "bytes":
+			val, err := parseScriptUint(value, 64)
+			if err != nil {
+				return err
+			}
+			if key == "packets" {
+				counter.Packets = &val
+			} else {
+				counter.Bytes = &val
+			}
+		case "comment":
+			counter.Comment = &value.text
+		default:
+			return fmt.Errorf("unknown counter attribute %q", key)
+		}
+		return nil
+	})
+	return counter, err
+}
+
+func parseScriptQuota(name string, handle *int, stmts [][]scriptToken) (*Quota, error) {
+	quota := &Quota{Name: name, Handle: handle}
+	for _, stmt := range stmts {
+		if stmt[0].text == "comment" {
+			if len(stmt) != 2 {
+				return nil, fmt.Errorf("missing value for \"comment\"")
+			}
+			quota.Comment = &stmt[1].text
+			continue
+		}
+
+		// [over] N bytes [used N bytes]
+		if stmt[0].text == "over" {
+			quota.Over = true
+			stmt = stmt[1:]
+		}
+		if len(stmt) < 2 || stmt[1].text != "bytes" {
+			return nil, fmt.Errorf("unexpected %q", joinScriptTokens(stmt))
+		}
+		val, err := parseScriptUint(stmt[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		quota.Bytes = val
+		stmt = stmt[2:]
+
+		if len(stmt) != 0 {
+			if len(stmt) != 3 || stmt[0].text != "used" || stmt[2].text != "bytes" {
+				return nil, fmt.Errorf("unexpected %q", joinScriptTokens(stmt))
+			}
+			used, err := parseScriptUint(stmt[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			quota.Used = &used
+		}
+	}
+	return quota, nil
+}
+
+func parseScriptLimit(name string, handle *int, stmts [][]scriptToken) (*Limit, error) {
+	limit := &Limit{Name: name, Handle: handle}
+	for _, stmt := range stmts {
+		if stmt[0].text == "comment" {
+			if len(stmt) != 2 {
+				return nil, fmt.Errorf("missing value for \"comment\"")
+			}
+			limit.Comment = &stmt[1].text
+			continue
+		}
+
+		// rate [over] N/PER [burst N packets], or
+		// rate [over] N UNIT/PER [burst N UNIT]
+		if stmt[0].text != "rate" {
+			return nil, fmt.Errorf("unknown limit attribute %q", stmt[0].text)
+		}
+		stmt = stmt[1:]
+		if len(stmt) > 0 && stmt[0].text == "over" {
+			limit.Inverse = true
+			stmt = stmt[1:]
+		}
+		if len(stmt) == 0 {
+			return nil, fmt.Errorf("missing limit rate")
+		}
+
+		var rate, per string
+		var ok bool
+		if rate, per, ok = strings.Cut(stmt[0].text, "/"); ok {
+			stmt = stmt[1:]
+		} else if len(stmt) >= 2 {
+			rate = stmt[0].text
+			if limit.RateUnit, per, ok = strings.Cut(stmt[1].text, "/"); !ok {
+				return nil, fmt.Errorf("bad limit rate %q", joinScriptTokens(stmt[:2]))
+			}
+			stmt = stmt[2:]
+		} else {
+			return nil, fmt.Errorf("bad limit rate %q", stmt[0].text)
+		}
+		val, err := parseScriptUint(scriptToken{text: rate}, 64)
+		if err != nil {
+			return nil, err
+		}
+		limit.Rate = val
+		limit.Per = per
+
+		if len(stmt) != 0 {
+			if len(stmt) != 3 || stmt[0].text != "burst" {
+				return nil, fmt.Errorf("unexpected %q", joinScriptTokens(stmt))
+			}
+			burst, err := parseScriptUint(stmt[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			limit.Burst = &burst
+			if limit.RateUnit != "" {
+				limit.BurstUnit = stmt[2].text
+			}
+		}
+	}
+	return limit, nil
+}
+
+func parseScriptCTHelper(name string, handle *int, stmts [][]scriptToken) (*CTHelper, error) {
+	helper := &CTHelper{Name: name, Handle: handle}
+	err := forEachScriptAttribute(stmts, func(key string, value scriptToken) error {
+		switch key {
+		case "type":
+			helper.Type = value.text
+		case "protocol":
+			helper.Protocol = value.text
+		case "l3proto":
+			helper.L3Proto = PtrTo(Family(value.text))
+		case "comment":
+			helper.Comment = &value.text
+		default:
+			return fmt.Errorf("unknown ct helper attribute %q", key)
+		}
+		return nil
+	})
+	return helper, err
+}
+
+func parseScriptCTTimeout(name string, handle *int, stmts [][]scriptToken) (*CTTimeout, error) {
+	timeout := &CTTimeout{Name: name, Handle: handle}
+	for _, stmt := range stmts {
+		if stmt[0].text == "policy" {
+			// policy = { STATE : N, ... }
+			entries, err := parseScriptBraceList(stmt[1:])
+			if err != nil {
+				return nil, err
+			}
+			if len(entries)%3 != 0 {
+				return nil, fmt.Errorf("bad ct timeout policy %q", joinScriptTokens(stmt[1:]))
+			}
+			timeout.Policy = make(map[string]uint32)
+			for i := 0; i < len(entries); i += 3 {
+				if entries[i+1] != ":" {
+					return nil, fmt.Errorf("bad ct timeout policy %q", joinScriptTokens(stmt[1:]))
+				}
+				val, err := parseScriptUint(scriptToken{text: entries[i+2]}, 32)
+				if err != nil {
+					return nil, err
+				}
+				timeout.Policy[entries[i]] = uint32(val)
+			}
+			continue
+		}
+
+		err := forEachScriptAttribute([][]scriptToken{stmt}, func(key string, value scriptToken) error {
+			switch key {
+			case "protocol":
+				timeout.Protocol = value.text
+			case "l3proto":
+				timeout.L3Proto = PtrTo(Family(value.text))
+			case "comment":
+				timeout.Comment = &value.text
+			default:
+				return fmt.Errorf("unknown ct timeout attribute %q", key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return timeout, nil
+}
+
+func parseScriptCTExpectation(name string, handle *int, stmts [][]scriptToken) (*CTExpectation, error) {
+	expect := &CTExpectation{Name: name, Handle: handle}
+	err := forEachScriptAttribute(stmts, func(key string, value scriptToken) error {
+		switch key {
+		case "protocol":
+			expect.Protocol = value.text
+		case "dport":
+			val, err := parseScriptUint(value, 16)
+			if err != nil {
+				return err
+			}
+			expect.DPort = uint16(val)
+		case "timeout":
+			val, err := parseScriptDuration(value)
+			if err != nil {
+				return err
+			}
+			expect.Timeout = val
+		case "size":
+			val, err := parseScriptUint(value, 8)
+			if err != nil {
+				return err
+			}
+			expect.Size = uint8(val)
+		case "l3proto":
+			expect.L3Proto = PtrTo(Family(value.text))
+		case "comment":
+			expect.Comment = &value.text
+		default:
+			return fmt.Errorf("unknown ct expectation attribute %q", key)
+		}
+		return nil
+	})
+	return expect, err
+}
+
+func parseScriptSecmark(name string, handle *int, stmts [][]scriptToken) (*Secmark, error) {
+	secmark := &Secmark{Name: name, Handle: handle}
+	for _, stmt := range stmts {
+		switch {
+		case len(stmt) == 1 && stmt[0].quoted:
+			secmark.Context = stmt[0].text
+		case len(stmt) == 2 && stmt[0].text == "comment":
+			secmark.Comment = &stmt[1].text
+		default:
+			return nil, fmt.Errorf("unexpected %q", joinScriptTokens(stmt))
+		}
+	}
+	return secmark, nil
+}
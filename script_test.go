@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/lithammer/dedent"
+)
+
+func TestNewTransactionFromScriptRoundTrip(t *testing.T) {
+	fake := NewFake(InetFamily, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{Comment: PtrTo("rules for \"kube-proxy\"")})
+	tx.Comment("chains\nand rules")
+	tx.Add(&Chain{Name: "services"})
+	tx.Add(&Chain{
+		Name:     "filter-input",
+		Type:     PtrTo(FilterType),
+		Hook:     PtrTo(InputHook),
+		Priority: PtrTo(FilterPriority),
+		Policy:   PtrTo(AcceptPolicy),
+		Comment:  PtrTo("input chain"),
+	})
+	tx.Add(&Chain{
+		Name:     "ingress",
+		Type:     PtrTo(FilterType),
+		Hook:     PtrTo(IngressHook),
+		Device:   PtrTo("eth0"),
+		Priority: PtrTo(BaseChainPriority("-150")),
+	})
+	tx.Flush(&Chain{Name: "services"})
+	tx.Add(&Rule{Chain: "services", Rule: `ip daddr 10.0.0.1 tcp dport 80 ct state new counter jump svc-1`})
+	tx.Add(&Rule{Chain: "services", Rule: `iifname "eth0" drop`, Comment: PtrTo("drop \"bad\" traffic")})
+	tx.Insert(&Rule{Chain: "services", Rule: "accept", Index: PtrTo(2)})
+	tx.Replace(&Rule{Chain: "services", Rule: "reject", Handle: PtrTo(7)})
+	tx.Delete(&Rule{Chain: "services", Handle: PtrTo(8)})
+	tx.Add(&Set{
+		Name:      "ips",
+		Type:      "ipv4_addr . inet_service",
+		Flags:     []SetFlag{IntervalFlag, TimeoutFlag},
+		Timeout:   PtrTo(5 * time.Minute),
+		Size:      PtrTo[uint64](1000),
+		Policy:    PtrTo(MemoryPolicy),
+		AutoMerge: PtrTo(true),
+		Comment:   PtrTo("ips"),
+	})
+	tx.Add(&Map{
+		Name:       "vmap",
+		TypeOf:     "ip daddr . tcp dport",
+		GCInterval: PtrTo(time.Minute),
+	})
+	tx.Add(&Map{Name: "ports", Type: "inet_service : verdict"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1", "80"}, Timeout: time.Minute, Comment: PtrTo("first")})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.2", "443"}})
+	tx.Add(&Element{Map: "ports", Key: []string{"80"}, Value: []string{"goto services"}, Comment: PtrTo("http")})
+	tx.Delete(&Element{Map: "ports", Key: []string{"443"}})
+	tx.Delete(&Element{Set: "ips", Key: []string{"10.0.0.3", "22"}})
+	tx.Add(&Flowtable{Name: "ft", Priority: PtrTo(FilterIngressPriority), Devices: []string{"eth0", "eth1"}})
+	tx.Add(&Counter{Name: "c1"})
+	tx.Add(&Counter{Name: "c2", Packets: PtrTo[uint64](5), Bytes: PtrTo[uint64](500), Comment: PtrTo("counted")})
+	tx.Add(&Quota{Name: "q1", Bytes: 1000})
+	tx.Add(&Quota{Name: "q2", Bytes: 2000, Over: true, Used: PtrTo[uint64](10), Comment: PtrTo("quota")})
+	tx.Add(&Limit{Name: "l1", Rate: 10, Per: "second", Burst: PtrTo[uint64](5)})
+	tx.Add(&Limit{Name: "l2", Rate: 1, RateUnit: "mbytes", Per: "hour", Inverse: true, Burst: PtrTo[uint64](100), BurstUnit: "kbytes", Comment: PtrTo("limit")})
+	tx.Add(&CTHelper{Name: "ftp", Type: "ftp", Protocol: "tcp", L3Proto: PtrTo(IPv4Family)})
+	tx.Add(&CTTimeout{Name: "timeout", Protocol: "tcp", Policy: map[string]uint32{"established": 100, "close": 5}})
+	tx.Add(&CTExpectation{Name: "expect", Protocol: "tcp", DPort: 22, Timeout: 1500 * time.Millisecond, Size: 2, Comment: PtrTo("expect")})
+	tx.Add(&Secmark{Name: "secmark", Context: "system_u:object_r:ssh_server_packet_t:s0", Comment: PtrTo("ssh")})
+	tx.Delete(&Chain{Name: "old"})
+	tx.Delete(&Set{Handle: PtrTo(5)})
+	tx.Destroy(&Map{Name: "oldmap"})
+	tx.Delete(&Counter{Handle: PtrTo(6)})
+	tx.Delete(&Table{Handle: PtrTo(1)})
+
+	script := tx.String()
+	tx2, err := NewTransactionFromScript(script)
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %v\n%s", err, script)
+	}
+	if diff := cmp.Diff(script, tx2.String()); diff != "" {
+		t.Errorf("round-tripped script differs:\n%s", diff)
+	}
+	if tx2.family != InetFamily || tx2.table != "kube-proxy" {
+		t.Errorf("unexpected family/table %s/%s", tx2.family, tx2.table)
+	}
+}
+
+func TestNewTransactionFromScript(t *testing.T) {
+	tx, err := NewTransactionFromScript(strings.TrimPrefix(dedent.Dedent(`
+		# a hand-written script
+		add table ip filter
+
+		add chain ip filter input { type filter hook input priority filter ; policy drop ; }
+		add set ip filter blocked { type ipv4_addr ; flags interval,timeout ; }
+		add map ip filter ports { type inet_service : verdict ; }
+		add element ip filter blocked { 10.0.0.0/8, 192.168.0.1 timeout 30s }
+		add element ip filter ports { 22 : accept }
+		delete element ip filter ports { 23 }
+		add rule ip filter input ip saddr @blocked drop comment "blocked"
+		`), "\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []operation{
+		{verb: commentVerb, obj: &scriptComment{text: "a hand-written script"}},
+		{verb: addVerb, obj: &Table{}},
+		{verb: addVerb, obj: &Chain{
+			Name:     "input",
+			Type:     PtrTo(FilterType),
+			Hook:     PtrTo(InputHook),
+			Priority: PtrTo(FilterPriority),
+			Policy:   PtrTo(DropPolicy),
+		}},
+		{verb: addVerb, obj: &Set{Name: "blocked", Type: "ipv4_addr", Flags: []SetFlag{IntervalFlag, TimeoutFlag}}},
+		{verb: addVerb, obj: &Map{Name: "ports", Type: "inet_service : verdict"}},
+		{verb: addVerb, obj: &Element{Set: "blocked", Key: []string{"10.0.0.0/8"}}},
+		{verb: addVerb, obj: &Element{Set: "blocked", Key: []string{"192.168.0.1"}, Timeout: 30 * time.Second}},
+		{verb: addVerb, obj: &Element{Map: "ports", Key: []string{"22"}, Value: []string{"accept"}}},
+		{verb: deleteVerb, obj: &Element{Map: "ports", Key: []string{"23"}}},
+		{verb: addVerb, obj: &Rule{Chain: "input", Rule: "ip saddr @blocked drop", Comment: PtrTo("blocked")}},
+	}
+	if diff := cmp.Diff(expected, tx.operations, cmp.AllowUnexported(operation{}, scriptComment{})); diff != "" {
+		t.Errorf("unexpected operations:\n%s", diff)
+	}
+}
+
+func TestNewTransactionFromScriptErrors(t *testing.T) {
+	for _, tc := range []struct {
+		script string
+		err    string
+	}{
+		{
+			script: "add table",
+			err:    `line 1: incomplete command "add table"`,
+		},
+		{
+			script: "frob table ip filter",
+			err:    `line 1: unknown verb "frob"`,
+		},
+		{
+			script: "add widget ip filter foo",
+			err:    `line 1: unknown object type "widget"`,
+		},
+		{
+			script: "add table ip filter\nadd chain ip other chain",
+			err:    "line 2: script refers to multiple tables (filter and other)",
+		},
+		{
+			script: "add table ip filter\nadd chain ip6 filter chain",
+			err:    "line 2: script refers to multiple families (ip and ip6)",
+		},
+		{
+			script: `add table ip filter { comment "unterminated ; }`,
+			err:    "line 1: unterminated quoted string",
+		},
+		{
+			script: "add chain ip filter chain { type filter hook input }",
+			err:    `line 1: base chain "chain" must specify Type and Priority`,
+		},
+		{
+			script: "add chain ip filter chain { frobnicate 5 ; }",
+			err:    `line 1: unknown chain attribute "frobnicate"`,
+		},
+		{
+			script: "add set ip filter set { type ipv4_addr ; size lots ; }",
+			err:    `line 1: bad number "lots"`,
+		},
+		{
+			script: "add element ip filter set { 10.0.0.1 timeout forever }",
+			err:    `line 1: bad duration "forever"`,
+		},
+		{
+			script: "add rule ip filter chain",
+			err:    "line 1: no rule specified",
+		},
+	} {
+		_, err := NewTransactionFromScript(tc.script)
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("expected error %q for %q, got %v", tc.err, tc.script, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// writeScriptFile writes tx to a new temporary file in dir and returns its path. If
+// compress is true, the file is gzip-compressed.
+func writeScriptFile(tx *Transaction, dir string, compress bool) (string, error) {
+	pattern := "knftables-*.nft"
+	if compress {
+		pattern += ".gz"
+	}
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("could not create script file: %w", err)
+	}
+
+	if compress {
+		gz := gzip.NewWriter(file)
+		writer := bufio.NewWriter(gz)
+		tx.writeOperations(writer)
+		err = writer.Flush()
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+	} else {
+		writer := bufio.NewWriter(file)
+		tx.writeOperations(writer)
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("could not write script file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// runFromCompressedFile implements RunFromFile when nft.compressScripts is set. It writes
+// a compressed script file, and then runs nft on a named pipe, while decompressing the
+// script into the other end of the pipe.
+func (nft *realNFTables) runFromCompressedFile(ctx context.Context, tx *Transaction, dir string) error {
+	path, err := writeScriptFile(tx, dir, true)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	pipeDir, err := os.MkdirTemp(dir, "knftables-")
+	if err != nil {
+		return fmt.Errorf("could not create named pipe: %w", err)
+	}
+	defer os.RemoveAll(pipeDir)
+	pipe := filepath.Join(pipeDir, "script.nft")
+	if err := mkfifo(pipe); err != nil {
+		return fmt.Errorf("could not create named pipe: %w", err)
+	}
+
+	start := time.Now()
+	_, err = nft.retry(ctx, func() (string, error) {
+		return "", nft.runFromPipe(ctx, path, pipe)
+	})
+	err = checkAlreadyExists(err)
+	nft.recordRun(start, err)
+	return err
+}
+
+// runFromPipe runs nft once on the named pipe pipe, while decompressing the script at
+// path into it.
+func (nft *realNFTables) runFromPipe(ctx context.Context, path, pipe string) error {
+	// If decompression fails, we need to kill nft before it sees EOF on the pipe,
+	// or else it would commit a truncated transaction.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	nftDone := make(chan struct{})
+	feedErr := make(chan error, 1)
+	go func() {
+		feedErr <- feedScriptPipe(path, pipe, cancel, nftDone)
+	}()
+
+	_, err := nft.runCommandOnce(ctx, nil, "--file", pipe)
+	close(nftDone)
+	if ferr := finishScriptPipe(pipe, feedErr); err == nil && ferr != nil {
+		err = fmt.Errorf("could not decompress script file: %w", ferr)
+	}
+	return err
+}
+
+// feedScriptPipe opens pipe for writing (which blocks until nft opens it for reading),
+// decompresses the script at path into it, and then closes it. If decompression fails,
+// it calls cancel and waits for nftDone to be closed before closing the pipe.
+func feedScriptPipe(path, pipe string, cancel context.CancelFunc, nftDone <-chan struct{}) error {
+	out, err := os.OpenFile(pipe, os.O_WRONLY, 0)
+	if err != nil {
+		cancel()
+		return err
+	}
+	defer out.Close()
+
+	err = decompressScript(path, out)
+	if err != nil {
+		cancel()
+		<-nftDone
+	}
+	return err
+}
+
+// finishScriptPipe waits for feedScriptPipe to return its result on feedErr, after nft
+// has exited. If nft exited without opening the pipe, then feedScriptPipe will still be
+// blocked opening it for writing, so this repeatedly opens (and immediately closes) the
+// read end until feedScriptPipe returns. (Once there is no reader, any further writes
+// to the pipe will fail.)
+func finishScriptPipe(pipe string, feedErr <-chan error) error {
+	for {
+		select {
+		case err := <-feedErr:
+			return err
+		default:
+		}
+
+		in, err := os.OpenFile(pipe, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			in.Close()
+		}
+
+		select {
+		case err := <-feedErr:
+			return err
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// decompressScript decompresses the gzip file at path into out.
+func decompressScript(path string, out io.Writer) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(in))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, gz)
+	return err
+}
@@ -0,0 +1,168 @@
+//go:build unix
+
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunFromCompressedFile(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy", WithScriptCompression(true), WithRetry(2, time.Millisecond))
+	dir := t.TempDir()
+
+	script := "add table ip kube-proxy\nadd chain ip kube-proxy chain\n"
+	fexec.expected = append(fexec.expected,
+		// Successful run
+		expectedCmd{
+			args: []string{"/nft", "--file", "FILE"},
+			file: script,
+		},
+		// Successful run where nft is slow to open the pipe
+		expectedCmd{
+			args:      []string{"/nft", "--file", "FILE"},
+			file:      script,
+			fileDelay: 100 * time.Millisecond,
+		},
+		// Transient failure, then success; the script is passed both times
+		expectedCmd{
+			args: []string{"/nft", "--file", "FILE"},
+			file: script,
+			err:  mkExecError("Error: Could not process rule: Resource temporarily unavailable\n"),
+		},
+		expectedCmd{
+			args: []string{"/nft", "--file", "FILE"},
+			file: script,
+		},
+		// Non-transient failure
+		expectedCmd{
+			args: []string{"/nft", "--file", "FILE"},
+			file: script,
+			err:  mkExecError("Error: No such file or directory\n"),
+		},
+	)
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	if err := nft.RunFromFile(context.Background(), tx, dir); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := nft.RunFromFile(context.Background(), tx, dir); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := nft.RunFromFile(context.Background(), tx, dir); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := nft.RunFromFile(context.Background(), tx, dir); !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+	if fexec.matched != len(fexec.expected) {
+		t.Errorf("expected %d commands to be run, but only %d were", len(fexec.expected), fexec.matched)
+	}
+
+	// The script files and pipes are removed whether or not nft succeeds
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected script files to be removed, found %v", entries)
+	}
+}
+
+func TestFeedScriptPipeError(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/script.nft.gz"
+	if err := os.WriteFile(path, []byte("not gzipped\n"), 0600); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+	pipe := dir + "/pipe"
+	if err := mkfifo(pipe); err != nil {
+		t.Fatalf("unexpected error creating pipe: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nftDone := make(chan struct{})
+	feedErr := make(chan error, 1)
+	go func() {
+		feedErr <- feedScriptPipe(path, pipe, cancel, nftDone)
+	}()
+
+	// The pipe must not be closed until after nft has exited
+	in, err := os.Open(pipe)
+	if err != nil {
+		t.Fatalf("unexpected error opening pipe: %v", err)
+	}
+	defer in.Close()
+	<-ctx.Done()
+	select {
+	case err := <-feedErr:
+		t.Fatalf("feedScriptPipe returned before nft exited: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(nftDone)
+
+	content, err := io.ReadAll(in)
+	if err != nil {
+		t.Fatalf("unexpected error reading pipe: %v", err)
+	}
+	if len(content) != 0 {
+		t.Errorf("expected no content, got %q", content)
+	}
+	if err := <-feedErr; err == nil || !strings.Contains(err.Error(), "gzip") {
+		t.Errorf("expected gzip error, got %v", err)
+	}
+}
+
+func TestFinishScriptPipe(t *testing.T) {
+	dir := t.TempDir()
+	path, err := writeScriptFile(&Transaction{nftContext: &nftContext{family: IPv4Family, table: "kube-proxy"}}, dir, true)
+	if err != nil {
+		t.Fatalf("unexpected error writing script: %v", err)
+	}
+	pipe := dir + "/pipe"
+	if err := mkfifo(pipe); err != nil {
+		t.Fatalf("unexpected error creating pipe: %v", err)
+	}
+
+	// If nft exits without ever opening the pipe, finishScriptPipe unblocks
+	// feedScriptPipe rather than hanging.
+	nftDone := make(chan struct{})
+	feedErr := make(chan error, 1)
+	go func() {
+		feedErr <- feedScriptPipe(path, pipe, func() {}, nftDone)
+	}()
+	close(nftDone)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- finishScriptPipe(pipe, feedErr)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("finishScriptPipe did not return")
+	}
+}
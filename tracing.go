@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+)
+
+// Tracer is used to trace invocations of nft. knftables does not depend on any particular
+// tracing library, but a Tracer can be trivially implemented on top of one. For example,
+// with OpenTelemetry:
+//
+//	type otelTracer struct {
+//		tracer trace.Tracer
+//	}
+//
+//	func (t otelTracer) StartSpan(ctx context.Context, args []string) (context.Context, func(error)) {
+//		ctx, span := t.tracer.Start(ctx, "nft",
+//			trace.WithAttributes(attribute.StringSlice("nft.command", args)))
+//		return ctx, func(err error) {
+//			if err != nil {
+//				span.RecordError(err)
+//				span.SetStatus(codes.Error, err.Error())
+//			}
+//			span.End()
+//		}
+//	}
+type Tracer interface {
+	// StartSpan is called before running nft with args (which includes the path to
+	// the nft binary as its first element). It returns the context to run nft with
+	// (which will normally contain the new span), and a function that will be called
+	// with the resulting error (if any) when nft exits.
+	StartSpan(ctx context.Context, args []string) (context.Context, func(err error))
+}
+
+// tracerKey is the context key for the Tracer attached by ContextWithTracer
+type tracerKey struct{}
+
+// ContextWithTracer returns a copy of ctx with tracer attached. When that context (or a
+// context derived from it) is passed to an Interface method, each resulting invocation
+// of nft will be traced with tracer.
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// tracerFromContext returns the Tracer attached to ctx, or nil if there is none
+func tracerFromContext(ctx context.Context) Tracer {
+	tracer, _ := ctx.Value(tracerKey{}).(Tracer)
+	return tracer
+}
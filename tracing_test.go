@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type spanKey struct{}
+
+// fakeTracer is a Tracer that records spans as strings
+type fakeTracer struct {
+	spans []string
+}
+
+func (ft *fakeTracer) StartSpan(ctx context.Context, args []string) (context.Context, func(error)) {
+	return context.WithValue(ctx, spanKey{}, true), func(err error) {
+		ft.spans = append(ft.spans, fmt.Sprintf("%s: err=%v", strings.Join(args, " "), err != nil))
+	}
+}
+
+func TestTracing(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "testing")
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add table ip testing\n",
+		},
+		expectedCmd{
+			args: []string{"/nft", "--json", "list", "chain", "ip", "testing", "missing"},
+			err:  mkExecError("Error: No such file or directory\nlist chain ip testing missing\n                     ^^^^^^^\n"),
+		},
+		expectedCmd{
+			args:  []string{"/nft", "-f", "-"},
+			stdin: "add table ip testing\n",
+		},
+	)
+
+	tracer := &fakeTracer{}
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	tx := nft.NewTransaction()
+	tx.Add(&Table{})
+	if err := nft.Run(ctx, tx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := nft.ListRules(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("expected NotFoundError, got %v", err)
+	}
+	// Without the tracer in the context, nothing is traced
+	if err := nft.Run(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"/nft -f -: err=false",
+		"/nft --json list chain ip testing missing: err=true",
+	}
+	if diff := cmp.Diff(expected, tracer.spans); diff != "" {
+		t.Errorf("unexpected spans:\n%s", diff)
+	}
+}
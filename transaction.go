@@ -18,16 +18,31 @@ package knftables
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
 )
 
 // Transaction represents an nftables transaction
 type Transaction struct {
 	*nftContext
 
+	// ctx is the context passed to NewTransactionWithContext, if any
+	ctx context.Context
+
+	// description is the description set by SetDescription, if any
+	description string
+
 	operations []operation
 	err        error
+
+	// laterErrs contains validation errors for operations that were added after err
+	// was set (which are reported by Validate but otherwise ignored)
+	laterErrs []error
 }
 
 // operation contains a single nftables operation (eg "add table", "flush chain")
@@ -45,7 +60,11 @@ const (
 	insertVerb  verb = "insert"
 	replaceVerb verb = "replace"
 	deleteVerb  verb = "delete"
+	destroyVerb verb = "destroy"
 	flushVerb   verb = "flush"
+
+	// commentVerb is used for the pseudo-operations added by tx.Comment()
+	commentVerb verb = "#"
 )
 
 // asCommandBuf returns the transaction as an io.Reader that outputs a series of nft commands
@@ -55,19 +74,50 @@ func (tx *Transaction) asCommandBuf() (io.Reader, error) {
 	}
 
 	buf := &bytes.Buffer{}
-	for _, op := range tx.operations {
-		op.obj.writeOperation(op.verb, tx.nftContext, buf)
-	}
+	tx.writeOperations(buf)
 	return buf, nil
 }
 
+// writeOperations writes out tx's operations as a series of nft commands. Consecutive
+// "add element" operations on the same set or map are combined into a single command
+// (up to tx.batchSize() elements, and unless that would result in the same key being
+// added twice in one command).
+func (tx *Transaction) writeOperations(writer io.Writer) {
+	if tx.description != "" {
+		(&scriptComment{text: tx.description}).writeOperation(commentVerb, tx.nftContext, writer)
+	}
+	for i := 0; i < len(tx.operations); i++ {
+		op := tx.operations[i]
+		element, ok := op.obj.(*Element)
+		if !ok || op.verb != addVerb {
+			op.obj.writeOperation(op.verb, tx.nftContext, writer)
+			continue
+		}
+
+		elements := []*Element{element}
+		keys := map[string]bool{strings.Join(element.Key, " . "): true}
+		for i+1 < len(tx.operations) && tx.operations[i+1].verb == addVerb && len(elements) < tx.batchSize() {
+			next, ok := tx.operations[i+1].obj.(*Element)
+			if !ok || next.Set != element.Set || next.Map != element.Map {
+				break
+			}
+			key := strings.Join(next.Key, " . ")
+			if keys[key] {
+				break
+			}
+			keys[key] = true
+			elements = append(elements, next)
+			i++
+		}
+		writeElements(op.verb, tx.nftContext, writer, elements)
+	}
+}
+
 // String returns the transaction as a string containing the nft commands; if there is
 // a pending error, it will be output as a comment at the end of the transaction.
 func (tx *Transaction) String() string {
 	buf := &bytes.Buffer{}
-	for _, op := range tx.operations {
-		op.obj.writeOperation(op.verb, tx.nftContext, buf)
-	}
+	tx.writeOperations(buf)
 
 	if tx.err != nil {
 		fmt.Fprintf(buf, "# ERROR: %v", tx.err)
@@ -76,10 +126,124 @@ func (tx *Transaction) String() string {
 	return buf.String()
 }
 
+// Len returns the number of operations that have been added to tx (not counting
+// comments). Each added element counts as a separate operation, even though consecutive
+// elements may be combined into a single "add element" command when tx is run.
+// Operations that were rejected because tx has a pending error are not counted.
+func (tx *Transaction) Len() int {
+	n := 0
+	for _, op := range tx.operations {
+		if op.verb != commentVerb {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset clears tx's operations, description, and pending error (if any), so that it can
+// be reused to build a new transaction for the same family and table, without needing to
+// reallocate its storage. (Any context it was created with is kept.)
+func (tx *Transaction) Reset() {
+	// Clear the old entries so the objects they point to can be garbage-collected.
+	for i := range tx.operations {
+		tx.operations[i] = operation{}
+	}
+	tx.operations = tx.operations[:0]
+	tx.description = ""
+	tx.err = nil
+	tx.laterErrs = nil
+}
+
+// copy returns a copy of tx that does not share its operations with tx.
+func (tx *Transaction) copy() *Transaction {
+	txCopy := *tx
+	txCopy.operations = append([]operation(nil), tx.operations...)
+	txCopy.laterErrs = append([]error(nil), tx.laterErrs...)
+	return &txCopy
+}
+
+// IsEmpty returns true if tx contains no operations (other than comments), meaning that
+// running it would have no effect.
+func (tx *Transaction) IsEmpty() bool {
+	return tx.Len() == 0
+}
+
+// runContext returns the context to use when running tx: if tx was created with a
+// context, this is a context derived from ctx that is also cancelled when tx's context
+// is done; otherwise it is just ctx. The caller must call the returned CancelFunc when
+// the run is complete.
+func (tx *Transaction) runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if tx.ctx == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if tx.ctx.Err() != nil {
+		cancel()
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-tx.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// bindTransaction returns a version of tx that will be written out using ctx (and thus
+// with ctx's optional features), which is tx itself if tx was created from ctx, or
+// else a shallow copy of tx. It is an error for tx to be for a different family or
+// table than ctx, unless tx does not name any table at all (eg, because it was parsed
+// from a script containing only comments).
+func bindTransaction(ctx *nftContext, tx *Transaction) (*Transaction, error) {
+	if tx.nftContext == ctx {
+		return tx, nil
+	}
+	if (tx.family != "" || tx.table != "") && (tx.family != ctx.family || tx.table != ctx.table) {
+		return nil, fmt.Errorf("transaction for table %s %s cannot be run against table %s %s",
+			tx.family, tx.table, ctx.family, ctx.table)
+	}
+	bound := *tx
+	bound.nftContext = ctx
+	return &bound, nil
+}
+
+// combineTransactions appends the operations of txs to combined (which should be a new
+// Transaction) and returns it, or returns the first pending error from txs. It is an
+// error for any of txs to be for a different family or table than combined. If
+// combined has no context, it inherits the first context found in txs.
+func combineTransactions(combined *Transaction, txs []*Transaction) (*Transaction, error) {
+	for _, tx := range txs {
+		if tx.err != nil {
+			return nil, tx.err
+		}
+		if _, err := bindTransaction(combined.nftContext, tx); err != nil {
+			return nil, err
+		}
+		if combined.ctx == nil {
+			combined.ctx = tx.ctx
+		}
+		if tx.description != "" {
+			combined.operations = append(combined.operations, operation{verb: commentVerb, obj: &scriptComment{text: tx.description}})
+		}
+		combined.operations = append(combined.operations, tx.operations...)
+	}
+	return combined, nil
+}
+
 func (tx *Transaction) operation(verb verb, obj Object) {
 	if tx.err != nil {
+		if err := obj.validate(verb); err != nil {
+			tx.laterErrs = append(tx.laterErrs, err)
+		}
 		return
 	}
+	if tx.ctx != nil {
+		if tx.err = tx.ctx.Err(); tx.err != nil {
+			return
+		}
+	}
 	if tx.err = obj.validate(verb); tx.err != nil {
 		return
 	}
@@ -132,7 +296,337 @@ func (tx *Transaction) Flush(obj Object) {
 // Delete adds an "nft delete" operation to tx, deleting obj. The Delete() call always
 // succeeds, but if obj does not exist or cannot be deleted based on the information
 // provided (eg, Handle is required but not set) then an error will be returned when the
-// transaction is Run.
+// transaction is Run. (When deleting an Element, only its Set or Map and its Key are
+// used; any Value, Comment, or Timeout is ignored.)
 func (tx *Transaction) Delete(obj Object) {
 	tx.operation(deleteVerb, obj)
 }
+
+// Destroy adds an "nft destroy" operation to tx, deleting obj if it exists. Unlike
+// Delete, it is not an error if obj does not exist. (Note that "destroy" requires nft
+// 1.0.8 and kernel 6.3 or later; with older versions, the transaction will fail.) The
+// Destroy() call always succeeds, but if obj cannot be destroyed based on the
+// information provided (eg, Handle is required but not set) then an error will be
+// returned when the transaction is Run.
+func (tx *Transaction) Destroy(obj Object) {
+	tx.operation(destroyVerb, obj)
+}
+
+// Comment adds a "#" comment line containing text to tx's script, which can be useful
+// for explaining the following operations when inspecting the output of tx.String(). If
+// text contains multiple lines, each one will be commented. Comments have no effect on
+// the result of running tx, and are ignored by Diff.
+func (tx *Transaction) Comment(text string) {
+	tx.operation(commentVerb, &scriptComment{text: text})
+}
+
+// SetDescription sets a description of tx as a whole (eg, what it is for, or an ID to
+// correlate it with other logs), which is written as a "#" comment at the start of tx's
+// script, before any other operations, and so appears in tx.String() and in the script
+// file written by RunFromFile. Calling SetDescription again replaces the description. As
+// with Comment, the description has no effect on the result of running tx, and it is not
+// included in nft's output (eg, the objects returned by RunWithEcho). (When transactions
+// are combined by RunAll, each one's description is output as a comment before its
+// operations.)
+func (tx *Transaction) SetDescription(desc string) {
+	tx.description = desc
+}
+
+// Description returns the description set by SetDescription, if any.
+func (tx *Transaction) Description() string {
+	return tx.description
+}
+
+// scriptComment is the Object used for comment pseudo-operations
+type scriptComment struct {
+	text string
+}
+
+func (c *scriptComment) validate(verb verb) error {
+	if verb != commentVerb {
+		return fmt.Errorf("%s is not implemented for comments", verb)
+	}
+	return nil
+}
+
+func (c *scriptComment) writeOperation(_ verb, _ *nftContext, writer io.Writer) {
+	for _, line := range strings.Split(c.text, "\n") {
+		fmt.Fprintf(writer, "# %s\n", line)
+	}
+}
+
+// transactionJSONVersion is the version of the JSON format used by tx.MarshalJSON.
+const transactionJSONVersion = 1
+
+// jsonTransaction is the JSON representation of a Transaction
+type jsonTransaction struct {
+	Version     int             `json:"version"`
+	Family      Family          `json:"family"`
+	Table       string          `json:"table"`
+	Description string          `json:"description,omitempty"`
+	Operations  []jsonOperation `json:"operations"`
+}
+
+// jsonOperation is the JSON representation of a single operation. Comments are
+// represented by an operation with only Comment set.
+type jsonOperation struct {
+	Verb    verb            `json:"verb,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Object  json.RawMessage `json:"object,omitempty"`
+	Comment *string         `json:"comment,omitempty"`
+}
+
+// jsonObjectTypes maps the "type" of a jsonOperation to a constructor for its Object
+var jsonObjectTypes = map[string]func() Object{
+	"table":          func() Object { return &Table{} },
+	"chain":          func() Object { return &Chain{} },
+	"rule":           func() Object { return &Rule{} },
+	"set":            func() Object { return &Set{} },
+	"map":            func() Object { return &Map{} },
+	"element":        func() Object { return &Element{} },
+	"flowtable":      func() Object { return &Flowtable{} },
+	"counter":        func() Object { return &Counter{} },
+	"quota":          func() Object { return &Quota{} },
+	"limit":          func() Object { return &Limit{} },
+	"ct helper":      func() Object { return &CTHelper{} },
+	"ct timeout":     func() Object { return &CTTimeout{} },
+	"ct expectation": func() Object { return &CTExpectation{} },
+	"secmark":        func() Object { return &Secmark{} },
+}
+
+// jsonObjectType returns the "type" of obj in a jsonOperation
+func jsonObjectType(obj Object) string {
+	switch obj.(type) {
+	case *Table:
+		return "table"
+	case *Chain:
+		return "chain"
+	case *Rule:
+		return "rule"
+	case *Set:
+		return "set"
+	case *Map:
+		return "map"
+	case *Element:
+		return "element"
+	case *Flowtable:
+		return "flowtable"
+	case *Counter:
+		return "counter"
+	case *Quota:
+		return "quota"
+	case *Limit:
+		return "limit"
+	case *CTHelper:
+		return "ct helper"
+	case *CTTimeout:
+		return "ct timeout"
+	case *CTExpectation:
+		return "ct expectation"
+	case *Secmark:
+		return "secmark"
+	default:
+		return ""
+	}
+}
+
+// MarshalJSON serializes tx (including its family and table) to JSON, so that it can be
+// stored or sent elsewhere and later turned back into a Transaction with
+// UnmarshalTransaction. Objects are serialized using their exported field names, and the
+// format will remain backward-compatible in future releases. If tx has a pending error,
+// that error is returned.
+func (tx *Transaction) MarshalJSON() ([]byte, error) {
+	if tx.err != nil {
+		return nil, tx.err
+	}
+
+	jtx := jsonTransaction{
+		Version:     transactionJSONVersion,
+		Family:      tx.family,
+		Table:       tx.table,
+		Description: tx.description,
+		Operations:  make([]jsonOperation, 0, len(tx.operations)),
+	}
+	for _, op := range tx.operations {
+		if c, ok := op.obj.(*scriptComment); ok {
+			text := c.text
+			jtx.Operations = append(jtx.Operations, jsonOperation{Comment: &text})
+			continue
+		}
+
+		objType := jsonObjectType(op.obj)
+		if objType == "" {
+			return nil, fmt.Errorf("cannot serialize object of type %T", op.obj)
+		}
+		data, err := json.Marshal(op.obj)
+		if err != nil {
+			return nil, err
+		}
+		jtx.Operations = append(jtx.Operations, jsonOperation{Verb: op.verb, Type: objType, Object: data})
+	}
+	return json.Marshal(jtx)
+}
+
+// UnmarshalTransaction parses data (as generated by tx.MarshalJSON) into a new
+// Transaction. Each operation is validated as it would have been when it was originally
+// added, and an error is returned if any is invalid. The returned Transaction uses the
+// family and table that it was serialized with, and can only be run by an Interface for
+// that family and table. tx.String() writes it out assuming that the system supports
+// all optional features, but when it is run, it is written out using the Interface's
+// features (see Interface.SupportsFeature).
+func UnmarshalTransaction(data []byte) (*Transaction, error) {
+	var jtx jsonTransaction
+	if err := json.Unmarshal(data, &jtx); err != nil {
+		return nil, fmt.Errorf("could not parse transaction: %w", err)
+	}
+	if jtx.Version != transactionJSONVersion {
+		return nil, fmt.Errorf("unsupported transaction version %d", jtx.Version)
+	}
+
+	tx := &Transaction{nftContext: &nftContext{family: jtx.Family, table: jtx.Table}, description: jtx.Description}
+	for i, jop := range jtx.Operations {
+		if jop.Comment != nil {
+			tx.Comment(*jop.Comment)
+			continue
+		}
+
+		switch jop.Verb {
+		case addVerb, createVerb, insertVerb, replaceVerb, deleteVerb, destroyVerb, flushVerb:
+		default:
+			return nil, fmt.Errorf("operation %d: unknown verb %q", i, jop.Verb)
+		}
+		newObject := jsonObjectTypes[jop.Type]
+		if newObject == nil {
+			return nil, fmt.Errorf("operation %d: unknown object type %q", i, jop.Type)
+		}
+		obj := newObject()
+		if err := json.Unmarshal(jop.Object, obj); err != nil {
+			return nil, fmt.Errorf("operation %d: could not parse %s: %w", i, jop.Type, err)
+		}
+		tx.operation(jop.Verb, obj)
+		if tx.err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, tx.err)
+		}
+	}
+	return tx, nil
+}
+
+// jumpRegexp matches a "jump" or "goto" verdict in a rule, capturing the target chain.
+var jumpRegexp = regexp.MustCompile(`(?:^|\s)(?:jump|goto)\s+([^\s,;}]+)`)
+
+// Validate does client-side validation of tx, without running nft, and returns an error
+// describing every problem that it finds, or nil if it finds none. In addition to the
+// checks that are done when each operation is added to tx (which normally only cause the
+// first invalid operation to be reported), this checks that tx's family and table are
+// valid, and that tx does not operate on chains, sets, or maps that were deleted earlier
+// in the same transaction. Problems that depend on the existing state of the table (such
+// as referring to a chain that does not exist in the kernel) can only be detected by
+// Interface.Check.
+func Validate(tx *Transaction) error {
+	var errs []error
+
+	switch tx.family {
+	case IPv4Family, IPv6Family, InetFamily, ARPFamily, BridgeFamily, NetDevFamily:
+	default:
+		errs = append(errs, fmt.Errorf("invalid family %q", tx.family))
+	}
+	if tx.table == "" {
+		errs = append(errs, fmt.Errorf("no table name specified"))
+	}
+	if tx.err != nil {
+		errs = append(errs, tx.err)
+	}
+	errs = append(errs, tx.laterErrs...)
+
+	// Track which chains, sets, and maps (keyed by "chain NAME", etc) are known to not
+	// exist at each point in the transaction.
+	tableDeleted := false
+	added := make(map[string]bool)
+	deleted := make(map[string]bool)
+	gone := func(key string) bool {
+		return deleted[key] || (tableDeleted && !added[key])
+	}
+	checkRef := func(op operation, key string) {
+		if gone(key) {
+			errs = append(errs, fmt.Errorf("%s %s refers to %s, which was deleted earlier in the transaction", op.verb, objectDescription(op.obj), key))
+		}
+	}
+
+	for _, op := range tx.operations {
+		var key string
+		switch obj := op.obj.(type) {
+		case *Table:
+			if op.verb == deleteVerb || op.verb == destroyVerb {
+				tableDeleted = true
+				added = make(map[string]bool)
+				deleted = make(map[string]bool)
+			}
+			continue
+		case *Chain:
+			key = "chain " + obj.Name
+		case *Set:
+			key = "set " + obj.Name
+		case *Map:
+			key = "map " + obj.Name
+		case *Rule:
+			if op.verb != destroyVerb {
+				checkRef(op, "chain "+obj.Chain)
+			}
+			if op.verb != deleteVerb && op.verb != destroyVerb {
+				for _, match := range jumpRegexp.FindAllStringSubmatch(obj.Rule, -1) {
+					checkRef(op, "chain "+match[1])
+				}
+			}
+			continue
+		case *Element:
+			if op.verb != destroyVerb {
+				if obj.Set != "" {
+					checkRef(op, "set "+obj.Set)
+				} else {
+					checkRef(op, "map "+obj.Map)
+				}
+			}
+			continue
+		default:
+			continue
+		}
+
+		switch op.verb {
+		case addVerb, createVerb:
+			added[key] = true
+			delete(deleted, key)
+		case flushVerb:
+			checkRef(op, key)
+		case deleteVerb:
+			checkRef(op, key)
+			deleted[key] = true
+			delete(added, key)
+		case destroyVerb:
+			deleted[key] = true
+			delete(added, key)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// objectDescription returns a short description of obj for use in error messages.
+func objectDescription(obj Object) string {
+	switch obj := obj.(type) {
+	case *Chain:
+		return "chain " + obj.Name
+	case *Set:
+		return "set " + obj.Name
+	case *Map:
+		return "map " + obj.Name
+	case *Rule:
+		return "rule in chain " + obj.Chain
+	case *Element:
+		if obj.Set != "" {
+			return "element of set " + obj.Set
+		}
+		return "element of map " + obj.Map
+	default:
+		return fmt.Sprintf("%T", obj)
+	}
+}
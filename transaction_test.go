@@ -0,0 +1,669 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/lithammer/dedent"
+)
+
+func TestTransactionString(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	if tx.String() != "" {
+		t.Errorf("expected empty string for empty transaction, got %q", tx.String())
+	}
+
+	tx.Add(&Table{})
+	tx.Add(&Chain{
+		Name: "chain",
+	})
+	tx.Flush(&Chain{
+		Name: "chain",
+	})
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table ip kube-proxy
+		add chain ip kube-proxy chain
+		flush chain ip kube-proxy chain
+		`), "\n")
+	diff := cmp.Diff(expected, tx.String())
+	if diff != "" {
+		t.Errorf("unexpected transaction content:\n%s", diff)
+	}
+
+	// String() should not modify the transaction, so calling it again should give
+	// the same result.
+	diff = cmp.Diff(expected, tx.String())
+	if diff != "" {
+		t.Errorf("unexpected transaction content on second call:\n%s", diff)
+	}
+
+	// An invalid operation is not added, and the error is appended as a comment
+	tx.Delete(&Rule{
+		Chain: "chain",
+	})
+	tx.Add(&Chain{
+		Name: "chain2",
+	})
+	expected += "# ERROR: must specify Handle with delete"
+	diff = cmp.Diff(expected, tx.String())
+	if diff != "" {
+		t.Errorf("unexpected transaction content:\n%s", diff)
+	}
+}
+
+func TestTransactionDeleteTable(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	// Delete and Destroy must use the corresponding nft verbs, since "delete table"
+	// fails if the table doesn't exist but "destroy table" doesn't.
+	tx := fake.NewTransaction()
+	tx.Destroy(&Table{})
+	tx.Delete(&Table{})
+	tx.Destroy(&Table{Handle: PtrTo(3)})
+	tx.Delete(&Table{Handle: PtrTo(3)})
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		destroy table ip kube-proxy
+		delete table ip kube-proxy
+		destroy table ip handle 3
+		delete table ip handle 3
+		`), "\n")
+	if diff := cmp.Diff(expected, tx.String()); diff != "" {
+		t.Errorf("unexpected transaction content:\n%s", diff)
+	}
+
+	// The fake follows the same semantics
+	tx = fake.NewTransaction()
+	tx.Destroy(&Table{})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Errorf("unexpected error destroying nonexistent table: %v", err)
+	}
+	tx = fake.NewTransaction()
+	tx.Delete(&Table{})
+	if err := fake.Run(context.Background(), tx); !IsNotFound(err) {
+		t.Errorf("expected NotFoundError deleting nonexistent table, got %v", err)
+	}
+}
+
+func TestTransactionContext(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "tx")
+	tx := fake.NewTransactionWithContext(ctx)
+	other := context.WithValue(context.Background(), ctxKey{}, "other")
+	runCtx, runCancel := fake.NewTransaction().runContext(other)
+	if runCtx != other {
+		t.Errorf("expected explicit context to be used for transaction with no context")
+	}
+	runCancel()
+
+	// The run context is cancelled if either the explicit context or the
+	// transaction's context is cancelled.
+	txCtx, txCancel := context.WithCancel(context.Background())
+	runCtx, runCancel = fake.NewTransactionWithContext(txCtx).runContext(other)
+	defer runCancel()
+	if runCtx.Value(ctxKey{}) != "other" {
+		t.Errorf("expected run context to be derived from explicit context")
+	}
+	if runCtx.Err() != nil {
+		t.Errorf("expected run context to not be cancelled yet")
+	}
+	txCancel()
+	select {
+	case <-runCtx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("expected run context to be cancelled with transaction's context")
+	}
+
+	otherCtx, otherCancel := context.WithCancel(context.Background())
+	runCtx, runCancel = fake.NewTransactionWithContext(ctx).runContext(otherCtx)
+	defer runCancel()
+	otherCancel()
+	if runCtx.Err() == nil {
+		t.Errorf("expected run context to be cancelled with explicit context")
+	}
+
+	// Combined transactions inherit a context from their parts
+	combined, err := combineTransactions(fake.NewTransaction(), []*Transaction{fake.NewTransaction(), tx})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if combined.ctx != ctx {
+		t.Errorf("expected combined transaction to inherit context")
+	}
+
+	// Operations added after the context is cancelled cause the transaction to fail
+	ctx, cancel := context.WithCancel(context.Background())
+	tx = fake.NewTransactionWithContext(ctx)
+	tx.Add(&Table{})
+	cancel()
+	tx.Add(&Chain{Name: "chain"})
+	if len(tx.operations) != 1 {
+		t.Errorf("expected operation to be dropped after cancellation, got %d operations", len(tx.operations))
+	}
+	err = fake.Run(context.Background(), tx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if fake.Table != nil {
+		t.Errorf("cancelled transaction should not have been applied")
+	}
+}
+
+func TestTransactionComment(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Comment("Create the table")
+	tx.Add(&Table{})
+	tx.Comment("Service chains:\none per service")
+	tx.Add(&Chain{Name: "svc1"})
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		# Create the table
+		add table ip kube-proxy
+		# Service chains:
+		# one per service
+		add chain ip kube-proxy svc1
+		`), "\n")
+	if diff := cmp.Diff(expected, tx.String()); diff != "" {
+		t.Errorf("unexpected transaction output:\n%s", diff)
+	}
+
+	// Comments don't affect the result of running the transaction
+	err := fake.Run(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.Table == nil || fake.Table.Chains["svc1"] == nil {
+		t.Errorf("transaction was not applied correctly:\n%s", fake.Dump())
+	}
+
+	// ...and are ignored by Diff
+	desired := fake.NewTransaction()
+	desired.Comment("desired state")
+	desired.Add(&Table{})
+	desired.Add(&Chain{Name: "svc1"})
+	diffTx, err := Diff(context.Background(), fake, desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diffTx.String() != "add table ip kube-proxy\n" {
+		t.Errorf("unexpected diff transaction:\n%s", diffTx.String())
+	}
+}
+
+func TestTransactionDescription(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.SetDescription("first description")
+	tx.Add(&Table{})
+	tx.Comment("chains")
+	tx.Add(&Chain{Name: "svc1"})
+	tx.SetDescription("sync 1234\nfor service changes")
+	if tx.Description() != "sync 1234\nfor service changes" {
+		t.Errorf("unexpected description %q", tx.Description())
+	}
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		# sync 1234
+		# for service changes
+		add table ip kube-proxy
+		# chains
+		add chain ip kube-proxy svc1
+		`), "\n")
+	if diff := cmp.Diff(expected, tx.String()); diff != "" {
+		t.Errorf("unexpected transaction output:\n%s", diff)
+	}
+
+	// The description survives serialization
+	data, err := tx.MarshalJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx2, err := UnmarshalTransaction(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(expected, tx2.String()); diff != "" {
+		t.Errorf("unexpected unmarshalled transaction output:\n%s", diff)
+	}
+
+	// RunAll outputs each transaction's description before its operations
+	tx3 := fake.NewTransaction()
+	tx3.SetDescription("more chains")
+	tx3.Add(&Chain{Name: "svc2"})
+	if err := fake.RunAll(context.Background(), tx, tx3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = strings.TrimPrefix(dedent.Dedent(`
+		# sync 1234
+		# for service changes
+		add table ip kube-proxy
+		# chains
+		add chain ip kube-proxy svc1
+		# more chains
+		add chain ip kube-proxy svc2
+		`), "\n")
+	if diff := cmp.Diff(expected, fake.Transactions[0].String()); diff != "" {
+		t.Errorf("unexpected combined transaction output:\n%s", diff)
+	}
+
+	// Diff passes the description through
+	desired := fake.NewTransaction()
+	desired.SetDescription("desired state")
+	desired.Add(&Table{})
+	desired.Add(&Chain{Name: "svc1"})
+	diffTx, err := Diff(context.Background(), fake, desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diffTx.Description() != "desired state" {
+		t.Errorf("expected description to be passed through by Diff, got %q", diffTx.Description())
+	}
+}
+
+func TestTransactionLen(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	if tx.Len() != 0 || !tx.IsEmpty() {
+		t.Errorf("expected new transaction to be empty, got Len() %d", tx.Len())
+	}
+
+	tx.SetDescription("description")
+	tx.Comment("comment")
+	if tx.Len() != 0 || !tx.IsEmpty() {
+		t.Errorf("expected transaction with only comments to be empty, got Len() %d", tx.Len())
+	}
+
+	tx.Add(&Table{})
+	tx.Add(&Set{Name: "ips", Type: "ipv4_addr"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.2"}})
+	if tx.Len() != 4 || tx.IsEmpty() {
+		t.Errorf("expected Len() 4, got %d", tx.Len())
+	}
+
+	// Invalid operations are not counted
+	tx.Delete(&Rule{Chain: "chain"})
+	tx.Add(&Chain{Name: "chain"})
+	if tx.Len() != 4 {
+		t.Errorf("expected Len() 4 after invalid operation, got %d", tx.Len())
+	}
+}
+
+func TestTransactionReset(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tx := fake.NewTransactionWithContext(ctx)
+	tx.SetDescription("first")
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Delete(&Rule{Chain: "chain"})
+	if tx.err == nil {
+		t.Fatalf("expected transaction to have pending error")
+	}
+	capacity := cap(tx.operations)
+
+	tx.Reset()
+	if !tx.IsEmpty() || tx.String() != "" || tx.Description() != "" {
+		t.Errorf("expected empty transaction after Reset, got %q", tx.String())
+	}
+	if tx.err != nil || Validate(tx) != nil {
+		t.Errorf("expected no errors after Reset, got %v", Validate(tx))
+	}
+	if cap(tx.operations) != capacity {
+		t.Errorf("expected capacity %d to be retained, got %d", capacity, cap(tx.operations))
+	}
+	if tx.ctx != ctx {
+		t.Errorf("expected context to be retained")
+	}
+
+	// The transaction can be reused
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "other"})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "add table ip kube-proxy\nadd chain ip kube-proxy other\n"
+	if tx.String() != expected {
+		t.Errorf("unexpected transaction content:\n%s", tx.String())
+	}
+	if fake.Table == nil || fake.Table.Chains["other"] == nil || fake.Table.Chains["chain"] != nil {
+		t.Errorf("unexpected table content:\n%s", fake.Dump())
+	}
+
+	// Resetting it again does not affect the copy recorded by the Fake
+	tx.Reset()
+	if len(fake.Transactions) != 1 || fake.Transactions[0].String() != expected {
+		t.Errorf("expected recorded transaction to be unaffected by Reset, got %v", fake.Transactions)
+	}
+}
+
+func TestTransactionElementBatching(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Element{Set: "set1", Key: []string{"10.0.0.1"}})
+	tx.Add(&Element{Set: "set1", Key: []string{"10.0.0.2"}, Comment: PtrTo("two")})
+	tx.Add(&Element{Set: "set1", Key: []string{"10.0.0.3"}, Timeout: time.Minute})
+	tx.Add(&Element{Set: "set2", Key: []string{"10.0.0.1", "tcp", "80"}})
+	tx.Add(&Element{Set: "set2", Key: []string{"10.0.0.2", "tcp", "80"}})
+	tx.Add(&Element{Map: "set2", Key: []string{"10.0.0.3", "tcp", "80"}, Value: []string{"drop"}})
+	tx.Add(&Element{Map: "map1", Key: []string{"10.0.0.1"}, Value: []string{"goto chain1"}})
+	tx.Add(&Element{Map: "map1", Key: []string{"10.0.0.2"}, Value: []string{"goto chain2"}})
+	tx.Add(&Element{Map: "map1", Key: []string{"10.0.0.1"}, Value: []string{"goto chain3"}})
+	tx.Create(&Element{Set: "set1", Key: []string{"10.0.0.4"}})
+	tx.Create(&Element{Set: "set1", Key: []string{"10.0.0.5"}})
+	tx.Delete(&Element{Set: "set1", Key: []string{"10.0.0.1"}})
+	tx.Delete(&Element{Set: "set1", Key: []string{"10.0.0.2"}})
+	tx.Add(&Element{Set: "set1", Key: []string{"10.0.0.6"}})
+	tx.Comment("set1 again")
+	tx.Add(&Element{Set: "set1", Key: []string{"10.0.0.7"}})
+
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add element ip kube-proxy set1 { 10.0.0.1, 10.0.0.2 comment "two", 10.0.0.3 timeout 60s }
+		add element ip kube-proxy set2 { 10.0.0.1 . tcp . 80, 10.0.0.2 . tcp . 80 }
+		add element ip kube-proxy set2 { 10.0.0.3 . tcp . 80 : drop }
+		add element ip kube-proxy map1 { 10.0.0.1 : goto chain1, 10.0.0.2 : goto chain2 }
+		add element ip kube-proxy map1 { 10.0.0.1 : goto chain3 }
+		create element ip kube-proxy set1 { 10.0.0.4 }
+		create element ip kube-proxy set1 { 10.0.0.5 }
+		delete element ip kube-proxy set1 { 10.0.0.1 }
+		delete element ip kube-proxy set1 { 10.0.0.2 }
+		add element ip kube-proxy set1 { 10.0.0.6 }
+		# set1 again
+		add element ip kube-proxy set1 { 10.0.0.7 }
+		`), "\n")
+	if diff := cmp.Diff(expected, tx.String()); diff != "" {
+		t.Errorf("unexpected transaction output:\n%s", diff)
+	}
+}
+
+func TestTransactionInvalidOperation(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "chain"})
+	tx.Insert(&Rule{Chain: "chain", Rule: "drop", Index: PtrTo(0), Handle: PtrTo(1)})
+	tx.Add(&Rule{Chain: "chain", Rule: "accept"})
+
+	// The invalid operation and everything after it is dropped, and the error is
+	// returned when the transaction is run.
+	if !strings.HasSuffix(tx.String(), "# ERROR: cannot specify both Index and Handle") {
+		t.Errorf("expected error in transaction output, got:\n%s", tx.String())
+	}
+	err := fake.Run(context.Background(), tx)
+	if err == nil || err.Error() != "cannot specify both Index and Handle" {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	if fake.Table != nil {
+		t.Errorf("invalid transaction should not have been applied")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		family Family
+		table  string
+		build  func(tx *Transaction)
+		errs   []string
+	}{
+		{
+			name: "valid",
+			build: func(tx *Transaction) {
+				tx.Add(&Table{})
+				tx.Add(&Chain{Name: "chain"})
+				tx.Add(&Chain{Name: "other"})
+				tx.Add(&Set{Name: "set", Type: "ipv4_addr"})
+				tx.Add(&Rule{Chain: "chain", Rule: "ip daddr @set jump other"})
+				tx.Add(&Element{Set: "set", Key: []string{"10.0.0.1"}})
+			},
+		},
+		{
+			name:   "bad family and table",
+			family: Family("bogus"),
+			table:  "",
+			build: func(tx *Transaction) {
+				tx.Add(&Chain{Name: "chain"})
+			},
+			errs: []string{
+				`invalid family "bogus"`,
+				"no table name specified",
+			},
+		},
+		{
+			name: "multiple invalid objects",
+			build: func(tx *Transaction) {
+				tx.Add(&Chain{})
+				tx.Add(&Rule{Chain: "chain"})
+				tx.Add(&Chain{Name: "chain"})
+				tx.Add(&Set{Name: "set"})
+			},
+			errs: []string{
+				"no name specified for chain",
+				"no rule specified",
+				"set must specify either Type or TypeOf",
+			},
+		},
+		{
+			name: "deleted objects",
+			build: func(tx *Transaction) {
+				tx.Delete(&Chain{Name: "chain"})
+				tx.Delete(&Set{Name: "set"})
+				tx.Add(&Rule{Chain: "chain", Rule: "drop"})
+				tx.Add(&Rule{Chain: "other", Rule: "ip daddr 10.0.0.1 goto chain"})
+				tx.Add(&Element{Set: "set", Key: []string{"10.0.0.1"}})
+				tx.Flush(&Chain{Name: "chain"})
+				tx.Delete(&Set{Name: "set"})
+			},
+			errs: []string{
+				"add rule in chain chain refers to chain chain, which was deleted earlier in the transaction",
+				"add rule in chain other refers to chain chain, which was deleted earlier in the transaction",
+				"add element of set set refers to set set, which was deleted earlier in the transaction",
+				"flush chain chain refers to chain chain, which was deleted earlier in the transaction",
+				"delete set set refers to set set, which was deleted earlier in the transaction",
+			},
+		},
+		{
+			name: "re-created objects",
+			build: func(tx *Transaction) {
+				tx.Delete(&Chain{Name: "chain"})
+				tx.Add(&Chain{Name: "chain"})
+				tx.Add(&Rule{Chain: "chain", Rule: "drop"})
+				tx.Destroy(&Set{Name: "set"})
+				tx.Destroy(&Set{Name: "set"})
+			},
+		},
+		{
+			name: "deleted table",
+			build: func(tx *Transaction) {
+				tx.Add(&Table{})
+				tx.Add(&Chain{Name: "chain"})
+				tx.Delete(&Table{})
+				tx.Add(&Table{})
+				tx.Add(&Chain{Name: "other"})
+				tx.Add(&Rule{Chain: "other", Rule: "jump chain"})
+				tx.Add(&Element{Map: "map", Key: []string{"80"}, Value: []string{"drop"}})
+			},
+			errs: []string{
+				"add rule in chain other refers to chain chain, which was deleted earlier in the transaction",
+				"add element of map map refers to map map, which was deleted earlier in the transaction",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			family, table := IPv4Family, "testing"
+			if tc.family != "" {
+				family, table = tc.family, tc.table
+			}
+			tx := &Transaction{nftContext: &nftContext{family: family, table: table}}
+			tc.build(tx)
+
+			err := Validate(tx)
+			if len(tc.errs) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %v, got none", tc.errs)
+			}
+			if diff := cmp.Diff(tc.errs, strings.Split(err.Error(), "\n")); diff != "" {
+				t.Errorf("unexpected errors:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTransactionJSON(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	tx := fake.NewTransaction()
+	tx.Add(&Table{Comment: PtrTo("test table")})
+	tx.Comment("base chains")
+	tx.Add(&Chain{
+		Name:     "filter",
+		Type:     PtrTo(FilterType),
+		Hook:     PtrTo(InputHook),
+		Priority: PtrTo(FilterPriority),
+		Policy:   PtrTo(DropPolicy),
+	})
+	tx.Flush(&Chain{Name: "filter"})
+	tx.Add(&Set{Name: "ips", Type: "ipv4_addr", Flags: []SetFlag{TimeoutFlag}, Timeout: PtrTo(5 * time.Minute)})
+	tx.Add(&Map{Name: "ports", Type: "inet_service : verdict"})
+	tx.Add(&Element{Set: "ips", Key: []string{"10.0.0.1"}, Timeout: time.Minute})
+	tx.Add(&Element{Map: "ports", Key: []string{"80"}, Value: []string{"drop"}})
+	tx.Insert(&Rule{Chain: "filter", Rule: "ip saddr @ips drop", Comment: PtrTo("block")})
+	tx.Replace(&Rule{Chain: "filter", Rule: "accept", Handle: PtrTo(5)})
+	tx.Add(&Counter{Name: "packets"})
+	tx.Add(&Quota{Name: "quota", Bytes: 1000})
+	tx.Add(&Limit{Name: "limit", Rate: 10, Per: "second"})
+	tx.Add(&CTHelper{Name: "ftp", Type: "ftp", Protocol: "tcp"})
+	tx.Add(&CTTimeout{Name: "timeout", Protocol: "tcp", Policy: map[string]uint32{"established": 100}})
+	tx.Add(&CTExpectation{Name: "expect", Protocol: "tcp", DPort: 22, Timeout: time.Second, Size: 2})
+	tx.Add(&Secmark{Name: "secmark", Context: "system_u:object_r:ssh_server_packet_t:s0"})
+	tx.Add(&Flowtable{Name: "ft", Priority: PtrTo(FilterIngressPriority), Devices: []string{"eth0"}})
+	tx.Delete(&Set{Name: "old"})
+	tx.Destroy(&Chain{Name: "older"})
+
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling: %v", err)
+	}
+	tx2, err := UnmarshalTransaction(data)
+	if err != nil {
+		t.Fatalf("unexpected error unmarshaling: %v", err)
+	}
+	if diff := cmp.Diff(tx.String(), tx2.String()); diff != "" {
+		t.Errorf("round-tripped transaction differs:\n%s", diff)
+	}
+	if diff := cmp.Diff(tx.operations, tx2.operations, cmp.AllowUnexported(operation{}, scriptComment{})); diff != "" {
+		t.Errorf("round-tripped operations differ:\n%s", diff)
+	}
+
+	// The format is stable, so data written by older versions must still parse
+	tx3, err := UnmarshalTransaction([]byte(`{
+		"version": 1,
+		"family": "inet",
+		"table": "other",
+		"operations": [
+			{"verb": "add", "type": "table", "object": {}},
+			{"comment": "a chain"},
+			{"verb": "add", "type": "chain", "object": {"Name": "chain"}},
+			{"verb": "add", "type": "rule", "object": {"Chain": "chain", "Rule": "drop"}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error unmarshaling: %v", err)
+	}
+	expected := strings.TrimPrefix(dedent.Dedent(`
+		add table inet other
+		# a chain
+		add chain inet other chain
+		add rule inet other chain drop
+		`), "\n")
+	if diff := cmp.Diff(expected, tx3.String()); diff != "" {
+		t.Errorf("unexpected transaction:\n%s", diff)
+	}
+
+	// An unmarshaled transaction can only be run against its own table
+	if err := fake.Run(context.Background(), tx3); err == nil {
+		t.Errorf("expected error running transaction for another table")
+	}
+	if err := NewFake(InetFamily, "other").Run(context.Background(), tx3); err != nil {
+		t.Errorf("unexpected error running transaction: %v", err)
+	}
+
+	// Errors
+	tx = fake.NewTransaction()
+	tx.Add(&Chain{})
+	if _, err := json.Marshal(tx); err == nil {
+		t.Errorf("expected error marshaling invalid transaction")
+	}
+
+	for _, bad := range []struct {
+		data string
+		err  string
+	}{
+		{
+			data: `[]`,
+			err:  "could not parse transaction",
+		},
+		{
+			data: `{"version": 2, "family": "ip", "table": "t", "operations": []}`,
+			err:  "unsupported transaction version 2",
+		},
+		{
+			data: `{"version": 1, "family": "ip", "table": "t", "operations": [{"verb": "frob", "type": "table", "object": {}}]}`,
+			err:  `operation 0: unknown verb "frob"`,
+		},
+		{
+			data: `{"version": 1, "family": "ip", "table": "t", "operations": [{"verb": "add", "type": "frob", "object": {}}]}`,
+			err:  `operation 0: unknown object type "frob"`,
+		},
+		{
+			data: `{"version": 1, "family": "ip", "table": "t", "operations": [{"verb": "add", "type": "chain", "object": {"Name": 5}}]}`,
+			err:  "operation 0: could not parse chain",
+		},
+		{
+			data: `{"version": 1, "family": "ip", "table": "t", "operations": [{"verb": "add", "type": "table", "object": {}}, {"verb": "add", "type": "rule", "object": {"Chain": "chain"}}]}`,
+			err:  "operation 1: no rule specified",
+		},
+	} {
+		_, err := UnmarshalTransaction([]byte(bad.data))
+		if err == nil || !strings.Contains(err.Error(), bad.err) {
+			t.Errorf("expected error containing %q for %s, got %v", bad.err, bad.data, err)
+		}
+	}
+}
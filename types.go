@@ -17,6 +17,7 @@ limitations under the License.
 package knftables
 
 import (
+	"encoding/json"
 	"io"
 	"time"
 )
@@ -65,11 +66,36 @@ const (
 	NetDevFamily Family = "netdev"
 )
 
+// Feature is an optional nftables feature whose availability depends on the nft and
+// kernel versions. See Interface.SupportsFeature.
+type Feature string
+
+const (
+	// FeatureObjectComments indicates support for comments on tables and chains (and
+	// other objects besides rules).
+	FeatureObjectComments Feature = "object-comments"
+
+	// FeatureSetComments indicates support for comments on sets, maps, and elements.
+	FeatureSetComments Feature = "set-comments"
+
+	// FeatureIntervalSets indicates support for sets and maps with the "interval"
+	// flag.
+	FeatureIntervalSets Feature = "interval-sets"
+)
+
+// NFTVersion is the version of the nft binary.
+type NFTVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
 // Table represents an nftables table.
 type Table struct {
 	// Comment is an optional comment for the table. (Requires kernel >= 5.10 and
 	// nft >= 0.9.7; otherwise this field will be silently ignored. Requires
-	// nft >= 1.0.8 to include comments in List() results.)
+	// nft >= 1.0.8 to include comments in ExportRuleset() and ParseRuleset()
+	// results.)
 	Comment *string
 
 	// Handle is an identifier that can be used to uniquely identify an object when
@@ -163,8 +189,9 @@ const (
 	// bridge family it is equivalent to the value -200.
 	FilterPriority BaseChainPriority = "filter"
 
-	// OutPriority is FIXME. It is equivalent to the value 300 and can only be used in
-	// the bridge family.
+	// OutPriority is the standard priority for filtering locally-generated packets
+	// in the output hook of the bridge family. It is equivalent to the value 100 and
+	// can only be used in the bridge family.
 	OutPriority BaseChainPriority = "out"
 
 	// SecurityPriority is the standard priority for security operations ("where
@@ -179,6 +206,19 @@ const (
 	SNATPriority BaseChainPriority = "srcnat"
 )
 
+// BaseChainPolicy represents the default verdict of a base chain, which is applied to
+// packets that reach the end of the chain without any other verdict.
+type BaseChainPolicy string
+
+const (
+	// AcceptPolicy accepts packets that reach the end of the chain. This is the
+	// default.
+	AcceptPolicy BaseChainPolicy = "accept"
+
+	// DropPolicy drops packets that reach the end of the chain.
+	DropPolicy BaseChainPolicy = "drop"
+)
+
 // Chain represents an nftables chain; either a "base chain" (if Type, Hook, and Priority
 // are specified), or a "regular chain" (if they are not).
 type Chain struct {
@@ -192,7 +232,11 @@ type Chain struct {
 	// chain and unset for a regular chain.
 	Hook *BaseChainHook
 	// Priority is the chain priority; this must be set for a base chain and unset for
-	// a regular chain. You can call ParsePriority() to convert this to a number.
+	// a regular chain. It can be a named priority (eg DNATPriority), a number, or a
+	// named priority plus or minus a number. You can call ParsePriority() to convert
+	// this to a number. (Recognized named priorities are converted to numbers when
+	// the chain is added, since some nft versions only accept certain names in
+	// certain hooks; ListChains returns the numeric form.)
 	Priority *BaseChainPriority
 
 	// Device is the network interface that the chain is attached to; this must be set
@@ -200,6 +244,10 @@ type Chain struct {
 	// all other chains.
 	Device *string
 
+	// Policy is the chain's default verdict; this is optional for a base chain (with
+	// AcceptPolicy being the default) and must be unset for a regular chain.
+	Policy *BaseChainPolicy
+
 	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
 	// nft >= 0.9.7; otherwise this field will be silently ignored. Requires
 	// nft >= 1.0.8 to include comments in List() results.)
@@ -235,13 +283,22 @@ type Rule struct {
 	// of a List, this will indicate the rule's handle that can then be used in a
 	// later operation.
 	Handle *int
+
+	// Exprs is the rule's expression in nft's JSON syntax (see libnftables-json(5)),
+	// as a list of statements (e.g. `{"match": {...}}` or `{"counter": {...}}`). It
+	// is filled in on rules returned by ListRules, ListAllRules, ExportRuleset,
+	// Monitor, and RunWithEcho (though not by the Fake), and is ignored in
+	// transactions. Use UnmarshalExprs to parse it.
+	Exprs []json.RawMessage
 }
 
 // SetFlag represents a set or map flag
 type SetFlag string
 
 const (
-	// ConstantFlag is a flag indicating that the set/map is constant. FIXME UNDOCUMENTED
+	// ConstantFlag is a flag indicating that the set/map is constant; its elements
+	// can only be added in the same transaction that creates it, and cannot be
+	// changed afterward.
 	ConstantFlag SetFlag = "constant"
 
 	// DynamicFlag is a flag indicating that the set contains stateful objects
@@ -262,10 +319,12 @@ const (
 type SetPolicy string
 
 const (
-	// PolicyPerformance FIXME
+	// PerformancePolicy tells the kernel to choose a set implementation optimized
+	// for lookup speed. This is the default.
 	PerformancePolicy SetPolicy = "performance"
 
-	// PolicyMemory FIXME
+	// MemoryPolicy tells the kernel to choose a set implementation optimized for
+	// memory usage.
 	MemoryPolicy SetPolicy = "memory"
 )
 
@@ -291,18 +350,20 @@ type Set struct {
 	Timeout *time.Duration
 
 	// GCInterval is the interval at which timed-out elements will be removed from the
-	// set. (Optional; FIXME DEFAULT)
+	// set. (Optional; if unset, the kernel chooses a default interval.)
 	GCInterval *time.Duration
 
-	// Size if the maximum numer of elements in the set.
+	// Size is the maximum number of elements in the set.
 	// (Optional; mandatory for sets that will be added to from the packet path)
 	Size *uint64
 
-	// Policy is the FIXME
+	// Policy is a hint about whether the kernel should optimize the set's backing
+	// data structure for performance or memory usage. (Optional)
 	Policy *SetPolicy
 
 	// AutoMerge indicates that adjacent/overlapping set elements should be merged
-	// together (only for interval sets)
+	// together (eg, so that adding "10.0.0.0/25" and "10.0.0.128/25" results in a
+	// single "10.0.0.0/24" element). This requires the set to have IntervalFlag.
 	AutoMerge *bool
 
 	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
@@ -319,11 +380,12 @@ type Map struct {
 	// Name is the name of the map.
 	Name string
 
-	// Type is the type of the map key and value (eg "ipv4_addr : verdict"). Either
-	// Type or TypeOf, but not both, must be non-empty.
+	// Type is the type of the map key and value, separated by " : " (eg "ipv4_addr :
+	// verdict", or "ipv4_addr . inet_service : ipv4_addr . inet_service" for
+	// concatenated types). Either Type or TypeOf, but not both, must be non-empty.
 	Type string
 
-	// TypeOf is the type of the set key as an nftables expression (eg "ip saddr : verdict").
+	// TypeOf is the type of the map key and value as nftables expressions (eg "ip saddr : verdict").
 	// Either Type or TypeOf, but not both, must be non-empty. (Requires at least nft 0.9.4,
 	// and newer than that for some types.)
 	TypeOf string
@@ -336,14 +398,15 @@ type Map struct {
 	Timeout *time.Duration
 
 	// GCInterval is the interval at which timed-out elements will be removed from the
-	// set. (Optional; FIXME DEFAULT)
+	// map. (Optional; if unset, the kernel chooses a default interval.)
 	GCInterval *time.Duration
 
-	// Size if the maximum numer of elements in the set.
+	// Size is the maximum number of elements in the map.
 	// (Optional; mandatory for sets that will be added to from the packet path)
 	Size *uint64
 
-	// Policy is the FIXME
+	// Policy is a hint about whether the kernel should optimize the map's backing
+	// data structure for performance or memory usage. (Optional)
 	Policy *SetPolicy
 
 	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
@@ -370,9 +433,323 @@ type Element struct {
 	Key []string
 
 	// Value is the map element value. As with Key, this may be a single value or
-	// multiple. For set elements, this must be nil.
+	// multiple. For set elements, this must be nil. For elements of a verdict map,
+	// this is a single verdict, such as "drop", "accept", "return", "goto mychain", or
+	// "jump mychain".
 	Value []string
 
 	// Comment is an optional comment for the element
 	Comment *string
+
+	// Timeout is the time that the element will stay in the set or map before being
+	// removed, if it is different from the set or map's default timeout. (Optional;
+	// requires a set or map with the "timeout" flag.)
+	Timeout time.Duration
+
+	// ExpiresAt is the time at which the element will be removed from its set or map.
+	// This is filled in by ListElements for elements with a timeout, and is ignored
+	// when adding elements.
+	ExpiresAt time.Time
+}
+
+// MapEntry is a key and value to add to a map with BulkAddMapElements
+type MapEntry struct {
+	// Key is the entry's key, as with Element.Key
+	Key []string
+
+	// Value is the entry's value, as with Element.Value
+	Value []string
+}
+
+// FlowtableIngressPriority represents the "priority" of a flowtable's "ingress" hook.
+// In addition to the const value, you can also use a signed integer value, or an
+// arithmetic expression consisting of the const value followed by "+" or "-" and an
+// integer.
+type FlowtableIngressPriority string
+
+const (
+	// FilterIngressPriority is the standard priority for a flowtable. It is
+	// equivalent to the value 0.
+	FilterIngressPriority FlowtableIngressPriority = "filter"
+)
+
+// Flowtable represents an nftables flowtable, which can be used to offload established
+// connections from the normal packet-processing path (with the "flow add" or "flow
+// offload" statement). Flowtables are always attached to the "ingress" hook.
+// See https://wiki.nftables.org/wiki-nftables/index.php/Flowtables
+type Flowtable struct {
+	// Name is the name of the flowtable.
+	Name string
+
+	// Priority is the flowtable's priority within the ingress hook; this must be set
+	// when adding a new flowtable.
+	Priority *FlowtableIngressPriority
+
+	// Devices are the network interfaces whose traffic can be offloaded via the
+	// flowtable. All of the devices must exist when the flowtable is added.
+	Devices []string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// Counter represents a named nftables counter, which can be shared by multiple rules
+// (via "counter name"). See
+// https://wiki.nftables.org/wiki-nftables/index.php/Counters#Named_counters
+type Counter struct {
+	// Name is the name of the counter.
+	Name string
+
+	// Packets is the number of packets counted. When adding a new counter, this
+	// can be used to set the initial value (which otherwise defaults to 0). In the
+	// result of a List or Get, this will contain the current value.
+	Packets *uint64
+
+	// Bytes is the number of bytes counted. When adding a new counter, this can be
+	// used to set the initial value (which otherwise defaults to 0). In the result
+	// of a List or Get, this will contain the current value.
+	Bytes *uint64
+
+	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
+	// nft >= 0.9.7; otherwise this field will be silently ignored.)
+	Comment *string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// Quota represents a named nftables quota, which can be shared by multiple rules (via
+// "quota name"). See https://wiki.nftables.org/wiki-nftables/index.php/Quotas
+type Quota struct {
+	// Name is the name of the quota.
+	Name string
+
+	// Bytes is the size of the quota, in bytes.
+	Bytes uint64
+
+	// Used is the number of bytes of the quota that have been used. When adding a
+	// new quota, this can be used to set the initial value (which otherwise defaults
+	// to 0). In the result of a List, this will contain the current value.
+	Used *uint64
+
+	// Over indicates that the quota should match only after Bytes bytes have been
+	// used, rather than only until they have been used.
+	Over bool
+
+	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
+	// nft >= 0.9.7; otherwise this field will be silently ignored.)
+	Comment *string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// Limit represents a named nftables limit, which can be shared by multiple rules (via
+// "limit name"). See
+// https://wiki.nftables.org/wiki-nftables/index.php/Stateful_objects#Limits
+type Limit struct {
+	// Name is the name of the limit.
+	Name string
+
+	// Rate is the rate limit, in units of RateUnit per Per.
+	Rate uint64
+
+	// RateUnit is the unit of Rate: "packets" (the default, if RateUnit is empty),
+	// "bytes", "kbytes", or "mbytes".
+	RateUnit string
+
+	// Per is the time unit of Rate: "second", "minute", "hour", "day", or "week".
+	Per string
+
+	// Burst is the optional burst size, in units of BurstUnit.
+	Burst *uint64
+
+	// BurstUnit is the unit of Burst. For packet limits this must be empty or
+	// "packets". For byte limits it can be "bytes" (the default, if BurstUnit is
+	// empty), "kbytes", or "mbytes".
+	BurstUnit string
+
+	// Inverse indicates that the limit should match only when the rate is exceeded
+	// ("rate over"), rather than only when it is not exceeded.
+	Inverse bool
+
+	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
+	// nft >= 0.9.7; otherwise this field will be silently ignored.)
+	Comment *string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// CTHelper represents a named nftables conntrack helper object, which can be assigned
+// to connections by rules (via "ct helper set"). See
+// https://wiki.nftables.org/wiki-nftables/index.php/Conntrack_helpers
+type CTHelper struct {
+	// Name is the name of the ct helper object.
+	Name string
+
+	// Type is the name of the kernel conntrack helper to use (eg "ftp" or "sip").
+	Type string
+
+	// Protocol is the layer 4 protocol of the helper ("tcp" or "udp").
+	Protocol string
+
+	// L3Proto is the layer 3 protocol of the helper ("ip", "ip6", or "inet"). If
+	// unset, nft will use the family of the table (which must not be "inet" in that
+	// case).
+	L3Proto *Family
+
+	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
+	// nft >= 0.9.7; otherwise this field will be silently ignored.)
+	Comment *string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// CTTimeout represents a named nftables conntrack timeout policy object, which can be
+// assigned to connections by rules (via "ct timeout set"). See
+// https://wiki.nftables.org/wiki-nftables/index.php/Ct_timeout
+type CTTimeout struct {
+	// Name is the name of the ct timeout object.
+	Name string
+
+	// Protocol is the layer 4 protocol that the policy applies to (eg "tcp" or
+	// "udp").
+	Protocol string
+
+	// L3Proto is the layer 3 protocol of the policy ("ip" or "ip6"). If unset, nft
+	// will use the family of the table (which must not be "inet" in that case).
+	L3Proto *Family
+
+	// Policy maps connection states (eg "established", "close") to timeout values,
+	// in seconds.
+	Policy map[string]uint32
+
+	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
+	// nft >= 0.9.7; otherwise this field will be silently ignored.)
+	Comment *string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// CTExpectation represents a named nftables conntrack expectation object, which can be
+// assigned to connections by rules (via "ct expectation set"). See
+// https://wiki.nftables.org/wiki-nftables/index.php/Ct_expectation
+type CTExpectation struct {
+	// Name is the name of the ct expectation object.
+	Name string
+
+	// L3Proto is the layer 3 protocol of the expectation ("ip" or "ip6"). If unset,
+	// nft will use the family of the table (which must not be "inet" in that case).
+	L3Proto *Family
+
+	// Protocol is the layer 4 protocol of the expected connection ("tcp", "udp",
+	// etc).
+	Protocol string
+
+	// DPort is the destination port of the expected connection.
+	DPort uint16
+
+	// Timeout is how long the expectation will remain valid. (It will be rounded
+	// down to milliseconds.)
+	Timeout time.Duration
+
+	// Size is the maximum number of expectations that can be created for a single
+	// connection.
+	Size uint8
+
+	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
+	// nft >= 0.9.7; otherwise this field will be silently ignored.)
+	Comment *string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// Secmark represents a named nftables secmark object, which associates an SELinux
+// security context with packets (via "meta secmark set").
+type Secmark struct {
+	// Name is the name of the secmark object.
+	Name string
+
+	// Context is the SELinux security context (eg
+	// "system_u:object_r:ssh_server_packet_t:s0").
+	Context string
+
+	// Comment is an optional comment for the object.  (Requires kernel >= 5.10 and
+	// nft >= 0.9.7; otherwise this field will be silently ignored.)
+	Comment *string
+
+	// Handle is an identifier that can be used to uniquely identify an object when
+	// deleting it. When adding a new object, this must be nil.
+	Handle *int
+}
+
+// Ruleset represents a snapshot of the contents of one or more nftables tables. (See
+// ParseRuleset.)
+type Ruleset struct {
+	// Tables contains the tables in the ruleset.
+	Tables []*RulesetTable
+}
+
+// RulesetTable represents the contents of a single table in a Ruleset.
+type RulesetTable struct {
+	// Family is the table's family.
+	Family Family
+
+	// Name is the table's name.
+	Name string
+
+	// Table contains the table's Comment and Handle.
+	Table Table
+
+	// Chains contains the table's chains.
+	Chains []*Chain
+
+	// Rules contains the table's rules, in order. The Rule field of each rule is
+	// filled in by Interface.ExportRuleset, but not by ParseRuleset (or, as with
+	// Interface.ListRules, by the other methods that return a Ruleset).
+	Rules []*Rule
+
+	// Sets contains the table's sets.
+	Sets []*Set
+
+	// Maps contains the table's maps.
+	Maps []*Map
+
+	// Elements contains the elements of the table's sets and maps.
+	Elements []*Element
+
+	// Flowtables contains the table's flowtables.
+	Flowtables []*Flowtable
+
+	// Counters contains the table's named counters.
+	Counters []*Counter
+
+	// Quotas contains the table's named quotas.
+	Quotas []*Quota
+
+	// Limits contains the table's named limits.
+	Limits []*Limit
+
+	// CTHelpers contains the table's ct helper objects.
+	CTHelpers []*CTHelper
+
+	// CTTimeouts contains the table's ct timeout objects.
+	CTTimeouts []*CTTimeout
+
+	// CTExpectations contains the table's ct expectation objects.
+	CTExpectations []*CTExpectation
+
+	// Secmarks contains the table's secmark objects.
+	Secmarks []*Secmark
 }
@@ -18,6 +18,7 @@ package knftables
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -115,3 +116,80 @@ func Concat(args ...interface{}) string {
 	}
 	return b.String()
 }
+
+// setLiteralTokenRegexp matches values that can be used as-is in a set literal
+var setLiteralTokenRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.:/*-]+$`)
+
+// setLiteralQuoter escapes a value for use inside an nft quoted string. (Unlike Go, nft
+// only understands backslash-escaping of quotes and backslashes.)
+var setLiteralQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// SetLiteral is a helper for constructing Rule objects that use anonymous sets. It
+// returns an nft set literal containing elements (eg, `SetLiteral("10.0.0.0/8",
+// "192.168.0.0/16")` returns "{ 10.0.0.0/8, 192.168.0.0/16 }"), which can be passed to
+// Concat. Elements can be concatenations (eg "10.0.0.1 . tcp . 80"); any value that is
+// not a simple address, number, or name will be quoted. (nft infers the type of the set
+// from the expression it is matched against, so there is no need to specify it.) There
+// must be at least one element, since nft does not allow empty anonymous sets; SetLiteral
+// panics if it is called with no elements.
+func SetLiteral(elements ...string) string {
+	if len(elements) == 0 {
+		panic("SetLiteral requires at least one element")
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("{ ")
+	for i, element := range elements {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		for j, val := range strings.Split(element, " . ") {
+			if j > 0 {
+				b.WriteString(" . ")
+			}
+			if setLiteralTokenRegexp.MatchString(val) {
+				b.WriteString(val)
+			} else {
+				b.WriteByte('"')
+				b.WriteString(setLiteralQuoter.Replace(val))
+				b.WriteByte('"')
+			}
+		}
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
+// nftVersionRegexp matches the output of "nft --version"
+var nftVersionRegexp = regexp.MustCompile(`^nftables v(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseNFTVersion parses the output of "nft --version"
+func parseNFTVersion(out string) (NFTVersion, error) {
+	match := nftVersionRegexp.FindStringSubmatch(strings.TrimSpace(out))
+	if match == nil {
+		return NFTVersion{}, fmt.Errorf("could not parse nft version %q", strings.TrimSpace(out))
+	}
+	var version NFTVersion
+	version.Major, _ = strconv.Atoi(match[1])
+	version.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		version.Patch, _ = strconv.Atoi(match[3])
+	}
+	return version, nil
+}
+
+// String returns the version in the form "1.0.7"
+func (v NFTVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast returns true if v is the same as or newer than major.minor.patch.
+func (v NFTVersion) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
@@ -92,3 +92,130 @@ func TestConcat(t *testing.T) {
 		})
 	}
 }
+
+func TestSetLiteral(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		elements []string
+		out      string
+	}{
+		{
+			name:     "single element",
+			elements: []string{"10.0.0.1"},
+			out:      "{ 10.0.0.1 }",
+		},
+		{
+			name:     "CIDRs",
+			elements: []string{"10.0.0.0/8", "192.168.0.0/16"},
+			out:      "{ 10.0.0.0/8, 192.168.0.0/16 }",
+		},
+		{
+			name:     "IPv6 and ranges",
+			elements: []string{"fd00::/64", "2001:db8::1-2001:db8::9", "1000-1999"},
+			out:      "{ fd00::/64, 2001:db8::1-2001:db8::9, 1000-1999 }",
+		},
+		{
+			name:     "concatenations",
+			elements: []string{"10.0.0.1 . tcp . 80", "10.0.0.2 . udp . 53"},
+			out:      "{ 10.0.0.1 . tcp . 80, 10.0.0.2 . udp . 53 }",
+		},
+		{
+			name:     "interface names",
+			elements: []string{"eth0", "veth*", "my iface"},
+			out:      `{ eth0, veth*, "my iface" }`,
+		},
+		{
+			name:     "escaping",
+			elements: []string{`a"b`, "c, d }", `e\f`},
+			out:      `{ "a\"b", "c, d }", "e\\f" }`,
+		},
+		{
+			name:     "non-ASCII",
+			elements: []string{"caf\u00e9", "tab\there"},
+			out:      "{ \"caf\u00e9\", \"tab\there\" }",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := SetLiteral(tc.elements...)
+			if out != tc.out {
+				t.Errorf("expected %q got %q", tc.out, out)
+			}
+		})
+	}
+
+	rule := Concat("ip daddr", SetLiteral("10.0.0.0/8", "192.168.0.0/16"), "drop")
+	if rule != "ip daddr { 10.0.0.0/8, 192.168.0.0/16 } drop" {
+		t.Errorf("unexpected rule %q", rule)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected SetLiteral with no elements to panic")
+		}
+	}()
+	_ = SetLiteral()
+}
+
+func TestParseNFTVersion(t *testing.T) {
+	for _, tc := range []struct {
+		out     string
+		version NFTVersion
+		err     bool
+	}{
+		{
+			out:     "nftables v1.0.7 (Old Doc Yak)\n",
+			version: NFTVersion{Major: 1, Minor: 0, Patch: 7},
+		},
+		{
+			out:     "nftables v0.9.3 (Topsy)\n",
+			version: NFTVersion{Major: 0, Minor: 9, Patch: 3},
+		},
+		{
+			out:     "nftables v1.1 (Commodore Bullmoose)\n",
+			version: NFTVersion{Major: 1, Minor: 1},
+		},
+		{
+			out:     "nftables v1.1.1 (Commodore Bullmoose #2)\n  cli:\treadline\n",
+			version: NFTVersion{Major: 1, Minor: 1, Patch: 1},
+		},
+		{
+			out: "iptables v1.8.7 (nf_tables)\n",
+			err: true,
+		},
+	} {
+		t.Run(tc.out, func(t *testing.T) {
+			version, err := parseNFTVersion(tc.out)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got %v", version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != tc.version {
+				t.Errorf("expected %v, got %v", tc.version, version)
+			}
+		})
+	}
+}
+
+func TestNFTVersionAtLeast(t *testing.T) {
+	v := NFTVersion{Major: 1, Minor: 0, Patch: 7}
+	for _, tc := range []struct {
+		major, minor, patch int
+		out                 bool
+	}{
+		{0, 9, 9, true},
+		{1, 0, 1, true},
+		{1, 0, 7, true},
+		{1, 0, 8, false},
+		{1, 1, 0, false},
+		{2, 0, 0, false},
+	} {
+		if out := v.AtLeast(tc.major, tc.minor, tc.patch); out != tc.out {
+			t.Errorf("expected %s.AtLeast(%d, %d, %d) to be %v", v, tc.major, tc.minor, tc.patch, tc.out)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// waitForChain polls nft's chains every interval until chainName exists or ctx is done.
+func waitForChain(ctx context.Context, nft Interface, chainName string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid polling interval %v", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		chains, err := nft.ListChains(ctx)
+		if err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed waiting for chain %q: %w", chainName, err)
+		}
+		for _, chain := range chains {
+			if chain.Name == chainName {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for chain %q: %w", chainName, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package knftables
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitForChain(t *testing.T) {
+	nft, fexec, _ := newTestInterface(t, IPv4Family, "kube-proxy")
+
+	noChains := `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}]}`
+	fexec.expected = append(fexec.expected,
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "chains", "ip"},
+			stdout: noChains,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "chains", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "other", "name": "services", "handle": 1}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "chains", "ip"},
+			stdout: `{"nftables": [{"metainfo": {"version": "1.0.1", "release_name": "Fearless Fosdick #3", "json_schema_version": 1}}, {"chain": {"family": "ip", "table": "kube-proxy", "name": "services", "handle": 2}}]}`,
+		},
+		expectedCmd{
+			args:   []string{"/nft", "--json", "list", "chains", "ip"},
+			stdout: noChains,
+		},
+	)
+
+	err := nft.WaitForChain(context.Background(), "services", time.Millisecond)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = nft.WaitForChain(ctx, "services", time.Millisecond)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	err = nft.WaitForChain(context.Background(), "services", 0)
+	if err == nil {
+		t.Errorf("expected error for invalid interval")
+	}
+}
+
+func TestFakeWaitForChain(t *testing.T) {
+	fake := NewFake(IPv4Family, "kube-proxy")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- fake.WaitForChain(ctx, "services", time.Millisecond)
+	}()
+
+	// WaitForChain keeps waiting while the table doesn't exist yet.
+	time.Sleep(10 * time.Millisecond)
+	tx := fake.NewTransaction()
+	tx.Add(&Table{})
+	tx.Add(&Chain{Name: "other"})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	tx = fake.NewTransaction()
+	tx.Add(&Chain{Name: "services"})
+	if err := fake.Run(context.Background(), tx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := fake.WaitForChain(ctx, "missing", time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}